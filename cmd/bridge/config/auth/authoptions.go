@@ -1,13 +1,25 @@
 package auth
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/http/httpguts"
+	"gopkg.in/yaml.v2"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
@@ -17,19 +29,112 @@ import (
 	"github.com/openshift/console/pkg/proxy"
 	"github.com/openshift/console/pkg/server"
 	"github.com/openshift/console/pkg/serverconfig"
+	"github.com/openshift/console/pkg/version"
+)
+
+const (
+	minInactivityTimeoutSeconds = 300
+
+	minOAuthStateTTL              = time.Minute
+	maxOAuthStateTTL              = 30 * time.Minute
+	oauthStateTTLWarningThreshold = 10 * time.Minute
+
+	maxClockSkew = 5 * time.Minute
+
+	maxSessionCookieChunks = 8
+
+	redisPingTimeout = 10 * time.Second
 )
 
 type AuthOptions struct {
 	AuthType string
 
 	IssuerURL            string
+	IssuerOverride       string
+	AllowedIssuers       string
+	SupportedSigningAlgs string
 	ClientID             string
 	ClientSecret         string
 	ClientSecretFilePath string
+	ClientCertFile       string
+	ClientKeyFile        string
 	CAFilePath           string
+	ExtraAudiences       string
+	Scopes               string
+	IdentityClaim        string
+	ClockSkew            time.Duration
+	MaxAge               time.Duration
+	ResponseMode         string
+	NoncePolicy          string
+	LoginHint            string
+	LoginHintDomains     string
+
+	ClientCertWithSecret bool
+
+	OutboundUserAgent string
+
+	AuditLogFile string
+
+	AllowIdPInitiatedLogin bool
+	SilentRenew            bool
+	DisableGroups          bool
+	MaxGroups              int
+	GroupsOverflowPolicy   string
+	RequireVerifiedEmail   bool
+
+	EmbeddedHeader  string
+	EmbeddedOrigins string
+	CookieDomain    string
+	CookiePath      string
+	SecureCookies   string
+
+	RequiredGroups     string
+	RequiredGroupsMode string
+	SessionAdminGroup  string
+	ProviderAdminGroup string
+
+	LoginPath    string
+	CallbackPath string
+	SuccessPath  string
+	ErrorPath    string
+
+	PostLoginRedirectPath string
 
 	InactivityTimeoutSeconds int
 	LogoutRedirect           string
+	RejectLogoutLoops        bool
+	OAuthStateTTL            time.Duration
+
+	ErrorRedirect             string
+	ErrorRedirectAllowedHosts string
+
+	CallbackMaxBodyBytes int
+	CallbackReadTimeout  time.Duration
+	AllowedRedirectURIs  string
+
+	SessionCookieMaxChunks int
+
+	IssuerCertExpiryWarning time.Duration
+	CredentialCheckInterval time.Duration
+	DiscoveryCacheFile      string
+	DiscoveryCacheTTL       time.Duration
+	UnhealthyThreshold      time.Duration
+
+	SessionStore                  string
+	SessionStoreRedisURL          string
+	SessionStoreRedisPasswordFile string
+	SessionStoreFailurePolicy     string
+	SessionFollowTokenExpiry      bool
+	StoreRefreshToken             bool
+	RefreshTokenKeyFile           string
+	TokenRefreshLeadTime          time.Duration
+	OnMissingRefreshToken         string
+	MaxSessionLifetime            time.Duration
+	SingleSessionPerUser          bool
+	TrackActiveSessions           bool
+
+	LogConfigPrecedence bool
+	PrintConfig         bool
 }
 
 type CompletedOptions struct {
@@ -39,13 +144,83 @@ type CompletedOptions struct {
 type completedOptions struct {
 	AuthType string
 
-	IssuerURL    *url.URL
-	ClientID     string
-	ClientSecret string
-	CAFilePath   string
+	IssuerURL        *url.URL
+	IssuerOverride   string
+	AllowedIssuers   []string
+	ClientID         string
+	ClientSecret     string
+	ClientCertFile   string
+	ClientKeyFile    string
+	CAFilePath       string
+	ExtraAudiences   []string
+	Scopes           []string
+	IdentityClaim    string
+	ClockSkew        time.Duration
+	MaxAge           time.Duration
+	ResponseMode     string
+	NoncePolicy      string
+	LoginHint        string
+	LoginHintDomains []string
+
+	AllowIdPInitiatedLogin bool
+	SilentRenew            bool
+	DisableGroups          bool
+	MaxGroups              int
+	GroupsOverflowPolicy   string
+	RequireVerifiedEmail   bool
+
+	OutboundUserAgent string
+
+	AuditLogFile string
+
+	SupportedSigningAlgs []string
+
+	EmbeddedHeader  string
+	EmbeddedOrigins []string
+	CookieDomain    string
+	CookiePath      string
+	SecureCookies   string
+
+	RequiredGroups     []string
+	RequireAllGroups   bool
+	SessionAdminGroup  string
+	ProviderAdminGroup string
+
+	AuthPaths server.AuthPaths
+
+	PostLoginRedirectPath string
 
 	InactivityTimeoutSeconds int
 	LogoutRedirectURL        *url.URL
+	RejectLogoutLoops        bool
+	OAuthStateTTL            time.Duration
+
+	ErrorRedirectURL          *url.URL
+	ErrorRedirectAllowedHosts []string
+
+	CallbackMaxBodyBytes int
+	CallbackReadTimeout  time.Duration
+	AllowedRedirectURIs  []string
+
+	SessionCookieMaxChunks int
+
+	IssuerCertExpiryWarning time.Duration
+	CredentialCheckInterval time.Duration
+	DiscoveryCacheFile      string
+	DiscoveryCacheTTL       time.Duration
+	UnhealthyThreshold      time.Duration
+
+	SessionStore              string
+	SessionStoreRedisURL      *url.URL
+	SessionStoreFailurePolicy string
+	FollowTokenExpiry         bool
+	StoreRefreshToken         bool
+	RefreshTokenKey           []byte
+	TokenRefreshLeadTime      time.Duration
+	OnMissingRefreshToken     string
+	MaxSessionLifetime        time.Duration
+	SingleSessionPerUser      bool
+	TrackActiveSessions       bool
 }
 
 func NewAuthOptions() *AuthOptions {
@@ -55,47 +230,270 @@ func NewAuthOptions() *AuthOptions {
 func (c *AuthOptions) AddFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.AuthType, "user-auth", "", "User authentication provider type. Possible values: disabled, oidc, openshift. Defaults to 'openshift'")
 	fs.StringVar(&c.IssuerURL, "user-auth-oidc-issuer-url", "", "The OIDC/OAuth2 issuer URL.")
+	fs.StringVar(&c.IssuerOverride, "user-auth-oidc-issuer-override", "", "The issuer expected in the OIDC discovery document and ID tokens, if it differs from --user-auth-oidc-issuer-url, e.g. when the console reaches the provider on an internal URL. Discovery still uses --user-auth-oidc-issuer-url. Use with care, ID tokens of the override issuer are trusted.")
+	fs.StringVar(&c.AllowedIssuers, "user-auth-oidc-allowed-issuers", "", "List of issuers separated by comma whose ID tokens are accepted. Must contain --user-auth-oidc-issuer-url. Defaults to --user-auth-oidc-issuer-url.")
+	fs.StringVar(&c.SupportedSigningAlgs, "user-auth-oidc-supported-signing-algs", "", "List of signature algorithms separated by comma, like ES256,PS256, that ID tokens must be signed with. Unsigned ID tokens are never accepted. Defaults to the algorithms advertised by the provider.")
 	fs.StringVar(&c.ClientID, "user-auth-oidc-client-id", "", "The OIDC OAuth2 Client ID.")
 	fs.StringVar(&c.ClientSecret, "user-auth-oidc-client-secret", "", "The OIDC OAuth2 Client Secret.")
 	fs.StringVar(&c.ClientSecretFilePath, "user-auth-oidc-client-secret-file", "", "File containing the OIDC OAuth2 Client Secret.")
+	fs.StringVar(&c.ClientCertFile, "user-auth-oidc-client-cert-file", "", "Path to a PEM file with a client certificate presented to the OIDC provider, for token endpoints authenticating clients with mutual TLS. Requires --user-auth-oidc-client-key-file.")
+	fs.StringVar(&c.ClientKeyFile, "user-auth-oidc-client-key-file", "", "Path to a PEM file with the private key of --user-auth-oidc-client-cert-file.")
+	fs.BoolVar(&c.ClientCertWithSecret, "user-auth-oidc-client-cert-with-secret", false, "Send the client secret in addition to the client certificate, for OIDC providers requiring both.")
+	fs.StringVar(&c.OutboundUserAgent, "outbound-user-agent", version.UserAgent(), "User-Agent header of requests to the OIDC or OAuth2 issuer, e.g. for discovery and token exchange. Also set on requests of the Kubernetes API proxy with --proxy-outbound-user-agent. Go's default is sent if empty.")
 	fs.StringVar(&c.CAFilePath, "user-auth-oidc-ca-file", "", "Path to a PEM file for the OIDC/OAuth2 issuer CA.")
+	fs.DurationVar(&c.IssuerCertExpiryWarning, "user-auth-oidc-cert-expiry-warning", 0, "Log a warning at startup when the certificate presented by the issuer expires within this duration, e.g. 720h. Disabled if 0.")
+	fs.DurationVar(&c.CredentialCheckInterval, "user-auth-oidc-credential-check-interval", 0, "How often to check that the OIDC provider accepts the client ID and secret, using a client_credentials token request. Disabled if 0.")
+	fs.StringVar(&c.AuditLogFile, "auth-audit-log-file", "", "File that a JSON audit record is appended to for every login, failed login and logout. The file is reopened for every record, so it can be rotated by moving it. It must be writable at startup.")
+	fs.DurationVar(&c.UnhealthyThreshold, "authenticator-unhealthy-threshold", 0, "How long OIDC discovery, OAuth metadata discovery or fetching the signing keys of the provider may keep failing before /livez fails, so that a liveness probe restarts the console. Disabled if 0.")
+	fs.StringVar(&c.DiscoveryCacheFile, "user-auth-oidc-discovery-cache-file", "", "File in which the OIDC discovery document is kept between restarts. A cached document younger than --user-auth-oidc-discovery-cache-ttl is used instead of fetching it from the issuer.")
+	fs.DurationVar(&c.DiscoveryCacheTTL, "user-auth-oidc-discovery-cache-ttl", 24*time.Hour, "How long a cached OIDC discovery document is used before it is fetched again.")
+	fs.StringVar(&c.ExtraAudiences, "user-auth-oidc-extra-audiences", "", "List of audiences separated by comma which are accepted in the OIDC ID token in addition to the client ID.")
+	fs.StringVar(&c.Scopes, "user-auth-oidc-scopes", "", "List of OAuth2 scopes separated by comma requested from the OIDC provider. Must contain openid. Defaults to openid, email, profile, groups.")
+	fs.StringVar(&c.NoncePolicy, "user-auth-oidc-nonce-policy", auth.NoncePolicyRequired, "How the nonce sent with OIDC logins is checked in the ID token. Possible values: required, optional (only checked if the ID token has a nonce, for providers that leave it out), disabled (no nonce is sent).")
+	fs.StringVar(&c.ResponseMode, "user-auth-oidc-response-mode", "", "The OAuth2 response mode requested from the OIDC provider. Possible values: query, form_post. Defaults to 'query'")
+	fs.StringVar(&c.LoginHint, "user-auth-oidc-login-hint", "", "The login_hint passed to the OIDC provider, e.g. to select a tenant.")
+	fs.StringVar(&c.LoginHintDomains, "user-auth-oidc-login-hint-domains", "", "List of domains separated by comma. A login_hint query parameter of the login request for a user or domain in one of these domains is passed to the OIDC provider.")
+	fs.StringVar(&c.IdentityClaim, "user-auth-oidc-identity-claim", "sub", "The ID token claim used as the stable user identifier. The username and email are only displayed.")
+	fs.DurationVar(&c.ClockSkew, "user-auth-oidc-clock-skew", 5*time.Second, "Leeway for the exp (expiry), nbf (not before) and iat (issued at) claims of an OIDC ID token, to allow for clock skew between the console and the provider. At most 5m.")
+	fs.DurationVar(&c.MaxAge, "user-auth-oidc-max-age", 0, "Sent as max_age to the OIDC provider, which makes it ask users who authenticated longer ago to log in again. Logins whose ID token has an older or no auth_time claim are rejected. Disabled if 0.")
+	fs.BoolVar(&c.AllowIdPInitiatedLogin, "allow-idp-initiated-login", false, "Accept OIDC login callbacks without the state cookie of a login started by the console, e.g. for logins started from an SSO portal. Such logins are only protected against replay: their ID token must be at most 5m old and carry a nonce that this console instance hasn't seen. Only use this if the identity provider requires it.")
+	fs.BoolVar(&c.DisableGroups, "user-auth-oidc-disable-groups", false, "Don't request the groups scope and ignore the groups claim of ID tokens, for providers with large groups claims when the console doesn't use groups. Cannot be used with --user-auth-required-groups or --user-auth-session-admin-group.")
+	fs.IntVar(&c.MaxGroups, "user-auth-oidc-max-groups", 0, "Maximum number of groups kept from the groups claim of an OIDC ID token, see --user-auth-oidc-groups-overflow-policy. --user-auth-required-groups are checked against all groups. Unlimited if 0.")
+	fs.StringVar(&c.GroupsOverflowPolicy, "user-auth-oidc-groups-overflow-policy", auth.GroupsOverflowPolicyTruncate, "What happens to users with more groups than --user-auth-oidc-max-groups. Possible values: truncate (keep the first groups in sorted order and log a warning), reject (reject the login).")
+	fs.BoolVar(&c.RequireVerifiedEmail, "user-auth-oidc-require-verified-email", false, "Reject OIDC logins unless the ID token has the email_verified claim set to true. Tokens with email_verified=false or without the claim are accepted by default.")
+	fs.BoolVar(&c.SilentRenew, "user-auth-oidc-silent-renew", false, "Serve /auth/login/silent, which logs in with prompt=none so that the frontend can renew OIDC sessions in a hidden iframe while the user still has a session at the provider.")
+
+	fs.StringVar(&c.EmbeddedHeader, "user-auth-embedded-header", "", "Name of a request header, set by a proxy in front of the console, that marks requests of an app embedding the console. Cookies for those requests are set with SameSite=None instead of Lax.")
+	fs.StringVar(&c.EmbeddedOrigins, "user-auth-embedded-origins", "", "List of origins separated by comma, e.g. https://portal.example.com, of apps embedding the console. Cookies for requests with one of these origins or referers are set with SameSite=None instead of Lax.")
+	fs.StringVar(&c.CookieDomain, "cookie-domain", "", "Domain attribute of the session and login cookies, e.g. console.example.com to share them with its subdomains. Must be the host of --base-address or a parent domain of it. Defaults to host-only cookies.")
+	fs.StringVar(&c.CookiePath, "cookie-path", "", "Path attribute of the session and login cookies, e.g. / to send them for every path of the host. Must be an absolute path on the path of --base-address, either a parent of it or below it. Note that the cookies are only sent for requests below it, so a path below the base path drops sessions on other console routes. Defaults to the api/ path below the path of --base-address.")
+	fs.StringVar(&c.SecureCookies, "secure-cookies", "", "Whether cookies are set with the Secure attribute, true or false. Startup fails if it conflicts with the scheme of --base-address, which must use https for secure cookies, except on localhost. Defaults to true for an https --base-address. A warning is logged for an http --base-address other than localhost.")
+	fs.IntVar(&c.SessionCookieMaxChunks, "session-cookie-max-chunks", 1, "Number of cookies the session cookie of --user-auth=openshift may be split across when the access token doesn't fit in one 4KB cookie. Logins with larger tokens fail. Must be at most 8. Defaults to 1 if 0, which doesn't split the cookie.")
+
+	fs.StringVar(&c.RequiredGroups, "user-auth-required-groups", "", "List of groups separated by comma, e.g. openshift-console-admins. Only members of these groups can log in, see --user-auth-required-groups-mode.")
+	fs.StringVar(&c.RequiredGroupsMode, "user-auth-required-groups-mode", "any", "Whether users must be a member of any or all of --user-auth-required-groups. Possible values: any, all.")
+	fs.StringVar(&c.SessionAdminGroup, "user-auth-session-admin-group", "", "Group whose members can log out all users with a POST to /api/console/invalidate-sessions. The endpoint is disabled if empty.")
+	fs.StringVar(&c.ProviderAdminGroup, "user-auth-provider-admin-group", "", "Group whose members can make the console fetch the OIDC discovery document and signing keys again with a POST to /api/console/refresh-auth-provider, e.g. after the provider rotated its keys. The endpoint is disabled if empty.")
 
-	fs.IntVar(&c.InactivityTimeoutSeconds, "inactivity-timeout", 0, "Number of seconds, after which user will be logged out if inactive. Ignored if less than 300 seconds (5 minutes).")
+	fs.StringVar(&c.LoginPath, "auth-login-path", server.AuthLoginEndpoint, "Path below --base-path that starts the login.")
+	fs.StringVar(&c.CallbackPath, "auth-callback-path", server.AuthLoginCallbackEndpoint, "Path below --base-path of the OAuth2 callback. The resulting redirect URL must be registered with the identity provider.")
+	fs.StringVar(&c.SuccessPath, "auth-success-path", server.AuthLoginSuccessEndpoint, "Path below --base-path users are sent to after logging in.")
+	fs.StringVar(&c.ErrorPath, "auth-error-path", server.AuthLoginErrorEndpoint, "Path below --base-path of the login error page.")
+	fs.StringVar(&c.PostLoginRedirectPath, "post-login-redirect-path", "", "Absolute path of the console page, e.g. /k8s/cluster/dashboards, users land on after logging in without a deep link. A deep link given with then, rd or return_to on the login path takes precedence. Must be below the path of --base-address. Defaults to --auth-success-path.")
+
+	fs.IntVar(&c.InactivityTimeoutSeconds, "inactivity-timeout", 0, "Number of seconds, after which user will be logged out if inactive. Ignored if less than 300 seconds (5 minutes). Activity is tracked by the browser, requests don't update the session cookie.")
 	fs.StringVar(&c.LogoutRedirect, "user-auth-logout-redirect", "", "Optional redirect URL on logout needed for some single sign-on identity providers.")
+	fs.StringVar(&c.ErrorRedirect, "user-auth-error-redirect", "", "URL users are redirected to when login fails, instead of the console error page, e.g. a help portal. The error, error_description and request_id query parameters are added to the query of the URL. Must be on the host of --base-address or one of --user-auth-error-redirect-allowed-hosts.")
+	fs.StringVar(&c.ErrorRedirectAllowedHosts, "user-auth-error-redirect-allowed-hosts", "", "List of hosts separated by comma that --user-auth-error-redirect may point to, in addition to the host of --base-address.")
+	fs.IntVar(&c.CallbackMaxBodyBytes, "auth-callback-max-body-bytes", 1<<20, "Maximum size in bytes of the body of a login callback with --user-auth-oidc-response-mode=form_post. Larger callbacks are rejected. Defaults to 1MiB if 0.")
+	fs.DurationVar(&c.CallbackReadTimeout, "auth-callback-read-timeout", 10*time.Second, "How long reading the body of a login callback with --user-auth-oidc-response-mode=form_post may take before the callback is rejected. Defaults to 10s if 0.")
+	fs.StringVar(&c.AllowedRedirectURIs, "auth-allowed-redirect-uris", "", "List of URIs separated by comma. Startup fails unless the login callback URI derived from --base-address is one of them, to catch an unexpected base address before it reaches the provider.")
+	fs.BoolVar(&c.RejectLogoutLoops, "user-auth-logout-redirect-reject-loops", false, "Fail startup instead of logging a warning when --user-auth-logout-redirect points to a console page, which requires a login and logs the user right back in.")
+	fs.DurationVar(&c.OAuthStateTTL, "user-auth-oauth-state-ttl", 0, "How long the login state cookie set before redirecting to the identity provider stays valid. Must be between 1m and 30m. Defaults to the browser session.")
+
+	fs.StringVar(&c.SessionStore, "session-store", "memory", "Where OIDC sessions are kept. Possible values: memory, redis. With memory, requests of a session must be routed to the same console replica.")
+	fs.StringVar(&c.SessionStoreRedisURL, "session-store-redis-url", "", "URL of the Redis server for --session-store=redis, e.g. rediss://redis.console.svc:6379/0.")
+	fs.StringVar(&c.SessionStoreRedisPasswordFile, "session-store-redis-password-file", "", "File containing the password of the Redis server for --session-store=redis.")
+	fs.StringVar(&c.SessionStoreFailurePolicy, "session-store-failure-policy", auth.SessionStoreFailClosed, "What to do with requests of OIDC sessions while --session-store=redis fails. Possible values: fail-closed (reject them), fail-open-readonly (accept read-only requests with the ID token of the session, kept in an additional cookie and verified like at login, until it expires). Read-only requests are GET, HEAD and OPTIONS requests without an Upgrade header, and not to exec, attach, portforward or proxy subresources. While failing open, sessions invalidated with the session admin group, ended by a newer login with --single-session-per-user or past --max-session-lifetime are accepted too. The cookie keeps the ID token of the login, it isn't rewritten when the session is refreshed, so refreshed sessions fail closed once that token expires.")
+	fs.BoolVar(&c.SessionFollowTokenExpiry, "session-follow-token-expiry", false, "End OIDC sessions --user-auth-oidc-clock-skew before the ID token expires, instead of when it expires. Sessions with a refresh token, e.g. requested with the offline_access scope, are refreshed instead of ended with --store-refresh-token, also after being idle past the token expiry. They are kept as long as the refresh token lives, per refresh_expires_in or 24h if the provider doesn't return it, but not past --max-session-lifetime.")
+	fs.BoolVar(&c.StoreRefreshToken, "store-refresh-token", false, "Keep the refresh tokens of OIDC sessions, encrypted, to refresh them with --session-follow-token-expiry.")
+	fs.DurationVar(&c.TokenRefreshLeadTime, "token-refresh-lead-time", 0, "How long before the ID token expires an OIDC session with a stored refresh token is refreshed, so that requests in flight don't use a token that just expired. Must be shorter than the lifetime of the ID tokens, logins with tokens that don't outlive it are rejected. Defaults to --user-auth-oidc-clock-skew if 0.")
+	fs.StringVar(&c.OnMissingRefreshToken, "on-missing-refresh-token", auth.OnMissingRefreshTokenWarn, "What to do when the identity provider returns no refresh token with --store-refresh-token, e.g. because it only returns one when the user consents. Possible values: warn (log a warning, the session ends when its ID token expires), force-consent (log in again with prompt=consent to obtain one), error (reject the login).")
+	fs.DurationVar(&c.MaxSessionLifetime, "max-session-lifetime", 0, "End OIDC sessions this long after the login, e.g. 8h, however active the user is and even if they could be refreshed with a refresh token. Users have to log in again afterwards. Disabled if 0.")
+	fs.BoolVar(&c.SingleSessionPerUser, "single-session-per-user", false, "Allow one OIDC session per user: a login ends the earlier sessions of the user. With --session-store=memory, only sessions on the same console replica are ended.")
+	fs.StringVar(&c.RefreshTokenKeyFile, "refresh-token-encryption-key-file", "", "File containing the key, at least 32 bytes, that refresh tokens are encrypted with when they are stored. Required with --session-store=redis, a random key is generated otherwise.")
+	fs.BoolVar(&c.TrackActiveSessions, "user-auth-track-active-sessions", false, "Keep the sessions created by this console instance in memory to report their number in the console_active_sessions metric and on /auth/status.")
+
+	fs.BoolVar(&c.LogConfigPrecedence, "log-config-precedence", false, "Log whether the flag or the config file value took effect for each authentication setting.")
+	fs.BoolVar(&c.PrintConfig, "print-auth-config", false, "Print the resolved authentication configuration as YAML, with secrets redacted, and exit.")
 }
 
-func (c *AuthOptions) ApplyConfig(config *serverconfig.Auth) {
-	setIfUnset(&c.ClientID, config.ClientID)
-	setIfUnset(&c.ClientSecretFilePath, config.ClientSecretFile)
-	setIfUnset(&c.CAFilePath, config.OAuthEndpointCAFile)
-	setIfUnset(&c.LogoutRedirect, config.LogoutRedirect)
+// ApplyConfig applies the auth section of the config file to the settings
+// whose flags weren't set in fs, on the command line or in the environment.
+// Flag defaults don't count as set, the config file takes precedence over them.
+func (c *AuthOptions) ApplyConfig(fs *flag.FlagSet, config *serverconfig.Auth) {
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	c.setIfUnset(setFlags, "user-auth-oidc-client-id", "auth.clientID", &c.ClientID, config.ClientID)
+	c.setIfUnset(setFlags, "user-auth-oidc-client-secret-file", "auth.clientSecretFile", &c.ClientSecretFilePath, config.ClientSecretFile)
+	c.setIfUnset(setFlags, "user-auth-oidc-ca-file", "auth.oauthEndpointCAFile", &c.CAFilePath, config.OAuthEndpointCAFile)
+	c.setIfUnset(setFlags, "user-auth-logout-redirect", "auth.logoutRedirect", &c.LogoutRedirect, config.LogoutRedirect)
+	c.setIfUnset(setFlags, "user-auth-oidc-scopes", "auth.scopes", &c.Scopes, strings.Join(config.Scopes, ","))
 
-	if c.InactivityTimeoutSeconds == 0 {
+	flagSet, configSet := setFlags["inactivity-timeout"], config.InactivityTimeoutSeconds != 0
+	c.logPrecedence("inactivity-timeout", "auth.inactivityTimeoutSeconds",
+		strconv.Itoa(c.InactivityTimeoutSeconds), flagSet,
+		strconv.Itoa(config.InactivityTimeoutSeconds), configSet,
+	)
+	if !flagSet && configSet {
 		c.InactivityTimeoutSeconds = config.InactivityTimeoutSeconds
 	}
 }
 
-func (c *AuthOptions) Complete(k8sAuthType string) (*CompletedOptions, error) {
+// setIfUnset applies the config file value unless the flag was set, flags
+// always take precedence over the config file.
+func (c *AuthOptions) setIfUnset(setFlags map[string]bool, flagName, configField string, flagVal *string, val string) {
+	flagSet := setFlags[flagName]
+	c.logPrecedence(flagName, configField, *flagVal, flagSet && !isUnset(*flagVal), val, !isUnset(val))
+	setIfUnset(flagVal, flagSet, val)
+}
+
+// logPrecedencef logs the outcome of logPrecedence, replaced in tests.
+var logPrecedencef = klog.Infof
+
+// logPrecedence reports which source provides the effective value of a setting
+// when --log-config-precedence is enabled.
+func (c *AuthOptions) logPrecedence(flagName, configField, flagVal string, flagSet bool, configVal string, configSet bool) {
+	if !c.LogConfigPrecedence {
+		return
+	}
+
+	switch {
+	case flagSet && configSet && flagVal != configVal:
+		logPrecedencef("config precedence: --%s overrides config file value %s", flagName, configField)
+	case flagSet:
+		logPrecedencef("config precedence: --%s is set by flag", flagName)
+	case configSet:
+		logPrecedencef("config precedence: --%s is set by config file value %s", flagName, configField)
+	default:
+		logPrecedencef("config precedence: --%s is not set, using its default", flagName)
+	}
+}
+
+// Check applies the defaults Complete starts with and returns the warnings
+// Complete logs and the errors it fails with. baseURL is the parsed
+// --base-address, see Validate.
+func (c *AuthOptions) Check(k8sAuthType string, baseURL *url.URL) (warnings, errs []error) {
 	// default values before running validation
 	if len(c.AuthType) == 0 {
 		c.AuthType = "openshift"
 	}
 
-	if c.InactivityTimeoutSeconds < 300 {
-		klog.Warning("Flag inactivity-timeout is set to less then 300 seconds and will be ignored!")
-		c.InactivityTimeoutSeconds = 0
+	var results []error
+	if c.InactivityTimeoutSeconds != 0 {
+		if err := flags.ValidateIntRange("inactivity-timeout", c.InactivityTimeoutSeconds, minInactivityTimeoutSeconds, 0); err != nil {
+			results = append(results, newValidationWarning("%v, the flag will be ignored", err))
+			c.InactivityTimeoutSeconds = 0
+		}
 	}
 
-	if errs := c.Validate(k8sAuthType); len(errs) > 0 {
+	return splitValidationWarnings(append(results, c.Validate(k8sAuthType, baseURL)...))
+}
+
+// PrintCheck writes the results of Check and of the parsing Complete does
+// afterwards to w, one per line prefixed with "error: " or "warning: ", and
+// returns whether there were errors.
+func (c *AuthOptions) PrintCheck(w io.Writer, k8sAuthType string, baseURL *url.URL) (bool, error) {
+	warnings, errs := c.Check(k8sAuthType, baseURL)
+	if len(errs) == 0 {
+		if _, err := c.complete(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, result := range []struct {
+		prefix string
+		errs   []error
+	}{{"error", errs}, {"warning", warnings}} {
+		for _, err := range result.errs {
+			msg := strings.Join(strings.Fields(err.Error()), " ")
+			if _, err := fmt.Fprintf(w, "%s: %s\n", result.prefix, msg); err != nil {
+				return false, err
+			}
+		}
+	}
+	return len(errs) > 0, nil
+}
+
+func (c *AuthOptions) Complete(k8sAuthType string, baseURL *url.URL) (*CompletedOptions, error) {
+	warnings, errs := c.Check(k8sAuthType, baseURL)
+	for _, warning := range warnings {
+		klog.Warning(warning)
+	}
+	if len(errs) > 0 {
 		return nil, utilerrors.NewAggregate(errs)
 	}
 
+	completed, err := c.complete()
+	if err != nil {
+		return nil, err
+	}
+	return &CompletedOptions{
+		completedOptions: completed,
+	}, nil
+}
+
+// complete parses the options checked by Check and reads the files they point
+// to.
+func (c *AuthOptions) complete() (*completedOptions, error) {
 	completed := &completedOptions{
-		AuthType:                 c.AuthType,
-		ClientID:                 c.ClientID,
-		ClientSecret:             c.ClientSecret,
-		CAFilePath:               c.CAFilePath,
-		InactivityTimeoutSeconds: c.InactivityTimeoutSeconds,
+		AuthType:                  c.AuthType,
+		IssuerOverride:            c.IssuerOverride,
+		ClientID:                  c.ClientID,
+		ClientSecret:              c.ClientSecret,
+		ClientCertFile:            c.ClientCertFile,
+		ClientKeyFile:             c.ClientKeyFile,
+		CAFilePath:                c.CAFilePath,
+		IdentityClaim:             c.IdentityClaim,
+		ClockSkew:                 c.ClockSkew,
+		MaxAge:                    c.MaxAge,
+		AllowIdPInitiatedLogin:    c.AllowIdPInitiatedLogin,
+		SilentRenew:               c.SilentRenew,
+		DisableGroups:             c.DisableGroups,
+		MaxGroups:                 c.MaxGroups,
+		GroupsOverflowPolicy:      c.GroupsOverflowPolicy,
+		RequireVerifiedEmail:      c.RequireVerifiedEmail,
+		OutboundUserAgent:         c.OutboundUserAgent,
+		AuditLogFile:              c.AuditLogFile,
+		ResponseMode:              c.ResponseMode,
+		LoginHint:                 c.LoginHint,
+		EmbeddedHeader:            c.EmbeddedHeader,
+		CookieDomain:              c.CookieDomain,
+		CookiePath:                c.CookiePath,
+		SecureCookies:             c.SecureCookies,
+		RequireAllGroups:          c.RequiredGroupsMode == "all",
+		SessionAdminGroup:         c.SessionAdminGroup,
+		ProviderAdminGroup:        c.ProviderAdminGroup,
+		InactivityTimeoutSeconds:  c.InactivityTimeoutSeconds,
+		RejectLogoutLoops:         c.RejectLogoutLoops,
+		OAuthStateTTL:             c.OAuthStateTTL,
+		IssuerCertExpiryWarning:   c.IssuerCertExpiryWarning,
+		CredentialCheckInterval:   c.CredentialCheckInterval,
+		UnhealthyThreshold:        c.UnhealthyThreshold,
+		DiscoveryCacheFile:        c.DiscoveryCacheFile,
+		DiscoveryCacheTTL:         c.DiscoveryCacheTTL,
+		SessionStore:              c.SessionStore,
+		SessionStoreFailurePolicy: c.SessionStoreFailurePolicy,
+		FollowTokenExpiry:         c.SessionFollowTokenExpiry,
+		StoreRefreshToken:         c.StoreRefreshToken,
+		TokenRefreshLeadTime:      c.TokenRefreshLeadTime,
+		OnMissingRefreshToken:     c.OnMissingRefreshToken,
+		MaxSessionLifetime:        c.MaxSessionLifetime,
+		SingleSessionPerUser:      c.SingleSessionPerUser,
+		TrackActiveSessions:       c.TrackActiveSessions,
+		CallbackMaxBodyBytes:      c.CallbackMaxBodyBytes,
+		CallbackReadTimeout:       c.CallbackReadTimeout,
+		SessionCookieMaxChunks:    c.SessionCookieMaxChunks,
+	}
+
+	completed.AuthPaths = server.AuthPaths{
+		Login:    c.LoginPath,
+		Callback: c.CallbackPath,
+		Success:  c.SuccessPath,
+		Error:    c.ErrorPath,
+	}.WithDefaults()
+	completed.PostLoginRedirectPath = c.PostLoginRedirectPath
+	completed.NoncePolicy = c.NoncePolicy
+	if completed.NoncePolicy == "" {
+		completed.NoncePolicy = auth.NoncePolicyRequired
+	}
+	if completed.OnMissingRefreshToken == "" {
+		completed.OnMissingRefreshToken = auth.OnMissingRefreshTokenWarn
+	}
+	if completed.SessionStoreFailurePolicy == "" {
+		completed.SessionStoreFailurePolicy = auth.SessionStoreFailClosed
 	}
 
 	if len(c.IssuerURL) > 0 {
@@ -106,6 +504,17 @@ func (c *AuthOptions) Complete(k8sAuthType string) (*CompletedOptions, error) {
 		completed.IssuerURL = issuerURL
 	}
 
+	for _, list := range c.listFlags(completed) {
+		parsed, err := flags.ParseStringList(list.name, list.value)
+		if err != nil {
+			return nil, err
+		}
+		*list.parsed = parsed
+	}
+	for i, host := range completed.ErrorRedirectAllowedHosts {
+		completed.ErrorRedirectAllowedHosts[i] = strings.ToLower(host)
+	}
+
 	if len(c.LogoutRedirect) > 0 {
 		logoutURL, err := url.Parse(c.LogoutRedirect)
 		if err != nil {
@@ -114,6 +523,14 @@ func (c *AuthOptions) Complete(k8sAuthType string) (*CompletedOptions, error) {
 		completed.LogoutRedirectURL = logoutURL
 	}
 
+	if len(c.ErrorRedirect) > 0 {
+		errorURL, err := url.Parse(c.ErrorRedirect)
+		if err != nil {
+			return nil, fmt.Errorf("invalid error redirect URL: %w", err)
+		}
+		completed.ErrorRedirectURL = errorURL
+	}
+
 	if len(c.ClientSecretFilePath) > 0 {
 		buf, err := os.ReadFile(c.ClientSecretFilePath)
 		if err != nil {
@@ -122,12 +539,37 @@ func (c *AuthOptions) Complete(k8sAuthType string) (*CompletedOptions, error) {
 		completed.ClientSecret = string(buf)
 	}
 
-	return &CompletedOptions{
-		completedOptions: completed,
-	}, nil
+	if len(c.RefreshTokenKeyFile) > 0 {
+		buf, err := os.ReadFile(c.RefreshTokenKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read refresh token encryption key file: %w", err)
+		}
+		completed.RefreshTokenKey = bytes.TrimSpace(buf)
+	}
+
+	if len(c.SessionStoreRedisURL) > 0 {
+		redisURL, err := url.Parse(c.SessionStoreRedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis URL: %w", err)
+		}
+		if len(c.SessionStoreRedisPasswordFile) > 0 {
+			buf, err := os.ReadFile(c.SessionStoreRedisPasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read redis password file: %w", err)
+			}
+			redisURL.User = url.UserPassword(redisURL.User.Username(), strings.TrimSpace(string(buf)))
+		}
+		completed.SessionStoreRedisURL = redisURL
+	}
+
+	return completed, nil
 }
 
-func (c *AuthOptions) Validate(k8sAuthType string) []error {
+// Validate returns the problems found with the options. Results that wrap a
+// ValidationWarning are logged by Complete without failing startup. baseURL
+// is the parsed --base-address the options are checked against, nil skips
+// those checks.
+func (c *AuthOptions) Validate(k8sAuthType string, baseURL *url.URL) []error {
 	var errs []error
 
 	switch c.AuthType {
@@ -136,8 +578,13 @@ func (c *AuthOptions) Validate(k8sAuthType string) []error {
 			errs = append(errs, flags.NewRequiredFlagError("user-auth-oidc-client-id"))
 		}
 
-		if c.ClientSecret == "" && c.ClientSecretFilePath == "" {
-			errs = append(errs, fmt.Errorf("must provide either --user-auth-oidc-client-secret or --user-auth-oidc-client-secret-file"))
+		hasSecret := c.ClientSecret != "" || c.ClientSecretFilePath != ""
+		if !hasSecret && c.ClientCertFile == "" {
+			errs = append(errs, fmt.Errorf("must provide either --user-auth-oidc-client-secret, --user-auth-oidc-client-secret-file or --user-auth-oidc-client-cert-file"))
+		}
+
+		if hasSecret && c.ClientCertFile != "" && !c.ClientCertWithSecret {
+			errs = append(errs, fmt.Errorf("cannot provide both a client secret and --user-auth-oidc-client-cert-file unless --user-auth-oidc-client-cert-with-secret is set"))
 		}
 
 		if c.ClientSecret != "" && c.ClientSecretFilePath != "" {
@@ -155,10 +602,301 @@ func (c *AuthOptions) Validate(k8sAuthType string) []error {
 			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-issuer-url", "cannot be used with --user-auth=\"openshift\""))
 		}
 
+		if len(c.ExtraAudiences) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-extra-audiences", "cannot be used with --user-auth=\"openshift\""))
+		}
+
+		if len(c.Scopes) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-scopes", "cannot be used with --user-auth=\"openshift\""))
+		}
+
+		if len(c.IdentityClaim) != 0 && c.IdentityClaim != "sub" {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-identity-claim", "cannot be used with --user-auth=\"openshift\""))
+		}
+
 	case "oidc":
 		if len(c.IssuerURL) == 0 {
 			errs = append(errs, fmt.Errorf("--user-auth-oidc-issuer-url must be set if --user-auth=oidc"))
 		}
+
+		if len(c.IssuerOverride) > 0 {
+			if u, err := url.Parse(c.IssuerOverride); err != nil || !u.IsAbs() || len(u.Host) == 0 {
+				errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-issuer-override", "must be an absolute URL, got %q", c.IssuerOverride))
+			}
+			if len(c.AllowedIssuers) > 0 && !listContains(c.AllowedIssuers, c.IssuerOverride) {
+				errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-allowed-issuers", "must contain the issuer %q of --user-auth-oidc-issuer-override", c.IssuerOverride))
+			}
+		} else if len(c.AllowedIssuers) > 0 && !listContains(c.AllowedIssuers, c.IssuerURL) {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-allowed-issuers", "must contain the issuer %q of --user-auth-oidc-issuer-url", c.IssuerURL))
+		}
+
+		if len(c.Scopes) > 0 && !listContains(c.Scopes, "openid") {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-scopes", "must contain openid"))
+		}
+
+		algs, _ := flags.ParseStringList("user-auth-oidc-supported-signing-algs", c.SupportedSigningAlgs)
+		for _, alg := range algs {
+			if err := auth.ValidateSigningAlg(alg); err != nil {
+				errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-supported-signing-algs", "%v", err))
+			}
+		}
+	}
+
+	switch c.ResponseMode {
+	case "", auth.ResponseModeQuery, auth.ResponseModeFormPost:
+		if len(c.ResponseMode) != 0 && c.AuthType != "oidc" {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-response-mode", "can only be used with --user-auth=\"oidc\""))
+		}
+	default:
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-response-mode", "must be one of: %s, %s", auth.ResponseModeQuery, auth.ResponseModeFormPost))
+	}
+
+	switch c.NoncePolicy {
+	case "", auth.NoncePolicyRequired, auth.NoncePolicyOptional, auth.NoncePolicyDisabled:
+		if c.NoncePolicy != "" && c.NoncePolicy != auth.NoncePolicyRequired && c.AuthType != "oidc" {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-nonce-policy", "can only be used with --user-auth=\"oidc\""))
+		}
+	default:
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-nonce-policy", "must be one of: %s, %s, %s", auth.NoncePolicyRequired, auth.NoncePolicyOptional, auth.NoncePolicyDisabled))
+	}
+
+	if c.AuthType != "oidc" {
+		if len(c.LoginHint) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-login-hint", "can only be used with --user-auth=\"oidc\""))
+		}
+
+		if len(c.LoginHintDomains) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-login-hint-domains", "can only be used with --user-auth=\"oidc\""))
+		}
+
+		if len(c.AllowedIssuers) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-allowed-issuers", "can only be used with --user-auth=\"oidc\""))
+		}
+
+		if len(c.IssuerOverride) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-issuer-override", "can only be used with --user-auth=\"oidc\""))
+		}
+
+		if len(c.SupportedSigningAlgs) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-supported-signing-algs", "can only be used with --user-auth=\"oidc\""))
+		}
+
+		if len(c.SessionAdminGroup) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-session-admin-group", "can only be used with --user-auth=\"oidc\", other auth types keep no sessions"))
+		}
+
+		if len(c.ProviderAdminGroup) != 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-provider-admin-group", "can only be used with --user-auth=\"oidc\""))
+		}
+	}
+
+	if len(c.ClientCertFile) > 0 || len(c.ClientKeyFile) > 0 {
+		switch {
+		case c.AuthType != "oidc":
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-client-cert-file", "can only be used with --user-auth=\"oidc\""))
+		case len(c.ClientCertFile) == 0:
+			errs = append(errs, flags.NewRequiredFlagError("user-auth-oidc-client-cert-file"))
+		case len(c.ClientKeyFile) == 0:
+			errs = append(errs, flags.NewRequiredFlagError("user-auth-oidc-client-key-file"))
+		default:
+			if _, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile); err != nil {
+				errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-client-cert-file", "failed to load the client certificate and key: %v", err))
+			}
+		}
+	}
+
+	switch c.RequiredGroupsMode {
+	case "", "any", "all":
+	default:
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-required-groups-mode", "must be one of: any, all"))
+	}
+
+	if len(c.RequiredGroups) > 0 && c.AuthType != "oidc" && c.AuthType != "openshift" {
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-required-groups", "can only be used with --user-auth=\"oidc\" or --user-auth=\"openshift\", which provide the groups of users"))
+	}
+
+	switch c.SessionStore {
+	case "", "memory":
+		if len(c.SessionStoreRedisURL) > 0 || len(c.SessionStoreRedisPasswordFile) > 0 {
+			errs = append(errs, flags.NewInvalidFlagError("session-store", "must be \"redis\" with --session-store-redis-url or --session-store-redis-password-file"))
+		}
+	case "redis":
+		if c.AuthType != "oidc" {
+			errs = append(errs, flags.NewInvalidFlagError("session-store", "redis can only be used with --user-auth=\"oidc\", other auth types keep no sessions"))
+		}
+		if len(c.SessionStoreRedisURL) == 0 {
+			errs = append(errs, flags.NewRequiredFlagError("session-store-redis-url"))
+		} else if _, err := redis.ParseURL(c.SessionStoreRedisURL); err != nil {
+			errs = append(errs, flags.NewInvalidFlagError("session-store-redis-url", "%v", err))
+		}
+	default:
+		errs = append(errs, flags.NewInvalidFlagError("session-store", "must be one of: memory, redis"))
+	}
+
+	switch c.SessionStoreFailurePolicy {
+	case "", auth.SessionStoreFailClosed:
+	case auth.SessionStoreFailOpenReadOnly:
+		if c.SessionStore != "redis" {
+			errs = append(errs, flags.NewInvalidFlagError("session-store-failure-policy", "%s can only be used with --session-store=\"redis\", the memory session store doesn't fail", auth.SessionStoreFailOpenReadOnly))
+		}
+	default:
+		errs = append(errs, flags.NewInvalidFlagError("session-store-failure-policy", "must be one of: %s, %s", auth.SessionStoreFailClosed, auth.SessionStoreFailOpenReadOnly))
+	}
+
+	if c.SessionFollowTokenExpiry && c.AuthType != "oidc" {
+		errs = append(errs, flags.NewInvalidFlagError("session-follow-token-expiry", "can only be used with --user-auth=\"oidc\", other sessions already end when their access token expires"))
+	}
+
+	if c.StoreRefreshToken && !c.SessionFollowTokenExpiry {
+		errs = append(errs, flags.NewInvalidFlagError("store-refresh-token", "requires --session-follow-token-expiry, refresh tokens are only used to refresh sessions following the token expiry"))
+	}
+
+	if c.StoreRefreshToken && c.SessionStore == "redis" && len(c.RefreshTokenKeyFile) == 0 {
+		errs = append(errs, flags.NewInvalidFlagError("refresh-token-encryption-key-file", "is required with --store-refresh-token and --session-store=\"redis\", all replicas must use the same key"))
+	}
+
+	if len(c.RefreshTokenKeyFile) > 0 && !c.StoreRefreshToken {
+		errs = append(errs, flags.NewInvalidFlagError("refresh-token-encryption-key-file", "requires --store-refresh-token"))
+	}
+
+	if c.TokenRefreshLeadTime != 0 && !c.StoreRefreshToken {
+		errs = append(errs, flags.NewInvalidFlagError("token-refresh-lead-time", "requires --store-refresh-token, only sessions with a refresh token are refreshed"))
+	}
+
+	switch c.OnMissingRefreshToken {
+	case "", auth.OnMissingRefreshTokenWarn:
+	case auth.OnMissingRefreshTokenForceConsent, auth.OnMissingRefreshTokenError:
+		if !c.StoreRefreshToken {
+			errs = append(errs, flags.NewInvalidFlagError("on-missing-refresh-token", "requires --store-refresh-token, refresh tokens are only expected when they are stored"))
+		}
+	default:
+		errs = append(errs, flags.NewInvalidFlagError("on-missing-refresh-token", "must be one of: %s, %s, %s", auth.OnMissingRefreshTokenWarn, auth.OnMissingRefreshTokenForceConsent, auth.OnMissingRefreshTokenError))
+	}
+
+	if c.MaxAge != 0 && c.AuthType != "oidc" {
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-max-age", "can only be used with --user-auth=\"oidc\""))
+	}
+
+	if c.MaxSessionLifetime != 0 && c.AuthType != "oidc" {
+		errs = append(errs, flags.NewInvalidFlagError("max-session-lifetime", "can only be used with --user-auth=\"oidc\", other auth types keep no sessions"))
+	}
+
+	if c.SingleSessionPerUser && c.AuthType != "oidc" {
+		errs = append(errs, flags.NewInvalidFlagError("single-session-per-user", "can only be used with --user-auth=\"oidc\", other auth types keep no sessions"))
+	}
+
+	if c.AllowIdPInitiatedLogin && c.AuthType != "oidc" {
+		errs = append(errs, flags.NewInvalidFlagError("allow-idp-initiated-login", "can only be used with --user-auth=\"oidc\", the nonce of the ID token protects against replay"))
+	}
+
+	if c.DisableGroups {
+		if c.AuthType != "oidc" {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-disable-groups", "can only be used with --user-auth=\"oidc\""))
+		}
+		if len(c.RequiredGroups) > 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-disable-groups", "cannot be used with --user-auth-required-groups, which checks the groups claim"))
+		}
+		if len(c.SessionAdminGroup) > 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-disable-groups", "cannot be used with --user-auth-session-admin-group, which checks the groups claim"))
+		}
+		if len(c.ProviderAdminGroup) > 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-disable-groups", "cannot be used with --user-auth-provider-admin-group, which checks the groups claim"))
+		}
+		if listContains(c.Scopes, "groups") {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-scopes", "cannot contain groups with --user-auth-oidc-disable-groups"))
+		}
+	}
+
+	if err := flags.ValidateIntRange("user-auth-oidc-max-groups", c.MaxGroups, 0, 0); err != nil {
+		errs = append(errs, err)
+	} else if c.MaxGroups > 0 {
+		if c.AuthType != "oidc" {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-max-groups", "can only be used with --user-auth=\"oidc\""))
+		}
+		if c.DisableGroups {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-max-groups", "cannot be used with --user-auth-oidc-disable-groups, which ignores the groups claim"))
+		}
+	}
+
+	switch c.GroupsOverflowPolicy {
+	case "", auth.GroupsOverflowPolicyTruncate:
+	case auth.GroupsOverflowPolicyReject:
+		if c.MaxGroups == 0 {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-groups-overflow-policy", "requires --user-auth-oidc-max-groups"))
+		}
+	default:
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-groups-overflow-policy", "must be one of: %s, %s", auth.GroupsOverflowPolicyTruncate, auth.GroupsOverflowPolicyReject))
+	}
+
+	if c.RequireVerifiedEmail && c.AuthType != "oidc" {
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-require-verified-email", "can only be used with --user-auth=\"oidc\""))
+	}
+
+	if c.SilentRenew && c.AuthType != "oidc" {
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-silent-renew", "can only be used with --user-auth=\"oidc\""))
+	}
+
+	if !httpguts.ValidHeaderFieldValue(c.OutboundUserAgent) {
+		errs = append(errs, flags.NewInvalidFlagError("outbound-user-agent", "must be a valid header value"))
+	}
+
+	if len(c.ErrorRedirect) > 0 {
+		if c.AuthType == "disabled" {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-error-redirect", "cannot be used with --user-auth=\"disabled\""))
+		}
+		if u, err := url.Parse(c.ErrorRedirect); err != nil {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-error-redirect", "%v", err))
+		} else if u.IsAbs() && u.Scheme != "https" && u.Scheme != "http" {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-error-redirect", "must be an http or https URL or a path, got scheme %q", u.Scheme))
+		}
+	} else if len(c.ErrorRedirectAllowedHosts) > 0 {
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-error-redirect-allowed-hosts", "requires --user-auth-error-redirect"))
+	}
+
+	if len(c.AllowedRedirectURIs) > 0 {
+		if c.AuthType == "disabled" {
+			errs = append(errs, flags.NewInvalidFlagError("auth-allowed-redirect-uris", "cannot be used with --user-auth=\"disabled\""))
+		}
+		uris, _ := flags.ParseStringList("auth-allowed-redirect-uris", c.AllowedRedirectURIs)
+		for _, uri := range uris {
+			if u, err := url.Parse(uri); err != nil || !u.IsAbs() || len(u.Host) == 0 {
+				errs = append(errs, flags.NewInvalidFlagError("auth-allowed-redirect-uris", "%q is not an absolute URI", uri))
+			}
+		}
+	}
+
+	if c.TrackActiveSessions && c.AuthType == "disabled" {
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-track-active-sessions", "cannot be used with --user-auth=\"disabled\""))
+	}
+
+	for _, list := range c.listFlags(&completedOptions{}) {
+		if _, err := flags.ParseStringList(list.name, list.value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, path := range []struct{ flag, value string }{
+		{"auth-login-path", c.LoginPath},
+		{"auth-callback-path", c.CallbackPath},
+		{"auth-success-path", c.SuccessPath},
+		{"auth-error-path", c.ErrorPath},
+	} {
+		if len(path.value) > 0 && !strings.HasPrefix(path.value, "/") {
+			errs = append(errs, flags.NewInvalidFlagError(path.flag, "must start with a slash"))
+		}
+	}
+
+	if len(c.CallbackPath) > 0 && c.CallbackPath != server.AuthLoginCallbackEndpoint && c.AuthType != "disabled" {
+		errs = append(errs, newValidationWarning("Flag auth-callback-path is set to %q, the redirect URL registered with the identity provider must be updated to use this path", c.CallbackPath))
+	}
+
+	if len(c.EmbeddedOrigins) > 0 {
+		origins, _ := flags.ParseStringList("user-auth-embedded-origins", c.EmbeddedOrigins)
+		for _, origin := range origins {
+			if !isOrigin(origin) {
+				errs = append(errs, flags.NewInvalidFlagError("user-auth-embedded-origins", "%q is not an origin of the form scheme://host[:port]", origin))
+			}
+		}
 	}
 
 	switch k8sAuthType {
@@ -169,36 +907,664 @@ func (c *AuthOptions) Validate(k8sAuthType string) []error {
 		}
 	}
 
+	if err := flags.ValidateDurationRange("user-auth-oidc-credential-check-interval", c.CredentialCheckInterval, 0, 0); err != nil {
+		errs = append(errs, err)
+	} else if c.CredentialCheckInterval > 0 && c.AuthType != "oidc" {
+		errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-credential-check-interval", "can only be used with --user-auth=\"oidc\""))
+	}
+
+	if err := flags.ValidateDurationRange("authenticator-unhealthy-threshold", c.UnhealthyThreshold, 0, 0); err != nil {
+		errs = append(errs, err)
+	} else if c.UnhealthyThreshold > 0 && c.AuthType == "disabled" {
+		errs = append(errs, flags.NewInvalidFlagError("authenticator-unhealthy-threshold", "cannot be used with --user-auth=\"disabled\""))
+	}
+
+	if len(c.AuditLogFile) > 0 && c.AuthType == "disabled" {
+		errs = append(errs, flags.NewInvalidFlagError("auth-audit-log-file", "cannot be used with --user-auth=\"disabled\""))
+	}
+
+	if len(c.DiscoveryCacheFile) > 0 {
+		if c.AuthType != "oidc" {
+			errs = append(errs, flags.NewInvalidFlagError("user-auth-oidc-discovery-cache-file", "can only be used with --user-auth=\"oidc\""))
+		}
+		if err := flags.ValidateDurationRange("user-auth-oidc-discovery-cache-ttl", c.DiscoveryCacheTTL, time.Minute, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := flags.ValidateDurationRange("token-refresh-lead-time", c.TokenRefreshLeadTime, 0, 0); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := flags.ValidateDurationRange("user-auth-oidc-clock-skew", c.ClockSkew, 0, maxClockSkew); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := flags.ValidateDurationRange("user-auth-oidc-max-age", c.MaxAge, 0, 0); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := flags.ValidateDurationRange("max-session-lifetime", c.MaxSessionLifetime, 0, 0); err != nil {
+		errs = append(errs, err)
+	} else if c.MaxSessionLifetime > 0 && c.InactivityTimeoutSeconds > 0 && time.Duration(c.InactivityTimeoutSeconds)*time.Second >= c.MaxSessionLifetime {
+		errs = append(errs, newValidationWarning("Flag inactivity-timeout is set to %d seconds, which is not shorter than --max-session-lifetime %s, sessions end before users are inactive for that long", c.InactivityTimeoutSeconds, c.MaxSessionLifetime))
+	}
+
+	if err := flags.ValidateIntRange("auth-callback-max-body-bytes", c.CallbackMaxBodyBytes, 0, 0); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := flags.ValidateDurationRange("auth-callback-read-timeout", c.CallbackReadTimeout, 0, 0); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := flags.ValidateIntRange("session-cookie-max-chunks", c.SessionCookieMaxChunks, 0, maxSessionCookieChunks); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.SecureCookies) > 0 {
+		if _, err := strconv.ParseBool(c.SecureCookies); err != nil {
+			errs = append(errs, flags.NewInvalidFlagError("secure-cookies", "must be true or false, got %q", c.SecureCookies))
+		}
+	}
+
+	if c.SessionCookieMaxChunks > 1 && c.AuthType != "openshift" {
+		errs = append(errs, flags.NewInvalidFlagError("session-cookie-max-chunks", "can only be used with --user-auth=\"openshift\", other auth types keep only a session token in the cookie"))
+	}
+
+	if err := flags.ValidateDurationRange("user-auth-oidc-cert-expiry-warning", c.IssuerCertExpiryWarning, 0, 0); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.OAuthStateTTL != 0 {
+		if err := flags.ValidateDurationRange("user-auth-oauth-state-ttl", c.OAuthStateTTL, minOAuthStateTTL, maxOAuthStateTTL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.OAuthStateTTL > oauthStateTTLWarningThreshold {
+		errs = append(errs, newValidationWarning("Flag user-auth-oauth-state-ttl is set to %s, a long lived login state weakens the CSRF protection of the login flow", c.OAuthStateTTL))
+	}
+
+	for _, warning := range c.issuerCAWarnings() {
+		errs = append(errs, newValidationWarning("%s", warning))
+	}
+
+	if baseURL != nil {
+		errs = append(errs, c.validateBaseAddress(baseURL)...)
+	}
+
+	return errs
+}
+
+// validateBaseAddress returns the problems of the options that depend on
+// --base-address, which are only known once it is parsed.
+func (c *AuthOptions) validateBaseAddress(baseURL *url.URL) []error {
+	if c.AuthType == "disabled" {
+		return nil
+	}
+	if err := flags.ValidateFlagNotEmpty("base-address", baseURL.String()); err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	secureCookies := secureCookiesEnabled(baseURL, c.SecureCookies)
+	if len(c.SecureCookies) == 0 && baseURL.Scheme == "http" && !isLoopbackHost(baseURL.Hostname()) {
+		errs = append(errs, newValidationWarning("--base-address %q uses http, cookies are set without the Secure attribute. If TLS is terminated by a proxy in front of the console, --base-address must be the https address users reach.", baseURL.String()))
+	}
+	if err := validateSecureCookies(baseURL, secureCookies); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateCookieDomain(baseURL, c.CookieDomain); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.CookiePath) > 0 {
+		if err := validateCookiePath(baseURL, c.CookiePath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(c.PostLoginRedirectPath) > 0 {
+		if err := validatePostLoginRedirectPath(baseURL, c.PostLoginRedirectPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if (len(c.EmbeddedHeader) > 0 || len(c.EmbeddedOrigins) > 0) && !secureCookies {
+		errs = append(errs, fmt.Errorf("--user-auth-embedded-header and --user-auth-embedded-origins require an https --base-address, browsers only accept SameSite=None for secure cookies"))
+	}
+
+	if len(c.LogoutRedirect) > 0 {
+		// Complete fails on a logout redirect that can't be parsed.
+		if logoutURL, err := url.Parse(c.LogoutRedirect); err == nil {
+			if err := validateLogoutRedirect(baseURL, logoutURL); err != nil {
+				if !c.RejectLogoutLoops {
+					err = ValidationWarning{err}
+				}
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(c.AllowedRedirectURIs) > 0 {
+		callbackPath := server.AuthPaths{Callback: c.CallbackPath}.WithDefaults().Callback
+		allowedRedirectURIs, _ := flags.ParseStringList("auth-allowed-redirect-uris", c.AllowedRedirectURIs)
+		if err := validateRedirectURI(proxy.SingleJoiningSlash(baseURL.String(), callbackPath), allowedRedirectURIs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(c.ErrorRedirect) > 0 {
+		// Validate reports an error redirect that can't be parsed.
+		if errorURL, err := url.Parse(c.ErrorRedirect); err == nil {
+			allowedHosts, _ := flags.ParseStringList("user-auth-error-redirect-allowed-hosts", c.ErrorRedirectAllowedHosts)
+			if err := validateErrorRedirect(baseURL, errorURL, allowedHosts); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
 	return errs
 }
 
+// secureCookiesEnabled returns whether cookies are set with the Secure attribute,
+// per --secure-cookies or the scheme of --base-address. Validate ensures
+// secureCookies can be parsed.
+func secureCookiesEnabled(baseURL *url.URL, secureCookies string) bool {
+	if len(secureCookies) > 0 {
+		secure, _ := strconv.ParseBool(secureCookies)
+		return secure
+	}
+	return baseURL.Scheme == "https"
+}
+
+// ValidationWarning is a Validate result that does not prevent the console
+// from starting. Complete logs warnings and only fails on the other errors.
+type ValidationWarning struct {
+	error
+}
+
+func newValidationWarning(format string, args ...interface{}) error {
+	return ValidationWarning{fmt.Errorf(format, args...)}
+}
+
+func (w ValidationWarning) Unwrap() error {
+	return w.error
+}
+
+// IsValidationWarning returns true if err only warrants a warning.
+func IsValidationWarning(err error) bool {
+	var warning ValidationWarning
+	return errors.As(err, &warning)
+}
+
+// splitValidationWarnings separates the warnings from the fatal errors in the
+// results of Validate.
+func splitValidationWarnings(results []error) (warnings, errs []error) {
+	for _, result := range results {
+		if IsValidationWarning(result) {
+			warnings = append(warnings, result)
+		} else {
+			errs = append(errs, result)
+		}
+	}
+	return warnings, errs
+}
+
+// listFlag is a flag with a list of values separated by comma, parsed into
+// a field of the completed options.
+type listFlag struct {
+	name   string
+	value  string
+	parsed *[]string
+}
+
+// listFlags returns the list flags, parsed into the fields of completed.
+func (c *AuthOptions) listFlags(completed *completedOptions) []listFlag {
+	return []listFlag{
+		{"user-auth-oidc-allowed-issuers", c.AllowedIssuers, &completed.AllowedIssuers},
+		{"user-auth-oidc-supported-signing-algs", c.SupportedSigningAlgs, &completed.SupportedSigningAlgs},
+		{"user-auth-oidc-extra-audiences", c.ExtraAudiences, &completed.ExtraAudiences},
+		{"user-auth-oidc-scopes", c.Scopes, &completed.Scopes},
+		{"user-auth-embedded-origins", c.EmbeddedOrigins, &completed.EmbeddedOrigins},
+		{"user-auth-oidc-login-hint-domains", c.LoginHintDomains, &completed.LoginHintDomains},
+		{"user-auth-required-groups", c.RequiredGroups, &completed.RequiredGroups},
+		{"auth-allowed-redirect-uris", c.AllowedRedirectURIs, &completed.AllowedRedirectURIs},
+		{"user-auth-error-redirect-allowed-hosts", c.ErrorRedirectAllowedHosts, &completed.ErrorRedirectAllowedHosts},
+	}
+}
+
+// listContains returns true if the list of values separated by comma
+// contains value.
+func listContains(list, value string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// issuerCAWarnings reports the common cases where the CA file given by
+// --user-auth-oidc-ca-file does not do what the operator likely expects.
+func (c *AuthOptions) issuerCAWarnings() []string {
+	var warnings []string
+
+	switch c.AuthType {
+	case "disabled":
+		if len(c.CAFilePath) > 0 {
+			warnings = append(warnings, "--user-auth-oidc-ca-file is ignored with --user-auth=disabled")
+		}
+
+	case "openshift":
+		// The OAuth metadata is discovered through the API server, which is
+		// verified with the k8s CA and not with the issuer CA.
+		if len(c.CAFilePath) > 0 {
+			warnings = append(warnings, "--user-auth-oidc-ca-file is only used to verify the OAuth server with --user-auth=openshift, OAuth metadata discovery is verified with the Kubernetes API server CA")
+		}
+
+	case "oidc":
+		issuerURL, err := url.Parse(c.IssuerURL)
+		if err != nil || len(issuerURL.Host) == 0 {
+			return warnings
+		}
+
+		if issuerURL.Scheme != "https" && len(c.CAFilePath) > 0 {
+			warnings = append(warnings, fmt.Sprintf("--user-auth-oidc-ca-file is ignored because the issuer URL %q does not use https", c.IssuerURL))
+		}
+
+		if issuerURL.Scheme == "https" && len(c.CAFilePath) == 0 && isPrivateHost(issuerURL.Hostname()) {
+			warnings = append(warnings, fmt.Sprintf("no --user-auth-oidc-ca-file is set for issuer %q, its certificate is unlikely to be trusted by the system roots", c.IssuerURL))
+		}
+	}
+
+	return warnings
+}
+
+// isPrivateHost returns true for hosts which are not expected to present
+// certificates signed by a publicly trusted CA.
+func isPrivateHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	for _, suffix := range []string{".svc", ".cluster.local", ".local", ".internal", ".localhost"} {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isOrigin returns true for an absolute URL without path, query or fragment.
+func isOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+// printableOptions is the YAML representation of completedOptions used by
+// --print-auth-config. It must never contain secrets, only references to them.
+type printableOptions struct {
+	AuthType                  string   `yaml:"authType"`
+	IssuerURL                 string   `yaml:"issuerURL,omitempty"`
+	IssuerOverride            string   `yaml:"issuerOverride,omitempty"`
+	AllowedIssuers            []string `yaml:"allowedIssuers,omitempty"`
+	ClientID                  string   `yaml:"clientID,omitempty"`
+	ClientSecret              string   `yaml:"clientSecret,omitempty"`
+	ClientCertFile            string   `yaml:"clientCertFile,omitempty"`
+	ClientKeyFile             string   `yaml:"clientKeyFile,omitempty"`
+	CAFile                    string   `yaml:"caFile,omitempty"`
+	ExtraAudiences            []string `yaml:"extraAudiences,omitempty"`
+	Scopes                    []string `yaml:"scopes,omitempty"`
+	IdentityClaim             string   `yaml:"identityClaim,omitempty"`
+	ClockSkew                 string   `yaml:"clockSkew"`
+	MaxAge                    string   `yaml:"maxAge"`
+	AllowIdPInitiatedLogin    bool     `yaml:"allowIdPInitiatedLogin,omitempty"`
+	SilentRenew               bool     `yaml:"silentRenew,omitempty"`
+	DisableGroups             bool     `yaml:"disableGroups,omitempty"`
+	MaxGroups                 int      `yaml:"maxGroups,omitempty"`
+	GroupsOverflowPolicy      string   `yaml:"groupsOverflowPolicy,omitempty"`
+	RequireVerifiedEmail      bool     `yaml:"requireVerifiedEmail,omitempty"`
+	OutboundUserAgent         string   `yaml:"outboundUserAgent,omitempty"`
+	AuditLogFile              string   `yaml:"auditLogFile,omitempty"`
+	SupportedSigningAlgs      []string `yaml:"supportedSigningAlgs,omitempty"`
+	ResponseMode              string   `yaml:"responseMode,omitempty"`
+	NoncePolicy               string   `yaml:"noncePolicy,omitempty"`
+	LoginHint                 string   `yaml:"loginHint,omitempty"`
+	LoginHintDomains          []string `yaml:"loginHintDomains,omitempty"`
+	EmbeddedHeader            string   `yaml:"embeddedHeader,omitempty"`
+	EmbeddedOrigins           []string `yaml:"embeddedOrigins,omitempty"`
+	CookieDomain              string   `yaml:"cookieDomain,omitempty"`
+	CookiePath                string   `yaml:"cookiePath,omitempty"`
+	SecureCookies             string   `yaml:"secureCookies,omitempty"`
+	RequiredGroups            []string `yaml:"requiredGroups,omitempty"`
+	RequireAllGroups          bool     `yaml:"requireAllGroups,omitempty"`
+	SessionAdminGroup         string   `yaml:"sessionAdminGroup,omitempty"`
+	ProviderAdminGroup        string   `yaml:"providerAdminGroup,omitempty"`
+	LoginPath                 string   `yaml:"loginPath,omitempty"`
+	CallbackPath              string   `yaml:"callbackPath,omitempty"`
+	SuccessPath               string   `yaml:"successPath,omitempty"`
+	ErrorPath                 string   `yaml:"errorPath,omitempty"`
+	PostLoginRedirectPath     string   `yaml:"postLoginRedirectPath,omitempty"`
+	ErrorRedirect             string   `yaml:"errorRedirect,omitempty"`
+	InactivityTimeoutSeconds  int      `yaml:"inactivityTimeoutSeconds"`
+	LogoutRedirect            string   `yaml:"logoutRedirect,omitempty"`
+	RejectLogoutLoops         bool     `yaml:"rejectLogoutLoops"`
+	OAuthStateTTL             string   `yaml:"oauthStateTTL"`
+	IssuerCertExpiryWarning   string   `yaml:"issuerCertExpiryWarning"`
+	CredentialCheckInterval   string   `yaml:"credentialCheckInterval"`
+	UnhealthyThreshold        string   `yaml:"unhealthyThreshold"`
+	DiscoveryCacheFile        string   `yaml:"discoveryCacheFile,omitempty"`
+	DiscoveryCacheTTL         string   `yaml:"discoveryCacheTTL"`
+	SessionStore              string   `yaml:"sessionStore,omitempty"`
+	SessionStoreRedisURL      string   `yaml:"sessionStoreRedisURL,omitempty"`
+	SessionStoreFailurePolicy string   `yaml:"sessionStoreFailurePolicy,omitempty"`
+	FollowTokenExpiry         bool     `yaml:"followTokenExpiry,omitempty"`
+	StoreRefreshToken         bool     `yaml:"storeRefreshToken,omitempty"`
+	RefreshTokenKey           string   `yaml:"refreshTokenKey,omitempty"`
+	TokenRefreshLeadTime      string   `yaml:"tokenRefreshLeadTime"`
+	OnMissingRefreshToken     string   `yaml:"onMissingRefreshToken,omitempty"`
+	MaxSessionLifetime        string   `yaml:"maxSessionLifetime"`
+	SingleSessionPerUser      bool     `yaml:"singleSessionPerUser,omitempty"`
+	TrackActiveSessions       bool     `yaml:"trackActiveSessions,omitempty"`
+	CallbackMaxBodyBytes      int      `yaml:"callbackMaxBodyBytes"`
+	CallbackReadTimeout       string   `yaml:"callbackReadTimeout"`
+	AllowedRedirectURIs       []string `yaml:"allowedRedirectURIs,omitempty"`
+	SessionCookieMaxChunks    int      `yaml:"sessionCookieMaxChunks"`
+
+	ErrorRedirectAllowedHosts []string `yaml:"errorRedirectAllowedHosts,omitempty"`
+}
+
+const redacted = "<redacted>"
+
+// PrintConfig writes the resolved options as YAML to w, with secrets redacted.
+func (c *completedOptions) PrintConfig(w io.Writer) error {
+	printable := printableOptions{
+		AuthType:                  c.AuthType,
+		IssuerOverride:            c.IssuerOverride,
+		AllowedIssuers:            c.AllowedIssuers,
+		ClientID:                  c.ClientID,
+		ClientCertFile:            c.ClientCertFile,
+		ClientKeyFile:             c.ClientKeyFile,
+		CAFile:                    c.CAFilePath,
+		ExtraAudiences:            c.ExtraAudiences,
+		Scopes:                    c.Scopes,
+		IdentityClaim:             c.IdentityClaim,
+		ClockSkew:                 c.ClockSkew.String(),
+		MaxAge:                    c.MaxAge.String(),
+		AllowIdPInitiatedLogin:    c.AllowIdPInitiatedLogin,
+		SilentRenew:               c.SilentRenew,
+		DisableGroups:             c.DisableGroups,
+		MaxGroups:                 c.MaxGroups,
+		GroupsOverflowPolicy:      c.GroupsOverflowPolicy,
+		RequireVerifiedEmail:      c.RequireVerifiedEmail,
+		OutboundUserAgent:         c.OutboundUserAgent,
+		AuditLogFile:              c.AuditLogFile,
+		SupportedSigningAlgs:      c.SupportedSigningAlgs,
+		ResponseMode:              c.ResponseMode,
+		NoncePolicy:               c.NoncePolicy,
+		LoginHint:                 c.LoginHint,
+		LoginHintDomains:          c.LoginHintDomains,
+		EmbeddedHeader:            c.EmbeddedHeader,
+		EmbeddedOrigins:           c.EmbeddedOrigins,
+		CookieDomain:              c.CookieDomain,
+		CookiePath:                c.CookiePath,
+		SecureCookies:             c.SecureCookies,
+		RequiredGroups:            c.RequiredGroups,
+		RequireAllGroups:          c.RequireAllGroups,
+		SessionAdminGroup:         c.SessionAdminGroup,
+		ProviderAdminGroup:        c.ProviderAdminGroup,
+		LoginPath:                 c.AuthPaths.Login,
+		CallbackPath:              c.AuthPaths.Callback,
+		SuccessPath:               c.AuthPaths.Success,
+		ErrorPath:                 c.AuthPaths.Error,
+		PostLoginRedirectPath:     c.PostLoginRedirectPath,
+		InactivityTimeoutSeconds:  c.InactivityTimeoutSeconds,
+		RejectLogoutLoops:         c.RejectLogoutLoops,
+		OAuthStateTTL:             c.OAuthStateTTL.String(),
+		IssuerCertExpiryWarning:   c.IssuerCertExpiryWarning.String(),
+		CredentialCheckInterval:   c.CredentialCheckInterval.String(),
+		UnhealthyThreshold:        c.UnhealthyThreshold.String(),
+		DiscoveryCacheFile:        c.DiscoveryCacheFile,
+		DiscoveryCacheTTL:         c.DiscoveryCacheTTL.String(),
+		SessionStore:              c.SessionStore,
+		SessionStoreFailurePolicy: c.SessionStoreFailurePolicy,
+		FollowTokenExpiry:         c.FollowTokenExpiry,
+		StoreRefreshToken:         c.StoreRefreshToken,
+		TokenRefreshLeadTime:      c.TokenRefreshLeadTime.String(),
+		OnMissingRefreshToken:     c.OnMissingRefreshToken,
+		MaxSessionLifetime:        c.MaxSessionLifetime.String(),
+		SingleSessionPerUser:      c.SingleSessionPerUser,
+		TrackActiveSessions:       c.TrackActiveSessions,
+		CallbackMaxBodyBytes:      c.CallbackMaxBodyBytes,
+		CallbackReadTimeout:       c.CallbackReadTimeout.String(),
+		AllowedRedirectURIs:       c.AllowedRedirectURIs,
+		SessionCookieMaxChunks:    c.SessionCookieMaxChunks,
+	}
+
+	if c.SessionStoreRedisURL != nil {
+		printable.SessionStoreRedisURL = c.SessionStoreRedisURL.Redacted()
+	}
+
+	if c.IssuerURL != nil {
+		printable.IssuerURL = c.IssuerURL.String()
+	}
+
+	if len(c.ClientSecret) > 0 {
+		printable.ClientSecret = redacted
+	}
+
+	if len(c.RefreshTokenKey) > 0 {
+		printable.RefreshTokenKey = redacted
+	}
+
+	if c.LogoutRedirectURL != nil {
+		printable.LogoutRedirect = c.LogoutRedirectURL.String()
+	}
+
+	if c.ErrorRedirectURL != nil {
+		printable.ErrorRedirect = c.ErrorRedirectURL.String()
+		printable.ErrorRedirectAllowedHosts = c.ErrorRedirectAllowedHosts
+	}
+
+	out, err := yaml.Marshal(printable)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
 func (c *completedOptions) ApplyTo(
+	ctx context.Context,
 	srv *server.Server,
 	k8sEndpoint *url.URL,
 	pubAPIServerEndpoint string,
 	caCertFilePath string,
 ) error {
 	srv.InactivityTimeout = c.InactivityTimeoutSeconds
+	srv.SessionAdminGroup = c.SessionAdminGroup
+	srv.ProviderAdminGroup = c.ProviderAdminGroup
+	srv.AuthPaths = c.AuthPaths
 	srv.LogoutRedirect = c.LogoutRedirectURL
+	srv.AuthMetrics = auth.NewMetrics()
+
+	if c.InactivityTimeoutSeconds > 0 {
+		klog.Infof("Inactivity timeout is active, users are logged out after %d seconds of inactivity", c.InactivityTimeoutSeconds)
+	} else {
+		klog.Info("Inactivity timeout is disabled")
+	}
+	srv.AuthMetrics.InactivityTimeoutConfigured(c.InactivityTimeoutSeconds)
 
 	var err error
 	srv.Authenticator, err = c.getAuthenticator(
+		ctx,
 		srv.BaseURL,
 		k8sEndpoint,
 		pubAPIServerEndpoint,
 		caCertFilePath,
 		srv.K8sClient.Transport,
+		srv.AuthMetrics,
 	)
 
 	return err
 }
 
+// oidcScopes returns the scopes requested from an OIDC provider.
+func (c *completedOptions) oidcScopes() []string {
+	if len(c.Scopes) > 0 {
+		return c.Scopes
+	}
+	if c.DisableGroups {
+		return []string{"openid", "email", "profile"}
+	}
+	return []string{"openid", "email", "profile", "groups"}
+}
+
+// validateSecureCookies refuses to set the session cookies without the Secure
+// attribute when the console is served over https, and with it when the
+// console is served over http. Browsers only keep secure cookies set over
+// http for localhost.
+func validateSecureCookies(baseURL *url.URL, secureCookies bool) error {
+	if baseURL.Scheme == "https" && !secureCookies {
+		return fmt.Errorf("secure cookies must not be disabled when --base-address %q uses https", baseURL.String())
+	}
+	if baseURL.Scheme == "http" && secureCookies && !isLoopbackHost(baseURL.Hostname()) {
+		return fmt.Errorf("secure cookies conflict with --base-address %q, which uses http. If TLS is terminated by a proxy in front of the console, --base-address must be the https address users reach", baseURL.String())
+	}
+	return nil
+}
+
+// isLoopbackHost returns true for hosts browsers treat as secure even over http.
+func isLoopbackHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+// validateCookieDomain refuses a cookie domain other than the host of the
+// console or one of its parent domains, browsers would reject the cookies or
+// send them to unrelated sites.
+func validateCookieDomain(baseURL *url.URL, cookieDomain string) error {
+	if len(cookieDomain) == 0 {
+		return nil
+	}
+
+	host := strings.ToLower(baseURL.Hostname())
+	domain := strings.ToLower(strings.TrimPrefix(cookieDomain, "."))
+	if domain == host {
+		return nil
+	}
+	if net.ParseIP(host) != nil || !strings.Contains(domain, ".") || !strings.HasSuffix(host, "."+domain) {
+		return flags.NewInvalidFlagError("cookie-domain", "%q is not the host of --base-address %q or a parent domain of it", cookieDomain, baseURL.String())
+	}
+	return nil
+}
+
+// validateCookiePath refuses a cookie path that isn't absolute or that isn't on
+// the path of the console, browsers would never send the cookies to it.
+func validateCookiePath(baseURL *url.URL, cookiePath string) error {
+	if !strings.HasPrefix(cookiePath, "/") || strings.ContainsAny(cookiePath, ";\r\n") {
+		return flags.NewInvalidFlagError("cookie-path", "must be an absolute path, got %q", cookiePath)
+	}
+
+	basePath := strings.TrimSuffix(baseURL.Path, "/") + "/"
+	path := strings.TrimSuffix(cookiePath, "/") + "/"
+	if !strings.HasPrefix(basePath, path) && !strings.HasPrefix(path, basePath) {
+		return flags.NewInvalidFlagError("cookie-path", "%q is neither a parent of the path of --base-address %q nor below it", cookiePath, baseURL.String())
+	}
+	return nil
+}
+
+// validatePostLoginRedirectPath only accepts a path below the path of the
+// console, so that users can't be sent to another host or application after
+// logging in.
+func validatePostLoginRedirectPath(baseURL *url.URL, redirectPath string) error {
+	u, err := url.Parse(redirectPath)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(redirectPath, "//") || strings.ContainsAny(redirectPath, "\\\r\n") {
+		return flags.NewInvalidFlagError("post-login-redirect-path", "must be an absolute path on the host of --base-address, got %q", redirectPath)
+	}
+
+	basePath := strings.TrimSuffix(baseURL.Path, "/")
+	if cleanPath := path.Clean(u.Path); cleanPath != basePath && !strings.HasPrefix(cleanPath, basePath+"/") {
+		return flags.NewInvalidFlagError("post-login-redirect-path", "%q is not below the path of --base-address %q", redirectPath, baseURL.String())
+	}
+	return nil
+}
+
+// validateRedirectURI refuses to start with a login callback URI other than the
+// allowed ones, which would have to be registered with the provider.
+func validateRedirectURI(redirectURI string, allowedRedirectURIs []string) error {
+	if len(allowedRedirectURIs) == 0 {
+		return nil
+	}
+	for _, allowed := range allowedRedirectURIs {
+		if redirectURI == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("login callback URI %q derived from --base-address is not one of --auth-allowed-redirect-uris %q", redirectURI, allowedRedirectURIs)
+}
+
+// validateErrorRedirect only accepts error redirects to the console host or
+// one of the allowed hosts, so that a typo can't send users and the request
+// IDs of their failed logins to an unrelated site.
+func validateErrorRedirect(baseURL, errorRedirect *url.URL, allowedHosts []string) error {
+	if errorRedirect == nil {
+		return nil
+	}
+
+	target := baseURL.ResolveReference(errorRedirect)
+	if target.Scheme != "https" && target.Scheme != "http" {
+		return flags.NewInvalidFlagError("user-auth-error-redirect", "must be an http or https URL or a path, got %q", errorRedirect.String())
+	}
+	if strings.EqualFold(target.Host, baseURL.Host) {
+		return nil
+	}
+	for _, host := range allowedHosts {
+		if strings.EqualFold(target.Host, host) || strings.EqualFold(target.Hostname(), host) {
+			return nil
+		}
+	}
+	return flags.NewInvalidFlagError("user-auth-error-redirect", "host of %q is not the host of --base-address %q or one of --user-auth-error-redirect-allowed-hosts", errorRedirect.String(), baseURL.String())
+}
+
+// validateLogoutRedirect refuses logout redirects to a console page, which
+// requires a login and would log the user right back in.
+func validateLogoutRedirect(baseURL, logoutRedirect *url.URL) error {
+	if logoutRedirect == nil {
+		return nil
+	}
+
+	target := baseURL.ResolveReference(logoutRedirect)
+	if target.Scheme != baseURL.Scheme || target.Host != baseURL.Host {
+		return nil
+	}
+
+	basePath := strings.TrimSuffix(baseURL.Path, "/") + "/"
+	if target.Path+"/" == basePath || strings.HasPrefix(target.Path, basePath) {
+		return fmt.Errorf("--user-auth-logout-redirect %q points to a console page, which requires a login and logs the user right back in", logoutRedirect.String())
+	}
+	return nil
+}
+
 func (c *completedOptions) getAuthenticator(
+	ctx context.Context,
 	baseURL *url.URL,
 	k8sEndpoint *url.URL,
 	pubAPIServerEndpoint string,
 	caCertFilePath string,
 	k8sTransport http.RoundTripper,
+	authMetrics *auth.Metrics,
 ) (*auth.Authenticator, error) {
 
 	if c.AuthType == "disabled" {
@@ -206,21 +1572,31 @@ func (c *completedOptions) getAuthenticator(
 		return nil, nil
 	}
 
-	flags.FatalIfFailed(flags.ValidateFlagNotEmpty("base-address", baseURL.String()))
-
 	var (
 		err                      error
 		userAuthOIDCIssuerURL    *url.URL
-		authLoginErrorEndpoint   = proxy.SingleJoiningSlash(baseURL.String(), server.AuthLoginErrorEndpoint)
-		authLoginSuccessEndpoint = proxy.SingleJoiningSlash(baseURL.String(), server.AuthLoginSuccessEndpoint)
+		authLoginErrorEndpoint   = proxy.SingleJoiningSlash(baseURL.String(), c.AuthPaths.Error)
+		authLoginSuccessEndpoint = proxy.SingleJoiningSlash(baseURL.String(), c.AuthPaths.Success)
 		oidcClientSecret         = c.ClientSecret
 		// Abstraction leak required by NewAuthenticator. We only want the browser to send the auth token for paths starting with basePath/api.
 		cookiePath       = proxy.SingleJoiningSlash(baseURL.Path, "/api/")
 		refererPath      = baseURL.String()
-		useSecureCookies = baseURL.Scheme == "https"
+		useSecureCookies = secureCookiesEnabled(baseURL, c.SecureCookies)
 	)
 
-	scopes := []string{"openid", "email", "profile", "groups"}
+	if len(c.CookiePath) > 0 {
+		cookiePath = c.CookiePath
+	}
+
+	if len(c.PostLoginRedirectPath) > 0 {
+		authLoginSuccessEndpoint = (&url.URL{Scheme: baseURL.Scheme, Host: baseURL.Host}).String() + c.PostLoginRedirectPath
+	}
+
+	if c.ErrorRedirectURL != nil {
+		authLoginErrorEndpoint = baseURL.ResolveReference(c.ErrorRedirectURL).String()
+	}
+
+	var scopes []string
 	authSource := auth.AuthSourceTectonic
 
 	if c.AuthType == "openshift" {
@@ -234,20 +1610,68 @@ func (c *completedOptions) getAuthenticator(
 		userAuthOIDCIssuerURL = k8sEndpoint
 	} else {
 		userAuthOIDCIssuerURL = c.IssuerURL
-
+		scopes = c.oidcScopes()
+		if len(c.IssuerOverride) > 0 {
+			klog.Warningf("OIDC ISSUER OVERRIDE IN USE: ID tokens issued by %q are accepted for the provider at %q", c.IssuerOverride, c.IssuerURL.String())
+		}
+		if c.AllowIdPInitiatedLogin {
+			klog.Warningf("IDP-INITIATED LOGIN ALLOWED: login callbacks without a state cookie are accepted, they are only protected against replay by the ID token nonce")
+		}
+		if c.NoncePolicy == auth.NoncePolicyDisabled {
+			klog.Warningf("OIDC NONCE CHECK DISABLED: ID tokens are not bound to the login they were issued for, which makes a stolen ID token easier to replay")
+		}
 	}
 
 	oidcClientSecret = c.ClientSecret
 
+	var sessionStore auth.SessionStore
+	if c.SessionStore == "redis" {
+		if sessionStore, err = newRedisSessionStore(ctx, c.SessionStoreRedisURL); err != nil {
+			return nil, err
+		}
+	}
+
 	// Config for logging into console.
 	oidcClientConfig := &auth.Config{
-		AuthSource:   authSource,
-		IssuerURL:    userAuthOIDCIssuerURL.String(),
-		IssuerCA:     c.CAFilePath,
-		ClientID:     c.ClientID,
-		ClientSecret: oidcClientSecret,
-		RedirectURL:  proxy.SingleJoiningSlash(baseURL.String(), server.AuthLoginCallbackEndpoint),
-		Scope:        scopes,
+		AuthSource:       authSource,
+		IssuerURL:        userAuthOIDCIssuerURL.String(),
+		IssuerOverride:   c.IssuerOverride,
+		IssuerCA:         c.CAFilePath,
+		ClientID:         c.ClientID,
+		ClientSecret:     oidcClientSecret,
+		ClientCertFile:   c.ClientCertFile,
+		ClientKeyFile:    c.ClientKeyFile,
+		RedirectURL:      proxy.SingleJoiningSlash(baseURL.String(), c.AuthPaths.Callback),
+		Scope:            scopes,
+		AllowedIssuers:   c.AllowedIssuers,
+		SigningAlgs:      c.SupportedSigningAlgs,
+		ExtraAudiences:   c.ExtraAudiences,
+		IdentityClaim:    c.IdentityClaim,
+		ClockSkew:        c.ClockSkew,
+		MaxAge:           c.MaxAge,
+		ResponseMode:     c.ResponseMode,
+		NoncePolicy:      c.NoncePolicy,
+		LoginHint:        c.LoginHint,
+		LoginHintDomains: c.LoginHintDomains,
+
+		CallbackMaxBodyBytes: int64(c.CallbackMaxBodyBytes),
+		CallbackReadTimeout:  c.CallbackReadTimeout,
+
+		AllowIdPInitiatedLogin: c.AllowIdPInitiatedLogin,
+		SilentRenew:            c.SilentRenew,
+		DisableGroups:          c.DisableGroups,
+		MaxGroups:              c.MaxGroups,
+		GroupsOverflowPolicy:   c.GroupsOverflowPolicy,
+		RequireVerifiedEmail:   c.RequireVerifiedEmail,
+
+		UserAgent: c.OutboundUserAgent,
+
+		AuditLogFile: c.AuditLogFile,
+
+		EmbeddedHeader:   c.EmbeddedHeader,
+		EmbeddedOrigins:  c.EmbeddedOrigins,
+		RequiredGroups:   c.RequiredGroups,
+		RequireAllGroups: c.RequireAllGroups,
 
 		// Use the k8s CA file for OpenShift OAuth metadata discovery.
 		// This might be different than IssuerCA.
@@ -256,17 +1680,40 @@ func (c *completedOptions) getAuthenticator(
 		ErrorURL:   authLoginErrorEndpoint,
 		SuccessURL: authLoginSuccessEndpoint,
 
-		CookiePath:    cookiePath,
-		RefererPath:   refererPath,
-		SecureCookies: useSecureCookies,
+		CookiePath:     cookiePath,
+		CookieDomain:   c.CookieDomain,
+		RefererPath:    refererPath,
+		SecureCookies:  useSecureCookies,
+		StateCookieTTL: c.OAuthStateTTL,
+
+		SessionCookieMaxChunks: c.SessionCookieMaxChunks,
+
+		IssuerCertExpiryWarning: c.IssuerCertExpiryWarning,
+		CredentialCheckInterval: c.CredentialCheckInterval,
+		DiscoveryCacheFile:      c.DiscoveryCacheFile,
+		DiscoveryCacheTTL:       c.DiscoveryCacheTTL,
+		UnhealthyThreshold:      c.UnhealthyThreshold,
+		FollowTokenExpiry:       c.FollowTokenExpiry,
+		TrackActiveSessions:     c.TrackActiveSessions,
+
+		StoreRefreshToken:     c.StoreRefreshToken,
+		RefreshTokenKey:       c.RefreshTokenKey,
+		TokenRefreshLeadTime:  c.TokenRefreshLeadTime,
+		OnMissingRefreshToken: c.OnMissingRefreshToken,
+		MaxSessionLifetime:    c.MaxSessionLifetime,
+		SingleSessionPerUser:  c.SingleSessionPerUser,
+
+		SessionStore:              sessionStore,
+		SessionStoreFailurePolicy: c.SessionStoreFailurePolicy,
 
 		K8sConfig: &rest.Config{
 			Host:      pubAPIServerEndpoint,
 			Transport: k8sTransport,
 		},
+		Metrics: authMetrics,
 	}
 
-	authenticator, err := auth.NewAuthenticator(context.Background(), oidcClientConfig)
+	authenticator, err := auth.NewAuthenticator(ctx, oidcClientConfig)
 	if err != nil {
 		klog.Fatalf("Error initializing authenticator: %v", err)
 	}
@@ -274,8 +1721,40 @@ func (c *completedOptions) getAuthenticator(
 	return authenticator, nil
 }
 
-func setIfUnset(flagVal *string, val string) {
-	if len(*flagVal) == 0 {
-		*flagVal = val
+// newRedisSessionStore connects to the Redis server, failing if it can't be
+// reached so that logins don't fail later on.
+func newRedisSessionStore(ctx context.Context, redisURL *url.URL) (auth.SessionStore, error) {
+	opts, err := redis.ParseURL(redisURL.String())
+	if err != nil {
+		return nil, err
 	}
+	client := redis.NewClient(opts)
+
+	pingCtx, cancel := context.WithTimeout(ctx, redisPingTimeout)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to the redis session store %s: %w", redisURL.Redacted(), err)
+	}
+
+	klog.Infof("Keeping sessions in redis at %s", redisURL.Redacted())
+	return auth.NewRedisSessionStore(client), nil
+}
+
+// setIfUnset applies val unless the flag was set to a value that isn't blank.
+// The default of a flag that wasn't set is replaced by a non-blank val.
+func setIfUnset(flagVal *string, flagSet bool, val string) {
+	if flagSet && !isUnset(*flagVal) {
+		return
+	}
+	if !flagSet && isUnset(val) {
+		return
+	}
+	*flagVal = val
+}
+
+// isUnset treats whitespace-only values as unset, templated config sometimes
+// renders an empty field as a single space.
+func isUnset(val string) bool {
+	return len(strings.TrimSpace(val)) == 0
 }
@@ -0,0 +1,1088 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/serverconfig"
+)
+
+func TestIssuerCAWarnings(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      AuthOptions
+		wantWarnings int
+	}{
+		{
+			name:         "openshift without CA file",
+			options:      AuthOptions{AuthType: "openshift"},
+			wantWarnings: 0,
+		},
+		{
+			name:         "openshift with CA file",
+			options:      AuthOptions{AuthType: "openshift", CAFilePath: "/etc/ca.crt"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "disabled with CA file",
+			options:      AuthOptions{AuthType: "disabled", CAFilePath: "/etc/ca.crt"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "oidc http issuer with CA file",
+			options:      AuthOptions{AuthType: "oidc", IssuerURL: "http://idp.example.com", CAFilePath: "/etc/ca.crt"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "oidc https issuer with CA file",
+			options:      AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.svc", CAFilePath: "/etc/ca.crt"},
+			wantWarnings: 0,
+		},
+		{
+			name:         "oidc public https issuer without CA file",
+			options:      AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com"},
+			wantWarnings: 0,
+		},
+		{
+			name:         "oidc in-cluster https issuer without CA file",
+			options:      AuthOptions{AuthType: "oidc", IssuerURL: "https://keycloak.sso.svc:8443"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "oidc private IP https issuer without CA file",
+			options:      AuthOptions{AuthType: "oidc", IssuerURL: "https://10.0.0.12/realms/console"},
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := tt.options.issuerCAWarnings()
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got %d: %v", tt.wantWarnings, len(warnings), warnings)
+			}
+		})
+	}
+}
+
+func TestValidateWarnings(t *testing.T) {
+	options := AuthOptions{
+		AuthType:      "disabled",
+		CAFilePath:    "/etc/ca.crt",
+		OAuthStateTTL: 30 * time.Minute,
+		ResponseMode:  "form_post",
+	}
+
+	warnings, errs := splitValidationWarnings(options.Validate("service-account", nil))
+	if len(warnings) != 2 {
+		t.Errorf("expected 2 warnings, got %d: %v", len(warnings), warnings)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	for _, err := range errs {
+		if IsValidationWarning(err) {
+			t.Errorf("expected %q not to be a warning", err)
+		}
+	}
+}
+
+func TestValidateAuthPaths(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      AuthOptions
+		wantErr      bool
+		wantWarnings int
+	}{
+		{name: "defaults", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", CallbackPath: "/auth/callback"}},
+		{name: "custom login paths", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", LoginPath: "/sso/login", ErrorPath: "/sso/error", SuccessPath: "/dashboards"}},
+		{name: "custom callback path", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", CallbackPath: "/sso/callback"}, wantWarnings: 1},
+		{name: "custom callback path without auth", options: AuthOptions{AuthType: "disabled", CallbackPath: "/sso/callback"}},
+		{name: "relative path", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", ErrorPath: "sso/error"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got: %v", tt.wantWarnings, warnings)
+			}
+		})
+	}
+}
+
+func TestValidateOAuthStateTTL(t *testing.T) {
+	tests := []struct {
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{ttl: 0, wantErr: false},
+		{ttl: 30 * time.Second, wantErr: true},
+		{ttl: time.Minute, wantErr: false},
+		{ttl: 15 * time.Minute, wantErr: false},
+		{ttl: 30 * time.Minute, wantErr: false},
+		{ttl: time.Hour, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ttl.String(), func(t *testing.T) {
+			options := AuthOptions{AuthType: "disabled", OAuthStateTTL: tt.ttl}
+			_, errs := splitValidationWarnings(options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateClockSkew(t *testing.T) {
+	tests := []struct {
+		skew    time.Duration
+		wantErr bool
+	}{
+		{skew: -time.Second, wantErr: true},
+		{skew: 0, wantErr: false},
+		{skew: 2 * time.Second, wantErr: false},
+		{skew: 5 * time.Minute, wantErr: false},
+		{skew: 5*time.Minute + time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.skew.String(), func(t *testing.T) {
+			options := AuthOptions{AuthType: "disabled", ClockSkew: tt.skew}
+			_, errs := splitValidationWarnings(options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateAllowedIssuers(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "unset", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret"}, wantErr: false},
+		{name: "contains the issuer", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", AllowedIssuers: "https://idp.example.com, https://idp2.example.com"}, wantErr: false},
+		{name: "missing the issuer", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", AllowedIssuers: "https://idp2.example.com"}, wantErr: true},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", AllowedIssuers: "https://idp.example.com"}, wantErr: true},
+		{name: "only separators", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", ExtraAudiences: " , "}, wantErr: true},
+		{name: "issuer override", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.internal", IssuerOverride: "https://idp.example.com", ClientID: "console", ClientSecret: "secret"}, wantErr: false},
+		{name: "contains the issuer override", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.internal", IssuerOverride: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", AllowedIssuers: "https://idp.example.com"}, wantErr: false},
+		{name: "missing the issuer override", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.internal", IssuerOverride: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", AllowedIssuers: "https://idp.internal"}, wantErr: true},
+		{name: "relative issuer override", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.internal", IssuerOverride: "idp.example.com", ClientID: "console", ClientSecret: "secret"}, wantErr: true},
+		{name: "openshift issuer override", options: AuthOptions{AuthType: "openshift", IssuerOverride: "https://idp.example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateRequiredGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "oidc", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", RequiredGroups: "admins"}, wantErr: false},
+		{name: "openshift all", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", RequiredGroups: "admins,operators", RequiredGroupsMode: "all"}, wantErr: false},
+		{name: "disabled", options: AuthOptions{AuthType: "disabled", RequiredGroups: "admins"}, wantErr: true},
+		{name: "unknown mode", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", RequiredGroups: "admins", RequiredGroupsMode: "some"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "default", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret"}, wantErr: false},
+		{name: "with openid", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", Scopes: "openid, email"}, wantErr: false},
+		{name: "without openid", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", Scopes: "email,profile"}, wantErr: true},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", Scopes: "openid"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateSessionStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "memory", options: AuthOptions{AuthType: "disabled", SessionStore: "memory"}, wantErr: false},
+		{name: "memory with redis URL", options: AuthOptions{AuthType: "disabled", SessionStore: "memory", SessionStoreRedisURL: "redis://redis:6379"}, wantErr: true},
+		{name: "redis", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionStore: "redis", SessionStoreRedisURL: "rediss://redis:6379/0"}, wantErr: false},
+		{name: "redis without URL", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionStore: "redis"}, wantErr: true},
+		{name: "redis failing open", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionStore: "redis", SessionStoreRedisURL: "rediss://redis:6379/0", SessionStoreFailurePolicy: "fail-open-readonly"}, wantErr: false},
+		{name: "memory failing open", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionStore: "memory", SessionStoreFailurePolicy: "fail-open-readonly"}, wantErr: true},
+		{name: "unknown failure policy", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionStore: "redis", SessionStoreRedisURL: "rediss://redis:6379/0", SessionStoreFailurePolicy: "fail-open"}, wantErr: true},
+		{name: "redis with invalid URL", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionStore: "redis", SessionStoreRedisURL: "http://redis:6379"}, wantErr: true},
+		{name: "redis with openshift", options: AuthOptions{AuthType: "openshift", SessionStore: "redis", SessionStoreRedisURL: "redis://redis:6379"}, wantErr: true},
+		{name: "unknown", options: AuthOptions{AuthType: "disabled", SessionStore: "etcd"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateResponseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "unset", options: AuthOptions{AuthType: "disabled"}, wantErr: false},
+		{name: "oidc query", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", ResponseMode: "query"}, wantErr: false},
+		{name: "oidc form_post", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", ResponseMode: "form_post"}, wantErr: false},
+		{name: "oidc unknown mode", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", ResponseMode: "fragment"}, wantErr: true},
+		{name: "openshift form_post", options: AuthOptions{AuthType: "openshift", ResponseMode: "form_post"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateSessionCookieMaxChunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "unset", options: AuthOptions{AuthType: "disabled"}, wantErr: false},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", SessionCookieMaxChunks: 4}, wantErr: false},
+		{name: "openshift too many", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", SessionCookieMaxChunks: 9}, wantErr: true},
+		{name: "negative", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", SessionCookieMaxChunks: -1}, wantErr: true},
+		{name: "oidc", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionCookieMaxChunks: 2}, wantErr: true},
+		{name: "oidc default", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionCookieMaxChunks: 1}, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateAllowIdPInitiatedLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "oidc", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", AllowIdPInitiatedLogin: true}, wantErr: false},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", AllowIdPInitiatedLogin: true}, wantErr: true},
+		{name: "disabled", options: AuthOptions{AuthType: "disabled", AllowIdPInitiatedLogin: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateSilentRenew(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "oidc", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SilentRenew: true}, wantErr: false},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", SilentRenew: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateSupportedSigningAlgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "supported", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SupportedSigningAlgs: "ES256, PS256"}, wantErr: false},
+		{name: "none", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SupportedSigningAlgs: "ES256,none"}, wantErr: true},
+		{name: "unsupported", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SupportedSigningAlgs: "HS256"}, wantErr: true},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", SupportedSigningAlgs: "ES256"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidatePostLoginRedirectPath(t *testing.T) {
+	baseURL := &url.URL{Scheme: "https", Host: "console.example.com", Path: "/console/"}
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "/console/k8s/cluster/dashboards", wantErr: false},
+		{path: "/console/search?kind=Pod", wantErr: false},
+		{path: "/console", wantErr: false},
+		{path: "/other/dashboards", wantErr: true},
+		{path: "/console/../other", wantErr: true},
+		{path: "/consoleother", wantErr: true},
+		{path: "console/dashboards", wantErr: true},
+		{path: "//evil.example.com/console/", wantErr: true},
+		{path: "https://evil.example.com/console/", wantErr: true},
+		{path: "/console/\\evil.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := validatePostLoginRedirectPath(baseURL, tt.path)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDisableGroups(t *testing.T) {
+	oidc := func(o AuthOptions) AuthOptions {
+		o.AuthType, o.IssuerURL, o.ClientID, o.ClientSecret = "oidc", "https://idp.example.com", "console", "secret"
+		o.DisableGroups = true
+		return o
+	}
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "oidc", options: oidc(AuthOptions{}), wantErr: false},
+		{name: "scopes without groups", options: oidc(AuthOptions{Scopes: "openid,email"}), wantErr: false},
+		{name: "scopes with groups", options: oidc(AuthOptions{Scopes: "openid,groups"}), wantErr: true},
+		{name: "required groups", options: oidc(AuthOptions{RequiredGroups: "admins"}), wantErr: true},
+		{name: "session admin group", options: oidc(AuthOptions{SessionAdminGroup: "admins"}), wantErr: true},
+		{name: "provider admin group", options: oidc(AuthOptions{ProviderAdminGroup: "admins"}), wantErr: true},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", DisableGroups: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+
+	want := []string{"openid", "email", "profile"}
+	if got := (&completedOptions{DisableGroups: true}).oidcScopes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong default scopes without groups, want %q, got %q", want, got)
+	}
+}
+
+func TestValidateRequireVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "oidc", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", RequireVerifiedEmail: true}, wantErr: false},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", RequireVerifiedEmail: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateNoncePolicy(t *testing.T) {
+	oidc := func(policy string) AuthOptions {
+		return AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", NoncePolicy: policy}
+	}
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "required", options: oidc("required"), wantErr: false},
+		{name: "optional", options: oidc("optional"), wantErr: false},
+		{name: "disabled", options: oidc("disabled"), wantErr: false},
+		{name: "unknown", options: oidc("lenient"), wantErr: true},
+		{name: "default with openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", NoncePolicy: "required"}, wantErr: false},
+		{name: "optional with openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", NoncePolicy: "optional"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRefreshLeadTime(t *testing.T) {
+	oidc := func(storeRefreshToken bool, leadTime time.Duration) AuthOptions {
+		return AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionStore: "memory", SessionFollowTokenExpiry: true, StoreRefreshToken: storeRefreshToken, TokenRefreshLeadTime: leadTime}
+	}
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "default", options: oidc(false, 0), wantErr: false},
+		{name: "with stored refresh tokens", options: oidc(true, 2*time.Minute), wantErr: false},
+		{name: "without stored refresh tokens", options: oidc(false, 2*time.Minute), wantErr: true},
+		{name: "negative", options: oidc(true, -time.Minute), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateOnMissingRefreshToken(t *testing.T) {
+	oidc := func(storeRefreshToken bool, policy string) AuthOptions {
+		return AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", SessionStore: "memory", SessionFollowTokenExpiry: true, StoreRefreshToken: storeRefreshToken, OnMissingRefreshToken: policy}
+	}
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "default", options: oidc(false, "warn"), wantErr: false},
+		{name: "force-consent", options: oidc(true, "force-consent"), wantErr: false},
+		{name: "error", options: oidc(true, "error"), wantErr: false},
+		{name: "without stored refresh tokens", options: oidc(false, "error"), wantErr: true},
+		{name: "unknown policy", options: oidc(true, "ignore"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateMaxSessionLifetime(t *testing.T) {
+	oidc := func(lifetime time.Duration, inactivityTimeoutSeconds int) AuthOptions {
+		return AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", MaxSessionLifetime: lifetime, InactivityTimeoutSeconds: inactivityTimeoutSeconds}
+	}
+	tests := []struct {
+		name         string
+		options      AuthOptions
+		wantErr      bool
+		wantWarnings int
+	}{
+		{name: "default", options: oidc(0, 0)},
+		{name: "lifetime", options: oidc(8*time.Hour, 0)},
+		{name: "shorter inactivity timeout", options: oidc(8*time.Hour, 1800)},
+		{name: "inactivity timeout as long as the lifetime", options: oidc(time.Hour, 3600), wantWarnings: 1},
+		{name: "negative", options: oidc(-time.Hour, 0), wantErr: true},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", MaxSessionLifetime: 8 * time.Hour}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, errs := splitValidationWarnings(tt.options.Validate("oidc", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got: %v", tt.wantWarnings, warnings)
+			}
+		})
+	}
+}
+
+func TestValidateMaxGroups(t *testing.T) {
+	oidc := func(maxGroups int, policy string) AuthOptions {
+		return AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", MaxGroups: maxGroups, GroupsOverflowPolicy: policy}
+	}
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "default", options: oidc(0, "truncate"), wantErr: false},
+		{name: "truncate", options: oidc(100, "truncate"), wantErr: false},
+		{name: "reject", options: oidc(100, "reject"), wantErr: false},
+		{name: "reject without a limit", options: oidc(0, "reject"), wantErr: true},
+		{name: "unknown policy", options: oidc(100, "drop"), wantErr: true},
+		{name: "negative", options: oidc(-1, "truncate"), wantErr: true},
+		{name: "with disabled groups", options: AuthOptions{AuthType: "oidc", IssuerURL: "https://idp.example.com", ClientID: "console", ClientSecret: "secret", MaxGroups: 100, DisableGroups: true}, wantErr: true},
+		{name: "with openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientSecret: "secret", MaxGroups: 100}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestSetIfUnset(t *testing.T) {
+	tests := []struct {
+		name    string
+		flagVal string
+		flagSet bool
+		val     string
+		want    string
+	}{
+		{name: "empty flag", flagVal: "", flagSet: true, val: "config", want: "config"},
+		{name: "whitespace-only flag", flagVal: " ", flagSet: true, val: "config", want: "config"},
+		{name: "tabs and newlines flag", flagVal: "\t\n", flagSet: true, val: "config", want: "config"},
+		{name: "padded flag is kept as is", flagVal: " flag ", flagSet: true, val: "config", want: " flag "},
+		{name: "flag with internal spaces is kept", flagVal: "my flag", flagSet: true, val: "config", want: "my flag"},
+		{name: "empty flag and config", flagVal: "", flagSet: true, val: "", want: ""},
+		{name: "default is replaced by config", flagVal: "default", val: "config", want: "config"},
+		{name: "default is kept without config", flagVal: "default", val: " ", want: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flagVal := tt.flagVal
+			setIfUnset(&flagVal, tt.flagSet, tt.val)
+			if flagVal != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, flagVal)
+			}
+		})
+	}
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	var logged []string
+	logPrecedencef = func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	defer func() { logPrecedencef = klog.Infof }()
+
+	c := &AuthOptions{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.AddFlags(fs)
+	if err := fs.Parse([]string{"--log-config-precedence", "--user-auth-oidc-client-id=flag-client", "--user-auth-oidc-ca-file=/flag/ca.crt"}); err != nil {
+		t.Fatal(err)
+	}
+	// A non-empty default isn't a flag that was set.
+	c.LogoutRedirect = "https://default.example.com/logout"
+
+	c.ApplyConfig(fs, &serverconfig.Auth{
+		ClientID:         "config-client",
+		ClientSecretFile: "/config/secret",
+		LogoutRedirect:   "https://config.example.com/logout",
+	})
+
+	for _, tt := range []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "flag overrides config", got: c.ClientID, want: "flag-client"},
+		{name: "config", got: c.ClientSecretFilePath, want: "/config/secret"},
+		{name: "flag without config", got: c.CAFilePath, want: "/flag/ca.crt"},
+		{name: "config overrides default", got: c.LogoutRedirect, want: "https://config.example.com/logout"},
+		{name: "default", got: c.Scopes, want: ""},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: want: %q, got: %q", tt.name, tt.want, tt.got)
+		}
+	}
+
+	want := []string{
+		"config precedence: --user-auth-oidc-client-id overrides config file value auth.clientID",
+		"config precedence: --user-auth-oidc-client-secret-file is set by config file value auth.clientSecretFile",
+		"config precedence: --user-auth-oidc-ca-file is set by flag",
+		"config precedence: --user-auth-logout-redirect is set by config file value auth.logoutRedirect",
+		"config precedence: --user-auth-oidc-scopes is not set, using its default",
+		"config precedence: --inactivity-timeout is not set, using its default",
+	}
+	if !reflect.DeepEqual(logged, want) {
+		t.Errorf("want:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(logged, "\n"))
+	}
+}
+
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	issuer, _ := url.Parse("https://idp.example.com")
+	c := &completedOptions{
+		AuthType:     "oidc",
+		IssuerURL:    issuer,
+		ClientID:     "console",
+		ClientSecret: "s3cr3t",
+	}
+
+	var out bytes.Buffer
+	if err := c.PrintConfig(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("expected the client secret to be redacted, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "clientSecret: <redacted>") {
+		t.Errorf("expected a redacted client secret, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "issuerURL: https://idp.example.com") {
+		t.Errorf("expected the issuer URL, got:\n%s", out.String())
+	}
+}
+
+func TestValidateSecureCookies(t *testing.T) {
+	tests := []struct {
+		baseAddress   string
+		secureCookies bool
+		wantErr       bool
+	}{
+		{baseAddress: "https://console.example.com", secureCookies: true, wantErr: false},
+		{baseAddress: "https://console.example.com", secureCookies: false, wantErr: true},
+		{baseAddress: "http://localhost:9000", secureCookies: false, wantErr: false},
+		{baseAddress: "http://localhost:9000", secureCookies: true, wantErr: false},
+		{baseAddress: "http://127.0.0.1:9000", secureCookies: true, wantErr: false},
+		{baseAddress: "http://console.example.com", secureCookies: false, wantErr: false},
+		{baseAddress: "http://console.example.com", secureCookies: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		baseURL, err := url.Parse(tt.baseAddress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateSecureCookies(baseURL, tt.secureCookies)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s, secure cookies %v: expected error: %v, got: %v", tt.baseAddress, tt.secureCookies, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateSecureCookiesFlag(t *testing.T) {
+	for value, wantErr := range map[string]bool{"": false, "true": false, "false": false, "yes": true} {
+		options := AuthOptions{AuthType: "disabled", SecureCookies: value}
+		_, errs := splitValidationWarnings(options.Validate("service-account", nil))
+		if gotErr := len(errs) > 0; gotErr != wantErr {
+			t.Errorf("--secure-cookies=%q: expected error: %v, got: %v", value, wantErr, errs)
+		}
+	}
+}
+
+func TestValidateCookieDomain(t *testing.T) {
+	tests := []struct {
+		baseAddress  string
+		cookieDomain string
+		wantErr      bool
+	}{
+		{baseAddress: "https://console.example.com", cookieDomain: "", wantErr: false},
+		{baseAddress: "https://console.example.com", cookieDomain: "console.example.com", wantErr: false},
+		{baseAddress: "https://app.console.example.com:8443", cookieDomain: ".console.example.com", wantErr: false},
+		{baseAddress: "https://app.console.example.com", cookieDomain: "Example.com", wantErr: false},
+		{baseAddress: "https://console.example.com", cookieDomain: "other.example.com", wantErr: true},
+		{baseAddress: "https://console.example.com", cookieDomain: "le.com", wantErr: true},
+		{baseAddress: "https://console.example.com", cookieDomain: "com", wantErr: true},
+		{baseAddress: "https://10.0.0.12", cookieDomain: "0.0.12", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		baseURL, err := url.Parse(tt.baseAddress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateCookieDomain(baseURL, tt.cookieDomain)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s, cookie domain %q: expected error: %v, got: %v", tt.baseAddress, tt.cookieDomain, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateCookiePath(t *testing.T) {
+	tests := []struct {
+		baseAddress string
+		cookiePath  string
+		wantErr     bool
+	}{
+		{baseAddress: "https://console.example.com", cookiePath: "/", wantErr: false},
+		{baseAddress: "https://example.com/console/", cookiePath: "/", wantErr: false},
+		{baseAddress: "https://example.com/console/", cookiePath: "/console", wantErr: false},
+		{baseAddress: "https://example.com/console", cookiePath: "/console/api/", wantErr: false},
+		{baseAddress: "https://example.com/console/", cookiePath: "/other/", wantErr: true},
+		{baseAddress: "https://example.com/console/", cookiePath: "/con", wantErr: true},
+		{baseAddress: "https://example.com/console/", cookiePath: "/consoles/api/", wantErr: true},
+		{baseAddress: "https://example.com/console/", cookiePath: "console/", wantErr: true},
+		{baseAddress: "https://example.com/console/", cookiePath: "/console;Domain=example.org", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		baseURL, err := url.Parse(tt.baseAddress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateCookiePath(baseURL, tt.cookiePath)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s, cookie path %q: expected error: %v, got: %v", tt.baseAddress, tt.cookiePath, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateLogoutRedirect(t *testing.T) {
+	tests := []struct {
+		baseAddress    string
+		logoutRedirect string
+		wantErr        bool
+	}{
+		{baseAddress: "https://console.example.com", logoutRedirect: "https://sso.example.com/logout", wantErr: false},
+		{baseAddress: "https://console.example.com", logoutRedirect: "https://console.example.com", wantErr: true},
+		{baseAddress: "https://console.example.com", logoutRedirect: "https://console.example.com/k8s/cluster/projects", wantErr: true},
+		{baseAddress: "https://console.example.com", logoutRedirect: "/dashboards", wantErr: true},
+		{baseAddress: "https://console.example.com", logoutRedirect: "http://console.example.com/", wantErr: false},
+		{baseAddress: "https://example.com/console/", logoutRedirect: "https://example.com/console", wantErr: true},
+		{baseAddress: "https://example.com/console/", logoutRedirect: "https://example.com/goodbye.html", wantErr: false},
+		{baseAddress: "https://example.com/console/", logoutRedirect: "https://example.com/consoles", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		baseURL, err := url.Parse(tt.baseAddress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logoutRedirect, err := url.Parse(tt.logoutRedirect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateLogoutRedirect(baseURL, logoutRedirect)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s, logout redirect %s: expected error: %v, got: %v", tt.baseAddress, tt.logoutRedirect, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		redirectURI string
+		allowed     []string
+		wantErr     bool
+	}{
+		{redirectURI: "https://console.example.com/auth/callback", allowed: nil, wantErr: false},
+		{redirectURI: "https://console.example.com/auth/callback", allowed: []string{"https://console.example.com/auth/callback"}, wantErr: false},
+		{redirectURI: "https://console.example.com/auth/callback", allowed: []string{"https://console.internal/auth/callback", "https://console.example.com/auth/callback"}, wantErr: false},
+		{redirectURI: "http://console.example.com/auth/callback", allowed: []string{"https://console.example.com/auth/callback"}, wantErr: true},
+		{redirectURI: "https://console.example.com/console/auth/callback", allowed: []string{"https://console.example.com/auth/callback"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := validateRedirectURI(tt.redirectURI, tt.allowed)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("redirect URI %s, allowed %v: expected error: %v, got: %v", tt.redirectURI, tt.allowed, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateErrorRedirect(t *testing.T) {
+	tests := []struct {
+		errorRedirect string
+		allowedHosts  []string
+		wantErr       bool
+	}{
+		{errorRedirect: "/help/login-failed", wantErr: false},
+		{errorRedirect: "https://console.example.com/help", wantErr: false},
+		{errorRedirect: "https://help.example.com/console?topic=login", wantErr: true},
+		{errorRedirect: "https://help.example.com/console?topic=login", allowedHosts: []string{"help.example.com"}, wantErr: false},
+		{errorRedirect: "https://help.example.com:8443/console", allowedHosts: []string{"help.example.com"}, wantErr: false},
+		{errorRedirect: "https://help.example.com.evil.com/console", allowedHosts: []string{"help.example.com"}, wantErr: true},
+		{errorRedirect: "//evil.com/console", wantErr: true},
+		{errorRedirect: "javascript:alert(1)", wantErr: true},
+	}
+
+	baseURL, err := url.Parse("https://console.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		errorRedirect, err := url.Parse(tt.errorRedirect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateErrorRedirect(baseURL, errorRedirect, tt.allowedHosts)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("error redirect %s, allowed hosts %v: expected error: %v, got: %v", tt.errorRedirect, tt.allowedHosts, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidateEmbeddedOrigins(t *testing.T) {
+	tests := []struct {
+		origins string
+		wantErr bool
+	}{
+		{origins: "", wantErr: false},
+		{origins: "https://portal.example.com", wantErr: false},
+		{origins: "https://portal.example.com, http://localhost:8080", wantErr: false},
+		{origins: "https://portal.example.com/apps", wantErr: true},
+		{origins: "portal.example.com", wantErr: true},
+		{origins: "https://portal.example.com?embedded=true", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origins, func(t *testing.T) {
+			options := AuthOptions{AuthType: "disabled", EmbeddedOrigins: tt.origins}
+			_, errs := splitValidationWarnings(options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCertificate(t, dir, "client")
+	_, otherKeyFile := writeClientCertificate(t, dir, "other")
+
+	oidc := func(o AuthOptions) AuthOptions {
+		o.AuthType = "oidc"
+		o.IssuerURL = "https://idp.example.com"
+		o.ClientID = "console"
+		return o
+	}
+
+	tests := []struct {
+		name    string
+		options AuthOptions
+		wantErr bool
+	}{
+		{name: "certificate", options: oidc(AuthOptions{ClientCertFile: certFile, ClientKeyFile: keyFile}), wantErr: false},
+		{name: "neither secret nor certificate", options: oidc(AuthOptions{}), wantErr: true},
+		{name: "certificate without key", options: oidc(AuthOptions{ClientCertFile: certFile}), wantErr: true},
+		{name: "key without certificate", options: oidc(AuthOptions{ClientSecret: "secret", ClientKeyFile: keyFile}), wantErr: true},
+		{name: "mismatched key", options: oidc(AuthOptions{ClientCertFile: certFile, ClientKeyFile: otherKeyFile}), wantErr: true},
+		{name: "missing file", options: oidc(AuthOptions{ClientCertFile: filepath.Join(dir, "missing.crt"), ClientKeyFile: keyFile}), wantErr: true},
+		{name: "certificate and secret", options: oidc(AuthOptions{ClientSecret: "secret", ClientCertFile: certFile, ClientKeyFile: keyFile}), wantErr: true},
+		{name: "certificate with secret", options: oidc(AuthOptions{ClientSecret: "secret", ClientCertFile: certFile, ClientKeyFile: keyFile, ClientCertWithSecret: true}), wantErr: false},
+		{name: "openshift", options: AuthOptions{AuthType: "openshift", ClientID: "console", ClientCertFile: certFile, ClientKeyFile: keyFile}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := splitValidationWarnings(tt.options.Validate("service-account", nil))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+// writeClientCertificate writes a self-signed certificate and its key to dir.
+func writeClientCertificate(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestPrintCheck(t *testing.T) {
+	options := AuthOptions{
+		AuthType:                 "oidc",
+		ClientSecret:             "secret",
+		InactivityTimeoutSeconds: 60,
+		OAuthStateTTL:            20 * time.Minute,
+	}
+
+	var out bytes.Buffer
+	failed, err := options.PrintCheck(&out, "service-account", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !failed {
+		t.Error("expected the check to fail")
+	}
+
+	want := []string{
+		"error: invalid flag: user-auth-oidc-client-id, error: value is required",
+		"error: --user-auth-oidc-issuer-url must be set if --user-auth=oidc",
+		"warning: invalid flag: inactivity-timeout, error: must be at least 300, not 60, the flag will be ignored",
+		"warning: Flag user-auth-oauth-state-ttl is set to 20m0s, a long lived login state weakens the CSRF protection of the login flow",
+	}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPrintCheckReadsFiles(t *testing.T) {
+	options := AuthOptions{
+		AuthType:             "oidc",
+		IssuerURL:            "https://idp.example.com",
+		ClientID:             "console",
+		ClientSecretFilePath: filepath.Join(t.TempDir(), "missing"),
+	}
+
+	var out bytes.Buffer
+	failed, err := options.PrintCheck(&out, "service-account", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !failed {
+		t.Error("expected the check to fail")
+	}
+	if !strings.HasPrefix(out.String(), "error: ") {
+		t.Errorf("expected an error for the missing client secret file, got %q", out.String())
+	}
+}
+
+func TestValidateBaseAddress(t *testing.T) {
+	tests := []struct {
+		name         string
+		baseAddress  string
+		options      AuthOptions
+		wantErr      bool
+		wantWarnings int
+	}{
+		{name: "valid", baseAddress: "https://console.example.com", options: AuthOptions{CookieDomain: "example.com"}},
+		{name: "missing base address", baseAddress: "", wantErr: true},
+		{name: "missing base address without auth", baseAddress: "", options: AuthOptions{AuthType: "disabled"}},
+		{name: "foreign cookie domain", baseAddress: "https://console.example.com", options: AuthOptions{CookieDomain: "evil.com"}, wantErr: true},
+		{name: "cookie path above the base path", baseAddress: "https://example.com/console/", options: AuthOptions{CookiePath: "/"}},
+		{name: "cookie path of another application", baseAddress: "https://example.com/console/", options: AuthOptions{CookiePath: "/grafana"}, wantErr: true},
+		{name: "http", baseAddress: "http://console.example.com", wantWarnings: 1},
+		{name: "http on localhost", baseAddress: "http://localhost:9000"},
+		{name: "insecure cookies on https", baseAddress: "https://console.example.com", options: AuthOptions{SecureCookies: "false"}, wantErr: true},
+		{name: "secure cookies on http", baseAddress: "http://console.example.com", options: AuthOptions{SecureCookies: "true"}, wantErr: true},
+		{name: "post-login redirect path", baseAddress: "https://example.com/console/", options: AuthOptions{PostLoginRedirectPath: "/console/dashboards"}},
+		{name: "post-login redirect path outside the console", baseAddress: "https://example.com/console/", options: AuthOptions{PostLoginRedirectPath: "/grafana"}, wantErr: true},
+		{name: "embedded on http", baseAddress: "http://console.example.com", options: AuthOptions{EmbeddedOrigins: "https://portal.example.com"}, wantErr: true, wantWarnings: 1},
+		{name: "embedded with secure cookies", baseAddress: "http://localhost:9000", options: AuthOptions{EmbeddedOrigins: "https://portal.example.com", SecureCookies: "true"}},
+		{name: "logout loop", baseAddress: "https://console.example.com", options: AuthOptions{LogoutRedirect: "https://console.example.com/"}, wantWarnings: 1},
+		{name: "rejected logout loop", baseAddress: "https://console.example.com", options: AuthOptions{LogoutRedirect: "https://console.example.com/", RejectLogoutLoops: true}, wantErr: true},
+		{name: "allowed redirect URI", baseAddress: "https://console.example.com/", options: AuthOptions{AllowedRedirectURIs: "https://other.example.com/auth/callback, https://console.example.com/auth/callback"}},
+		{name: "allowed custom callback path", baseAddress: "https://console.example.com", options: AuthOptions{CallbackPath: "/sso/callback", AllowedRedirectURIs: "https://console.example.com/sso/callback"}},
+		{name: "unexpected redirect URI", baseAddress: "https://console.internal", options: AuthOptions{AllowedRedirectURIs: "https://console.example.com/auth/callback"}, wantErr: true},
+		{name: "error redirect to the console host", baseAddress: "https://console.example.com", options: AuthOptions{ErrorRedirect: "/help"}},
+		{name: "error redirect to an allowed host", baseAddress: "https://console.example.com", options: AuthOptions{ErrorRedirect: "https://Help.example.com/login", ErrorRedirectAllowedHosts: "help.example.com"}},
+		{name: "error redirect to another host", baseAddress: "https://console.example.com", options: AuthOptions{ErrorRedirect: "https://evil.com/"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL, err := url.Parse(tt.baseAddress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			warnings, errs := splitValidationWarnings(tt.options.validateBaseAddress(baseURL))
+			if gotErr := len(errs) > 0; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, errs)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got: %v", tt.wantWarnings, warnings)
+			}
+		})
+	}
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"flag"
 	"fmt"
+	"html/template"
 	"runtime"
 
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	authopts "github.com/openshift/console/cmd/bridge/config/auth"
 	"github.com/openshift/console/pkg/auth"
@@ -21,6 +27,7 @@ import (
 	"github.com/openshift/console/pkg/server"
 	"github.com/openshift/console/pkg/serverconfig"
 	oscrypto "github.com/openshift/library-go/pkg/crypto"
+	"golang.org/x/net/http/httpguts"
 
 	"k8s.io/klog"
 )
@@ -55,6 +62,11 @@ const (
 	openshiftClusterProxyHost = "cluster-proxy-addon-user.multicluster-engine.svc:9092"
 
 	clusterManagementURL = "https://api.openshift.com/"
+
+	// Each retry holds back the response to the browser, more than a few are unlikely to help.
+	maxProxyTransientErrorRetries = 5
+	// The proxy holds back responses for at most 5 seconds between retries.
+	maxProxyRetryBackoff = 5 * time.Second
 )
 
 func main() {
@@ -66,12 +78,12 @@ func main() {
 	authOptions.AddFlags(fs)
 
 	// Define commandline / env / config options
-	fs.String("config", "", "The YAML config file.")
+	fs.String("config", "", "The YAML config files separated by comma. Later files override the fields set by earlier ones.")
 
 	fListen := fs.String("listen", "http://0.0.0.0:9000", "")
 
-	fBaseAddress := fs.String("base-address", "", "Format: <http | https>://domainOrIPAddress[:port]. Example: https://openshift.example.com.")
-	fBasePath := fs.String("base-path", "/", "")
+	fBaseAddress := fs.String("base-address", "", "Format: <http | https>://domainOrIPAddress[:port][/path/]. Example: https://openshift.example.com. A path serves the console below it, like --base-path.")
+	fBasePath := fs.String("base-path", "/", "Path the console is served under, starting and ending with slash. Defaults to the path of --base-address, if any.")
 
 	// See https://github.com/openshift/service-serving-cert-signer
 	fServiceCAFile := fs.String("service-ca-file", "", "CA bundle for OpenShift services signed with the service signing certificates.")
@@ -81,17 +93,61 @@ func main() {
 	fK8sModeOffClusterSkipVerifyTLS := fs.Bool("k8s-mode-off-cluster-skip-verify-tls", false, "DEV ONLY. When true, skip verification of certs presented by k8s API server.")
 	fK8sModeOffClusterThanos := fs.String("k8s-mode-off-cluster-thanos", "", "DEV ONLY. URL of the cluster's Thanos server.")
 	fK8sModeOffClusterAlertmanager := fs.String("k8s-mode-off-cluster-alertmanager", "", "DEV ONLY. URL of the cluster's AlertManager server.")
+	fK8sClientCertFile := fs.String("k8s-client-cert-file", "", "PEM client certificate presented by the proxy to an authenticating gateway in front of the Kubernetes API server, at --k8s-mode-off-cluster-endpoint. Requires --k8s-mode=off-cluster, --k8s-public-endpoint set to the API server and --k8s-client-key-file. It is refused for the API server itself, which authenticates requests by their client certificate before their bearer token, so that every user would act as the certificate.")
+	fK8sClientKeyFile := fs.String("k8s-client-key-file", "", "PEM private key of --k8s-client-cert-file.")
+	fK8sAdditionalCAFile := fs.String("k8s-additional-ca-file", "", "PEM file with CAs the proxy trusts for the Kubernetes API server in addition to the CA of --k8s-mode, e.g. for aggregated API servers behind a TLS endpoint signed by another CA. The console's own requests and the authenticator don't use them.")
 
 	fK8sAuth := fs.String("k8s-auth", "service-account", "service-account | bearer-token | oidc | openshift")
 	fK8sAuthBearerToken := fs.String("k8s-auth-bearer-token", "", "Authorization token to send with proxied Kubernetes API requests.")
 
+	fProxyResponseCacheTTL := fs.Duration("proxy-response-cache-ttl", 0, "How long GET responses of the Kubernetes API proxy are cached per user for paths in --proxy-response-cache-paths. Disabled if 0.")
+	fProxyResponseCachePaths := fs.String("proxy-response-cache-paths", "/api,/apis,/apis/apiextensions.k8s.io/v1/customresourcedefinitions", "List of Kubernetes API paths separated by comma whose GET responses may be cached. Paths ending with a slash match all paths below them.")
+	fProxyWebsocketIdleTimeout := fs.Duration("proxy-websocket-idle-timeout", 0, "How long a websocket to the Kubernetes API, e.g. for watches or exec, may go without messages in either direction before the console closes it. Disabled if 0.")
+	fProxyAuthorizationPassthrough := fs.String("proxy-allow-authorization-passthrough", "", "List of Kubernetes API paths separated by comma for which the Authorization bearer token of a request from --proxy-authorization-passthrough-cidrs is forwarded instead of the session token. Paths ending with a slash match all paths below them.")
+	fProxyAuthorizationPassthroughCIDRs := fs.String("proxy-authorization-passthrough-cidrs", "", "List of CIDRs separated by comma of clients allowed to use --proxy-allow-authorization-passthrough.")
+	proxyInjectHeaderFlags := serverconfig.MultiKeyValue{}
+	fs.Var(&proxyInjectHeaderFlags, "proxy-inject-header", "Header set on every request of the Kubernetes API proxy, as a name=value pair. Can be repeated. Authorization, Cookie and Impersonate-* headers can't be set.")
+	fProxyOutboundUserAgent := fs.Bool("proxy-outbound-user-agent", false, "Set the User-Agent header of requests of the Kubernetes API proxy to --outbound-user-agent instead of passing on the one of the browser. A User-Agent set with --proxy-inject-header takes precedence.")
+	fProxyExposeAuditID := fs.Bool("proxy-expose-audit-id", false, "Relay the Audit-ID header of Kubernetes API responses to the browser, to correlate console actions with the API server audit log.")
+	fProxyFlushInterval := fs.Duration("proxy-flush-interval", 100*time.Millisecond, "How often the Kubernetes API proxy flushes streamed responses, like watches and followed logs, to the browser. A negative value flushes after every write.")
+	fProxyRequestTimeout := fs.Duration("proxy-request-timeout", 60*time.Second, "How long the Kubernetes API proxy waits for a request before responding with 504. Websockets, watches and followed logs are not bounded. Disabled if 0.")
+	fEnableResponseCompression := fs.Bool("enable-response-compression", false, "Compress static assets and API responses with gzip for clients accepting it. Images and other already compressed content are left alone.")
+	fResponseCompressionMinSize := fs.Int("response-compression-min-size", 1024, "Size in bytes below which responses aren't compressed with --enable-response-compression.")
+	responseHeaderFlags := serverconfig.MultiKeyValue{}
+	fs.Var(&responseHeaderFlags, "response-header", "Header set on every response of the console, as a name=value pair, e.g. Strict-Transport-Security=max-age=31536000; includeSubDomains. Can be repeated and replaces the default of the header. Hop-by-hop, Authorization and cookie headers can't be set, and values can't contain commas.")
+	fProxyMaxIdleConns := fs.Int("proxy-max-idle-conns", 0, "Maximum number of idle connections the Kubernetes API proxy keeps open. Unlimited if 0.")
+	fProxyMaxIdleConnsPerHost := fs.Int("proxy-max-idle-conns-per-host", 0, "Maximum number of idle connections the Kubernetes API proxy keeps open to the API server. Defaults to 2 if 0.")
+	fProxyIdleConnTimeout := fs.Duration("proxy-idle-conn-timeout", 0, "How long an idle connection of the Kubernetes API proxy is kept open before it is closed. Idle connections are kept open indefinitely if 0.")
+	fProxyTransientErrorRetries := fs.Int("proxy-transient-error-retries", 0, "How many times the Kubernetes API proxy retries GET requests that fail with a transient error reason like Timeout, ServerTimeout or TooManyRequests. Disabled if 0.")
+	fProxyMaxRetries := fs.Int("proxy-max-retries", 0, "How many times the Kubernetes API proxy retries GET and HEAD requests that get a 502, 503 or 504 response, e.g. during an API server leader election. Watches and followed logs aren't retried. Disabled if 0.")
+	fProxyRetryBackoff := fs.Duration("proxy-retry-backoff", 100*time.Millisecond, "How long the Kubernetes API proxy waits before the first retry of --proxy-max-retries, doubled for each further retry. Retries are abandoned if they would exceed the deadline of the request.")
+	fEnableImpersonation := fs.Bool("enable-impersonation", false, "Make Kubernetes API requests with the console service account impersonating the user and groups of the OIDC session, so that the API server audit log attributes them to the user. Impersonation headers sent by clients are ignored. The console service account needs a ClusterRole allowing the impersonate verb on the users and groups resources of the core API group. Requires --user-auth=oidc.")
+	fImpersonationUsernameClaim := fs.String("impersonation-username-claim", "sub", "The ID token claim of the username impersonated with --enable-impersonation. Must match the --oidc-username-claim of the API server, so that the RBAC bindings of the user apply.")
+	fImpersonationUsernamePrefix := fs.String("impersonation-username-prefix", "", "Prefix of the username impersonated with --enable-impersonation. Must match the --oidc-username-prefix of the API server. Like there, defaults to the issuer and \"#\" for claims other than email, \"-\" disables the prefix.")
+
 	fK8sModeOffClusterGitOps := fs.String("k8s-mode-off-cluster-gitops", "", "DEV ONLY. URL of the GitOps backend service")
 
+	fAuthRateLimit := fs.Float64("auth-rate-limit", 0, "Requests per second each client IP may make to the login and login callback endpoints. Clients over the limit get a 429 response. Disabled if 0.")
+	fAuthRateLimitBurst := fs.Int("auth-rate-limit-burst", 10, "Number of login and login callback requests a client IP may make at once, on top of --auth-rate-limit.")
+	fCORSAllowedOrigins := fs.String("cors-allowed-origins", "", "List of origins separated by comma, like https://app.example.com, allowed to make read-only (GET and HEAD) cross-origin requests with credentials to the /api/ endpoints. The first label of the host may be a wildcard, like https://*.example.com. Mutating requests are not allowed cross-origin. CORS is disabled if empty.")
+	fTrustedProxyCIDRs := fs.String("trusted-proxy-cidrs", "", "List of CIDRs separated by comma of proxies in front of the console. If set, Forwarded and X-Forwarded-* headers of requests from other addresses are removed.")
+	fRealIPHeader := fs.String("real-ip-header", "", "Header carrying the client IP, like True-Client-IP, set by the proxies of --trusted-proxy-cidrs. It takes precedence over X-Forwarded-For for rate limiting and the auth audit log, and is ignored on requests from other addresses.")
+
+	fHTTPReadHeaderTimeout := fs.Duration("http-read-header-timeout", 10*time.Second, "How long the console waits for the headers of a request, protecting against clients sending them slowly. Disabled if 0.")
+	fHTTPReadTimeout := fs.Duration("http-read-timeout", 0, "How long reading a whole request, including its body, may take. Websockets, watches and followed logs are exempt. Disabled if 0.")
+	fHTTPWriteTimeout := fs.Duration("http-write-timeout", 0, "How long writing a response may take after its request was read. Websockets, watches and followed logs are exempt. Disabled if 0.")
+	fHTTPIdleTimeout := fs.Duration("http-idle-timeout", 2*time.Minute, "How long an idle keep-alive connection is kept open. Defaults to --http-read-timeout if 0, unbounded if both are 0.")
+
+	fShutdownGracePeriod := fs.Duration("shutdown-grace-period", 30*time.Second, "How long in-flight requests may take to finish after SIGTERM and the lame-duck period. Requests still running after that, like watches and websockets, are closed.")
+	fLameDuckPeriod := fs.Duration("lame-duck-period", 0, "How long the console keeps serving after SIGTERM while /readyz fails, so that load balancers stop routing new requests before it shuts down. Disabled if 0.")
+
 	fRedirectPort := fs.Int("redirect-port", 0, "Port number under which the console should listen for custom hostname redirect.")
 	fLogLevel := fs.String("log-level", "", "level of logging information by package (pkg=level).")
 	fPublicDir := fs.String("public-dir", "./frontend/public/dist", "directory containing static web assets.")
 	fTlSCertFile := fs.String("tls-cert-file", "", "TLS certificate. If the certificate is signed by a certificate authority, the certFile should be the concatenation of the server's certificate followed by the CA's certificate.")
 	fTlSKeyFile := fs.String("tls-key-file", "", "The TLS certificate key.")
+	fTLSMinVersion := fs.String("tls-min-version", "", "Minimum TLS version of the serving port. Possible values: "+strings.Join(oscrypto.ValidTLSVersions(), ", ")+". Defaults to VersionTLS12.")
+	fTLSCipherSuites := fs.String("tls-cipher-suites", "", "List of cipher suites separated by comma, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, allowed on the serving port for TLS 1.2 and earlier. Defaults to the OpenShift default cipher suites.")
 	fCAFile := fs.String("ca-file", "", "PEM File containing trusted certificates of trusted CAs. If not present, the system's Root CAs will be used.")
 
 	_ = fs.String("kubectl-client-id", "", "DEPRECATED: setting this does not do anything.")
@@ -103,6 +159,7 @@ func main() {
 	fBranding := fs.String("branding", "okd", "Console branding for the masthead logo and title. One of okd, openshift, ocp, online, dedicated, azure, or rosa. Defaults to okd.")
 	fCustomProductName := fs.String("custom-product-name", "", "Custom product name for console branding.")
 	fCustomLogoFile := fs.String("custom-logo-file", "", "Custom product image for console branding.")
+	fLogoutLandingPage := fs.String("logout-landing-page", "", "HTML template, in Go html/template syntax, of a page served after logging out instead of going back to the login. {{ .LoginURL }} is the URL of a new login. Cannot be used with --user-auth-logout-redirect.")
 	fStatuspageID := fs.String("statuspage-id", "", "Unique ID assigned by statuspage.io page that provides status info.")
 	fDocumentationBaseURL := fs.String("documentation-base-url", "", "The base URL for documentation links.")
 
@@ -121,6 +178,9 @@ func main() {
 	telemetryFlags := serverconfig.MultiKeyValue{}
 	fs.Var(&telemetryFlags, "telemetry", "Telemetry configuration that can be used by console plugins. Each entry should be a key=value pair.")
 
+	contentSecurityPolicyFlags := serverconfig.MultiKeyValue{}
+	fs.Var(&contentSecurityPolicyFlags, "content-security-policy", "Content-Security-Policy directives of the console page, e.g. frame-ancestors='self' https://portal.example.com. Each entry is a directive=sources pair and replaces the default of the directive, which is frame-ancestors='none'.")
+
 	fLoadTestFactor := fs.Int("load-test-factor", 0, "DEV ONLY. The factor used to multiply k8s API list responses for load testing purposes.")
 
 	fDevCatalogCategories := fs.String("developer-catalog-categories", "", "Allow catalog categories customization. (JSON as string)")
@@ -136,7 +196,15 @@ func main() {
 	fNodeOperatingSystems := fs.String("node-operating-systems", "", "List of node operating systems. Example --node-operating-system=linux,windows")
 	fCopiedCSVsDisabled := fs.Bool("copied-csvs-disabled", false, "Flag to indicate if OLM copied CSVs are disabled.")
 
-	cfg, err := serverconfig.Parse(fs, os.Args[1:], "BRIDGE")
+	// "bridge validate [flags]" checks the authentication options like a
+	// regular start would, prints the problems found and exits.
+	args := os.Args[1:]
+	validateOnly := len(args) > 0 && args[0] == "validate"
+	if validateOnly {
+		args = args[1:]
+	}
+
+	cfg, err := serverconfig.Parse(fs, args, "BRIDGE")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -147,15 +215,28 @@ func main() {
 		os.Exit(1)
 	}
 
-	authOptions.ApplyConfig(&cfg.Auth)
+	authOptions.ApplyConfig(fs, &cfg.Auth)
 
 	baseURL, err := flags.ValidateFlagIsURL("base-address", *fBaseAddress, true)
 	flags.FatalIfFailed(err)
 
-	if !strings.HasPrefix(*fBasePath, "/") || !strings.HasSuffix(*fBasePath, "/") {
-		flags.FatalIfFailed(flags.NewInvalidFlagError("base-path", "value must start and end with slash"))
+	basePath, err := server.ResolveBasePath(baseURL, *fBasePath)
+	if err != nil {
+		flags.FatalIfFailed(flags.NewInvalidFlagError("base-path", "%v", err))
+	}
+	baseURL.Path = basePath
+
+	if validateOnly {
+		failed, err := authOptions.PrintCheck(os.Stdout, *fK8sAuth, baseURL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
-	baseURL.Path = *fBasePath
 
 	documentationBaseURL := &url.URL{}
 	if *fDocumentationBaseURL != "" {
@@ -240,6 +321,95 @@ func main() {
 		}
 	}
 
+	trustedProxyCIDRs := parseCIDRs("trusted-proxy-cidrs", *fTrustedProxyCIDRs)
+	if *fRealIPHeader != "" {
+		if !httpguts.ValidHeaderFieldName(*fRealIPHeader) {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("real-ip-header", "%q is not a valid header name", *fRealIPHeader))
+		}
+		if len(trustedProxyCIDRs) == 0 {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("real-ip-header", "requires --trusted-proxy-cidrs, the header is only taken from trusted proxies"))
+		}
+	}
+
+	corsAllowedOrigins := []string{}
+	if *fCORSAllowedOrigins != "" {
+		for _, str := range strings.Split(*fCORSAllowedOrigins, ",") {
+			str = strings.TrimSpace(str)
+			if err := server.ValidateCORSAllowedOrigin(str); err != nil {
+				flags.FatalIfFailed(flags.NewInvalidFlagError("cors-allowed-origins", "%v", err))
+			}
+			corsAllowedOrigins = append(corsAllowedOrigins, str)
+		}
+	}
+
+	tlsMinVersion := parseTLSMinVersion("tls-min-version", *fTLSMinVersion)
+	tlsCipherSuites := parseTLSCipherSuites("tls-cipher-suites", *fTLSCipherSuites, tlsMinVersion)
+
+	if *fAuthRateLimit < 0 {
+		flags.FatalIfFailed(flags.NewInvalidFlagError("auth-rate-limit", "must not be negative"))
+	}
+	if *fAuthRateLimit > 0 {
+		flags.FatalIfFailed(flags.ValidateIntRange("auth-rate-limit-burst", *fAuthRateLimitBurst, 1, 0))
+	}
+
+	authorizationPassthroughPaths := []string{}
+	if *fProxyAuthorizationPassthrough != "" {
+		for _, str := range strings.Split(*fProxyAuthorizationPassthrough, ",") {
+			str = strings.TrimSpace(str)
+			if !strings.HasPrefix(str, "/") {
+				flags.FatalIfFailed(flags.NewInvalidFlagError("proxy-allow-authorization-passthrough", "list must contain absolute paths separated by comma"))
+			}
+			authorizationPassthroughPaths = append(authorizationPassthroughPaths, str)
+		}
+	}
+	authorizationPassthroughCIDRs := parseCIDRs("proxy-authorization-passthrough-cidrs", *fProxyAuthorizationPassthroughCIDRs)
+	if len(authorizationPassthroughPaths) > 0 && len(authorizationPassthroughCIDRs) == 0 {
+		flags.FatalIfFailed(flags.NewRequiredFlagError("proxy-authorization-passthrough-cidrs"))
+	}
+
+	if err := server.ValidateContentSecurityPolicy(contentSecurityPolicyFlags); err != nil {
+		flags.FatalIfFailed(flags.NewInvalidFlagError("content-security-policy", "%v", err))
+	}
+
+	for name, value := range responseHeaderFlags {
+		if err := server.ValidateResponseHeader(name, value); err != nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("response-header", "%v", err))
+		}
+	}
+
+	flags.FatalIfFailed(flags.ValidateDurationRange("proxy-response-cache-ttl", *fProxyResponseCacheTTL, 0, 0))
+	flags.FatalIfFailed(flags.ValidateIntRange("proxy-transient-error-retries", *fProxyTransientErrorRetries, 0, maxProxyTransientErrorRetries))
+	flags.FatalIfFailed(flags.ValidateIntRange("proxy-max-retries", *fProxyMaxRetries, 0, maxProxyTransientErrorRetries))
+	flags.FatalIfFailed(flags.ValidateDurationRange("proxy-retry-backoff", *fProxyRetryBackoff, 0, maxProxyRetryBackoff))
+	flags.FatalIfFailed(flags.ValidateDurationRange("proxy-websocket-idle-timeout", *fProxyWebsocketIdleTimeout, 0, 0))
+	flags.FatalIfFailed(flags.ValidateDurationRange("proxy-request-timeout", *fProxyRequestTimeout, 0, 0))
+	flags.FatalIfFailed(flags.ValidateIntRange("response-compression-min-size", *fResponseCompressionMinSize, 0, 0))
+	flags.FatalIfFailed(flags.ValidateIntRange("proxy-max-idle-conns", *fProxyMaxIdleConns, 0, 0))
+	flags.FatalIfFailed(flags.ValidateIntRange("proxy-max-idle-conns-per-host", *fProxyMaxIdleConnsPerHost, 0, 0))
+	flags.FatalIfFailed(flags.ValidateDurationRange("proxy-idle-conn-timeout", *fProxyIdleConnTimeout, 0, 0))
+	for name := range proxyInjectHeaderFlags {
+		if err := proxy.ValidateInjectHeader(name); err != nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("proxy-inject-header", "%v", err))
+		}
+	}
+	flags.FatalIfFailed(flags.ValidateDurationRange("http-read-header-timeout", *fHTTPReadHeaderTimeout, 0, 0))
+	flags.FatalIfFailed(flags.ValidateDurationRange("http-read-timeout", *fHTTPReadTimeout, 0, 0))
+	flags.FatalIfFailed(flags.ValidateDurationRange("http-write-timeout", *fHTTPWriteTimeout, 0, 0))
+	flags.FatalIfFailed(flags.ValidateDurationRange("http-idle-timeout", *fHTTPIdleTimeout, 0, 0))
+	flags.FatalIfFailed(flags.ValidateDurationRange("lame-duck-period", *fLameDuckPeriod, 0, 0))
+	flags.FatalIfFailed(flags.ValidateDurationRange("shutdown-grace-period", *fShutdownGracePeriod, 0, 0))
+
+	proxyResponseCachePaths := []string{}
+	if *fProxyResponseCachePaths != "" {
+		for _, str := range strings.Split(*fProxyResponseCachePaths, ",") {
+			str = strings.TrimSpace(str)
+			if !strings.HasPrefix(str, "/") {
+				flags.FatalIfFailed(flags.NewInvalidFlagError("proxy-response-cache-paths", "list must contain absolute API paths separated by comma"))
+			}
+			proxyResponseCachePaths = append(proxyResponseCachePaths, str)
+		}
+	}
+
 	srv := &server.Server{
 		PublicDir:                    *fPublicDir,
 		BaseURL:                      baseURL,
@@ -267,19 +437,36 @@ func main() {
 		ProjectAccessClusterRoles:    *fProjectAccessClusterRoles,
 		Perspectives:                 *fPerspectives,
 		Telemetry:                    telemetryFlags,
+		ContentSecurityPolicy:        contentSecurityPolicyFlags,
 		ReleaseVersion:               *fReleaseVersion,
 		NodeArchitectures:            nodeArchitectures,
 		NodeOperatingSystems:         nodeOperatingSystems,
+		TrustedProxyCIDRs:            trustedProxyCIDRs,
+		RealIPHeader:                 *fRealIPHeader,
+		CORSAllowedOrigins:           corsAllowedOrigins,
+		TLSMinVersion:                tlsMinVersion,
+		TLSCipherSuites:              tlsCipherSuites,
+		HTTPReadHeaderTimeout:        *fHTTPReadHeaderTimeout,
+		HTTPReadTimeout:              *fHTTPReadTimeout,
+		HTTPWriteTimeout:             *fHTTPWriteTimeout,
+		HTTPIdleTimeout:              *fHTTPIdleTimeout,
 		K8sMode:                      *fK8sMode,
 		CopiedCSVsDisabled:           *fCopiedCSVsDisabled,
 	}
 
-	completedAuthnOptions, err := authOptions.Complete(*fK8sAuth)
+	completedAuthnOptions, err := authOptions.Complete(*fK8sAuth, baseURL)
 	if err != nil {
 		klog.Fatalf("failed to complete authentication options: %v", err)
 		os.Exit(1)
 	}
 
+	if authOptions.PrintConfig {
+		if err := completedAuthnOptions.PrintConfig(os.Stdout); err != nil {
+			klog.Fatalf("failed to print authentication options: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	// if !in-cluster (dev) we should not pass these values to the frontend
 	// is used by catalog-utils.ts
 	if *fK8sMode == "in-cluster" {
@@ -473,6 +660,43 @@ func main() {
 		flags.FatalIfFailed(flags.NewInvalidFlagError("k8s-mode", "must be one of: in-cluster, off-cluster"))
 	}
 
+	if *fProxyResponseCacheTTL > 0 {
+		klog.Infof("Caching Kubernetes API GET responses for %s: %s", *fProxyResponseCacheTTL, strings.Join(proxyResponseCachePaths, ", "))
+		srv.K8sProxyConfig.ResponseCacheTTL = *fProxyResponseCacheTTL
+		srv.K8sProxyConfig.ResponseCachePaths = proxyResponseCachePaths
+	}
+
+	srv.K8sProxyConfig.ExposeAuditID = *fProxyExposeAuditID
+	srv.AuthorizationPassthroughPaths = authorizationPassthroughPaths
+	srv.AuthRateLimit = *fAuthRateLimit
+	srv.AuthRateLimitBurst = *fAuthRateLimitBurst
+	srv.AuthorizationPassthroughCIDRs = authorizationPassthroughCIDRs
+	if *fProxyOutboundUserAgent && authOptions.OutboundUserAgent != "" {
+		injected := false
+		for name := range proxyInjectHeaderFlags {
+			injected = injected || http.CanonicalHeaderKey(strings.TrimSpace(name)) == "User-Agent"
+		}
+		if !injected {
+			proxyInjectHeaderFlags["User-Agent"] = authOptions.OutboundUserAgent
+		}
+	}
+	if len(proxyInjectHeaderFlags) > 0 {
+		srv.K8sProxyConfig.InjectHeaders = proxyInjectHeaderFlags
+	}
+	srv.K8sProxyConfig.WebsocketIdleTimeout = *fProxyWebsocketIdleTimeout
+	srv.K8sProxyConfig.TransientErrorRetries = *fProxyTransientErrorRetries
+	srv.K8sProxyConfig.MaxRetries = *fProxyMaxRetries
+	srv.K8sProxyConfig.RetryBackoff = *fProxyRetryBackoff
+	srv.K8sProxyConfig.FlushInterval = *fProxyFlushInterval
+	srv.K8sProxyConfig.RequestTimeout = *fProxyRequestTimeout
+	srv.ResponseCompression = *fEnableResponseCompression
+	srv.ResponseCompressionMinSize = *fResponseCompressionMinSize
+	srv.ResponseHeaders = responseHeaderFlags
+	srv.K8sProxyConfig.MaxIdleConns = *fProxyMaxIdleConns
+	srv.K8sProxyConfig.MaxIdleConnsPerHost = *fProxyMaxIdleConnsPerHost
+	srv.K8sProxyConfig.IdleConnTimeout = *fProxyIdleConnTimeout
+	srv.K8sProxyConfig.Metrics = proxy.NewMetrics()
+
 	apiServerEndpoint := *fK8sPublicEndpoint
 	if apiServerEndpoint == "" {
 		apiServerEndpoint = srv.K8sProxyConfig.Endpoint.String()
@@ -515,6 +739,22 @@ func main() {
 		flags.FatalIfFailed(flags.NewInvalidFlagError("k8s-mode", "must be one of: service-account, bearer-token, oidc, openshift"))
 	}
 
+	if *fEnableImpersonation {
+		flags.FatalIfFailed(flags.ValidateFlagIs("user-auth", authOptions.AuthType, "oidc"))
+		if len(srv.ServiceAccountToken) == 0 {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("enable-impersonation", "requires the service account token of --k8s-mode=in-cluster or --k8s-auth-bearer-token"))
+		}
+		if len(authorizationPassthroughPaths) > 0 {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("enable-impersonation", "cannot be used with --proxy-allow-authorization-passthrough"))
+		}
+		if *fImpersonationUsernameClaim == "" {
+			flags.FatalIfFailed(flags.NewRequiredFlagError("impersonation-username-claim"))
+		}
+		srv.K8sProxyConfig.SessionImpersonation = true
+		srv.ImpersonationUsernameClaim = *fImpersonationUsernameClaim
+		srv.ImpersonationUsernamePrefix = *fImpersonationUsernamePrefix
+	}
+
 	monitoringDashboardHttpClientTransport := &http.Transport{
 		TLSClientConfig: srv.K8sProxyConfig.TLSClientConfig,
 	}
@@ -573,16 +813,66 @@ func main() {
 		knative.ChannelFilter,
 	)
 
+	// The client certificate is only presented by the proxy. The console's own
+	// requests above keep authenticating with the service account token.
+	if *fK8sClientCertFile != "" || *fK8sClientKeyFile != "" {
+		if *fK8sClientCertFile == "" {
+			flags.FatalIfFailed(flags.NewRequiredFlagError("k8s-client-cert-file"))
+		}
+		if *fK8sClientKeyFile == "" {
+			flags.FatalIfFailed(flags.NewRequiredFlagError("k8s-client-key-file"))
+		}
+		if *fK8sMode != "off-cluster" {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("k8s-client-cert-file", "requires --k8s-mode=off-cluster, the proxy endpoint is the cluster API server otherwise"))
+		}
+		publicEndpoint, err := url.Parse(*fK8sPublicEndpoint)
+		if *fK8sPublicEndpoint == "" || err != nil || (strings.EqualFold(publicEndpoint.Scheme, k8sEndpoint.Scheme) && strings.EqualFold(publicEndpoint.Host, k8sEndpoint.Host)) {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("k8s-client-cert-file", "requires --k8s-public-endpoint set to the API server, which must not be --k8s-mode-off-cluster-endpoint"))
+		}
+		tlsConfig, err := proxy.WithClientCertificate(srv.K8sProxyConfig.TLSClientConfig, *fK8sClientCertFile, *fK8sClientKeyFile)
+		if err != nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("k8s-client-cert-file", "%v", err))
+		}
+		srv.K8sProxyConfig.TLSClientConfig = tlsConfig
+	}
+
+	// Like the client certificate, the additional CAs are only trusted by the proxy.
+	if *fK8sAdditionalCAFile != "" {
+		tlsConfig, err := proxy.WithAdditionalCAs(srv.K8sProxyConfig.TLSClientConfig, *fK8sAdditionalCAFile)
+		if err != nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("k8s-additional-ca-file", "%v", err))
+		}
+		srv.K8sProxyConfig.TLSClientConfig = tlsConfig
+	}
+
 	caCertFilePath := *fCAFile
 	if *fK8sMode == "in-cluster" {
 		caCertFilePath = k8sInClusterCA
 	}
 
-	if err := completedAuthnOptions.ApplyTo(srv, k8sEndpoint, apiServerEndpoint, caCertFilePath); err != nil {
+	// ctx is canceled on shutdown, which stops background work and closes
+	// requests that are still running after the grace period.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if err := completedAuthnOptions.ApplyTo(ctx, srv, k8sEndpoint, apiServerEndpoint, caCertFilePath); err != nil {
 		klog.Fatalf("failed to apply configuration to server: %v", err)
 		os.Exit(1)
 	}
 
+	if *fLogoutLandingPage != "" {
+		if srv.Authenticator == nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("logout-landing-page", "cannot be used with --user-auth=\"disabled\""))
+		}
+		if srv.LogoutRedirect != nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("logout-landing-page", "cannot be used with --user-auth-logout-redirect"))
+		}
+		page, err := template.ParseFiles(*fLogoutLandingPage)
+		if err != nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError("logout-landing-page", "%v", err))
+		}
+		srv.LogoutLandingPage = page
+	}
+
 	listenURL, err := flags.ValidateFlagIsURL("listen", *fListen, false)
 	flags.FatalIfFailed(err)
 
@@ -595,13 +885,7 @@ func main() {
 		flags.FatalIfFailed(flags.NewInvalidFlagError("listen", "scheme must be one of: http, https"))
 	}
 
-	httpsrv := &http.Server{
-		Addr:    listenURL.Host,
-		Handler: srv.HTTPHandler(),
-		// Disable HTTP/2, which breaks WebSockets.
-		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
-		TLSConfig:    oscrypto.SecureTLSConfig(&tls.Config{}),
-	}
+	httpsrv := srv.HTTPServer(listenURL.Host, srv.HTTPHandler(), ctx)
 
 	if *fRedirectPort != 0 {
 		go func() {
@@ -622,12 +906,89 @@ func main() {
 		}()
 	}
 
+	shutdownDone := make(chan struct{})
+	go shutdownOnSignal(srv, httpsrv, *fLameDuckPeriod, *fShutdownGracePeriod, cancel, shutdownDone)
+
 	klog.Infof("Binding to %s...", httpsrv.Addr)
 	if listenURL.Scheme == "https" {
 		klog.Info("using TLS")
-		klog.Fatal(httpsrv.ListenAndServeTLS(*fTlSCertFile, *fTlSKeyFile))
+		err = httpsrv.ListenAndServeTLS(*fTlSCertFile, *fTlSKeyFile)
 	} else {
 		klog.Info("not using TLS")
-		klog.Fatal(httpsrv.ListenAndServe())
+		err = httpsrv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		klog.Fatal(err)
+	}
+	<-shutdownDone
+}
+
+// parseCIDRs parses a list of CIDRs separated by comma and exits on errors.
+func parseCIDRs(flagName, value string) []*net.IPNet {
+	cidrs := []*net.IPNet{}
+	if value == "" {
+		return cidrs
+	}
+	for _, str := range strings.Split(value, ",") {
+		_, cidr, err := net.ParseCIDR(strings.TrimSpace(str))
+		if err != nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError(flagName, "%q is not a valid CIDR", str))
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs
+}
+
+// parseTLSMinVersion parses a TLS version name, e.g. VersionTLS13, and exits
+// on errors. It returns 0 for the default version if value is empty.
+func parseTLSMinVersion(flagName, value string) uint16 {
+	if value == "" {
+		return 0
+	}
+	version, err := oscrypto.TLSVersion(value)
+	if err != nil {
+		flags.FatalIfFailed(flags.NewInvalidFlagError(flagName, "must be one of: %s", strings.Join(oscrypto.ValidTLSVersions(), ", ")))
+	}
+	return version
+}
+
+// parseTLSCipherSuites parses a list of cipher suite names separated by comma
+// and exits on errors. The cipher suites of TLS 1.3 aren't configurable.
+func parseTLSCipherSuites(flagName, value string, minVersion uint16) []uint16 {
+	if value == "" {
+		return nil
+	}
+	if minVersion >= tls.VersionTLS13 {
+		flags.FatalIfFailed(flags.NewInvalidFlagError(flagName, "cannot be used with TLS 1.3 as minimum version, the cipher suites of TLS 1.3 are not configurable"))
+	}
+	cipherSuites := []uint16{}
+	for _, name := range strings.Split(value, ",") {
+		cipherSuite, err := oscrypto.CipherSuite(strings.TrimSpace(name))
+		if err != nil {
+			flags.FatalIfFailed(flags.NewInvalidFlagError(flagName, "%v", err))
+		}
+		cipherSuites = append(cipherSuites, cipherSuite)
+	}
+	return cipherSuites
+}
+
+// shutdownOnSignal waits for SIGTERM, fails readiness for the lame-duck period
+// while still serving requests, then drains the server and closes done.
+func shutdownOnSignal(srv *server.Server, httpsrv *http.Server, lameDuckPeriod, gracePeriod time.Duration, cancel context.CancelFunc, done chan<- struct{}) {
+	defer close(done)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	<-sigs
+
+	if lameDuckPeriod > 0 {
+		klog.Infof("Received SIGTERM, failing readiness for %s before shutting down...", lameDuckPeriod)
+		srv.SetShuttingDown()
+		time.Sleep(lameDuckPeriod)
+	}
+
+	klog.Infof("Shutting down, waiting up to %s for in-flight requests...", gracePeriod)
+	if err := server.Drain(httpsrv, gracePeriod, cancel); err != nil {
+		klog.Errorf("failed to drain in-flight requests: %v", err)
 	}
 }
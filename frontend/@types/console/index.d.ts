@@ -18,6 +18,8 @@ declare interface Window {
     alertManagerBaseURL: string;
     alertmanagerUserWorkloadBaseURL: string;
     authDisabled: boolean;
+    authIdentityClaim: string;
+    authScopes: string[];
     basePath: string;
     branding: string;
     consoleVersion: string;
@@ -36,6 +38,7 @@ declare interface Window {
     prometheusTenancyBaseURL: string;
     quickStarts: string;
     releaseVersion: string;
+    silentLoginURL?: string;
     inactivityTimeout: number;
     statuspageID: string;
     GOARCH: string;
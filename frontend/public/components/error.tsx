@@ -92,7 +92,7 @@ const LoginErrorMessage: React.FC = () => {
   const location = useLocation();
   const urlSearchParams = new URLSearchParams(location.search);
   const errorType = urlSearchParams.get('error_type');
-  const error = urlSearchParams.get('error');
+  const error = urlSearchParams.get('error_description') || urlSearchParams.get('error');
   switch (errorType) {
     case 'oauth_error':
       return t('public~There was an error generating OAuth client from OIDC client.');
@@ -175,6 +175,7 @@ class MastheadToolbarContents_ extends React.Component {
   _resetInactivityTimeout() {
     const { flags, user } = this.props;
     clearTimeout(this.userInactivityTimeout);
+    authSvc.recordActivity();
     this.userInactivityTimeout = setTimeout(() => {
       if (flags[FLAGS.OPENSHIFT]) {
         authSvc.logoutOpenShift(user?.metadata?.name === 'kube:admin');
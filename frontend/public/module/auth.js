@@ -108,6 +108,14 @@ export const authSvc = {
       });
   },
 
+  // Tell the server about user input, which restarts the inactivity timeout of
+  // the session there. Requests the console makes on its own don't count as
+  // activity. Errors are ignored, e.g. OpenShift auth doesn't track activity.
+  recordActivity: _.throttle(
+    () => coFetch('/api/console/session-activity', { method: 'POST' }).catch(_.noop),
+    60 * 1000,
+  ),
+
   // The kube:admin user has a special logout flow. The OAuth server has a
   // session cookie that must be cleared by POSTing to the kube:admin logout
   // endpoint, otherwise the user will be logged in again immediately after
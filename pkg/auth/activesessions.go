@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// activeSessionsEvictInterval is how often expired sessions are forgotten.
+	activeSessionsEvictInterval = time.Minute
+	// browserSessionLifetime is assumed for session cookies without max-age,
+	// which live until the browser is closed.
+	browserSessionLifetime = 24 * time.Hour
+)
+
+// activeSessions tracks the sessions created by this console instance to
+// report their number. OpenShift sessions only live in the cookie, so the
+// sessions are tracked here for all login methods, keyed by a hash of the
+// session cookie. A session is forgotten on logout or once it expires.
+type activeSessions struct {
+	mux      sync.Mutex
+	sessions map[string]time.Time
+	now      nowFunc
+	metrics  *Metrics
+}
+
+func newActiveSessions(metrics *Metrics) *activeSessions {
+	return &activeSessions{
+		sessions: make(map[string]time.Time),
+		now:      defaultNow,
+		metrics:  metrics,
+	}
+}
+
+// sessionKey avoids keeping session tokens, which are OpenShift access tokens
+// for OpenShift auth, in memory.
+func sessionKey(cookieValue string) string {
+	sum := sha256.Sum256([]byte(cookieValue))
+	return hex.EncodeToString(sum[:])
+}
+
+// loggedIn tracks the session cookie written to header on login.
+func (s *activeSessions) loggedIn(header http.Header) {
+	resp := http.Response{Header: header}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name != openshiftAccessTokenCookieName || cookie.Value == "" {
+			continue
+		}
+		lifetime := time.Duration(cookie.MaxAge) * time.Second
+		if cookie.MaxAge == 0 {
+			lifetime = browserSessionLifetime
+		}
+		exp := s.now().Add(lifetime)
+		s.update(func() {
+			s.sessions[sessionKey(cookie.Value)] = exp
+		})
+	}
+}
+
+// loggedOut forgets the session of the session cookie of r.
+func (s *activeSessions) loggedOut(r *http.Request) {
+	cookie, err := r.Cookie(openshiftAccessTokenCookieName)
+	if err != nil || cookie.Value == "" {
+		return
+	}
+	s.update(func() {
+		delete(s.sessions, sessionKey(cookie.Value))
+	})
+}
+
+// reset forgets all sessions, e.g. after they were invalidated.
+func (s *activeSessions) reset() {
+	s.update(func() {
+		s.sessions = make(map[string]time.Time)
+	})
+}
+
+// count returns the number of sessions that haven't expired.
+func (s *activeSessions) count() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.evictLocked()
+	return len(s.sessions)
+}
+
+// evictPeriodically forgets expired sessions every interval until ctx is done,
+// so that the metric goes down without logouts.
+func (s *activeSessions) evictPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.update(func() {})
+		}
+	}
+}
+
+// update applies fn, evicts expired sessions and reports the new count.
+func (s *activeSessions) update(fn func()) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	fn()
+	s.evictLocked()
+	if s.metrics != nil {
+		s.metrics.ActiveSessionsChanged(len(s.sessions))
+	}
+}
+
+func (s *activeSessions) evictLocked() {
+	now := s.now()
+	for key, exp := range s.sessions {
+		if !exp.After(now) {
+			delete(s.sessions, key)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openshift/console/pkg/metrics"
+)
+
+func TestActiveSessions(t *testing.T) {
+	now := time.Now()
+	m := NewMetrics()
+	s := newActiveSessions(m)
+	s.now = func() time.Time { return now }
+
+	login := func(value string, maxAge int) {
+		w := httptest.NewRecorder()
+		http.SetCookie(w, &http.Cookie{Name: openshiftAccessTokenCookieName, Value: value, MaxAge: maxAge})
+		s.loggedIn(w.Header())
+	}
+	logout := func(value string) {
+		r := httptest.NewRequest(http.MethodPost, "/api/console/logout", nil)
+		r.AddCookie(&http.Cookie{Name: openshiftAccessTokenCookieName, Value: value})
+		s.loggedOut(r)
+	}
+	expectCount := func(want int) {
+		t.Helper()
+		if got := s.count(); got != want {
+			t.Errorf("expected %d active sessions, got %d", want, got)
+		}
+	}
+
+	login("first", 3600)
+	login("second", 60)
+	login("first", 3600)
+	expectCount(2)
+	if got := metrics.RemoveComments(metrics.FormatMetrics(m.activeSessions)); got != "console_active_sessions 2" {
+		t.Errorf("wrong active sessions metric, got: %s", got)
+	}
+
+	logout("first")
+	logout("unknown")
+	expectCount(1)
+
+	now = now.Add(2 * time.Minute)
+	expectCount(0)
+
+	login("third", 3600)
+	s.reset()
+	expectCount(0)
+	if got := metrics.RemoveComments(metrics.FormatMetrics(m.activeSessions)); got != "console_active_sessions 0" {
+		t.Errorf("wrong active sessions metric after reset, got: %s", got)
+	}
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrActivityTrackingUnsupported is returned for auth sources whose sessions
+// aren't kept by the console, so that their activity can't be kept either.
+var ErrActivityTrackingUnsupported = errors.New("sessions of this auth source are not kept by the console, their activity can't be tracked")
+
+// activityTracker is implemented by login methods that keep sessions.
+type activityTracker interface {
+	recordActivity(r *http.Request, t time.Time, ttl time.Duration) error
+	lastActivity(r *http.Request) (time.Time, error)
+}
+
+// RecordActivity records that the user of the session of r is active, as
+// signalled by the frontend. It is kept for the inactivity timeout, the
+// session is idle afterwards anyway.
+func (a *Authenticator) RecordActivity(r *http.Request, timeout time.Duration) error {
+	if err := a.Healthy(); err != nil {
+		return err
+	}
+	tracker, ok := a.getLoginMethod().(activityTracker)
+	if !ok {
+		return ErrActivityTrackingUnsupported
+	}
+	return tracker.recordActivity(r, time.Now(), timeout)
+}
+
+// IdleLogoutIn returns how long until the session of r has been idle for the
+// inactivity timeout. Sessions without recorded activity are idle since the
+// login. It doesn't count as activity itself.
+func (a *Authenticator) IdleLogoutIn(r *http.Request, timeout time.Duration) (time.Duration, error) {
+	if err := a.Healthy(); err != nil {
+		return 0, err
+	}
+	tracker, ok := a.getLoginMethod().(activityTracker)
+	if !ok {
+		return 0, ErrActivityTrackingUnsupported
+	}
+	last, err := tracker.lastActivity(r)
+	if err != nil {
+		return 0, err
+	}
+	if last.IsZero() {
+		// Sessions from before the login time was recorded.
+		return timeout, nil
+	}
+	if left := last.Add(timeout).Sub(time.Now()); left > 0 {
+		return left, nil
+	}
+	return 0, nil
+}
+
+func (o *oidcAuth) recordActivity(r *http.Request, t time.Time, ttl time.Duration) error {
+	cookie, err := r.Cookie(openshiftAccessTokenCookieName)
+	if err != nil {
+		return err
+	}
+	return o.sessions.SetLastActivity(r.Context(), cookie.Value, t, ttl)
+}
+
+func (o *oidcAuth) lastActivity(r *http.Request) (time.Time, error) {
+	cookie, err := r.Cookie(openshiftAccessTokenCookieName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return o.sessionLastActivity(r.Context(), cookie.Value)
+}
+
+func (o *oidcAuth) sessionLastActivity(ctx context.Context, token string) (time.Time, error) {
+	last, err := o.sessions.LastActivity(ctx, token)
+	if err != nil || !last.IsZero() {
+		return last, err
+	}
+	ls, err := o.sessions.Get(ctx, token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ls == nil {
+		return time.Time{}, fmt.Errorf("No session found on server")
+	}
+	return ls.loginTime, nil
+}
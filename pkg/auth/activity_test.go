@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestIdleLogoutIn(t *testing.T) {
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{}, o
+	}
+
+	login := func() *http.Request {
+		token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{
+			"aud": "console",
+		})})
+		rr := httptest.NewRecorder()
+		if _, err := o.login(rr, token, http.SameSiteLaxMode); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "http://example.com/api/console/session-info", nil)
+		for _, c := range rr.Result().Cookies() {
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+		return r
+	}
+	const timeout = 10 * time.Minute
+	expectLeft := func(r *http.Request, want time.Duration, msg string) {
+		t.Helper()
+		left, err := a.IdleLogoutIn(r, timeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if left > want || left < want-time.Second {
+			t.Errorf("%s: expected %s until the idle logout, got %s", msg, want, left)
+		}
+	}
+
+	first := login()
+	expectLeft(first, timeout, "a new session is idle since the login")
+
+	if err := o.recordActivity(first, time.Now().Add(-8*time.Minute), timeout); err != nil {
+		t.Fatal(err)
+	}
+	expectLeft(first, 2*time.Minute, "after activity 8 minutes ago")
+	expectLeft(first, 2*time.Minute, "asking again doesn't count as activity")
+
+	second := login()
+	expectLeft(second, timeout, "the activity of other sessions doesn't count")
+
+	if err := a.RecordActivity(first, timeout); err != nil {
+		t.Fatal(err)
+	}
+	expectLeft(first, timeout, "after the activity signal")
+
+	if err := o.recordActivity(second, time.Now().Add(-11*time.Minute), timeout); err != nil {
+		t.Fatal(err)
+	}
+	expectLeft(second, 0, "after no activity for longer than the timeout")
+
+	cookie, _ := first.Cookie(openshiftAccessTokenCookieName)
+	if err := o.sessions.Delete(context.Background(), cookie.Value); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RecordActivity(first, timeout); err == nil {
+		t.Error("expected no activity to be recorded for a deleted session")
+	}
+
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{}, nil
+	}
+	if err := a.RecordActivity(second, timeout); !errors.Is(err, ErrActivityTrackingUnsupported) {
+		t.Errorf("expected activity tracking to be unsupported without server side sessions, got: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+const (
+	auditEventLogin  = "login"
+	auditEventLogout = "logout"
+
+	auditOutcomeSuccess = "success"
+	auditOutcomeFailure = "failure"
+)
+
+// AuditRecord is a line of the auth audit log, see Config.AuditLogFile. It
+// must never hold tokens or other secrets.
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Outcome string    `json:"outcome"`
+	// Reason is the error code of a failed login.
+	Reason   string `json:"reason,omitempty"`
+	AuthType string `json:"authType"`
+	UserID   string `json:"userID,omitempty"`
+	Username string `json:"username,omitempty"`
+	// GroupsCount is the number of groups of the user, the groups themselves
+	// are left out.
+	GroupsCount int `json:"groupsCount"`
+	// SourceIP is the client IP found by the server, see --real-ip-header, or
+	// the address of the connection.
+	SourceIP string `json:"sourceIP"`
+	// ForwardedFor is the X-Forwarded-For header of the request, if any. It is
+	// set by the client or a proxy in front of the console and not verified.
+	ForwardedFor string `json:"forwardedFor,omitempty"`
+	RequestID    string `json:"requestID,omitempty"`
+}
+
+// auditLog appends AuditRecords as JSON lines to a file. The file is opened
+// for every record, so that it can be rotated by moving it away.
+type auditLog struct {
+	mux      sync.Mutex
+	path     string
+	authType string
+	now      nowFunc
+}
+
+// newAuditLog checks that path can be appended to, creating it if needed.
+func newAuditLog(path, authType string) (*auditLog, error) {
+	l := &auditLog{path: path, authType: authType, now: defaultNow}
+	f, err := l.open()
+	if err != nil {
+		return nil, fmt.Errorf("audit log file is not writable: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("audit log file is not writable: %v", err)
+	}
+	return l, nil
+}
+
+func (l *auditLog) open() (*os.File, error) {
+	return os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+// record appends a record for a request. It is a no-op on a nil receiver.
+// Errors are logged, a login or logout doesn't fail because of them.
+func (l *auditLog) record(r *http.Request, event, outcome, reason string, user *User) {
+	if l == nil {
+		return
+	}
+
+	rec := AuditRecord{
+		Time:         l.now().UTC(),
+		Event:        event,
+		Outcome:      outcome,
+		Reason:       reason,
+		AuthType:     l.authType,
+		SourceIP:     sourceIP(r),
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		RequestID:    serverutils.RequestIDFrom(r.Context()),
+	}
+	if user != nil {
+		rec.UserID = user.ID
+		rec.Username = user.Username
+		rec.GroupsCount = len(user.Groups)
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		klog.Errorf("failed to encode audit record: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	f, err := l.open()
+	if err != nil {
+		klog.Errorf("failed to open audit log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		klog.Errorf("failed to write audit record: %v", err)
+	}
+}
+
+func sourceIP(r *http.Request) string {
+	if ip := serverutils.ClientIPFrom(r.Context()); ip != "" {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
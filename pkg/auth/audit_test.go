@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+func TestAuditLog(t *testing.T) {
+	if _, err := newAuditLog(filepath.Join(t.TempDir(), "missing", "audit.log"), "oidc"); err == nil {
+		t.Error("expected an error for a file that can't be created")
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := newAuditLog(path, "oidc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	audit.now = func() time.Time { return now }
+
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.audit = audit
+
+	r := httptest.NewRequest("GET", "http://example.com/auth/callback?code=secret-code", nil)
+	r.RemoteAddr = "10.0.0.1:43210"
+	r.Header.Set("X-Forwarded-For", "192.0.2.10")
+	r = r.WithContext(serverutils.WithRequestID(r.Context(), "request-id"))
+	audit.record(r, auditEventLogin, auditOutcomeSuccess, "", &User{ID: "user-id", Username: "alice", Token: "secret-token", Groups: []string{"admins", "developers"}})
+	a.redirectAuthError(httptest.NewRecorder(), r, errorMissingGroups, "")
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-token", "secret-code", "admins"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("expected %q to be left out of the audit log, got:\n%s", secret, b)
+		}
+	}
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(strings.NewReader(string(b)))
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("failed to decode audit record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	want := []AuditRecord{
+		{
+			Time:         now,
+			Event:        "login",
+			Outcome:      "success",
+			AuthType:     "oidc",
+			UserID:       "user-id",
+			Username:     "alice",
+			GroupsCount:  2,
+			SourceIP:     "10.0.0.1",
+			ForwardedFor: "192.0.2.10",
+			RequestID:    "request-id",
+		},
+		{
+			Time:         now,
+			Event:        "login",
+			Outcome:      "failure",
+			Reason:       errorMissingGroups,
+			AuthType:     "oidc",
+			SourceIP:     "10.0.0.1",
+			ForwardedFor: "192.0.2.10",
+			RequestID:    "request-id",
+		},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d audit records, got:\n%s", len(want), b)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("wrong audit record %d, want: %+v, got: %+v", i, want[i], records[i])
+		}
+	}
+
+	// Records are appended to a new file after the old one was moved away.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	audit.record(r, auditEventLogout, auditOutcomeSuccess, "", nil)
+	if b, err := os.ReadFile(path); err != nil || !strings.Contains(string(b), `"event":"logout"`) {
+		t.Errorf("expected the logout in a new file, got %q: %v", b, err)
+	}
+
+	// The client IP found by the server takes precedence over the connection.
+	audit.record(r.WithContext(serverutils.WithClientIP(r.Context(), "198.51.100.1")), auditEventLogout, auditOutcomeSuccess, "", nil)
+	if b, err := os.ReadFile(path); err != nil || !strings.Contains(string(b), `"sourceIP":"198.51.100.1"`) {
+		t.Errorf("expected the client IP as source IP, got %q: %v", b, err)
+	}
+}
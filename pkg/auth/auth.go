@@ -1,19 +1,24 @@
 package auth
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	oidc "github.com/coreos/go-oidc"
@@ -21,22 +26,40 @@ import (
 
 	oscrypto "github.com/openshift/library-go/pkg/crypto"
 
+	"github.com/openshift/console/pkg/serverutils"
+
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
 )
 
 const (
-	CSRFCookieName    = "csrf-token"
-	CSRFHeader        = "X-CSRFToken"
-	stateCookieName   = "login-state"
-	errorOAuth        = "oauth_error"
-	errorLoginState   = "login_state_error"
-	errorCookie       = "cookie_error"
-	errorInternal     = "internal_error"
-	errorMissingCode  = "missing_code"
-	errorMissingState = "missing_state"
-	errorInvalidCode  = "invalid_code"
-	errorInvalidState = "invalid_state"
+	CSRFCookieName  = "csrf-token"
+	CSRFHeader      = "X-CSRFToken"
+	stateCookieName = "login-state"
+	// loginRedirectCookieName keeps the validated target of a login or logout request until the next login callback.
+	loginRedirectCookieName = "login-redirect"
+	// embeddedStateSuffix marks the login state of a login started in an embedding parent app.
+	embeddedStateSuffix = ".embedded"
+	errorOAuth          = "oauth_error"
+	errorLoginState     = "login_state_error"
+	errorCookie         = "cookie_error"
+	errorInternal       = "internal_error"
+	errorMissingCode    = "missing_code"
+	errorMissingState   = "missing_state"
+	errorInvalidCode    = "invalid_code"
+	errorInvalidState   = "invalid_state"
+	errorMissingGroups  = "missing_required_groups"
+	errorAuthTooOld     = "auth_too_old"
+	// errorEmailNotVerified rejects a login without a verified email.
+	errorEmailNotVerified = "email_not_verified"
+	// errorTooManyGroups rejects a login with more groups than allowed.
+	errorTooManyGroups = "too_many_groups"
+	// errorInvalidNonce rejects an ID token not issued for the login.
+	errorInvalidNonce = "invalid_nonce"
+	// errorMissingRefreshToken rejects a login without a refresh token.
+	errorMissingRefreshToken = "missing_refresh_token"
+	// errorUnsolicitedLogin rejects a login started by the identity provider.
+	errorUnsolicitedLogin = "unsolicited_login_rejected"
 )
 
 var (
@@ -61,11 +84,72 @@ type Authenticator struct {
 	errorURL      string
 	successURL    string
 	cookiePath    string
+	cookieDomain  string
 	refererURL    *url.URL
 	secureCookies bool
+	// stateCookieTTL limits how long the login state cookie is valid, zero means
+	// the cookie lasts for the browser session.
+	stateCookieTTL time.Duration
+	// responseMode is the OAuth2 response_mode requested from the provider.
+	responseMode string
+	// callbackBody limits the form_post callback bodies.
+	callbackBody callbackBodyLimit
+	// loginHint is sent as login_hint unless the login request has an allowed one.
+	loginHint        string
+	loginHintDomains []string
+	// maxAge is sent as max_age to make the provider re-authenticate users
+	// who authenticated longer ago. Zero omits it.
+	maxAge time.Duration
+	// Requests with embeddedHeader, or from one of embeddedOrigins, come from
+	// an app embedding the console and get SameSite=None cookies.
+	embeddedHeader  string
+	embeddedOrigins []string
+
+	capabilities Capabilities
 
 	k8sConfig *rest.Config
 	metrics   *Metrics
+	// activeSessions is nil unless active sessions are tracked.
+	activeSessions *activeSessions
+	// refreshTokens is nil unless refresh tokens are stored in sessions.
+	refreshTokens *refreshTokenCipher
+	// noRefreshToken is the OnMissingRefreshToken policy.
+	noRefreshToken string
+	// silentRenew enables SilentLoginFunc.
+	silentRenew bool
+	// idpInitiated is nil unless logins started by the identity provider,
+	// without a state cookie, are accepted.
+	idpInitiated *idpInitiatedLogins
+
+	// pending is set while the identity provider couldn't be contacted yet.
+	pending atomic.Bool
+
+	credentials credentialCheck
+
+	// providerFailures is nil unless Config.UnhealthyThreshold is set.
+	providerFailures *providerFailures
+	// providerRefreshes rate limits RefreshProvider.
+	providerRefreshes providerRefreshLimiter
+
+	// audit is nil unless Config.AuditLogFile is set.
+	audit *auditLog
+
+	// noncePolicy is one of the NoncePolicy constants, empty for OpenShift
+	// OAuth, which has no ID token.
+	noncePolicy string
+}
+
+// errProviderPending is returned while the identity provider couldn't be contacted yet.
+var errProviderPending = errors.New("auth provider has not been contacted yet")
+
+// Capabilities is the non-sensitive part of the auth configuration, exposed to
+// the UI to enable features depending on what the login provides.
+type Capabilities struct {
+	// Scopes are the OAuth2 scopes requested at login.
+	Scopes []string
+	// IdentityClaim is the ID token claim used as the stable user ID. It is
+	// empty for OpenShift OAuth, which has no ID token.
+	IdentityClaim string
 }
 
 type SpecialAuthURLs struct {
@@ -82,8 +166,8 @@ type SpecialAuthURLs struct {
 // support. It should not be made public or exposed to other packages.
 type loginMethod interface {
 	// login turns on oauth2 token response into a user session and associates a
-	// cookie with the user.
-	login(http.ResponseWriter, *oauth2.Token) (*loginState, error)
+	// cookie with the given SameSite mode with the user.
+	login(http.ResponseWriter, *oauth2.Token, http.SameSite) (*loginState, error)
 	// Removes user token cookie, but does not write a response.
 	deleteCookie(http.ResponseWriter, *http.Request)
 	// logout deletes any cookies associated with the user, and writes a no-content response.
@@ -91,6 +175,13 @@ type loginMethod interface {
 	getSpecialURLs() SpecialAuthURLs
 }
 
+const (
+	// ResponseModeQuery returns the authorization response in the callback query, the default.
+	ResponseModeQuery = "query"
+	// ResponseModeFormPost returns the authorization response in a POSTed form body.
+	ResponseModeFormPost = "form_post"
+)
+
 // AuthSource allows callers to switch between Tectonic and OpenShift login support.
 type AuthSource int
 
@@ -108,6 +199,41 @@ type Config struct {
 	ClientID     string
 	ClientSecret string
 	Scope        []string
+	// ClientCertFile and ClientKeyFile are a client certificate presented to
+	// the issuer, for providers authenticating the client with mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+	// UserAgent is set on requests to the issuer, e.g. for discovery and
+	// token exchange. Go's default User-Agent is sent if empty.
+	UserAgent string
+	// IssuerOverride is the issuer of the discovery document and ID tokens
+	// if it differs from IssuerURL, which is then only used to reach the
+	// provider, e.g. behind split-horizon DNS.
+	IssuerOverride string
+	// AllowedIssuers are the accepted iss claims of ID tokens. Defaults to
+	// IssuerOverride or IssuerURL.
+	AllowedIssuers []string
+	// SigningAlgs are the accepted signature algorithms of ID tokens. Defaults
+	// to the ones advertised by the provider, see ValidateSigningAlg.
+	SigningAlgs []string
+	// ExtraAudiences are accepted in the ID token audience in addition to the client ID.
+	ExtraAudiences []string
+	// IdentityClaim is the ID token claim used as the stable user ID. Defaults to "sub".
+	IdentityClaim string
+	// ClockSkew is the leeway allowed when checking the ID token exp, nbf and
+	// iat claims against the local clock.
+	ClockSkew time.Duration
+	// RequiredGroups restricts logins to members of any of the groups, or of
+	// all of them with RequireAllGroups.
+	RequiredGroups   []string
+	RequireAllGroups bool
+	// SessionStore keeps the OIDC sessions. Defaults to a MemorySessionStore.
+	SessionStore SessionStore
+	// DiscoveryCacheFile keeps the OIDC discovery document between restarts. It
+	// is used instead of fetching the document while it is younger than
+	// DiscoveryCacheTTL.
+	DiscoveryCacheFile string
+	DiscoveryCacheTTL  time.Duration
 
 	// K8sCA is required for OpenShift OAuth metadata discovery. This is the CA
 	// used to talk to the master, which might be different than the issuer CA.
@@ -119,11 +245,123 @@ type Config struct {
 	// cookiePath is an abstraction leak. (unfortunately, a necessary one.)
 	CookiePath    string
 	SecureCookies bool
+	// CookieDomain is the Domain attribute of the cookies. Empty keeps them
+	// host-only.
+	CookieDomain string
+	// SessionCookieMaxChunks is the number of cookies an OpenShift access
+	// token too large for one cookie may be split across. Zero or one
+	// disables splitting.
+	SessionCookieMaxChunks int
+	// StateCookieTTL is how long the login state cookie is valid. Zero leaves it a session cookie.
+	StateCookieTTL time.Duration
+	// ResponseMode is either ResponseModeQuery or ResponseModeFormPost. Defaults to ResponseModeQuery.
+	ResponseMode string
+	// CallbackMaxBodyBytes and CallbackReadTimeout limit the size of form_post
+	// callback bodies and how long reading them may take. Zero uses the defaults.
+	CallbackMaxBodyBytes int64
+	CallbackReadTimeout  time.Duration
+	// LoginHint is passed to the provider as login_hint. A login_hint query
+	// parameter of the login request overrides it if it is in LoginHintDomains.
+	LoginHint        string
+	LoginHintDomains []string
+
+	// EmbeddedHeader and EmbeddedOrigins detect requests from an app embedding
+	// the console, see Authenticator.isEmbedded. Cookies set for those requests
+	// use SameSite=None instead of Lax.
+	EmbeddedHeader  string
+	EmbeddedOrigins []string
+
+	// IssuerCertExpiryWarning logs a warning at startup when the certificate presented
+	// during discovery expires within this window. Zero disables the check.
+	IssuerCertExpiryWarning time.Duration
+
+	// FollowTokenExpiry ends OIDC sessions ClockSkew before their ID token
+	// expires, unless the session can be refreshed with a refresh token.
+	FollowTokenExpiry bool
+	// StoreRefreshToken keeps the refresh tokens of OIDC sessions following
+	// the token expiry, encrypted with RefreshTokenKey. A random key is used
+	// if it is empty, which only works for sessions kept in memory.
+	StoreRefreshToken bool
+	RefreshTokenKey   []byte
+	// TokenRefreshLeadTime is how long before its ID token expires a session
+	// with a refresh token is refreshed. ClockSkew is used if it is zero.
+	TokenRefreshLeadTime time.Duration
+	// OnMissingRefreshToken is one of the OnMissingRefreshToken constants,
+	// applied to logins without a refresh token when StoreRefreshToken is
+	// set. Empty is OnMissingRefreshTokenWarn.
+	OnMissingRefreshToken string
+	// MaxSessionLifetime ends OIDC sessions this long after the login, even
+	// if they are active or could be refreshed. Zero disables it.
+	MaxSessionLifetime time.Duration
+	// SingleSessionPerUser ends the earlier OIDC sessions of a user when the
+	// user logs in again.
+	SingleSessionPerUser bool
+	// SessionStoreFailurePolicy is one of the SessionStoreFail constants,
+	// applied when the OIDC session store fails. Empty is
+	// SessionStoreFailClosed.
+	SessionStoreFailurePolicy string
+
+	// DisableGroups ignores the groups claim of ID tokens, users have no
+	// groups then.
+	DisableGroups bool
+	// MaxGroups caps the number of groups kept from the groups claim of ID
+	// tokens, following GroupsOverflowPolicy. Zero keeps all groups.
+	MaxGroups int
+	// GroupsOverflowPolicy is one of the GroupsOverflowPolicy constants.
+	GroupsOverflowPolicy string
+
+	// RequireVerifiedEmail rejects OIDC logins unless the ID token has
+	// email_verified=true.
+	RequireVerifiedEmail bool
+
+	// SilentRenew enables Authenticator.SilentLoginFunc, which renews OIDC
+	// sessions with prompt=none in a hidden iframe.
+	SilentRenew bool
+
+	// AllowIdPInitiatedLogin accepts OIDC login callbacks without the state
+	// cookie of a login started by the console, e.g. from an SSO portal. Their
+	// ID token must be recent and carry a nonce that wasn't used before.
+	AllowIdPInitiatedLogin bool
+
+	// MaxAge makes the OIDC provider re-authenticate users who authenticated
+	// longer ago, and rejects ID tokens with an older or missing auth_time
+	// claim. Zero disables it.
+	MaxAge time.Duration
+
+	// TrackActiveSessions keeps the sessions created by this instance in memory
+	// to report their number.
+	TrackActiveSessions bool
+
+	// CredentialCheckInterval periodically checks that the provider accepts the
+	// client ID and secret. Zero disables the check.
+	CredentialCheckInterval time.Duration
+
+	// UnhealthyThreshold is how long discovery or fetching the signing keys
+	// of the provider may keep failing before Authenticator.Liveness reports
+	// an error. Zero disables the check.
+	UnhealthyThreshold time.Duration
+
+	// AuditLogFile is appended an AuditRecord for every login and logout.
+	// Empty disables the audit log.
+	AuditLogFile string
+
+	// NoncePolicy is one of the NoncePolicy constants. Empty, like
+	// NoncePolicyDisabled, neither sends nor checks a nonce. Ignored for
+	// OpenShift OAuth.
+	NoncePolicy string
 
 	K8sConfig *rest.Config
 	Metrics   *Metrics
 }
 
+func (c *Config) requiredGroups() groupRequirement {
+	return groupRequirement{groups: c.RequiredGroups, all: c.RequireAllGroups}
+}
+
+func (c *Config) groupsLimit() groupsLimit {
+	return groupsLimit{max: c.MaxGroups, reject: c.GroupsOverflowPolicy == GroupsOverflowPolicyReject}
+}
+
 func newHTTPClient(issuerCA string, includeSystemRoots bool) (*http.Client, error) {
 	if issuerCA == "" {
 		return http.DefaultClient, nil
@@ -173,108 +411,402 @@ func newHTTPClient(issuerCA string, includeSystemRoots bool) (*http.Client, erro
 	return httpClient, nil
 }
 
-// NewAuthenticator initializes an Authenticator struct. It blocks until the authenticator is
-// able to contact the provider.
+// withClientCertificate returns a copy of client presenting cert to servers
+// requesting a client certificate.
+func withClientCertificate(client *http.Client, cert tls.Certificate) *http.Client {
+	var transport *http.Transport
+	if t, ok := client.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = oscrypto.SecureTLSConfig(&tls.Config{})
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   client.Timeout,
+	}
+}
+
+// withUserAgent returns a copy of client setting the User-Agent header of its
+// requests to userAgent.
+func withUserAgent(client *http.Client, userAgent string) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &http.Client{
+		Transport: &userAgentTransport{next: next, userAgent: userAgent},
+		Timeout:   client.Timeout,
+	}
+}
+
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(r)
+}
+
+// Retry contacting the identity provider in the background, starting after
+// discoveryRetryBackoff and doubling up to discoveryRetryMaxBackoff.
+var (
+	discoveryRetryBackoff    = 10 * time.Second
+	discoveryRetryMaxBackoff = 5 * time.Minute
+)
+
+// NewAuthenticator initializes an Authenticator struct. If the provider can't
+// be contacted because of a transient error, the authenticator is returned
+// unhealthy and keeps retrying in the background until the provider responds
+// or ctx is done. Permanent errors, like a wrong issuer, are returned.
 func NewAuthenticator(ctx context.Context, c *Config) (*Authenticator, error) {
-	// Retry connecting to the identity provider every 10s for 5 minutes
-	const (
-		backoff  = time.Second * 10
-		maxSteps = 30
-	)
-	steps := 0
+	a, err := newUnstartedAuthenticator(c)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		a, err := newUnstartedAuthenticator(c)
-		if err != nil {
+	if err = a.start(ctx, c); err != nil {
+		if isPermanentDiscoveryError(err) {
+			klog.Errorf("error contacting auth provider: %v", err)
 			return nil, err
 		}
 
-		var authSourceFunc func() (oauth2.Endpoint, loginMethod, error)
-		switch c.AuthSource {
-		case AuthSourceOpenShift:
-			a.userFunc = getOpenShiftUser
-			authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
-				// Use the k8s CA for OAuth metadata discovery.
-				k8sClient, errK8Client := newHTTPClient(c.K8sCA, true)
-				if errK8Client != nil {
-					return oauth2.Endpoint{}, nil, errK8Client
-				}
-
-				return newOpenShiftAuth(ctx, &openShiftConfig{
-					k8sClient:     k8sClient,
-					oauthClient:   a.clientFunc(),
-					issuerURL:     c.IssuerURL,
-					cookiePath:    c.CookiePath,
-					secureCookies: c.SecureCookies,
-				})
+		klog.Errorf("error contacting auth provider (retrying in %s): %v", discoveryRetryBackoff, err)
+		a.providerFailures.record(err)
+		a.pending.Store(true)
+		go a.retryStart(ctx, c)
+	}
+
+	if c.CredentialCheckInterval > 0 {
+		go a.checkCredentialsPeriodically(ctx, c, c.CredentialCheckInterval)
+	}
+
+	if a.activeSessions != nil {
+		go a.activeSessions.evictPeriodically(ctx, activeSessionsEvictInterval)
+	}
+
+	return a, nil
+}
+
+// retryStart retries contacting the identity provider with backoff until it
+// succeeds, then marks the authenticator as healthy.
+func (a *Authenticator) retryStart(ctx context.Context, c *Config) {
+	backoff := discoveryRetryBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		err := a.start(ctx, c)
+		a.providerFailures.record(err)
+		if err == nil {
+			klog.Infof("contacted auth provider %s", c.IssuerURL)
+			a.pending.Store(false)
+			return
+		}
+
+		if backoff *= 2; backoff > discoveryRetryMaxBackoff {
+			backoff = discoveryRetryMaxBackoff
+		}
+		klog.Errorf("error contacting auth provider (retrying in %s): %v", backoff, err)
+	}
+}
+
+// isPermanentDiscoveryError returns true for errors that retrying won't fix.
+// The provider libraries don't return typed errors, so the messages are matched.
+func isPermanentDiscoveryError(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Op == "parse" {
+		return true
+	}
+
+	msg := err.Error()
+	// go-oidc and fetch start with the status, followed by the body, which
+	// may say anything: "404 Not Found: <body>". OpenShift discovery ends
+	// with it: "discovery through endpoint <url> failed: 404 Not Found".
+	notFound := fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	if strings.HasPrefix(msg, notFound+":") || strings.HasSuffix(msg, " failed: "+notFound) {
+		return true
+	}
+
+	for _, permanent := range []string{
+		"issuer did not match",
+		"url is not absolute",
+	} {
+		if strings.Contains(msg, permanent) {
+			return true
+		}
+	}
+	return false
+}
+
+// start contacts the identity provider and sets up the login method. The
+// authenticator is only modified if the provider could be contacted.
+func (a *Authenticator) start(ctx context.Context, c *Config) error {
+	var (
+		userFunc       func(*http.Request) (*User, error)
+		authSourceFunc func() (oauth2.Endpoint, loginMethod, error)
+	)
+	switch c.AuthSource {
+	case AuthSourceOpenShift:
+		userFunc = func(r *http.Request) (*User, error) {
+			return getOpenShiftUser(r, c.SessionCookieMaxChunks)
+		}
+		authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
+			// Use the k8s CA for OAuth metadata discovery.
+			k8sClient, errK8Client := newHTTPClient(c.K8sCA, true)
+			if errK8Client != nil {
+				return oauth2.Endpoint{}, nil, errK8Client
 			}
-		default:
-			// OIDC auth source is stateful, so only create it once.
-			endpoint, oidcAuthSource, err := newOIDCAuth(ctx, &oidcConfig{
-				client:        a.clientFunc(),
+
+			return newOpenShiftAuth(ctx, &openShiftConfig{
+				k8sClient:     k8sClient,
+				oauthClient:   a.clientFunc(),
 				issuerURL:     c.IssuerURL,
-				clientID:      c.ClientID,
 				cookiePath:    c.CookiePath,
+				cookieDomain:  c.CookieDomain,
 				secureCookies: c.SecureCookies,
+
+				requiredGroups: c.requiredGroups(),
+				k8sConfig:      c.K8sConfig,
+
+				sessionCookieMaxChunks: c.SessionCookieMaxChunks,
 			})
-			a.userFunc = func(r *http.Request) (*User, error) {
-				if oidcAuthSource == nil {
-					return nil, fmt.Errorf("OIDC auth source is not intialized")
-				}
-				return oidcAuthSource.authenticate(r)
-			}
-			authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
-				return endpoint, oidcAuthSource, err
+		}
+	default:
+		// OIDC auth source is stateful, so only create it once.
+		endpoint, oidcAuthSource, err := newOIDCAuth(ctx, &oidcConfig{
+			client:         a.clientFunc(),
+			issuerURL:      c.IssuerURL,
+			clientID:       c.ClientID,
+			allowedIssuers: c.AllowedIssuers,
+			extraAudiences: c.ExtraAudiences,
+			identityClaim:  c.IdentityClaim,
+			clockSkew:      c.ClockSkew,
+			sessions:       c.SessionStore,
+			cookiePath:     c.CookiePath,
+			cookieDomain:   c.CookieDomain,
+			secureCookies:  c.SecureCookies,
+
+			discoveryCacheFile: c.DiscoveryCacheFile,
+			discoveryCacheTTL:  c.DiscoveryCacheTTL,
+
+			requiredGroups: c.requiredGroups(),
+			groupsLimit:    c.groupsLimit(),
+
+			followTokenExpiry: c.FollowTokenExpiry,
+			refresh:           a.refreshToken,
+			refreshTokens:     a.refreshTokens,
+			refreshLeadTime:   c.TokenRefreshLeadTime,
+
+			maxSessionLifetime:   c.MaxSessionLifetime,
+			singleSessionPerUser: c.SingleSessionPerUser,
+			storeFailOpen:        c.SessionStoreFailurePolicy == SessionStoreFailOpenReadOnly,
+
+			maxAge:         c.MaxAge,
+			issuerOverride: c.IssuerOverride,
+			signingAlgs:    c.SigningAlgs,
+			disableGroups:  c.DisableGroups,
+
+			requireVerifiedEmail: c.RequireVerifiedEmail,
+
+			providerFailures: a.providerFailures,
+			metrics:          c.Metrics,
+		})
+		userFunc = func(r *http.Request) (*User, error) {
+			if oidcAuthSource == nil {
+				return nil, fmt.Errorf("OIDC auth source is not intialized")
 			}
+			return oidcAuthSource.authenticate(r)
 		}
+		authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
+			return endpoint, oidcAuthSource, err
+		}
+	}
 
-		fallbackEndpoint, fallbackLoginMethod, err := authSourceFunc()
-		if err != nil {
-			steps++
-			if steps > maxSteps {
-				klog.Errorf("error contacting auth provider: %v", err)
-				return nil, err
+	if c.AuthSource == AuthSourceOpenShift {
+		// The OAuth metadata is discovered again when it gets stale.
+		discover := authSourceFunc
+		authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
+			endpoint, lm, err := discover()
+			a.providerFailures.record(err)
+			return endpoint, lm, err
+		}
+	}
+
+	fallbackEndpoint, fallbackLoginMethod, err := authSourceFunc()
+	if err != nil {
+		return err
+	}
+
+	if c.IssuerCertExpiryWarning > 0 {
+		discoveryClient := a.clientFunc()
+		if c.AuthSource == AuthSourceOpenShift {
+			// OAuth metadata discovery goes through the API server.
+			if k8sClient, errK8Client := newHTTPClient(c.K8sCA, true); errK8Client == nil {
+				discoveryClient = k8sClient
 			}
+		}
+		checkIssuerCertExpiry(ctx, discoveryClient, c.IssuerURL, c.IssuerCertExpiryWarning, c.Metrics)
+	}
 
-			klog.Errorf("error contacting auth provider (retrying in %s): %v", backoff, err)
+	a.userFunc = userFunc
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		// rebuild non-pointer struct each time to prevent any mutation
+		baseOAuth2Config := oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Scopes:       c.Scope,
+			Endpoint:     fallbackEndpoint,
+		}
+		if c.ClientSecret == "" {
+			// Clients authenticating with a certificate only send their ID.
+			baseOAuth2Config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+		}
 
-			time.Sleep(backoff)
-			continue
+		currentEndpoint, currentLoginMethod, errAuthSource := authSourceFunc()
+		if errAuthSource != nil {
+			klog.Errorf("failed to get latest auth source data: %v", errAuthSource)
+			return &baseOAuth2Config, fallbackLoginMethod
 		}
 
-		a.authFunc = func() (*oauth2.Config, loginMethod) {
-			// rebuild non-pointer struct each time to prevent any mutation
-			baseOAuth2Config := oauth2.Config{
-				ClientID:     c.ClientID,
-				ClientSecret: c.ClientSecret,
-				RedirectURL:  c.RedirectURL,
-				Scopes:       c.Scope,
-				Endpoint:     fallbackEndpoint,
-			}
+		baseOAuth2Config.Endpoint = currentEndpoint
+		if c.ClientSecret == "" {
+			baseOAuth2Config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+		}
+		return &baseOAuth2Config, currentLoginMethod
+	}
 
-			currentEndpoint, currentLoginMethod, errAuthSource := authSourceFunc()
-			if errAuthSource != nil {
-				klog.Errorf("failed to get latest auth source data: %v", errAuthSource)
-				return &baseOAuth2Config, fallbackLoginMethod
-			}
+	return nil
+}
+
+// checkIssuerCertExpiry warns when the earliest expiring certificate presented
+// by the issuer expires within the given window.
+func checkIssuerCertExpiry(ctx context.Context, client *http.Client, issuerURL string, window time.Duration, metrics *Metrics) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, issuerURL, nil)
+	if err != nil {
+		klog.Errorf("failed to check issuer certificate expiry: %v", err)
+		return
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		klog.Errorf("failed to check issuer certificate expiry: %v", err)
+		return
+	}
+	resp.Body.Close()
 
-			baseOAuth2Config.Endpoint = currentEndpoint
-			return &baseOAuth2Config, currentLoginMethod
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return
+	}
+
+	notAfter := resp.TLS.PeerCertificates[0].NotAfter
+	for _, cert := range resp.TLS.PeerCertificates[1:] {
+		if cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
 		}
+	}
 
-		return a, nil
+	if metrics != nil {
+		metrics.IssuerCertificateExpires(notAfter)
+	}
+
+	if remaining := notAfter.Sub(time.Now()); remaining < window {
+		klog.Warningf("certificate presented by issuer %s expires in %s (at %s)", issuerURL, remaining.Round(time.Minute), notAfter)
 	}
 }
 
 func newUnstartedAuthenticator(c *Config) (*Authenticator, error) {
+	issuerClient := func() (*http.Client, error) {
+		return newHTTPClient(c.IssuerCA, true)
+	}
+	if c.ClientCertFile != "" {
+		clientCert, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %v", err)
+		}
+		// Keep one client per issuer CA client so connections are reused.
+		var clientCertClients sync.Map
+		issuerClient = func() (*http.Client, error) {
+			client, err := newHTTPClient(c.IssuerCA, true)
+			if err != nil {
+				return nil, err
+			}
+			certClient, _ := clientCertClients.LoadOrStore(client, withClientCertificate(client, clientCert))
+			return certClient.(*http.Client), nil
+		}
+	}
+
+	if c.UserAgent != "" {
+		// Keep one client per issuer client so connections are reused.
+		var userAgentClients sync.Map
+		next := issuerClient
+		issuerClient = func() (*http.Client, error) {
+			client, err := next()
+			if err != nil {
+				return nil, err
+			}
+			uaClient, _ := userAgentClients.LoadOrStore(client, withUserAgent(client, c.UserAgent))
+			return uaClient.(*http.Client), nil
+		}
+	}
+
 	// make sure we get a valid starting client
-	fallbackClient, err := newHTTPClient(c.IssuerCA, true)
+	fallbackClient, err := issuerClient()
 	if err != nil {
 		return nil, err
 	}
 
+	var sessions *activeSessions
+	if c.TrackActiveSessions {
+		sessions = newActiveSessions(c.Metrics)
+	}
+
+	var refreshTokens *refreshTokenCipher
+	if c.StoreRefreshToken {
+		if refreshTokens, err = newRefreshTokenCipher(c.RefreshTokenKey); err != nil {
+			return nil, err
+		}
+	}
+
+	var idpInitiated *idpInitiatedLogins
+	if c.AllowIdPInitiatedLogin {
+		idpInitiated = newIdPInitiatedLogins(c.ClockSkew)
+	}
+
+	var failures *providerFailures
+	if c.UnhealthyThreshold > 0 {
+		failures = newProviderFailures(c.UnhealthyThreshold, c.Metrics)
+	}
+
+	noncePolicy := c.NoncePolicy
+	if c.AuthSource == AuthSourceOpenShift {
+		noncePolicy = ""
+	}
+
+	var audit *auditLog
+	if c.AuditLogFile != "" {
+		authType := "oidc"
+		if c.AuthSource == AuthSourceOpenShift {
+			authType = "openshift"
+		}
+		if audit, err = newAuditLog(c.AuditLogFile, authType); err != nil {
+			return nil, err
+		}
+	}
+
 	clientFunc := func() *http.Client {
-		currentClient, err := newHTTPClient(c.IssuerCA, true)
+		currentClient, err := issuerClient()
 		if err != nil {
 			klog.Errorf("failed to get latest http client: %v", err)
 			return fallbackClient
@@ -301,15 +833,41 @@ func newUnstartedAuthenticator(c *Config) (*Authenticator, error) {
 		return nil, err
 	}
 
+	capabilities := Capabilities{Scopes: c.Scope}
+	if c.AuthSource != AuthSourceOpenShift {
+		capabilities.IdentityClaim = defaultIdentityClaim
+		if c.IdentityClaim != "" {
+			capabilities.IdentityClaim = c.IdentityClaim
+		}
+	}
+
 	return &Authenticator{
-		clientFunc:    clientFunc,
-		errorURL:      errURL,
-		successURL:    sucURL,
-		cookiePath:    c.CookiePath,
-		refererURL:    refUrl,
-		secureCookies: c.SecureCookies,
-		k8sConfig:     c.K8sConfig,
-		metrics:       c.Metrics,
+		clientFunc:       clientFunc,
+		errorURL:         errURL,
+		successURL:       sucURL,
+		cookiePath:       c.CookiePath,
+		cookieDomain:     c.CookieDomain,
+		refererURL:       refUrl,
+		secureCookies:    c.SecureCookies,
+		stateCookieTTL:   c.StateCookieTTL,
+		responseMode:     c.ResponseMode,
+		callbackBody:     newCallbackBodyLimit(c.CallbackMaxBodyBytes, c.CallbackReadTimeout),
+		loginHint:        c.LoginHint,
+		loginHintDomains: c.LoginHintDomains,
+		maxAge:           c.MaxAge,
+		embeddedHeader:   c.EmbeddedHeader,
+		embeddedOrigins:  c.EmbeddedOrigins,
+		capabilities:     capabilities,
+		k8sConfig:        c.K8sConfig,
+		metrics:          c.Metrics,
+		activeSessions:   sessions,
+		refreshTokens:    refreshTokens,
+		noRefreshToken:   c.OnMissingRefreshToken,
+		idpInitiated:     idpInitiated,
+		providerFailures: failures,
+		silentRenew:      c.SilentRenew,
+		audit:            audit,
+		noncePolicy:      noncePolicy,
 	}, nil
 }
 
@@ -318,18 +876,98 @@ type User struct {
 	ID       string
 	Username string
 	Token    string
+	// Groups are taken from the groups claim of the ID token, if any.
+	Groups []string
+}
+
+// Healthy returns an error until the identity provider has been contacted.
+func (a *Authenticator) Healthy() error {
+	if a.pending.Load() {
+		return errProviderPending
+	}
+	return nil
 }
 
 func (a *Authenticator) Authenticate(r *http.Request) (*User, error) {
+	if err := a.Healthy(); err != nil {
+		return nil, err
+	}
 	return a.userFunc(r)
 }
 
 func (a *Authenticator) DeleteCookie(w http.ResponseWriter, r *http.Request) {
+	if a.Healthy() != nil {
+		return
+	}
+	if a.activeSessions != nil {
+		a.activeSessions.loggedOut(r)
+	}
 	a.getLoginMethod().deleteCookie(w, r)
 }
 
+// ActiveSessions returns the number of unexpired sessions created by this
+// instance. It returns false if active sessions aren't tracked.
+func (a *Authenticator) ActiveSessions() (int, bool) {
+	if a.activeSessions == nil {
+		return 0, false
+	}
+	return a.activeSessions.count(), true
+}
+
+// ErrSessionInvalidationUnsupported is returned by InvalidateSessions for auth
+// sources whose sessions aren't kept by the console.
+var ErrSessionInvalidationUnsupported = errors.New("sessions of this auth source are not kept by the console and can't be invalidated")
+
+// sessionInvalidator is implemented by login methods that keep sessions.
+type sessionInvalidator interface {
+	invalidateSessions(ctx context.Context) (int64, error)
+}
+
+// InvalidateSessions logs out all users by starting a new session epoch. It
+// returns the new epoch.
+func (a *Authenticator) InvalidateSessions(ctx context.Context) (int64, error) {
+	if err := a.Healthy(); err != nil {
+		return 0, err
+	}
+	invalidator, ok := a.getLoginMethod().(sessionInvalidator)
+	if !ok {
+		return 0, ErrSessionInvalidationUnsupported
+	}
+	epoch, err := invalidator.invalidateSessions(ctx)
+	if err == nil && a.activeSessions != nil {
+		a.activeSessions.reset()
+	}
+	return epoch, err
+}
+
 // LoginFunc redirects to the OIDC provider for user login.
+//
+// The optional `then` query parameter (or `rd` or `return_to`, for compatibility
+// with other proxies) is the page the user is sent to after a successful login. It must be
+// a path below the console base path, or an absolute URL of the console
+// itself. Other targets are ignored and the user lands on the success URL.
 func (a *Authenticator) LoginFunc(w http.ResponseWriter, r *http.Request) {
+	a.startLogin(w, r, "", a.isEmbedded(r))
+}
+
+const (
+	// promptNone asks the provider not to interact with the user.
+	promptNone = "none"
+	// promptConsent asks the provider to prompt the user for consent.
+	promptConsent = "consent"
+)
+
+// startLogin sets the state cookie and redirects to the provider with the
+// prompt parameter, if set. A silent login, with promptNone, asks the
+// provider not to interact with the user. An embedded login is for a console
+// embedded in another app.
+func (a *Authenticator) startLogin(w http.ResponseWriter, r *http.Request, prompt string, embedded bool) {
+	silent := prompt == promptNone
+	if err := a.Healthy(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
 	if a.metrics != nil {
 		a.metrics.LoginRequested()
 	}
@@ -340,14 +978,208 @@ func (a *Authenticator) LoginFunc(w http.ResponseWriter, r *http.Request) {
 	}
 	state := hex.EncodeToString(randData[:])
 
+	if embedded {
+		// The callback comes from the provider, remember that the session cookie is for an embedded console.
+		state += embeddedStateSuffix
+	}
+	if prompt == promptConsent {
+		// The callback doesn't ask for consent again.
+		state += consentStateSuffix
+	}
+
 	cookie := http.Cookie{
 		Name:     stateCookieName,
 		Value:    state,
 		HttpOnly: true,
+		Domain:   a.cookieDomain,
 		Secure:   a.secureCookies,
+		SameSite: a.loginCookieSameSite(embedded),
+	}
+	if a.stateCookieTTL > 0 {
+		cookie.MaxAge = int(a.stateCookieTTL.Seconds())
+	}
+	if silent {
+		cookie.Name = silentStateCookieName
+		cookie.Value += silentStateSuffix
+		state = cookie.Value
+		// The silent login endpoint isn't next to the callback, unlike the login endpoint.
+		if redirectURL, err := url.Parse(a.getOAuth2Config().RedirectURL); err == nil {
+			cookie.Path = redirectURL.Path
+		}
+	}
+
+	var opts []oauth2.AuthCodeOption
+	if a.responseMode == ResponseModeFormPost {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", ResponseModeFormPost))
+	}
+	if loginHint := a.getLoginHint(r); loginHint != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("login_hint", loginHint))
+	}
+	if a.maxAge > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("max_age", strconv.Itoa(int(a.maxAge.Seconds()))))
+	}
+	if prompt != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("prompt", prompt))
+	}
+	if a.checksNonce() {
+		nonce, nonceCookie := newNonce(&cookie)
+		opts = append(opts, oidc.Nonce(nonce))
+		http.SetCookie(w, nonceCookie)
 	}
 	http.SetCookie(w, &cookie)
-	http.Redirect(w, r, a.getOAuth2Config().AuthCodeURL(state), http.StatusSeeOther)
+
+	// Without a target, keep the one stored on logout.
+	if target := loginRedirectParam(r); target != "" && !silent {
+		a.setLoginRedirect(w, a.validateLoginRedirect(target), cookie.MaxAge, cookie.SameSite)
+	}
+	http.Redirect(w, r, a.getOAuth2Config().AuthCodeURL(state, opts...), http.StatusSeeOther)
+}
+
+// isEmbedded returns true if the request comes from an app embedding the
+// console: it has the configured embedded header, or its Origin or Referer is
+// one of the configured embedded origins.
+func (a *Authenticator) isEmbedded(r *http.Request) bool {
+	if a.embeddedHeader != "" && r.Header.Get(a.embeddedHeader) != "" {
+		return true
+	}
+
+	for _, source := range []string{r.Header.Get("Origin"), r.Header.Get("Referer")} {
+		if source == "" {
+			continue
+		}
+		u, err := url.Parse(source)
+		if err != nil {
+			continue
+		}
+		for _, origin := range a.embeddedOrigins {
+			if u.Scheme+"://"+u.Host == origin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cookieSameSite returns SameSite=None for cookies of an embedded console and
+// Lax otherwise. Browsers reject SameSite=None without the Secure attribute,
+// so it is only used with secure cookies.
+func (a *Authenticator) cookieSameSite(embedded bool) http.SameSite {
+	if embedded && a.secureCookies {
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// loginCookieSameSite is cookieSameSite for the cookies read by the login callback.
+func (a *Authenticator) loginCookieSameSite(embedded bool) http.SameSite {
+	if a.responseMode == ResponseModeFormPost {
+		// The provider POSTs the response cross-site, browsers only send the cookies along with SameSite=None.
+		return http.SameSiteNoneMode
+	}
+	return a.cookieSameSite(embedded)
+}
+
+func loginRedirectParam(r *http.Request) string {
+	q := r.URL.Query()
+	for _, param := range []string{"then", "rd", "return_to"} {
+		if target := q.Get(param); target != "" {
+			return target
+		}
+	}
+	return ""
+}
+
+// validateLoginRedirect returns the path, query and fragment of target if it
+// points to the console, and "" otherwise. Returning only a path below the base
+// path prevents open redirects to other hosts.
+func (a *Authenticator) validateLoginRedirect(target string) string {
+	if target == "" || strings.Contains(target, "\\") {
+		return ""
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+
+	if u.Scheme != "" || u.Host != "" {
+		if u.Scheme != a.refererURL.Scheme || u.Host != a.refererURL.Host {
+			return ""
+		}
+	}
+
+	if !strings.HasPrefix(u.Path, "/") {
+		return ""
+	}
+
+	// Cleaning also collapses a leading "//", which browsers treat as another host.
+	cleanPath := path.Clean(u.Path)
+	basePath := strings.TrimSuffix(a.refererURL.Path, "/")
+	if cleanPath != basePath && !strings.HasPrefix(cleanPath, basePath+"/") {
+		return ""
+	}
+
+	return (&url.URL{Path: cleanPath, RawQuery: u.RawQuery, Fragment: u.Fragment}).String()
+}
+
+// SetLoginRedirect stores the page to show after the next login, like the
+// `then` parameter of LoginFunc. A target outside of the console is dropped, so
+// that the user lands on the success URL.
+func (a *Authenticator) SetLoginRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	a.setLoginRedirect(w, a.validateLoginRedirect(target), 0, a.loginCookieSameSite(a.isEmbedded(r)))
+}
+
+// setLoginRedirect sets the cookie for an already validated target, or deletes it if the target is empty.
+func (a *Authenticator) setLoginRedirect(w http.ResponseWriter, target string, maxAge int, sameSite http.SameSite) {
+	cookie := http.Cookie{
+		Name:     loginRedirectCookieName,
+		Value:    url.QueryEscape(target),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Domain:   a.cookieDomain,
+		Secure:   a.secureCookies,
+		SameSite: sameSite,
+	}
+	if target == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// getLoginRedirect returns the validated target stored by LoginFunc or SetLoginRedirect, if any.
+func (a *Authenticator) getLoginRedirect(r *http.Request) string {
+	cookie, err := r.Cookie(loginRedirectCookieName)
+	if err != nil {
+		return ""
+	}
+
+	target, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return ""
+	}
+
+	return a.validateLoginRedirect(target)
+}
+
+// getLoginHint returns the login_hint of the login request if it is allowed,
+// otherwise the configured one. Only a user or domain in one of the allowed
+// domains is forwarded, so that arbitrary values can't be passed to the provider.
+func (a *Authenticator) getLoginHint(r *http.Request) string {
+	hint := r.URL.Query().Get("login_hint")
+	if hint == "" || strings.Count(hint, "@") > 1 {
+		return a.loginHint
+	}
+
+	for _, domain := range a.loginHintDomains {
+		if strings.EqualFold(hint, domain) || strings.HasSuffix(strings.ToLower(hint), "@"+strings.ToLower(domain)) {
+			return hint
+		}
+	}
+
+	if klog.V(4) {
+		newRequestLog(r).Infof("ignoring login_hint %q, not in an allowed domain", hint)
+	}
+	return a.loginHint
 }
 
 // LogoutFunc cleans up session cookies.
@@ -356,34 +1188,156 @@ func (a *Authenticator) LogoutFunc(w http.ResponseWriter, r *http.Request) {
 		a.metrics.LogoutRequested(UnknownLogoutReason)
 	}
 
+	if a.Healthy() != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if a.activeSessions != nil {
+		a.activeSessions.loggedOut(r)
+	}
+	if a.audit != nil {
+		user, _ := a.userFunc(r)
+		a.audit.record(r, auditEventLogout, auditOutcomeSuccess, "", user)
+	}
 	a.getLoginMethod().logout(w, r)
 }
 
 // GetKubeAdminLogoutURL returns the logout URL for the special kube:admin user in OpenShift
 func (a *Authenticator) GetSpecialURLs() SpecialAuthURLs {
+	if a.Healthy() != nil {
+		return SpecialAuthURLs{}
+	}
 	return a.getLoginMethod().getSpecialURLs()
 }
 
+// GetCapabilities returns the scopes and claims provided by the login.
+func (a *Authenticator) GetCapabilities() Capabilities {
+	return a.capabilities
+}
+
+const (
+	// defaultCallbackMaxBodyBytes leaves plenty of room for the code, state
+	// and an ID token or error description in a form_post callback.
+	defaultCallbackMaxBodyBytes = 1 << 20
+	defaultCallbackReadTimeout  = 10 * time.Second
+)
+
+var (
+	errCallbackBodyTooLarge = errors.New("callback body is too large")
+	errCallbackBodyTimeout  = errors.New("timed out reading the callback body")
+)
+
+// callbackBodyLimit bounds the callback bodies read into memory, and how long
+// a client may take to send them.
+type callbackBodyLimit struct {
+	maxBytes    int64
+	readTimeout time.Duration
+}
+
+func newCallbackBodyLimit(maxBytes int64, readTimeout time.Duration) callbackBodyLimit {
+	if maxBytes <= 0 {
+		maxBytes = defaultCallbackMaxBodyBytes
+	}
+	if readTimeout <= 0 {
+		readTimeout = defaultCallbackReadTimeout
+	}
+	return callbackBodyLimit{maxBytes: maxBytes, readTimeout: readTimeout}
+}
+
+// read reads body up to the limit. A stalled read is abandoned after the
+// timeout, it ends when the server closes the request body.
+func (l callbackBodyLimit) read(body io.Reader) ([]byte, error) {
+	type result struct {
+		body []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		b, err := io.ReadAll(io.LimitReader(body, l.maxBytes+1))
+		done <- result{body: b, err: err}
+	}()
+
+	timer := time.NewTimer(l.readTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		if int64(len(res.body)) > l.maxBytes {
+			return nil, fmt.Errorf("%w: more than %d bytes", errCallbackBodyTooLarge, l.maxBytes)
+		}
+		return res.body, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w after %s", errCallbackBodyTimeout, l.readTimeout)
+	}
+}
+
 // CallbackFunc handles OAuth2 callbacks and code/token exchange.
-// Requests with unexpected params are redirected to the root route.
+// Requests with unexpected params are redirected to the root route. Clients
+// that accept JSON get a LoginSuccessJSON instead of the response of fn.
 func (a *Authenticator) CallbackFunc(fn func(loginInfo LoginJSON, successURL string, w http.ResponseWriter)) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := newRequestLog(r)
+		if err := a.Healthy(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
 		q := r.URL.Query()
+		if a.responseMode == ResponseModeFormPost {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			body, err := a.callbackBody.read(r.Body)
+			if err != nil {
+				log.Errorf("rejecting callback: %v", err)
+				http.Error(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if err := r.ParseForm(); err != nil {
+				log.Errorf("failed to parse callback form: %v", err)
+				a.redirectAuthError(w, r, errorMissingCode, "")
+				return
+			}
+			q = r.PostForm
+		}
 		qErr := q.Get("error")
 		qErrDesc := q.Get("error_description")
 		code := q.Get("code")
 		urlState := q.Get("state")
 
+		silent := a.silentRenew && strings.HasSuffix(urlState, silentStateSuffix)
+		stateCookie := stateCookieName
+		if silent {
+			r = r.WithContext(withSilentLogin(r.Context()))
+			stateCookie = silentStateCookieName
+			if silentLoginErrors[qErr] {
+				log.Infof("silent login requires an interactive login: %s", qErr)
+				sendSilentLoginError(w, qErr, qErrDesc)
+				return
+			}
+		}
+
 		if qErr != "" && qErrDesc != "" {
-			klog.Errorf("OAuth error: %s", qErrDesc)
-			a.redirectAuthError(w, qErrDesc)
+			log.Errorf("OAuth error: %s", qErrDesc)
+			a.redirectAuthError(w, r, qErr, qErrDesc)
 			return
 		}
 
-		cookieState, err := r.Cookie(stateCookieName)
-		if err != nil {
-			klog.Errorf("failed to parse state cookie: %v", err)
-			a.redirectAuthError(w, errorMissingState)
+		// A login started by the identity provider has neither a state
+		// cookie nor a state parameter.
+		var idpInitiated bool
+		cookieState, err := r.Cookie(stateCookie)
+		if err != nil && a.idpInitiated != nil && urlState == "" {
+			idpInitiated = true
+		} else if err != nil {
+			log.Errorf("failed to parse state cookie: %v", err)
+			a.redirectAuthError(w, r, errorMissingState, "")
 			return
 		}
 
@@ -394,39 +1348,128 @@ func (a *Authenticator) CallbackFunc(fn func(loginInfo LoginJSON, successURL str
 		}
 
 		if code == "" {
-			klog.Error("missing auth code in query param")
-			a.redirectAuthError(w, errorMissingCode)
+			log.Errorf("missing auth code in query param")
+			a.redirectAuthError(w, r, errorMissingCode, "")
 			return
 		}
 
-		if urlState != cookieState.Value {
-			klog.Error("state in url does not match State cookie")
-			a.redirectAuthError(w, errorInvalidState)
+		if !idpInitiated && urlState != cookieState.Value {
+			log.Errorf("state in url does not match State cookie")
+			a.redirectAuthError(w, r, errorInvalidState, "")
 			return
 		}
 		ctx := oidc.ClientContext(context.TODO(), a.clientFunc())
 		oauthConfig, lm := a.authFunc()
 		token, err := oauthConfig.Exchange(ctx, code)
 		if err != nil {
-			klog.Errorf("unable to verify auth code with issuer: %v", err)
-			a.redirectAuthError(w, errorInvalidCode)
+			log.Errorf("unable to verify auth code with issuer: %v", err)
+			a.redirectAuthError(w, r, errorInvalidCode, "")
+			return
+		}
+
+		if idpInitiated {
+			if err := a.idpInitiated.check(token); err != nil {
+				log.Errorf("%v", err)
+				a.redirectAuthError(w, r, errorUnsolicitedLogin, "The login started by your identity provider could not be accepted. Please log in from the console.")
+				return
+			}
+			log.Infof("accepting login started by the identity provider")
+		} else if err := a.checkNonce(r, stateCookie, token); err != nil {
+			log.Errorf("rejecting login: %v", err)
+			a.redirectAuthError(w, r, errorInvalidNonce, "")
 			return
 		}
 
-		ls, err := lm.login(w, token)
+		var state string
+		if !idpInitiated {
+			state = cookieState.Value
+		}
+		embedded := strings.HasSuffix(strings.TrimSuffix(strings.TrimSuffix(state, silentStateSuffix), consentStateSuffix), embeddedStateSuffix)
+		if !a.checkRefreshToken(w, r, token, state, embedded) {
+			return
+		}
+		ls, err := lm.login(w, token, a.cookieSameSite(embedded))
+		if errors.Is(err, errMissingRequiredGroups) {
+			log.Errorf("rejecting login: %v", err)
+			a.redirectAuthError(w, r, errorMissingGroups, "You are not a member of the groups required to access the console.")
+			return
+		}
+		if errors.Is(err, errTooManyGroups) {
+			log.Errorf("rejecting login: %v", err)
+			a.redirectAuthError(w, r, errorTooManyGroups, "You are a member of more groups than the console allows.")
+			return
+		}
+		if errors.Is(err, errAuthTooOld) {
+			log.Errorf("rejecting login: %v", err)
+			a.redirectAuthError(w, r, errorAuthTooOld, "Your login at the identity provider is too old. Please log in again.")
+			return
+		}
+		if errors.Is(err, errEmailNotVerified) {
+			log.Errorf("rejecting login: %v", err)
+			a.redirectAuthError(w, r, errorEmailNotVerified, "Your email address has not been verified by your identity provider.")
+			return
+		}
 		if err != nil {
-			klog.Errorf("error constructing login state: %v", err)
-			a.redirectAuthError(w, errorInternal)
+			log.Errorf("error constructing login state: %v", err)
+			a.redirectAuthError(w, r, errorInternal, "")
 			return
 		}
 
+		if a.activeSessions != nil {
+			a.activeSessions.loggedIn(w.Header())
+		}
+
 		if a.metrics != nil {
 			a.metrics.LoginSuccessful(a.k8sConfig, ls)
+			if size := sessionCookieSize(w.Header()); size > 0 {
+				a.metrics.SessionCookieWritten(size)
+			}
+		}
+		a.audit.record(r, auditEventLogin, auditOutcomeSuccess, "", &User{ID: ls.UserID, Username: ls.Name, Groups: ls.Groups})
+
+		if silent {
+			log.Infof("silent login succeeded")
+			w.Header().Set("Cache-Control", "no-store")
+			serverutils.SendResponse(w, http.StatusOK, ls.toLoginJSON())
+			return
+		}
+
+		successURL := a.successURL
+		if target := a.getLoginRedirect(r); target != "" {
+			successURL = target
 		}
+		a.setLoginRedirect(w, "", 0, a.loginCookieSameSite(embedded))
 
-		klog.Infof("oauth success, redirecting to: %q", a.successURL)
-		fn(ls.toLoginJSON(), a.successURL, w)
+		if serverutils.AcceptsJSON(r) {
+			log.Infof("oauth success, responding with JSON")
+			w.Header().Set("Cache-Control", "no-store")
+			serverutils.SendResponse(w, http.StatusOK, LoginSuccessJSON{LoginJSON: ls.toLoginJSON(), Authenticated: true, SuccessURL: successURL})
+			return
+		}
+
+		log.Infof("oauth success, redirecting to: %q", successURL)
+		fn(ls.toLoginJSON(), successURL, w)
+	}
+}
+
+// sessionCookieSize returns the size of the Set-Cookie headers written for the
+// chunks of the session cookie, or 0 if the login method didn't write one.
+// Deleted chunks aren't counted.
+func sessionCookieSize(header http.Header) int {
+	size := 0
+	for _, cookie := range header.Values("Set-Cookie") {
+		if isCookieChunk(cookie, openshiftAccessTokenCookieName) && !strings.Contains(cookie, "Max-Age=0") {
+			size += len(cookie)
+		}
 	}
+	return size
+}
+
+// refreshToken exchanges a refresh token for new tokens at the provider.
+func (a *Authenticator) refreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	ctx = oidc.ClientContext(ctx, a.clientFunc())
+	oauthConfig, _ := a.authFunc()
+	return oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
 }
 
 func (a *Authenticator) getOAuth2Config() *oauth2.Config {
@@ -439,10 +1482,38 @@ func (a *Authenticator) getLoginMethod() loginMethod {
 	return lm
 }
 
-func (a *Authenticator) redirectAuthError(w http.ResponseWriter, authErr string) {
+// AuthErrorJSON is the response to login failures for clients that accept
+// JSON, it mirrors the OAuth error response.
+type AuthErrorJSON struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// LoginSuccessJSON is the response to a successful login for clients that
+// accept JSON, instead of the page that sends browsers on to SuccessURL. The
+// session cookie is set along with it.
+type LoginSuccessJSON struct {
+	LoginJSON
+	Authenticated bool   `json:"authenticated"`
+	SuccessURL    string `json:"successURL"`
+}
+
+// redirectAuthError sends the browser to the error page. Clients that accept
+// JSON get the error in the response body instead.
+func (a *Authenticator) redirectAuthError(w http.ResponseWriter, r *http.Request, authErr, description string) {
 	if a.metrics != nil {
 		a.metrics.LoginFailed(UnknownLoginFailureReason)
 	}
+	a.audit.record(r, auditEventLogin, auditOutcomeFailure, authErr, nil)
+
+	if serverutils.AcceptsJSON(r) || isSilentLogin(r.Context()) {
+		status := http.StatusUnauthorized
+		if authErr == errorInternal {
+			status = http.StatusInternalServerError
+		}
+		serverutils.SendResponse(w, status, AuthErrorJSON{Error: authErr, ErrorDescription: description})
+		return
+	}
 
 	var u url.URL
 	up, err := url.Parse(a.errorURL)
@@ -451,9 +1522,16 @@ func (a *Authenticator) redirectAuthError(w http.ResponseWriter, authErr string)
 	} else {
 		u = *up
 	}
-	q := url.Values{}
+	// Keep the query of a configured error redirect.
+	q := u.Query()
 	q.Set("error", authErr)
+	if description != "" {
+		q.Set("error_description", description)
+	}
 	q.Set("error_type", "auth")
+	if requestID := serverutils.RequestIDFrom(r.Context()); requestID != "" {
+		q.Set("request_id", requestID)
+	}
 	u.RawQuery = q.Encode()
 	w.Header().Set("Location", u.String())
 	w.WriteHeader(http.StatusSeeOther)
@@ -493,15 +1571,16 @@ func (a *Authenticator) VerifySourceOrigin(r *http.Request) (err error) {
 	return nil
 }
 
-func (a *Authenticator) SetCSRFCookie(path string, w *http.ResponseWriter) {
+func (a *Authenticator) SetCSRFCookie(path string, r *http.Request, w *http.ResponseWriter) {
 	cookie := http.Cookie{
 		Name:  CSRFCookieName,
 		Value: randomString(64),
 		// JS needs to read this Cookie
 		HttpOnly: false,
 		Path:     path,
+		Domain:   a.cookieDomain,
 		Secure:   a.secureCookies,
-		SameSite: http.SameSiteLaxMode,
+		SameSite: a.cookieSameSite(a.isEmbedded(r)),
 	}
 
 	http.SetCookie(*w, &cookie)
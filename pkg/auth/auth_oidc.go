@@ -6,88 +6,771 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	oidc "github.com/coreos/go-oidc"
 	"golang.org/x/oauth2"
+	"k8s.io/klog"
 )
 
 type oidcAuth struct {
-	verifier *oidc.IDTokenVerifier
+	verifierMu sync.Mutex
+	verifier   *oidc.IDTokenVerifier
+	// rediscover is set when the discovery document was loaded from the cache.
+	// It fetches the document once when a signature can't be verified, in case
+	// the provider moved its keys since the document was cached.
+	rediscover func(ctx context.Context) (*oidc.IDTokenVerifier, error)
+	// discover fetches the discovery document again, returning it with a
+	// verifier that fetches the signing keys anew.
+	discover func(ctx context.Context) (*providerMetadata, *oidc.IDTokenVerifier, error)
+	// client fetches the signing keys when the provider is refreshed on demand.
+	client *http.Client
+	// allowedIssuers are checked after verification instead of the issuer
+	// check of the verifier, which only accepts the discovered issuer.
+	allowedIssuers []string
+	// audiences is only set when extra audiences are configured, the verifier
+	// checks for the client ID otherwise.
+	audiences []string
+	// identityClaim is the claim used as the stable user ID.
+	identityClaim string
+	// clockSkew is the leeway allowed for the exp, nbf and iat claims of the ID token.
+	clockSkew time.Duration
+	// requiredGroups is checked against the groups claim at login.
+	requiredGroups groupRequirement
+	// disableGroups ignores the groups claim.
+	disableGroups bool
+	// groupsLimit caps the number of groups kept from the groups claim.
+	groupsLimit groupsLimit
+	// requireVerifiedEmail rejects ID tokens without email_verified=true.
+	requireVerifiedEmail bool
+	// followTokenExpiry ends sessions clockSkew before their ID token expires,
+	// or refreshes them with the refresh token of the session, if any.
+	followTokenExpiry bool
+	// refresh exchanges a refresh token for new tokens at the provider.
+	refresh func(ctx context.Context, refreshToken string) (*oauth2.Token, error)
+	// refreshing holds the refreshes in flight by session token, concurrent
+	// requests of a session wait for the same refresh.
+	refreshMux sync.Mutex
+	refreshing map[string]*sessionRefresh
+	// refreshTokens encrypts the refresh tokens kept in sessions. Refresh
+	// tokens aren't kept if it is nil.
+	refreshTokens *refreshTokenCipher
+	// refreshLeadTime is how long before its ID token expires a session with
+	// a refresh token is refreshed, clockSkew if zero.
+	refreshLeadTime time.Duration
+	// maxAge rejects logins whose auth_time is older, or missing. Zero
+	// disables the check.
+	maxAge time.Duration
+	// maxSessionLifetime ends sessions this long after the login, however
+	// active they are and even if they could be refreshed. Zero disables it.
+	maxSessionLifetime time.Duration
+	// singleSessionPerUser rejects the sessions of a user but the latest one.
+	singleSessionPerUser bool
 
 	// This preserves the old logic of associating users with session keys
 	// and requires smart routing when running multiple backend instances.
-	sessions *SessionStore
+	sessions SessionStore
+	// storeFailOpen accepts read-only requests with the fallback cookie while
+	// the session store fails.
+	storeFailOpen bool
 
 	cookiePath    string
+	cookieDomain  string
 	secureCookies bool
+
+	// providerFailures tracks failures to fetch the signing keys, if set.
+	providerFailures *providerFailures
+	metrics          *Metrics
 }
 
 type oidcConfig struct {
-	client        *http.Client
-	issuerURL     string
-	clientID      string
-	cookiePath    string
-	secureCookies bool
+	client         *http.Client
+	issuerURL      string
+	clientID       string
+	allowedIssuers []string
+	extraAudiences []string
+	identityClaim  string
+	clockSkew      time.Duration
+	cookiePath     string
+	cookieDomain   string
+	secureCookies  bool
+	sessions       SessionStore
+	storeFailOpen  bool
+
+	discoveryCacheFile string
+	discoveryCacheTTL  time.Duration
+
+	requiredGroups groupRequirement
+	disableGroups  bool
+	groupsLimit    groupsLimit
+
+	requireVerifiedEmail bool
+
+	followTokenExpiry bool
+	refresh           func(ctx context.Context, refreshToken string) (*oauth2.Token, error)
+	refreshTokens     *refreshTokenCipher
+	refreshLeadTime   time.Duration
+
+	maxSessionLifetime   time.Duration
+	singleSessionPerUser bool
+
+	maxAge time.Duration
+	// issuerOverride is the expected issuer if it differs from issuerURL.
+	issuerOverride string
+	// signingAlgs restricts the accepted ID token signature algorithms.
+	signingAlgs []string
+
+	providerFailures *providerFailures
+	metrics          *Metrics
+}
+
+// issuer returns the issuer expected in the discovery document and ID tokens.
+func (c *oidcConfig) issuer() string {
+	if len(c.issuerOverride) > 0 {
+		return c.issuerOverride
+	}
+	return c.issuerURL
+}
+
+func (c *oidcConfig) verifierConfig() *oidc.Config {
+	return &oidc.Config{
+		ClientID: c.clientID,
+		// The verifier only accepts the client ID as audience, extra audiences are checked after verification.
+		SkipClientIDCheck: len(c.extraAudiences) > 0,
+		// The verifier only accepts the discovered issuer, the allowed issuers are checked after verification.
+		SkipIssuerCheck: true,
+		// The verifier checks exp without leeway and nbf with a fixed one, both are checked with clockSkew after verification, like iat.
+		SkipExpiryCheck: true,
+		// Defaults to the algorithms advertised by the provider if empty.
+		SupportedSigningAlgs: c.signingAlgs,
+	}
+}
+
+func (c *oidcConfig) audiences() []string {
+	if len(c.extraAudiences) == 0 {
+		return nil
+	}
+	return append([]string{c.clientID}, c.extraAudiences...)
+}
+
+func (c *oidcConfig) getAllowedIssuers() []string {
+	if len(c.allowedIssuers) == 0 {
+		return []string{c.issuer()}
+	}
+	return c.allowedIssuers
+}
+
+func (c *oidcConfig) getSessionStore() SessionStore {
+	if c.sessions == nil {
+		return NewSessionStore(32768)
+	}
+	return c.sessions
 }
 
 func newOIDCAuth(ctx context.Context, c *oidcConfig) (oauth2.Endpoint, *oidcAuth, error) {
 	ctx = oidc.ClientContext(ctx, c.client)
+	if len(c.discoveryCacheFile) > 0 {
+		return newCachedOIDCAuth(ctx, c)
+	}
+	if len(c.issuerOverride) > 0 {
+		// go-oidc requires the discovered issuer to be the discovery URL.
+		m, err := fetchProviderMetadata(ctx, c.issuerURL, c.issuer())
+		if err != nil {
+			return oauth2.Endpoint{}, nil, err
+		}
+		checkSigningAlgs(c.signingAlgs, m.Algorithms)
+		o := c.newAuth(m.verifier(ctx, c.verifierConfig()))
+		o.discover = c.discoverFunc(ctx, nil)
+		return m.endpoint(), o, nil
+	}
+
 	p, err := oidc.NewProvider(ctx, c.issuerURL)
 	if err != nil {
 		return oauth2.Endpoint{}, nil, err
 	}
+	var m providerMetadata
+	if err := p.Claims(&m); err != nil {
+		return oauth2.Endpoint{}, nil, err
+	}
+	checkSigningAlgs(c.signingAlgs, m.Algorithms)
 
-	return p.Endpoint(), &oidcAuth{
-		verifier: p.Verifier(&oidc.Config{
-			ClientID: c.clientID,
-		}),
-		sessions:      NewSessionStore(32768),
-		cookiePath:    c.cookiePath,
-		secureCookies: c.secureCookies,
-	}, nil
+	o := c.newAuth(p.Verifier(c.verifierConfig()))
+	o.discover = c.discoverFunc(ctx, nil)
+	return p.Endpoint(), o, nil
 }
 
-func (o *oidcAuth) login(w http.ResponseWriter, token *oauth2.Token) (*loginState, error) {
-	rawIDToken, ok := token.Extra("id_token").(string)
-	if !ok {
-		return nil, errors.New("token response did not have an id_token field")
+// newCachedOIDCAuth discovers the provider through the discovery cache file.
+func newCachedOIDCAuth(ctx context.Context, c *oidcConfig) (oauth2.Endpoint, *oidcAuth, error) {
+	cache := &discoveryCache{
+		path: c.discoveryCacheFile,
+		ttl:  c.discoveryCacheTTL,
+		now:  defaultNow,
+	}
+	m, fromCache, err := cache.discover(ctx, c.issuerURL, c.issuer())
+	if err != nil {
+		return oauth2.Endpoint{}, nil, err
 	}
+	checkSigningAlgs(c.signingAlgs, m.Algorithms)
 
-	idToken, err := o.verifier.Verify(context.Background(), rawIDToken)
+	o := c.newAuth(m.verifier(ctx, c.verifierConfig()))
+	o.discover = c.discoverFunc(ctx, cache)
+	if fromCache {
+		o.rediscover = func(reqCtx context.Context) (*oidc.IDTokenVerifier, error) {
+			_, verifier, err := o.discover(reqCtx)
+			return verifier, err
+		}
+	}
+	return m.endpoint(), o, nil
+}
+
+// discoverFunc returns the discover function of oidcAuth, updating cache if it
+// is set. The verifiers it returns fetch keys with ctx, which must outlive them.
+func (c *oidcConfig) discoverFunc(ctx context.Context, cache *discoveryCache) func(context.Context) (*providerMetadata, *oidc.IDTokenVerifier, error) {
+	return func(reqCtx context.Context) (*providerMetadata, *oidc.IDTokenVerifier, error) {
+		reqCtx = oidc.ClientContext(reqCtx, c.client)
+		var m *providerMetadata
+		var err error
+		if cache != nil {
+			m, err = cache.refresh(reqCtx, c.issuerURL, c.issuer())
+		} else {
+			m, err = fetchProviderMetadata(reqCtx, c.issuerURL, c.issuer())
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return m, m.verifier(ctx, c.verifierConfig()), nil
+	}
+}
+
+func (c *oidcConfig) newAuth(verifier *oidc.IDTokenVerifier) *oidcAuth {
+	return &oidcAuth{
+		verifier:       verifier,
+		client:         c.client,
+		allowedIssuers: c.getAllowedIssuers(),
+		audiences:      c.audiences(),
+		identityClaim:  c.identityClaim,
+		clockSkew:      c.clockSkew,
+		requiredGroups: c.requiredGroups,
+		disableGroups:  c.disableGroups,
+		groupsLimit:    c.groupsLimit,
+		sessions:       c.getSessionStore(),
+		storeFailOpen:  c.storeFailOpen,
+		cookiePath:     c.cookiePath,
+		cookieDomain:   c.cookieDomain,
+		secureCookies:  c.secureCookies,
+
+		followTokenExpiry: c.followTokenExpiry,
+		refresh:           c.refresh,
+		refreshing:        map[string]*sessionRefresh{},
+		refreshTokens:     c.refreshTokens,
+		refreshLeadTime:   c.refreshLeadTime,
+
+		maxSessionLifetime:   c.maxSessionLifetime,
+		singleSessionPerUser: c.singleSessionPerUser,
+
+		maxAge: c.maxAge,
+
+		requireVerifiedEmail: c.requireVerifiedEmail,
+
+		providerFailures: c.providerFailures,
+		metrics:          c.metrics,
+	}
+}
+
+func (o *oidcAuth) login(w http.ResponseWriter, token *oauth2.Token, sameSite http.SameSite) (*loginState, error) {
+	ls, err := o.newLoginState(context.Background(), token)
 	if err != nil {
 		return nil, err
 	}
-	var c json.RawMessage
-	if err := idToken.Claims(&c); err != nil {
-		return nil, fmt.Errorf("parsing claims: %v", err)
+	if err := o.checkAuthTime(ls.authTime, time.Now()); err != nil {
+		return nil, err
 	}
-	ls, err := newLoginState(rawIDToken, []byte(c))
-	if err != nil {
+	if o.followTokenExpiry && o.refreshTokens != nil && token.RefreshToken != "" {
+		if err := o.checkRefreshLeadTime(ls); err != nil {
+			return nil, err
+		}
+		if ls.encryptedRefreshToken, err = o.refreshTokens.encrypt(token.RefreshToken); err != nil {
+			return nil, err
+		}
+	}
+	if ls.epoch, err = o.sessions.Epoch(context.Background()); err != nil {
 		return nil, err
 	}
-	if err := o.sessions.addSession(ls); err != nil {
+	ls.loginTime = ls.now()
+	o.setKeepUntil(ls, token)
+	ls.sessionToken = randomString(128)
+	if err := o.sessions.Set(context.Background(), ls.sessionToken, ls); err != nil {
 		return nil, err
 	}
+	if o.singleSessionPerUser {
+		if err := o.sessions.SetLatestSession(context.Background(), ls); err != nil {
+			return nil, err
+		}
+	}
 
 	cookie := http.Cookie{
 		Name:     openshiftAccessTokenCookieName,
 		Value:    ls.sessionToken,
-		MaxAge:   maxAge(ls.exp, time.Now()),
+		MaxAge:   o.cookieMaxAge(ls),
 		HttpOnly: true,
 		Path:     o.cookiePath,
+		Domain:   o.cookieDomain,
 		Secure:   o.secureCookies,
+		SameSite: sameSite,
 	}
 	http.SetCookie(w, &cookie)
+	if o.storeFailOpen {
+		o.setFallbackCookie(w, ls, sameSite)
+	}
 
-	o.sessions.pruneSessions()
 	return ls, nil
 }
 
+// newLoginState verifies the ID token of a token response and checks that the
+// user is allowed to log in.
+func (o *oidcAuth) newLoginState(ctx context.Context, token *oauth2.Token) (*loginState, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response did not have an id_token field")
+	}
+
+	idToken, err := o.verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	var c json.RawMessage
+	if err := idToken.Claims(&c); err != nil {
+		return nil, fmt.Errorf("parsing claims: %v", err)
+	}
+	ls, err := newLoginState(rawIDToken, []byte(c), o.identityClaim)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkEmailVerified(c); err != nil {
+		return nil, err
+	}
+	if o.disableGroups {
+		ls.Groups = nil
+	}
+	if !o.requiredGroups.allows(ls.Groups) {
+		return nil, errMissingRequiredGroups
+	}
+	// Required groups are checked against all groups, only the kept ones end
+	// up in the session.
+	groups, err := o.groupsLimit.apply(ls.Groups)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) < len(ls.Groups) {
+		klog.Warningf("keeping %d of the %d groups of user %q, see --user-auth-oidc-max-groups", len(groups), len(ls.Groups), ls.UserID)
+	}
+	ls.Groups = groups
+	return ls, nil
+}
+
+// cookieMaxAge returns the max-age of the session cookie. Following the token
+// expiry, a session that can be refreshed outlives its ID token, so its cookie
+// lasts for the browser session and the server decides when it ends.
+func (o *oidcAuth) cookieMaxAge(ls *loginState) int {
+	age := o.tokenCookieMaxAge(ls)
+	if deadline, ok := o.sessionDeadline(ls); ok {
+		if lifetime := maxAge(deadline, time.Now()); age == 0 || lifetime < age {
+			return lifetime
+		}
+	}
+	return age
+}
+
+// tokenCookieMaxAge returns the max age of the session cookie following the
+// ID token of ls, zero for sessions that are refreshed.
+func (o *oidcAuth) tokenCookieMaxAge(ls *loginState) int {
+	if !o.followTokenExpiry {
+		return maxAge(ls.exp, time.Now())
+	}
+	if ls.encryptedRefreshToken != "" {
+		return 0
+	}
+	return maxAge(ls.exp.Add(-o.clockSkew), time.Now())
+}
+
+// sessionDeadline returns when ls ends because of the maximum session
+// lifetime, and false if there is none. Sessions without a login time, from
+// before it was recorded, are already past it.
+func (o *oidcAuth) sessionDeadline(ls *loginState) (time.Time, bool) {
+	if o.maxSessionLifetime <= 0 {
+		return time.Time{}, false
+	}
+	if ls.loginTime.IsZero() {
+		return time.Time{}, true
+	}
+	return ls.loginTime.Add(o.maxSessionLifetime), true
+}
+
+// defaultRefreshTokenLifetime is assumed for refresh tokens when the provider
+// doesn't return refresh_expires_in.
+const defaultRefreshTokenLifetime = 24 * time.Hour
+
+// refreshable returns whether ls is refreshed instead of ended when its ID
+// token expires.
+func (o *oidcAuth) refreshable(ls *loginState) bool {
+	return o.followTokenExpiry && o.refreshTokens != nil && ls.encryptedRefreshToken != ""
+}
+
+// setKeepUntil keeps a refreshable session in the store as long as its
+// refresh token lives, rather than its ID token, but not past the maximum
+// session lifetime.
+func (o *oidcAuth) setKeepUntil(ls *loginState, token *oauth2.Token) {
+	if !o.refreshable(ls) {
+		ls.keepUntil = time.Time{}
+		return
+	}
+	lifetime := defaultRefreshTokenLifetime
+	var seconds float64
+	switch v := token.Extra("refresh_expires_in").(type) {
+	case float64:
+		seconds = v
+	case string:
+		seconds, _ = strconv.ParseFloat(v, 64)
+	}
+	if seconds > 0 {
+		lifetime = time.Duration(seconds) * time.Second
+	}
+	ls.keepUntil = ls.now().Add(lifetime)
+	if deadline, ok := o.sessionDeadline(ls); ok && deadline.Before(ls.keepUntil) {
+		ls.keepUntil = deadline
+	}
+	if ls.keepUntil.Before(ls.exp) {
+		ls.keepUntil = ls.exp
+	}
+}
+
+// sessionRefresh is a refresh of a session in flight. done is closed once ls
+// or err is set.
+type sessionRefresh struct {
+	done chan struct{}
+	ls   *loginState
+	err  error
+}
+
+// refreshLeadTimeOrDefault returns how long before its ID token expires a
+// session with a refresh token is refreshed.
+func (o *oidcAuth) refreshLeadTimeOrDefault() time.Duration {
+	if o.refreshLeadTime > 0 {
+		return o.refreshLeadTime
+	}
+	return o.clockSkew
+}
+
+// checkRefreshLeadTime rejects ID tokens that expire within the configured
+// refresh lead time, their sessions would be refreshed on every request.
+func (o *oidcAuth) checkRefreshLeadTime(ls *loginState) error {
+	if o.refreshLeadTime == 0 {
+		return nil
+	}
+	if lifetime := ls.exp.Sub(ls.now()); lifetime <= o.refreshLeadTime {
+		return fmt.Errorf("ID token lifetime %s is not longer than the token refresh lead time %s", lifetime.Round(time.Second), o.refreshLeadTime)
+	}
+	return nil
+}
+
+// sessionRefreshTimeout bounds a refresh, which doesn't end with the request
+// that started it.
+const sessionRefreshTimeout = 30 * time.Second
+
+// refreshSession replaces the ID token of a session about to expire with one
+// issued for the refresh token of the session. The session keeps its token.
+// Concurrent refreshes of the same session share the result of the first,
+// which runs on its own context, so that callers going away don't fail it
+// for the others.
+func (o *oidcAuth) refreshSession(ctx context.Context, ls *loginState) (*loginState, error) {
+	o.refreshMux.Lock()
+	inFlight, ok := o.refreshing[ls.sessionToken]
+	if !ok {
+		inFlight = &sessionRefresh{done: make(chan struct{})}
+		o.refreshing[ls.sessionToken] = inFlight
+		go func() {
+			refreshCtx, cancel := context.WithTimeout(context.Background(), sessionRefreshTimeout)
+			defer cancel()
+			inFlight.ls, inFlight.err = o.doRefreshSession(refreshCtx, ls)
+
+			o.refreshMux.Lock()
+			delete(o.refreshing, ls.sessionToken)
+			o.refreshMux.Unlock()
+			close(inFlight.done)
+		}()
+	}
+	o.refreshMux.Unlock()
+
+	select {
+	case <-inFlight.done:
+		return inFlight.ls, inFlight.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// isInvalidGrant returns whether the provider rejected the refresh token, as
+// opposed to the refresh failing for a reason that may go away.
+func isInvalidGrant(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant"
+}
+
+// doRefreshSession refreshes ls. The session is only deleted if it can't be
+// refreshed anymore: its refresh token can't be decrypted or is rejected by
+// the provider. Other failures leave it to be refreshed by a later request.
+func (o *oidcAuth) doRefreshSession(ctx context.Context, ls *loginState) (*loginState, error) {
+	// The session might have been refreshed already, e.g. by another replica.
+	if current, err := o.sessions.Get(ctx, ls.sessionToken); err == nil && current != nil && current.exp.After(ls.exp) {
+		return current, nil
+	}
+
+	refreshToken, err := o.refreshTokens.decrypt(ls.encryptedRefreshToken)
+	if err != nil {
+		o.sessions.Delete(ctx, ls.sessionToken)
+		return nil, fmt.Errorf("failed to refresh the session: %v", err)
+	}
+	start := time.Now()
+	token, err := o.refresh(ctx, refreshToken)
+	if o.metrics != nil {
+		o.metrics.TokenRefreshed(time.Since(start), err)
+	}
+	if err != nil {
+		if isInvalidGrant(err) {
+			o.sessions.Delete(ctx, ls.sessionToken)
+		}
+		return nil, fmt.Errorf("failed to refresh the session: %v", err)
+	}
+	refreshed, err := o.newLoginState(ctx, token)
+	if err == nil {
+		err = o.checkRefreshLeadTime(refreshed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh the session: %v", err)
+	}
+	refreshed.sessionToken = ls.sessionToken
+	refreshed.epoch = ls.epoch
+	refreshed.loginTime = ls.loginTime
+	refreshed.encryptedRefreshToken = ls.encryptedRefreshToken
+	refreshed.keepUntil = ls.keepUntil
+	if token.RefreshToken != "" {
+		// The provider rotates refresh tokens.
+		if refreshed.encryptedRefreshToken, err = o.refreshTokens.encrypt(token.RefreshToken); err != nil {
+			return nil, err
+		}
+		o.setKeepUntil(refreshed, token)
+	}
+
+	if err := o.sessions.Replace(ctx, ls.sessionToken, refreshed); err != nil {
+		return nil, err
+	}
+	if o.singleSessionPerUser {
+		// Keep the latest session recorded as long as it lives, unless the
+		// user logged in again in the meantime.
+		if latest, err := o.sessions.LatestSession(ctx, refreshed.UserID); err == nil && latest == sessionKey(ls.sessionToken) {
+			if err := o.sessions.SetLatestSession(ctx, refreshed); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return refreshed, nil
+}
+
+// errTokenNotYetValid is returned when the ID token nbf or iat claim is in the
+// future by more than the allowed clock skew.
+var errTokenNotYetValid = errors.New("oidc: token is not valid yet")
+
+// verify verifies the raw ID token and checks that it is currently valid and
+// that its audience contains one of the accepted audiences.
+func (o *oidcAuth) verify(ctx context.Context, rawIDToken string) (*oidc.IDToken, error) {
+	idToken, err := o.getVerifier().Verify(ctx, rawIDToken)
+	if err != nil && isSignatureError(err) {
+		if verifier := o.rediscoverVerifier(ctx); verifier != nil {
+			idToken, err = verifier.Verify(ctx, rawIDToken)
+		}
+	}
+	if err != nil {
+		if isKeyFetchError(err) {
+			o.providerFailures.record(err)
+		}
+		return nil, err
+	}
+	o.providerFailures.record(nil)
+
+	if err := o.checkValidity(idToken, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if !o.issuerAllowed(idToken.Issuer) {
+		return nil, fmt.Errorf("oidc: issuer %q is not one of the allowed issuers %q", idToken.Issuer, o.allowedIssuers)
+	}
+
+	if len(o.audiences) == 0 {
+		return idToken, nil
+	}
+
+	for _, aud := range idToken.Audience {
+		for _, accepted := range o.audiences {
+			if aud == accepted {
+				return idToken, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("oidc: expected audience to contain one of %q got %q", o.audiences, idToken.Audience)
+}
+
+func (o *oidcAuth) getVerifier() *oidc.IDTokenVerifier {
+	o.verifierMu.Lock()
+	defer o.verifierMu.Unlock()
+	return o.verifier
+}
+
+// rediscoverVerifier replaces the verifier built from a cached discovery
+// document with one from a freshly fetched document. It returns nil if the
+// document was not cached or was already fetched again.
+func (o *oidcAuth) rediscoverVerifier(ctx context.Context) *oidc.IDTokenVerifier {
+	o.verifierMu.Lock()
+	defer o.verifierMu.Unlock()
+	if o.rediscover == nil {
+		return nil
+	}
+
+	verifier, err := o.rediscover(ctx)
+	if err != nil {
+		klog.Errorf("failed to refresh the cached OIDC discovery document: %v", err)
+		return nil
+	}
+	klog.Infof("refreshed the cached OIDC discovery document after a signature verification failure")
+	o.verifier, o.rediscover = verifier, nil
+	return verifier
+}
+
+// refreshProvider fetches the discovery document and the signing keys of the
+// provider and verifies ID tokens with the new keys from then on. The
+// endpoints of the provider are kept, they are only read at startup.
+func (o *oidcAuth) refreshProvider(ctx context.Context) (*ProviderRefresh, error) {
+	if o.discover == nil {
+		return nil, ErrProviderRefreshUnsupported
+	}
+	m, verifier, err := o.discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the discovery document: %v", err)
+	}
+	keys, err := fetchJWKS(oidc.ClientContext(ctx, o.client), m.JWKSURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the signing keys: %v", err)
+	}
+
+	o.verifierMu.Lock()
+	defer o.verifierMu.Unlock()
+	o.verifier, o.rediscover = verifier, nil
+	return &ProviderRefresh{Issuer: m.Issuer, JWKSURL: m.JWKSURL, Keys: keys}, nil
+}
+
+// isSignatureError returns true if go-oidc failed to verify the signature of
+// an ID token, which it only reports in the error message.
+func isSignatureError(err error) bool {
+	return strings.Contains(err.Error(), "failed to verify signature")
+}
+
+// issuerAllowed returns true if issuer is one of the allowed issuers.
+func (o *oidcAuth) issuerAllowed(issuer string) bool {
+	for _, allowed := range o.allowedIssuers {
+		if issuer == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkValidity rejects ID tokens that expired more than the allowed clock
+// skew ago, and tokens whose iat or nbf claim is later than now plus the skew.
+func (o *oidcAuth) checkValidity(idToken *oidc.IDToken, now time.Time) error {
+	if idToken.Expiry.Before(now.Add(-o.clockSkew)) {
+		return fmt.Errorf("oidc: token is expired (Token Expiry: %v)", idToken.Expiry)
+	}
+
+	if !idToken.IssuedAt.IsZero() && now.Add(o.clockSkew).Before(idToken.IssuedAt) {
+		return fmt.Errorf("%w: current time %v is before the iat (issued at) time %v", errTokenNotYetValid, now, idToken.IssuedAt)
+	}
+
+	var claims struct {
+		NotBefore *float64 `json:"nbf"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return fmt.Errorf("parsing claims: %v", err)
+	}
+	if claims.NotBefore == nil {
+		return nil
+	}
+
+	nbf := time.Unix(int64(*claims.NotBefore), 0)
+	if now.Add(o.clockSkew).Before(nbf) {
+		return fmt.Errorf("%w: current time %v is before the nbf (not before) time %v", errTokenNotYetValid, now, nbf)
+	}
+	return nil
+}
+
+// errAuthTooOld is returned by login when the user authenticated at the
+// provider longer ago than the max age.
+var errAuthTooOld = errors.New("oidc: authentication is older than the max age")
+
+// checkAuthTime rejects logins whose auth_time claim is older than the max age
+// plus the allowed clock skew. A missing auth_time is rejected as well, the
+// provider must include it when max_age is requested.
+func (o *oidcAuth) checkAuthTime(authTime time.Time, now time.Time) error {
+	if o.maxAge <= 0 {
+		return nil
+	}
+	if authTime.IsZero() {
+		return fmt.Errorf("%w: token has no auth_time claim", errAuthTooOld)
+	}
+	if authTime.Before(now.Add(-o.maxAge - o.clockSkew)) {
+		return fmt.Errorf("%w: auth_time %v is more than %v ago", errAuthTooOld, authTime, o.maxAge)
+	}
+	return nil
+}
+
+// errEmailNotVerified is returned by login when a verified email is required
+// and the ID token doesn't have email_verified=true.
+var errEmailNotVerified = errors.New("oidc: email is not verified")
+
+// checkEmailVerified rejects ID tokens whose email_verified claim is false or
+// missing if a verified email is required. Some providers send the claim as a
+// string.
+func (o *oidcAuth) checkEmailVerified(claims []byte) error {
+	if !o.requireVerifiedEmail {
+		return nil
+	}
+	var c struct {
+		EmailVerified interface{} `json:"email_verified"`
+	}
+	if err := json.Unmarshal(claims, &c); err != nil {
+		return fmt.Errorf("parsing claims: %v", err)
+	}
+
+	var verified bool
+	switch v := c.EmailVerified.(type) {
+	case nil:
+		return fmt.Errorf("%w: token has no email_verified claim", errEmailNotVerified)
+	case bool:
+		verified = v
+	case string:
+		verified, _ = strconv.ParseBool(v)
+	}
+	if !verified {
+		return fmt.Errorf("%w: email_verified is %v", errEmailNotVerified, c.EmailVerified)
+	}
+	return nil
+}
+
 func (o *oidcAuth) deleteCookie(w http.ResponseWriter, r *http.Request) {
 	// The returned login state can be nil even if err == nil.
 	if ls, _ := o.getLoginState(r); ls != nil {
-		o.sessions.deleteSession(ls.sessionToken)
+		o.sessions.Delete(r.Context(), ls.sessionToken)
 	}
 
 	// Delete session cookie
@@ -97,9 +780,13 @@ func (o *oidcAuth) deleteCookie(w http.ResponseWriter, r *http.Request) {
 		MaxAge:   0,
 		HttpOnly: true,
 		Path:     o.cookiePath,
+		Domain:   o.cookieDomain,
 		Secure:   o.secureCookies,
 	}
 	http.SetCookie(w, &cookie)
+	if o.storeFailOpen {
+		o.deleteFallbackCookie(w)
+	}
 }
 
 func (o *oidcAuth) logout(w http.ResponseWriter, r *http.Request) {
@@ -113,17 +800,66 @@ func (o *oidcAuth) getLoginState(r *http.Request) (*loginState, error) {
 		return nil, err
 	}
 	sessionToken := sessionCookie.Value
-	ls := o.sessions.getSession(sessionToken)
+	ls, err := o.sessions.Get(r.Context(), sessionToken)
+	if err != nil {
+		return o.sessionStoreFailed(r, err)
+	}
 	if ls == nil {
 		return nil, fmt.Errorf("No session found on server")
 	}
-	if ls.exp.Sub(ls.now()) < 0 {
-		o.sessions.deleteSession(sessionToken)
+	// Refreshable sessions outlive their ID token, they are refreshed below.
+	refreshable := o.refreshable(ls)
+	if !refreshable && ls.exp.Sub(ls.now()) < 0 {
+		o.sessions.Delete(r.Context(), sessionToken)
+		return nil, fmt.Errorf("Session is expired.")
+	}
+	if refreshable && !ls.now().Before(ls.storeExpiry()) {
+		o.sessions.Delete(r.Context(), sessionToken)
+		return nil, fmt.Errorf("Session is expired.")
+	}
+	epoch, err := o.sessions.Epoch(r.Context())
+	if err != nil {
+		return o.sessionStoreFailed(r, err)
+	}
+	if ls.epoch < epoch {
+		o.sessions.Delete(r.Context(), sessionToken)
+		return nil, fmt.Errorf("Session was invalidated.")
+	}
+	if o.singleSessionPerUser {
+		latest, err := o.sessions.LatestSession(r.Context(), ls.UserID)
+		if err != nil {
+			return o.sessionStoreFailed(r, err)
+		}
+		if latest != "" && latest != sessionKey(sessionToken) {
+			o.sessions.Delete(r.Context(), sessionToken)
+			return nil, fmt.Errorf("Session was replaced by a newer login of the user.")
+		}
+	}
+	// Sessions past their lifetime require a new login, instead of a refresh.
+	if deadline, ok := o.sessionDeadline(ls); ok && !ls.now().Before(deadline) {
+		o.sessions.Delete(r.Context(), sessionToken)
+		return nil, fmt.Errorf("Session exceeded the maximum session lifetime.")
+	}
+	if !o.followTokenExpiry {
+		return ls, nil
+	}
+	if refreshable {
+		if ls.exp.Add(-o.refreshLeadTimeOrDefault()).Sub(ls.now()) < 0 {
+			return o.refreshSession(r.Context(), ls)
+		}
+	} else if ls.exp.Add(-o.clockSkew).Sub(ls.now()) < 0 {
+		o.sessions.Delete(r.Context(), sessionToken)
 		return nil, fmt.Errorf("Session is expired.")
 	}
 	return ls, nil
 }
 
+// invalidateSessions starts a new session epoch, all existing sessions are
+// rejected afterwards.
+func (o *oidcAuth) invalidateSessions(ctx context.Context) (int64, error) {
+	return o.sessions.BumpEpoch(ctx)
+}
+
 func (o *oidcAuth) authenticate(r *http.Request) (*User, error) {
 	ls, err := o.getLoginState(r)
 	if err != nil {
@@ -134,6 +870,7 @@ func (o *oidcAuth) authenticate(r *http.Request) (*User, error) {
 		ID:       ls.UserID,
 		Username: ls.Name,
 		Token:    ls.rawToken,
+		Groups:   ls.Groups,
 	}, nil
 }
 
@@ -0,0 +1,846 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+)
+
+const testIssuer = "https://issuer.example.com"
+
+// insecureKeySet skips the signature verification so tests can hand craft ID tokens.
+type insecureKeySet struct{}
+
+func (insecureKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed jwt")
+	}
+	return base64.RawURLEncoding.DecodeString(parts[1])
+}
+
+// newTestIDToken returns an unsigned RS256 JWT with the given claims. The
+// issuer, subject and expiry are filled in unless already present.
+func newTestIDToken(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	if _, ok := claims["iss"]; !ok {
+		claims["iss"] = testIssuer
+	}
+	if _, ok := claims["sub"]; !ok {
+		claims["sub"] = "user-id"
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	signature := base64.RawURLEncoding.EncodeToString([]byte("signature"))
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + signature
+}
+
+func newTestOIDCAuth(c *oidcConfig) *oidcAuth {
+	if c.issuerURL == "" {
+		c.issuerURL = testIssuer
+	}
+	return &oidcAuth{
+		verifier:       oidc.NewVerifier(c.issuer(), insecureKeySet{}, c.verifierConfig()),
+		allowedIssuers: c.getAllowedIssuers(),
+		audiences:      c.audiences(),
+		clockSkew:      c.clockSkew,
+		requiredGroups: c.requiredGroups,
+		disableGroups:  c.disableGroups,
+		sessions:       NewSessionStore(32),
+		maxAge:         c.maxAge,
+		refreshing:     map[string]*sessionRefresh{},
+	}
+}
+
+func TestOIDCAudience(t *testing.T) {
+	tests := []struct {
+		name           string
+		extraAudiences []string
+		aud            interface{}
+		wantErr        bool
+	}{
+		{
+			name:    "single client ID audience",
+			aud:     "console",
+			wantErr: false,
+		},
+		{
+			name:    "single foreign audience",
+			aud:     "other",
+			wantErr: true,
+		},
+		{
+			name:    "array containing the client ID",
+			aud:     []string{"other", "console"},
+			wantErr: false,
+		},
+		{
+			name:    "array without the client ID",
+			aud:     []string{"other", "another"},
+			wantErr: true,
+		},
+		{
+			name:           "single extra audience",
+			extraAudiences: []string{"other"},
+			aud:            "other",
+			wantErr:        false,
+		},
+		{
+			name:           "array containing an extra audience",
+			extraAudiences: []string{"other"},
+			aud:            []string{"unknown", "other"},
+			wantErr:        false,
+		},
+		{
+			name:           "array containing the client ID with extra audiences",
+			extraAudiences: []string{"other"},
+			aud:            []string{"unknown", "console"},
+			wantErr:        false,
+		},
+		{
+			name:           "array without any accepted audience",
+			extraAudiences: []string{"other"},
+			aud:            []string{"unknown", "another"},
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console", extraAudiences: tt.extraAudiences})
+			_, err := o.verify(context.Background(), newTestIDToken(t, map[string]interface{}{"aud": tt.aud}))
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestOIDCSigningAlgs(t *testing.T) {
+	withAlg := func(t *testing.T, alg string) string {
+		parts := strings.Split(newTestIDToken(t, map[string]interface{}{"aud": "console"}), ".")
+		parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + alg + `","typ":"JWT"}`))
+		return strings.Join(parts, ".")
+	}
+
+	tests := []struct {
+		name        string
+		signingAlgs []string
+		alg         string
+		wantErr     bool
+	}{
+		{name: "allowed algorithm", signingAlgs: []string{oidc.ES256, oidc.PS256}, alg: oidc.ES256, wantErr: false},
+		{name: "disallowed algorithm", signingAlgs: []string{oidc.ES256, oidc.PS256}, alg: oidc.RS256, wantErr: true},
+		{name: "unsigned", signingAlgs: []string{oidc.ES256, oidc.PS256}, alg: "none", wantErr: true},
+		{name: "unsigned without allow-list", alg: "none", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console", signingAlgs: tt.signingAlgs})
+			_, err := o.verify(context.Background(), withAlg(t, tt.alg))
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	for alg, wantErr := range map[string]bool{oidc.PS256: false, "none": true, "NONE": true, "HS256": true} {
+		if err := ValidateSigningAlg(alg); (err != nil) != wantErr {
+			t.Errorf("ValidateSigningAlg(%q): expected error: %v, got: %v", alg, wantErr, err)
+		}
+	}
+}
+
+func TestOIDCDisableGroups(t *testing.T) {
+	for _, disableGroups := range []bool{false, true} {
+		o := newTestOIDCAuth(&oidcConfig{clientID: "console", disableGroups: disableGroups})
+		idToken := newTestIDToken(t, map[string]interface{}{"aud": "console", "groups": []string{"admins", "developers"}})
+		rr := httptest.NewRecorder()
+		ls, err := o.login(rr, (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": idToken}), http.SameSiteLaxMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := o.sessions.Get(context.Background(), ls.sessionToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotGroups := len(stored.Groups) > 0; gotGroups == disableGroups {
+			t.Errorf("with disableGroups %v, got session groups %q", disableGroups, stored.Groups)
+		}
+	}
+}
+
+func TestOIDCMaxGroups(t *testing.T) {
+	groups := []string{"developers", "admins", "viewers", "auditors"}
+	tests := []struct {
+		name       string
+		limit      groupsLimit
+		groups     []string
+		required   []string
+		wantGroups []string
+		wantErr    error
+	}{
+		{name: "unlimited", limit: groupsLimit{}, groups: groups, wantGroups: groups},
+		{name: "at the limit", limit: groupsLimit{max: 4}, groups: groups, wantGroups: groups},
+		{name: "at the limit with reject", limit: groupsLimit{max: 4, reject: true}, groups: groups, wantGroups: groups},
+		{name: "truncated", limit: groupsLimit{max: 3}, groups: groups, wantGroups: []string{"admins", "auditors", "developers"}},
+		{name: "truncated to one", limit: groupsLimit{max: 1}, groups: groups, wantGroups: []string{"admins"}},
+		{name: "rejected", limit: groupsLimit{max: 3, reject: true}, groups: groups, wantErr: errTooManyGroups},
+		{name: "required group dropped by truncation", limit: groupsLimit{max: 1}, groups: groups, required: []string{"viewers"}, wantGroups: []string{"admins"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console", requiredGroups: groupRequirement{groups: tt.required}})
+			o.groupsLimit = tt.limit
+			idToken := newTestIDToken(t, map[string]interface{}{"aud": "console", "groups": tt.groups})
+			for i := 0; i < 2; i++ {
+				ls, err := o.login(httptest.NewRecorder(), (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": idToken}), http.SameSiteLaxMode)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got: %v", tt.wantErr, err)
+				}
+				if err != nil {
+					return
+				}
+				if !reflect.DeepEqual(ls.Groups, tt.wantGroups) {
+					t.Errorf("expected groups %q, got %q", tt.wantGroups, ls.Groups)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCRequireVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified interface{}
+		required      bool
+		wantErr       bool
+	}{
+		{name: "verified", emailVerified: true, required: true, wantErr: false},
+		{name: "verified as string", emailVerified: "true", required: true, wantErr: false},
+		{name: "unverified", emailVerified: false, required: true, wantErr: true},
+		{name: "absent", required: true, wantErr: true},
+		{name: "unverified when not required", emailVerified: false, required: false, wantErr: false},
+		{name: "absent when not required", required: false, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+			o.requireVerifiedEmail = tt.required
+			claims := map[string]interface{}{"aud": "console", "email": "user@example.com"}
+			if tt.emailVerified != nil {
+				claims["email_verified"] = tt.emailVerified
+			}
+			token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, claims)})
+			_, err := o.login(httptest.NewRecorder(), token, http.SameSiteLaxMode)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, errEmailNotVerified) {
+				t.Errorf("expected %v, got: %v", errEmailNotVerified, err)
+			}
+		})
+	}
+}
+
+func TestOIDCAllowedIssuers(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowedIssuers []string
+		iss            string
+		wantErr        bool
+	}{
+		{name: "default to the configured issuer", wantErr: false},
+		{name: "default rejects other issuers", iss: "https://other.example.com", wantErr: true},
+		{name: "issuer allowed", allowedIssuers: []string{"https://other.example.com", testIssuer}, wantErr: false},
+		{name: "other issuer allowed", allowedIssuers: []string{testIssuer, "https://other.example.com"}, iss: "https://other.example.com", wantErr: false},
+		{name: "issuer not allowed", allowedIssuers: []string{"https://other.example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console", allowedIssuers: tt.allowedIssuers})
+			claims := map[string]interface{}{"aud": "console"}
+			if tt.iss != "" {
+				claims["iss"] = tt.iss
+			}
+			_, err := o.verify(context.Background(), newTestIDToken(t, claims))
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestOIDCRequiredGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		required groupRequirement
+		groups   []string
+		wantErr  bool
+	}{
+		{name: "no required groups", groups: nil, wantErr: false},
+		{name: "any, member of one", required: groupRequirement{groups: []string{"admins", "operators"}}, groups: []string{"operators"}, wantErr: false},
+		{name: "any, member of none", required: groupRequirement{groups: []string{"admins", "operators"}}, groups: []string{"developers"}, wantErr: true},
+		{name: "all, member of all", required: groupRequirement{groups: []string{"admins", "operators"}, all: true}, groups: []string{"operators", "developers", "admins"}, wantErr: false},
+		{name: "all, member of one", required: groupRequirement{groups: []string{"admins", "operators"}, all: true}, groups: []string{"operators"}, wantErr: true},
+		{name: "no groups claim", required: groupRequirement{groups: []string{"admins"}}, groups: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console", requiredGroups: tt.required})
+			claims := map[string]interface{}{"aud": "console"}
+			if tt.groups != nil {
+				claims["groups"] = tt.groups
+			}
+			token := (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, claims)})
+
+			rr := httptest.NewRecorder()
+			_, err := o.login(rr, token, http.SameSiteLaxMode)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, errMissingRequiredGroups) {
+					t.Errorf("expected %v, got: %v", errMissingRequiredGroups, err)
+				}
+				if cookies := rr.Result().Cookies(); len(cookies) > 0 {
+					t.Errorf("expected no session cookie for a rejected login, got: %v", cookies)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCNotBefore(t *testing.T) {
+	tests := []struct {
+		name       string
+		clockSkew  time.Duration
+		nbf        time.Duration
+		exp        time.Duration
+		wantErr    bool
+		wantNotYet bool
+	}{
+		{name: "no skew, nbf in the past", nbf: -time.Minute},
+		{name: "no skew, nbf in the future", nbf: time.Minute, wantErr: true, wantNotYet: true},
+		{name: "nbf within the allowed skew", clockSkew: 5 * time.Minute, nbf: 4 * time.Minute},
+		{name: "nbf beyond the allowed skew", clockSkew: 5 * time.Minute, nbf: 6 * time.Minute, wantErr: true, wantNotYet: true},
+		{name: "expired token", clockSkew: 5 * time.Minute, nbf: -time.Hour, exp: -6 * time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := tt.exp
+			if exp == 0 {
+				exp = time.Hour
+			}
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console", clockSkew: tt.clockSkew})
+			_, err := o.verify(context.Background(), newTestIDToken(t, map[string]interface{}{
+				"aud": "console",
+				"nbf": time.Now().Add(tt.nbf).Unix(),
+				"exp": time.Now().Add(exp).Unix(),
+			}))
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if gotNotYet := errors.Is(err, errTokenNotYetValid); gotNotYet != tt.wantNotYet {
+				t.Errorf("expected not yet valid error: %v, got: %v", tt.wantNotYet, err)
+			}
+		})
+	}
+}
+
+func TestOIDCMaxAge(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		maxAge    time.Duration
+		clockSkew time.Duration
+		authTime  time.Time
+		wantErr   bool
+	}{
+		{name: "disabled, no auth_time", authTime: time.Time{}},
+		{name: "disabled, old auth_time", authTime: now.Add(-24 * time.Hour)},
+		{name: "recent auth_time", maxAge: 5 * time.Minute, authTime: now.Add(-time.Minute)},
+		{name: "auth_time at the max age", maxAge: 5 * time.Minute, authTime: now.Add(-5 * time.Minute)},
+		{name: "auth_time beyond the max age", maxAge: 5 * time.Minute, authTime: now.Add(-5*time.Minute - time.Second), wantErr: true},
+		{name: "auth_time within the allowed skew", maxAge: 5 * time.Minute, clockSkew: time.Minute, authTime: now.Add(-6 * time.Minute)},
+		{name: "auth_time beyond the allowed skew", maxAge: 5 * time.Minute, clockSkew: time.Minute, authTime: now.Add(-6*time.Minute - time.Second), wantErr: true},
+		{name: "missing auth_time", maxAge: 5 * time.Minute, authTime: time.Time{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console", clockSkew: tt.clockSkew, maxAge: tt.maxAge})
+			err := o.checkAuthTime(tt.authTime, now)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if tt.wantErr && !errors.Is(err, errAuthTooOld) {
+				t.Errorf("expected %v, got: %v", errAuthTooOld, err)
+			}
+		})
+	}
+
+	t.Run("login", func(t *testing.T) {
+		o := newTestOIDCAuth(&oidcConfig{clientID: "console", maxAge: 5 * time.Minute})
+		for _, tc := range []struct {
+			claims  map[string]interface{}
+			wantErr bool
+		}{
+			{claims: map[string]interface{}{"aud": "console", "auth_time": time.Now().Add(-time.Minute).Unix()}},
+			{claims: map[string]interface{}{"aud": "console", "auth_time": time.Now().Add(-time.Hour).Unix()}, wantErr: true},
+			{claims: map[string]interface{}{"aud": "console"}, wantErr: true},
+		} {
+			token := (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, tc.claims)})
+			rr := httptest.NewRecorder()
+			_, err := o.login(rr, token, http.SameSiteLaxMode)
+			if gotErr := errors.Is(err, errAuthTooOld); gotErr != tc.wantErr {
+				t.Errorf("claims %v: expected rejection: %v, got: %v", tc.claims, tc.wantErr, err)
+			}
+			if cookies := rr.Result().Cookies(); tc.wantErr && len(cookies) > 0 {
+				t.Errorf("claims %v: expected no session cookie for a rejected login, got: %v", tc.claims, cookies)
+			}
+		}
+	})
+}
+
+func TestOIDCIssuerOverride(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/auth","token_endpoint":"%[1]s/token","jwks_uri":"%[1]s/keys"}`, testIssuer)
+	}))
+	defer s.Close()
+
+	if _, _, err := newOIDCAuth(context.Background(), &oidcConfig{client: s.Client(), issuerURL: s.URL, clientID: "console"}); err == nil {
+		t.Error("expected discovery to fail without the override")
+	}
+	endpoint, _, err := newOIDCAuth(context.Background(), &oidcConfig{client: s.Client(), issuerURL: s.URL, issuerOverride: testIssuer, clientID: "console"})
+	if err != nil {
+		t.Fatalf("discovery with the override failed: %v", err)
+	}
+	if endpoint.TokenURL != testIssuer+"/token" {
+		t.Errorf("unexpected token URL %q", endpoint.TokenURL)
+	}
+
+	o := newTestOIDCAuth(&oidcConfig{issuerURL: s.URL, issuerOverride: testIssuer, clientID: "console"})
+	for _, tt := range []struct {
+		iss     string
+		wantErr bool
+	}{
+		{iss: testIssuer, wantErr: false},
+		{iss: s.URL, wantErr: true},
+		{iss: "https://other.example.com", wantErr: true},
+	} {
+		_, err := o.verify(context.Background(), newTestIDToken(t, map[string]interface{}{"aud": "console", "iss": tt.iss}))
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("issuer %s: expected error: %v, got: %v", tt.iss, tt.wantErr, err)
+		}
+	}
+}
+
+// sharedSessionStore keeps sessions when a new epoch starts, like a store
+// shared by several replicas, so that only the epoch check rejects them.
+type sharedSessionStore struct {
+	*MemorySessionStore
+}
+
+func (ss sharedSessionStore) BumpEpoch(_ context.Context) (int64, error) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	ss.epoch++
+	return ss.epoch, nil
+}
+
+func TestOIDCInvalidateSessions(t *testing.T) {
+	stores := map[string]SessionStore{
+		"memory": NewSessionStore(32),
+		"shared": sharedSessionStore{NewSessionStore(32)},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testOIDCInvalidateSessions(t, store)
+		})
+	}
+}
+
+func testOIDCInvalidateSessions(t *testing.T, store SessionStore) {
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.sessions = store
+	login := func() *http.Request {
+		t.Helper()
+		token := (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console"})})
+		rr := httptest.NewRecorder()
+		if _, err := o.login(rr, token, http.SameSiteLaxMode); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+		for _, c := range rr.Result().Cookies() {
+			r.AddCookie(c)
+		}
+		return r
+	}
+
+	before := login()
+	if _, err := o.authenticate(before); err != nil {
+		t.Fatalf("unexpected error before invalidating sessions: %v", err)
+	}
+
+	epoch, err := o.invalidateSessions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch != 1 {
+		t.Errorf("expected epoch 1, got: %d", epoch)
+	}
+	if _, err := o.authenticate(before); err == nil {
+		t.Error("expected a session created before invalidating sessions to be rejected")
+	}
+
+	if _, err := o.authenticate(login()); err != nil {
+		t.Errorf("unexpected error for a session created after invalidating sessions: %v", err)
+	}
+}
+
+func TestOIDCFollowTokenExpiry(t *testing.T) {
+	tests := []struct {
+		name          string
+		exp           time.Duration
+		refreshToken  string
+		notStored     bool
+		wantMaxAge    func(int) bool
+		wantErr       bool
+		wantRefreshes int
+	}{
+		{name: "cookie expires before the token", exp: time.Hour, wantMaxAge: func(m int) bool { return m > 3000 && m <= 3300 }},
+		{name: "token about to expire", exp: 3 * time.Minute, wantMaxAge: func(m int) bool { return m < 0 }, wantErr: true},
+		{name: "refreshable session", exp: time.Hour, refreshToken: "refresh", wantMaxAge: func(m int) bool { return m == 0 }},
+		{name: "refreshed session", exp: 3 * time.Minute, refreshToken: "refresh", wantMaxAge: func(m int) bool { return m == 0 }, wantRefreshes: 1},
+		{name: "refresh token not stored", exp: 3 * time.Minute, refreshToken: "refresh", notStored: true, wantMaxAge: func(m int) bool { return m < 0 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refreshes := 0
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+			o.clockSkew = 5 * time.Minute
+			o.followTokenExpiry = true
+			if !tt.notStored {
+				cipher, err := newRefreshTokenCipher(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				o.refreshTokens = cipher
+			}
+			o.refresh = func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+				refreshes++
+				if refreshToken != tt.refreshToken {
+					t.Errorf("expected refresh token %q, got %q", tt.refreshToken, refreshToken)
+				}
+				return (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console"})}), nil
+			}
+
+			token := (&oauth2.Token{RefreshToken: tt.refreshToken}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{
+				"aud": "console",
+				"exp": time.Now().Add(tt.exp).Unix(),
+			})})
+			rr := httptest.NewRecorder()
+			if _, err := o.login(rr, token, http.SameSiteLaxMode); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+			for _, c := range rr.Result().Cookies() {
+				if !tt.wantMaxAge(c.MaxAge) {
+					t.Errorf("unexpected session cookie max-age %d", c.MaxAge)
+				}
+				r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+			}
+
+			for i := 0; i < 2; i++ {
+				if _, err := o.authenticate(r); (err != nil) != tt.wantErr {
+					t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+				}
+			}
+			if refreshes != tt.wantRefreshes {
+				t.Errorf("expected %d refreshes, got %d", tt.wantRefreshes, refreshes)
+			}
+		})
+	}
+}
+
+func TestOIDCRefreshIdleSession(t *testing.T) {
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.clockSkew = 5 * time.Minute
+	o.followTokenExpiry = true
+	cipher, err := newRefreshTokenCipher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.refreshTokens = cipher
+	refreshes := 0
+	o.refresh = func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+		refreshes++
+		return (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console"})}), nil
+	}
+
+	token := (&oauth2.Token{RefreshToken: "refresh"}).WithExtra(map[string]interface{}{
+		"id_token":           newTestIDToken(t, map[string]interface{}{"aud": "console"}),
+		"refresh_expires_in": float64(8 * 60 * 60),
+	})
+	rr := httptest.NewRecorder()
+	ls, err := o.login(rr, token, http.SameSiteLaxMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keep := ls.keepUntil.Sub(ls.loginTime); keep < 8*time.Hour || keep > 8*time.Hour+time.Second {
+		t.Errorf("expected the session to be kept for the refresh token lifetime, got %s", keep)
+	}
+	r := httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+	for _, c := range rr.Result().Cookies() {
+		r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+
+	// The user was idle until well after the ID token expired.
+	ls.exp = time.Now().Add(-30 * time.Minute)
+	o.sessions.Delete(context.Background(), ls.sessionToken)
+	if err := o.sessions.Set(context.Background(), ls.sessionToken, ls); err != nil {
+		t.Fatal(err)
+	}
+	o.sessions.(*MemorySessionStore).pruneSessions()
+	if _, err := o.authenticate(r); err != nil {
+		t.Fatalf("expected the idle session to be refreshed, got: %v", err)
+	}
+	if refreshes != 1 {
+		t.Errorf("expected 1 refresh, got %d", refreshes)
+	}
+	if refreshed, _ := o.sessions.Get(context.Background(), ls.sessionToken); refreshed == nil || !refreshed.exp.After(time.Now()) {
+		t.Errorf("expected the refreshed session to be stored, got %v", refreshed)
+	}
+
+	// Past the lifetime of its refresh token, the session ends.
+	stored, _ := o.sessions.Get(context.Background(), ls.sessionToken)
+	stored.exp, stored.keepUntil = time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour)
+	o.sessions.Delete(context.Background(), ls.sessionToken)
+	if err := o.sessions.Set(context.Background(), ls.sessionToken, stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.authenticate(r); err == nil {
+		t.Error("expected the session to end with its refresh token")
+	}
+	if refreshes != 1 {
+		t.Errorf("expected no more refreshes, got %d", refreshes)
+	}
+
+	// The maximum session lifetime caps how long the session is kept.
+	o.maxSessionLifetime = 2 * time.Hour
+	o.setKeepUntil(ls, token)
+	if keep := ls.keepUntil.Sub(ls.loginTime); keep != 2*time.Hour {
+		t.Errorf("expected the session to be kept for the session lifetime, got %s", keep)
+	}
+}
+
+func TestOIDCClockSkewBoundaries(t *testing.T) {
+	const skew = 30 * time.Second
+	now := time.Unix(time.Now().Unix(), 0)
+
+	tests := []struct {
+		name    string
+		claim   string
+		offset  time.Duration
+		wantErr bool
+	}{
+		{name: "exp within the skew", claim: "exp", offset: -skew},
+		{name: "exp beyond the skew", claim: "exp", offset: -skew - time.Second, wantErr: true},
+		{name: "nbf within the skew", claim: "nbf", offset: skew},
+		{name: "nbf beyond the skew", claim: "nbf", offset: skew + time.Second, wantErr: true},
+		{name: "iat within the skew", claim: "iat", offset: skew},
+		{name: "iat beyond the skew", claim: "iat", offset: skew + time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console", clockSkew: skew})
+			claims := map[string]interface{}{"aud": "console"}
+			claims[tt.claim] = now.Add(tt.offset).Unix()
+			idToken, err := o.getVerifier().Verify(context.Background(), newTestIDToken(t, claims))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = o.checkValidity(idToken, now)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestOIDCMaxSessionLifetime(t *testing.T) {
+	const lifetime = 8 * time.Hour
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.clockSkew = 5 * time.Minute
+	o.followTokenExpiry = true
+	o.maxSessionLifetime = lifetime
+	cipher, err := newRefreshTokenCipher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.refreshTokens = cipher
+	refreshes := 0
+	o.refresh = func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+		refreshes++
+		return (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(time.Hour).Unix()})}), nil
+	}
+
+	login := func() (*loginState, *http.Request) {
+		token := (&oauth2.Token{RefreshToken: "refresh"}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{
+			"aud": "console",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})})
+		rr := httptest.NewRecorder()
+		ls, err := o.login(rr, token, http.SameSiteLaxMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+		for _, c := range rr.Result().Cookies() {
+			// Refreshable sessions outlive the token, but not the session lifetime.
+			if o.maxSessionLifetime > 0 && (c.MaxAge <= int((lifetime-time.Minute).Seconds()) || c.MaxAge > int(lifetime.Seconds())) {
+				t.Errorf("expected the session cookie to last for the session lifetime, got max-age %d", c.MaxAge)
+			}
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+		return ls, r
+	}
+	// update moves the session to a different login time and token expiry.
+	update := func(ls *loginState, loginTime time.Time, exp time.Time) {
+		ls.loginTime, ls.exp = loginTime, exp
+		o.sessions.Delete(context.Background(), ls.sessionToken)
+		if err := o.sessions.Set(context.Background(), ls.sessionToken, ls); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Activity and refreshes within the lifetime don't extend it.
+	ls, r := login()
+	loginTime := ls.loginTime
+	update(ls, loginTime.Add(-lifetime+time.Minute), time.Now().Add(time.Minute))
+	for i := 0; i < 2; i++ {
+		if _, err := o.authenticate(r); err != nil {
+			t.Fatalf("expected the session to be valid just before its lifetime ends, got: %v", err)
+		}
+	}
+	if refreshes != 1 {
+		t.Errorf("expected the session to be refreshed once, got %d refreshes", refreshes)
+	}
+	refreshed, err := o.sessions.Get(context.Background(), ls.sessionToken)
+	if err != nil || refreshed == nil {
+		t.Fatalf("expected the refreshed session, got %v: %v", refreshed, err)
+	}
+	if !refreshed.loginTime.Equal(loginTime.Add(-lifetime + time.Minute)) {
+		t.Errorf("expected the refresh to keep the login time, got %s", refreshed.loginTime)
+	}
+	if maxAge := o.cookieMaxAge(refreshed); maxAge > 60 {
+		t.Errorf("expected the session cookie to end with the lifetime, got max-age %d", maxAge)
+	}
+
+	// At the lifetime, a session that could be refreshed needs a new login.
+	refreshes = 0
+	update(refreshed, time.Now().Add(-lifetime), time.Now().Add(time.Minute))
+	if _, err := o.authenticate(r); err == nil {
+		t.Error("expected the session to end at its lifetime")
+	}
+	if refreshes != 0 {
+		t.Errorf("expected no refresh at the end of the lifetime, got %d", refreshes)
+	}
+	if stored, _ := o.sessions.Get(context.Background(), ls.sessionToken); stored != nil {
+		t.Error("expected the session to be deleted at the end of its lifetime")
+	}
+
+	// Sessions from before login times were recorded are ended.
+	ls, r = login()
+	update(ls, time.Time{}, ls.exp)
+	if _, err := o.authenticate(r); err == nil {
+		t.Error("expected a session without login time to be ended")
+	}
+
+	// Without a lifetime, sessions last as long as they are refreshed.
+	o.maxSessionLifetime = 0
+	ls, r = login()
+	update(ls, time.Now().Add(-10*lifetime), ls.exp)
+	if _, err := o.authenticate(r); err != nil {
+		t.Errorf("expected sessions without a lifetime not to end, got: %v", err)
+	}
+}
+
+func TestOIDCSingleSessionPerUser(t *testing.T) {
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.singleSessionPerUser = true
+
+	login := func(sub string) *http.Request {
+		token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{
+			"aud": "console",
+			"sub": sub,
+		})})
+		rr := httptest.NewRecorder()
+		if _, err := o.login(rr, token, http.SameSiteLaxMode); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+		for _, c := range rr.Result().Cookies() {
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+		return r
+	}
+
+	first := login("alice")
+	other := login("bob")
+	if _, err := o.authenticate(first); err != nil {
+		t.Fatalf("expected the first session to be valid, got: %v", err)
+	}
+
+	second := login("alice")
+	if _, err := o.authenticate(first); err == nil {
+		t.Error("expected the first session to be ended by the second login")
+	}
+	cookie, _ := first.Cookie(openshiftAccessTokenCookieName)
+	if stored, _ := o.sessions.Get(context.Background(), cookie.Value); stored != nil {
+		t.Error("expected the first session to be deleted")
+	}
+	if _, err := o.authenticate(second); err != nil {
+		t.Errorf("expected the second session to be valid, got: %v", err)
+	}
+	if _, err := o.authenticate(other); err != nil {
+		t.Errorf("expected the session of another user to be valid, got: %v", err)
+	}
+
+	// Users may have several sessions without the option.
+	o.singleSessionPerUser = false
+	third := login("alice")
+	if _, err := o.authenticate(second); err != nil {
+		t.Errorf("expected the second session to be valid, got: %v", err)
+	}
+	if _, err := o.authenticate(third); err != nil {
+		t.Errorf("expected the third session to be valid, got: %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"golang.org/x/oauth2"
+	"k8s.io/client-go/rest"
 
 	"github.com/openshift/console/pkg/proxy"
 )
@@ -18,8 +19,18 @@ import (
 // https://access.redhat.com/documentation/en-us/openshift_container_platform/4.9/html/authentication_and_authorization/understanding-authentication
 type openShiftAuth struct {
 	cookiePath    string
+	cookieDomain  string
 	secureCookies bool
 	specialURLs   SpecialAuthURLs
+
+	// requiredGroups are looked up with k8sConfig, OpenShift access tokens
+	// carry no groups.
+	requiredGroups groupRequirement
+	k8sConfig      *rest.Config
+
+	// sessionCookieMaxChunks is the number of cookies the access token may
+	// be split across.
+	sessionCookieMaxChunks int
 }
 
 type openShiftConfig struct {
@@ -27,7 +38,13 @@ type openShiftConfig struct {
 	oauthClient   *http.Client
 	issuerURL     string
 	cookiePath    string
+	cookieDomain  string
 	secureCookies bool
+
+	requiredGroups groupRequirement
+	k8sConfig      *rest.Config
+
+	sessionCookieMaxChunks int
 }
 
 func validateAbsURL(value string) error {
@@ -109,15 +126,19 @@ func newOpenShiftAuth(ctx context.Context, c *openShiftConfig) (oauth2.Endpoint,
 			TokenURL: metadata.Token,
 		}, &openShiftAuth{
 			c.cookiePath,
+			c.cookieDomain,
 			c.secureCookies,
 			SpecialAuthURLs{
 				requestTokenURL,
 				kubeAdminLogoutURL,
 			},
+			c.requiredGroups,
+			c.k8sConfig,
+			c.sessionCookieMaxChunks,
 		}, nil
 }
 
-func (o *openShiftAuth) login(w http.ResponseWriter, token *oauth2.Token) (*loginState, error) {
+func (o *openShiftAuth) login(w http.ResponseWriter, token *oauth2.Token, sameSite http.SameSite) (*loginState, error) {
 	if token.AccessToken == "" {
 		return nil, fmt.Errorf("token response did not contain an access token %#v", token)
 	}
@@ -126,6 +147,17 @@ func (o *openShiftAuth) login(w http.ResponseWriter, token *oauth2.Token) (*logi
 		rawToken: token.AccessToken,
 	}
 
+	if len(o.requiredGroups.groups) > 0 {
+		groups, err := selfSubjectGroups(context.TODO(), o.k8sConfig, ls.rawToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the groups of the user: %v", err)
+		}
+		if !o.requiredGroups.allows(groups) {
+			return nil, errMissingRequiredGroups
+		}
+		ls.Groups = groups
+	}
+
 	expiresIn := (time.Hour * 24).Seconds()
 	if !token.Expiry.IsZero() {
 		expiresIn = token.Expiry.Sub(time.Now()).Seconds()
@@ -133,8 +165,8 @@ func (o *openShiftAuth) login(w http.ResponseWriter, token *oauth2.Token) (*logi
 
 	// NOTE: In Tectonic, we previously had issues with tokens being bigger than
 	// cookies can handle. Since OpenShift doesn't store groups in the token, the
-	// token can't grow arbitrarily big, so we assume it will always fit in a cookie
-	// value.
+	// token can't grow arbitrarily big, so we assume it will usually fit in a cookie
+	// value. Larger tokens can be split across sessionCookieMaxChunks cookies.
 	//
 	// NOTE: in the future we'll have to avoid the use of cookies. This should likely switch to frontend
 	// only logic using the OAuth2 implicit flow.
@@ -145,11 +177,14 @@ func (o *openShiftAuth) login(w http.ResponseWriter, token *oauth2.Token) (*logi
 		MaxAge:   int(expiresIn),
 		HttpOnly: true,
 		Path:     o.cookiePath,
+		Domain:   o.cookieDomain,
 		Secure:   o.secureCookies,
-		SameSite: http.SameSiteLaxMode,
+		SameSite: sameSite,
 	}
 
-	http.SetCookie(w, &cookie)
+	if err := setChunkedCookie(w, cookie, o.sessionCookieMaxChunks); err != nil {
+		return nil, fmt.Errorf("%w; allow more session cookie chunks or use OIDC authentication, which keeps sessions on the server", err)
+	}
 	return ls, nil
 }
 
@@ -162,9 +197,10 @@ func (o *openShiftAuth) deleteCookie(w http.ResponseWriter, r *http.Request) {
 		MaxAge:   0,
 		HttpOnly: true,
 		Path:     o.cookiePath,
+		Domain:   o.cookieDomain,
 		Secure:   o.secureCookies,
 	}
-	http.SetCookie(w, &cookie)
+	deleteChunkedCookie(w, cookie, o.sessionCookieMaxChunks)
 }
 
 func (o *openShiftAuth) logout(w http.ResponseWriter, r *http.Request) {
@@ -172,20 +208,22 @@ func (o *openShiftAuth) logout(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func getOpenShiftUser(r *http.Request) (*User, error) {
+// getOpenShiftUser returns the user of the access token in the session cookie,
+// which may be split across maxChunks cookies.
+func getOpenShiftUser(r *http.Request, maxChunks int) (*User, error) {
 	// TODO: This doesn't do any validation of the cookie with the assumption that the
 	// API server will reject tokens it doesn't recognize. If we want to keep some backend
 	// state we should sign this cookie. If not there's not much we can do.
-	cookie, err := r.Cookie(openshiftAccessTokenCookieName)
+	token, err := readChunkedCookie(r, openshiftAccessTokenCookieName, maxChunks)
 	if err != nil {
 		return nil, err
 	}
-	if cookie.Value == "" {
+	if token == "" {
 		return nil, fmt.Errorf("unauthenticated, no value for cookie %s", openshiftAccessTokenCookieName)
 	}
 
 	return &User{
-		Token: cookie.Value,
+		Token: token,
 	}, nil
 }
 
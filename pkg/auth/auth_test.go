@@ -2,11 +2,23 @@ package auth
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/openshift/console/pkg/metrics"
+	"github.com/openshift/console/pkg/serverutils"
 )
 
 // mockOpenShiftProvider is test OpenShift provider that only supports discovery
@@ -148,6 +160,172 @@ func TestNewOpenShiftAuthenticator(t *testing.T) {
 	}
 }
 
+func TestNewAuthenticatorRetry(t *testing.T) {
+	defer func(backoff time.Duration) { discoveryRetryBackoff = backoff }(discoveryRetryBackoff)
+	discoveryRetryBackoff = 10 * time.Millisecond
+
+	p := &mockOIDCProvider{}
+	var unavailable int32 = 1
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&unavailable) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		p.handleDiscovery(w, r)
+	}))
+	defer s.Close()
+	p.issuer = s.URL
+
+	ccfg := &Config{
+		ClientID:     "fake-client-id",
+		ClientSecret: "fake-secret",
+		RedirectURL:  "http://example.com/callback",
+		IssuerURL:    p.issuer,
+		ErrorURL:     "http://example.com/error",
+		SuccessURL:   "http://example.com/success",
+		CookiePath:   "/",
+		RefererPath:  "http://auth.example.com/",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := NewAuthenticator(ctx, ccfg)
+	if err != nil {
+		t.Fatalf("expected a transient error to be retried, got: %v", err)
+	}
+	if a.Healthy() == nil {
+		t.Fatal("expected the authenticator to be unhealthy before the provider was contacted")
+	}
+
+	rr := httptest.NewRecorder()
+	a.LoginFunc(rr, httptest.NewRequest("GET", "http://example.com/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected login to fail with %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	atomic.StoreInt32(&unavailable, 0)
+	for i := 0; a.Healthy() != nil; i++ {
+		if i > 100 {
+			t.Fatal("authenticator didn't become healthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rr = httptest.NewRecorder()
+	a.LoginFunc(rr, httptest.NewRequest("GET", "http://example.com/", nil))
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("expected login to redirect with %d, got: %d", http.StatusSeeOther, rr.Code)
+	}
+}
+
+func TestNewAuthenticatorPermanentError(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	defer s.Close()
+
+	ccfg := &Config{
+		ClientID:     "fake-client-id",
+		ClientSecret: "fake-secret",
+		RedirectURL:  "http://example.com/callback",
+		IssuerURL:    s.URL,
+		ErrorURL:     "http://example.com/error",
+		SuccessURL:   "http://example.com/success",
+		CookiePath:   "/",
+		RefererPath:  "http://auth.example.com/",
+	}
+
+	if _, err := NewAuthenticator(context.Background(), ccfg); err == nil {
+		t.Error("expected a 404 on discovery to be fatal")
+	}
+}
+
+func TestNewAuthenticatorNotFoundInBody(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream Not Found", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	ccfg := &Config{
+		ClientID:     "fake-client-id",
+		ClientSecret: "fake-secret",
+		RedirectURL:  "http://example.com/callback",
+		IssuerURL:    s.URL,
+		ErrorURL:     "http://example.com/error",
+		SuccessURL:   "http://example.com/success",
+		CookiePath:   "/",
+		RefererPath:  "http://auth.example.com/",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, err := NewAuthenticator(ctx, ccfg)
+	if err != nil {
+		t.Fatalf("expected a 503 on discovery to be retried, got: %v", err)
+	}
+	if a.Healthy() == nil {
+		t.Error("expected the authenticator to be unhealthy until discovery succeeds")
+	}
+}
+
+func TestIsPermanentDiscoveryError(t *testing.T) {
+	tests := []struct {
+		err  string
+		want bool
+	}{
+		{err: "404 Not Found: 404 page not found", want: true},
+		{err: "discovery through endpoint https://api.example.com/.well-known/oauth-authorization-server failed: 404 Not Found", want: true},
+		{err: "oidc: issuer did not match the issuer returned by provider", want: true},
+		{err: "503 Service Unavailable: upstream Not Found", want: false},
+		{err: "502 Bad Gateway: 404 Not Found: from the backend", want: false},
+		{err: "dial tcp 127.0.0.1:443: connect: connection refused", want: false},
+	}
+	for _, tt := range tests {
+		if got := isPermanentDiscoveryError(fmt.Errorf("%s", tt.err)); got != tt.want {
+			t.Errorf("%q: expected permanent: %v, got: %v", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestNewAuthenticatorUserAgent(t *testing.T) {
+	p := &mockOIDCProvider{}
+	userAgents := make(chan string, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.UserAgent()
+		p.handleDiscovery(w, r)
+	}))
+	defer s.Close()
+	p.issuer = s.URL
+
+	ccfg := &Config{
+		ClientID:     "fake-client-id",
+		ClientSecret: "fake-secret",
+		RedirectURL:  "http://example.com/callback",
+		IssuerURL:    p.issuer,
+		ErrorURL:     "http://example.com/error",
+		SuccessURL:   "http://example.com/success",
+		CookiePath:   "/",
+		RefererPath:  "http://auth.example.com/",
+		UserAgent:    "openshift-console/v1.2.3",
+	}
+
+	a, err := NewAuthenticator(context.Background(), ccfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-userAgents; got != ccfg.UserAgent {
+		t.Errorf("wrong User-Agent of the discovery request, want: %q, got: %q", ccfg.UserAgent, got)
+	}
+
+	resp, err := a.clientFunc().Get(s.URL + "/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := <-userAgents; got != ccfg.UserAgent {
+		t.Errorf("wrong User-Agent of requests to the issuer, want: %q, got: %q", ccfg.UserAgent, got)
+	}
+}
+
 func TestRedirectAuthError(t *testing.T) {
 	errURL := "http://example.com/error"
 	sucURL := "http://example.com/success"
@@ -170,7 +348,7 @@ func TestRedirectAuthError(t *testing.T) {
 		t.Fatal("error instantiating test authenticator")
 	}
 
-	a.redirectAuthError(w, "fake_error")
+	a.redirectAuthError(w, httptest.NewRequest("GET", "http://example.com/auth/callback", nil), "fake_error", "")
 	if w.Code != http.StatusSeeOther {
 		t.Fatalf("wrong http status, want: %d, got: %d", http.StatusSeeOther, w.Code)
 		return
@@ -188,6 +366,176 @@ func TestRedirectAuthError(t *testing.T) {
 	}
 }
 
+func TestRedirectAuthErrorRedirect(t *testing.T) {
+	a, err := newUnstartedAuthenticator(&Config{
+		ClientID:      "fake-client-id",
+		ClientSecret:  "fake-secret",
+		RedirectURL:   "http://example.com/callback",
+		IssuerURL:     "http://auth.example.com",
+		ErrorURL:      "https://help.example.com/console?topic=login",
+		SuccessURL:    "http://example.com/success",
+		CookiePath:    "/",
+		RefererPath:   "http://auth.example.com/",
+		SecureCookies: true,
+	})
+	if err != nil {
+		t.Fatal("error instantiating test authenticator")
+	}
+
+	r := httptest.NewRequest("GET", "http://example.com/auth/callback", nil)
+	r = r.WithContext(serverutils.WithRequestID(r.Context(), "request-id"))
+	w := httptest.NewRecorder()
+	a.redirectAuthError(w, r, errorMissingGroups, "")
+
+	want := "https://help.example.com/console?error=missing_required_groups&error_type=auth&request_id=request-id&topic=login"
+	if loc := w.Header().Get("Location"); loc != want {
+		t.Fatalf("wrong location header, want: %s, got: %s", want, loc)
+	}
+}
+
+func TestAuthErrorJSON(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := a.CallbackFunc(func(LoginJSON, string, http.ResponseWriter) {
+		t.Error("unexpected successful login")
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		accept     string
+		wantStatus int
+		wantBody   *AuthErrorJSON
+		wantQuery  string
+	}{
+		{
+			name:       "provider error for browsers",
+			query:      "error=access_denied&error_description=User+denied+access",
+			accept:     "text/html,application/xhtml+xml,*/*;q=0.8",
+			wantStatus: http.StatusSeeOther,
+			wantQuery:  "error=access_denied&error_description=User+denied+access&error_type=auth",
+		},
+		{
+			name:       "provider error as JSON",
+			query:      "error=access_denied&error_description=User+denied+access",
+			accept:     "application/json",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   &AuthErrorJSON{Error: "access_denied", ErrorDescription: "User denied access"},
+		},
+		{
+			name:       "console error as JSON",
+			query:      "code=abc&state=state",
+			accept:     "application/json, text/plain;q=0.9",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   &AuthErrorJSON{Error: errorMissingState},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/auth/callback?"+tt.query, nil)
+			r.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+			callback(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("wrong http status, want: %d, got: %d", tt.wantStatus, rr.Code)
+			}
+			if tt.wantBody == nil {
+				location, err := rr.Result().Location()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if location.RawQuery != tt.wantQuery {
+					t.Errorf("wrong error page query, want: %s, got: %s", tt.wantQuery, location.RawQuery)
+				}
+				return
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("wrong content type, want: application/json, got: %s", ct)
+			}
+			var got AuthErrorJSON
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != *tt.wantBody {
+				t.Errorf("wrong error body, want: %+v, got: %+v", *tt.wantBody, got)
+			}
+		})
+	}
+}
+
+func TestLoginSuccessJSON(t *testing.T) {
+	idToken := newTestIDToken(t, map[string]interface{}{"aud": "console", "sub": "user-id", "iat": time.Now().Unix()})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	}))
+	defer tokenServer.Close()
+
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{
+			ClientID:    "console",
+			RedirectURL: "http://example.com/auth/callback",
+			Endpoint:    oauth2.Endpoint{AuthURL: "https://auth.example.com/auth", TokenURL: tokenServer.URL},
+		}, o
+	}
+
+	var pageShown bool
+	callback := a.CallbackFunc(func(loginInfo LoginJSON, successURL string, w http.ResponseWriter) {
+		pageShown = true
+	})
+	callbackRequest := func(accept string) *http.Request {
+		r := httptest.NewRequest("GET", "http://example.com/auth/callback?code=abc&state=state", nil)
+		r.AddCookie(&http.Cookie{Name: stateCookieName, Value: "state"})
+		r.Header.Set("Accept", accept)
+		return r
+	}
+
+	rr := httptest.NewRecorder()
+	callback(rr, callbackRequest("text/html,application/xhtml+xml,*/*;q=0.8"))
+	if !pageShown {
+		t.Errorf("expected browsers to be sent on to the success page, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	pageShown = false
+	rr = httptest.NewRecorder()
+	callback(rr, callbackRequest("application/json"))
+	if pageShown {
+		t.Error("unexpected success page for a client that accepts JSON")
+	}
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong http status, want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	var got LoginSuccessJSON
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Authenticated || got.UserID != "user-id" || got.SuccessURL != a.successURL {
+		t.Errorf("wrong login success body: %+v", got)
+	}
+	var sessionCookie bool
+	for _, c := range rr.Result().Cookies() {
+		if strings.HasPrefix(c.Name, openshiftAccessTokenCookieName) && c.Value != "" {
+			sessionCookie = true
+		}
+	}
+	if !sessionCookie {
+		t.Errorf("expected the session cookie to be set, got: %v", rr.Header().Values("Set-Cookie"))
+	}
+}
+
 const validReferer string = "https://example.com/asdf/"
 
 func makeAuthenticator() (*Authenticator, error) {
@@ -311,3 +659,423 @@ func TestCSRF(t *testing.T) {
 	testCSRF(t, "", "b", false)
 	testCSRF(t, "", "", false)
 }
+
+func TestLoginStateCookieTTL(t *testing.T) {
+	for _, tt := range []struct {
+		ttl        time.Duration
+		wantMaxAge int
+	}{
+		{ttl: 0, wantMaxAge: 0},
+		{ttl: 5 * time.Minute, wantMaxAge: 300},
+	} {
+		a, err := makeAuthenticator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.stateCookieTTL = tt.ttl
+		a.authFunc = func() (*oauth2.Config, loginMethod) {
+			return &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example.com/auth"}}, nil
+		}
+
+		rr := httptest.NewRecorder()
+		a.LoginFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/login", nil))
+
+		var stateCookie *http.Cookie
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == stateCookieName {
+				stateCookie = c
+			}
+		}
+		if stateCookie == nil {
+			t.Fatalf("ttl %s: missing %s cookie", tt.ttl, stateCookieName)
+		}
+		if stateCookie.MaxAge != tt.wantMaxAge {
+			t.Errorf("ttl %s: wrong cookie max age, want: %d, got: %d", tt.ttl, tt.wantMaxAge, stateCookie.MaxAge)
+		}
+	}
+}
+
+func TestLoginStateCookieDomain(t *testing.T) {
+	for _, domain := range []string{"", "console.example.com"} {
+		a, err := makeAuthenticator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.cookieDomain = domain
+		a.authFunc = func() (*oauth2.Config, loginMethod) {
+			return &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example.com/auth"}}, nil
+		}
+
+		rr := httptest.NewRecorder()
+		a.LoginFunc(rr, httptest.NewRequest("GET", "http://app.console.example.com/auth/login", nil))
+
+		var stateCookie *http.Cookie
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == stateCookieName {
+				stateCookie = c
+			}
+		}
+		if stateCookie == nil {
+			t.Fatalf("domain %q: missing %s cookie", domain, stateCookieName)
+		}
+		if stateCookie.Domain != domain {
+			t.Errorf("wrong cookie domain, want: %q, got: %q", domain, stateCookie.Domain)
+		}
+	}
+}
+
+func TestResponseModeFormPost(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.responseMode = ResponseModeFormPost
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example.com/auth"}}, nil
+	}
+
+	rr := httptest.NewRecorder()
+	a.LoginFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/login", nil))
+	location, err := rr.Result().Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Query().Get("response_mode"); got != ResponseModeFormPost {
+		t.Errorf("wrong response_mode in authorization request, want: %s, got: %q", ResponseModeFormPost, got)
+	}
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == stateCookieName && c.SameSite != http.SameSiteNoneMode {
+			t.Errorf("expected SameSite=None on the %s cookie, got: %v", stateCookieName, c.SameSite)
+		}
+	}
+
+	callback := a.CallbackFunc(func(LoginJSON, string, http.ResponseWriter) {
+		t.Error("unexpected successful login")
+	})
+
+	rr = httptest.NewRecorder()
+	callback(rr, httptest.NewRequest("GET", "http://example.com/auth/callback?code=abc&state=state", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET callback to be rejected with %d, got: %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+
+	r := httptest.NewRequest("POST", "http://example.com/auth/callback", strings.NewReader("code=abc&state=other"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: stateCookieName, Value: "state"})
+	rr = httptest.NewRecorder()
+	callback(rr, r)
+	location, err = rr.Result().Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Query().Get("error"); got != errorInvalidState {
+		t.Errorf("expected the state to be read from the form body, want error: %s, got: %q", errorInvalidState, got)
+	}
+}
+
+func TestCallbackBodyLimit(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.responseMode = ResponseModeFormPost
+	a.callbackBody = newCallbackBodyLimit(64, 50*time.Millisecond)
+	callback := a.CallbackFunc(func(LoginJSON, string, http.ResponseWriter) {
+		t.Error("unexpected successful login")
+	})
+
+	post := func(body io.Reader) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://example.com/auth/callback", body)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: stateCookieName, Value: "state"})
+		rr := httptest.NewRecorder()
+		callback(rr, r)
+		return rr
+	}
+
+	if rr := post(strings.NewReader("code=abc&state=other")); rr.Code != http.StatusSeeOther {
+		t.Errorf("expected a body within the limit to be read, got status %d", rr.Code)
+	}
+
+	if rr := post(strings.NewReader("code=abc&state=state&error_description=" + strings.Repeat("a", 64))); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an oversized body to be rejected with %d, got: %d", http.StatusBadRequest, rr.Code)
+	}
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("code=abc"))
+	start := time.Now()
+	if rr := post(pr); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a stalled body to be rejected with %d, got: %d", http.StatusBadRequest, rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected a stalled body to be abandoned after the read timeout, took %s", elapsed)
+	}
+}
+
+func TestLoginHint(t *testing.T) {
+	tests := []struct {
+		name          string
+		loginHint     string
+		domains       []string
+		query         string
+		wantLoginHint string
+	}{
+		{name: "no hint", wantLoginHint: ""},
+		{name: "configured hint", loginHint: "tenant.example.com", wantLoginHint: "tenant.example.com"},
+		{name: "request hint without allowed domains", loginHint: "tenant.example.com", query: "login_hint=evil.example.com", wantLoginHint: "tenant.example.com"},
+		{name: "request hint for an allowed user", domains: []string{"example.com"}, query: "login_hint=penny@example.com", wantLoginHint: "penny@example.com"},
+		{name: "request hint for an allowed domain", domains: []string{"example.com"}, query: "login_hint=EXAMPLE.com", wantLoginHint: "EXAMPLE.com"},
+		{name: "request hint for a subdomain", domains: []string{"example.com"}, query: "login_hint=penny@evil.example.com", wantLoginHint: ""},
+		{name: "request hint with several users", domains: []string{"example.com"}, query: "login_hint=penny@evil.com@example.com", wantLoginHint: ""},
+		{name: "other query parameters are not forwarded", domains: []string{"example.com"}, query: "login_hint=penny@example.com&prompt=none", wantLoginHint: "penny@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := makeAuthenticator()
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.loginHint = tt.loginHint
+			a.loginHintDomains = tt.domains
+			a.authFunc = func() (*oauth2.Config, loginMethod) {
+				return &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example.com/auth"}}, nil
+			}
+
+			rr := httptest.NewRecorder()
+			a.LoginFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/login?"+tt.query, nil))
+			location, err := rr.Result().Location()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q := location.Query()
+			if got := q.Get("login_hint"); got != tt.wantLoginHint {
+				t.Errorf("wrong login_hint, want: %q, got: %q", tt.wantLoginHint, got)
+			}
+			if _, ok := q["prompt"]; ok {
+				t.Errorf("unexpected query parameter forwarded: %s", location)
+			}
+		})
+	}
+}
+
+func TestValidateLoginRedirect(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		target string
+		want   string
+	}{
+		{target: "", want: ""},
+		{target: "/asdf/k8s/cluster/projects", want: "/asdf/k8s/cluster/projects"},
+		{target: "/asdf/search?kind=Pod#results", want: "/asdf/search?kind=Pod#results"},
+		{target: "/asdf", want: "/asdf"},
+		{target: "https://example.com/asdf/dashboards", want: "/asdf/dashboards"},
+		{target: "/other/path", want: ""},
+		{target: "/asdf/../other", want: ""},
+		{target: "relative/path", want: ""},
+		{target: "//evil.example.com/asdf/", want: ""},
+		{target: "https://example.com//evil.example.com/asdf", want: ""},
+		{target: "/\\evil.example.com/asdf/", want: ""},
+		{target: "https://evil.example.com/asdf/", want: ""},
+		{target: "http://example.com/asdf/", want: ""},
+		{target: "javascript:alert(1)", want: ""},
+	} {
+		if got := a.validateLoginRedirect(tt.target); got != tt.want {
+			t.Errorf("%q: want: %q, got: %q", tt.target, tt.want, got)
+		}
+	}
+}
+
+func TestLoginRedirect(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example.com/auth"}}, nil
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{query: "then=" + url.QueryEscape("/asdf/search?kind=Pod&q=a b"), want: "/asdf/search?kind=Pod&q=a b"},
+		{query: "rd=/asdf/dashboards", want: "/asdf/dashboards"},
+		{query: "return_to=/asdf/k8s/cluster/projects", want: "/asdf/k8s/cluster/projects"},
+		{query: "then=https://evil.example.com/", want: ""},
+		{query: "", want: ""},
+	} {
+		rr := httptest.NewRecorder()
+		a.LoginFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/login?"+tt.query, nil))
+
+		r := httptest.NewRequest("GET", "http://example.com/auth/callback", nil)
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == loginRedirectCookieName && c.MaxAge >= 0 {
+				r.AddCookie(c)
+			}
+		}
+		if got := a.getLoginRedirect(r); got != tt.want {
+			t.Errorf("%q: want: %q, got: %q", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestSetLoginRedirect(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		returnTo string
+		want     string
+	}{
+		{returnTo: "/asdf/k8s/ns/default/pods", want: "/asdf/k8s/ns/default/pods"},
+		{returnTo: "https://evil.example.com/asdf/", want: ""},
+		{returnTo: "//evil.example.com", want: ""},
+	} {
+		rr := httptest.NewRecorder()
+		a.SetLoginRedirect(rr, httptest.NewRequest("POST", "http://example.com/auth/logout", nil), tt.returnTo)
+
+		r := httptest.NewRequest("GET", "http://example.com/auth/callback", nil)
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == loginRedirectCookieName && c.MaxAge >= 0 {
+				r.AddCookie(c)
+			}
+		}
+		if got := a.getLoginRedirect(r); got != tt.want {
+			t.Errorf("%q: want: %q, got: %q", tt.returnTo, tt.want, got)
+		}
+	}
+}
+
+func TestEmbeddedCookieSameSite(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.embeddedHeader = "X-Console-Embedded"
+	a.embeddedOrigins = []string{"https://portal.example.com"}
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example.com/auth"}}, nil
+	}
+
+	for _, tt := range []struct {
+		name         string
+		header       http.Header
+		wantSameSite http.SameSite
+	}{
+		{name: "direct", header: http.Header{}, wantSameSite: http.SameSiteLaxMode},
+		{name: "embedded header", header: http.Header{"X-Console-Embedded": {"true"}}, wantSameSite: http.SameSiteNoneMode},
+		{name: "embedded referer", header: http.Header{"Referer": {"https://portal.example.com/apps/console"}}, wantSameSite: http.SameSiteNoneMode},
+		{name: "other referer", header: http.Header{"Referer": {"https://evil.example.com/apps/console"}}, wantSameSite: http.SameSiteLaxMode},
+		{name: "referer with another scheme", header: http.Header{"Referer": {"http://portal.example.com/"}}, wantSameSite: http.SameSiteLaxMode},
+	} {
+		r := httptest.NewRequest("GET", "http://example.com/auth/login", nil)
+		r.Header = tt.header
+		rr := httptest.NewRecorder()
+		a.LoginFunc(rr, r)
+
+		var stateCookie *http.Cookie
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == stateCookieName {
+				stateCookie = c
+			}
+		}
+		if stateCookie == nil {
+			t.Fatalf("%s: missing %s cookie", tt.name, stateCookieName)
+		}
+		if stateCookie.SameSite != tt.wantSameSite {
+			t.Errorf("%s: wrong state cookie SameSite, want: %v, got: %v", tt.name, tt.wantSameSite, stateCookie.SameSite)
+		}
+		if embedded := strings.HasSuffix(stateCookie.Value, embeddedStateSuffix); embedded != (tt.wantSameSite == http.SameSiteNoneMode) {
+			t.Errorf("%s: state %q doesn't match the embedded context", tt.name, stateCookie.Value)
+		}
+
+		csrfRecorder := httptest.NewRecorder()
+		var w http.ResponseWriter = csrfRecorder
+		a.SetCSRFCookie("/", r, &w)
+		for _, c := range csrfRecorder.Result().Cookies() {
+			if c.Name == CSRFCookieName && c.SameSite != tt.wantSameSite {
+				t.Errorf("%s: wrong CSRF cookie SameSite, want: %v, got: %v", tt.name, tt.wantSameSite, c.SameSite)
+			}
+		}
+	}
+}
+
+func TestCheckIssuerCertExpiry(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	m := NewMetrics()
+	checkIssuerCertExpiry(context.Background(), s.Client(), s.URL, time.Hour, m)
+
+	want := fmt.Sprintf("console_auth_issuer_certificate_expiry_timestamp_seconds %g", float64(s.Certificate().NotAfter.Unix()))
+	got := metrics.RemoveComments(metrics.FormatMetrics(m.issuerCertificateExpiry))
+	if got != want {
+		t.Errorf("wrong issuer certificate expiry metric, want: %s, got: %s", want, got)
+	}
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			t.Error("expected a client certificate")
+		}
+	}))
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	s.StartTLS()
+	defer s.Close()
+
+	if resp, err := s.Client().Get(s.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the request without a client certificate to fail")
+	}
+
+	client := withClientCertificate(s.Client(), s.TLS.Certificates[0])
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		t.Fatalf("request with a client certificate failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestGetCapabilities(t *testing.T) {
+	tests := []struct {
+		name              string
+		authSource        AuthSource
+		identityClaim     string
+		wantIdentityClaim string
+	}{
+		{name: "oidc default claim", authSource: AuthSourceTectonic, wantIdentityClaim: "sub"},
+		{name: "oidc configured claim", authSource: AuthSourceTectonic, identityClaim: "oid", wantIdentityClaim: "oid"},
+		{name: "openshift has no claim", authSource: AuthSourceOpenShift},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := newUnstartedAuthenticator(&Config{
+				AuthSource:    tt.authSource,
+				Scope:         []string{"openid", "groups"},
+				IdentityClaim: tt.identityClaim,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := a.GetCapabilities()
+			if !reflect.DeepEqual(got.Scopes, []string{"openid", "groups"}) {
+				t.Errorf("expected the configured scopes, got %q", got.Scopes)
+			}
+			if got.IdentityClaim != tt.wantIdentityClaim {
+				t.Errorf("expected identity claim %q, got %q", tt.wantIdentityClaim, got.IdentityClaim)
+			}
+		})
+	}
+}
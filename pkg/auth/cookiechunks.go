@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxCookieChunkSize is the largest value kept in one cookie. Browsers limit
+// cookies to 4KB including the name and attributes.
+const maxCookieChunkSize = 3800
+
+// errSessionCookieTooLarge is returned by login when the session doesn't fit
+// in the allowed number of cookie chunks.
+var errSessionCookieTooLarge = errors.New("session cookie is too large")
+
+// chunkCookieName returns the name of the i-th chunk of the cookie name. The
+// first chunk keeps the name, so that unchunked sessions stay valid.
+func chunkCookieName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s-%d", name, i)
+}
+
+// isCookieChunk returns whether the Set-Cookie header value sets a chunk of
+// the cookie name.
+func isCookieChunk(setCookie, name string) bool {
+	if strings.HasPrefix(setCookie, name+"=") {
+		return true
+	}
+	rest := strings.TrimPrefix(setCookie, name+"-")
+	if rest == setCookie {
+		return false
+	}
+	i := strings.IndexByte(rest, '=')
+	if i <= 0 {
+		return false
+	}
+	_, err := strconv.Atoi(rest[:i])
+	return err == nil
+}
+
+// setChunkedCookie splits the value of cookie across at most maxChunks
+// cookies. Nothing is written if the value doesn't fit. Chunks of an earlier,
+// larger value are deleted.
+func setChunkedCookie(w http.ResponseWriter, cookie http.Cookie, maxChunks int) error {
+	if maxChunks < 1 {
+		maxChunks = 1
+	}
+	var chunks []string
+	for value := cookie.Value; len(value) > 0 || len(chunks) == 0; {
+		n := len(value)
+		if n > maxCookieChunkSize {
+			n = maxCookieChunkSize
+		}
+		chunks = append(chunks, value[:n])
+		value = value[n:]
+	}
+	if len(chunks) > maxChunks {
+		return fmt.Errorf("%w: %d bytes need %d cookies of at most %d bytes, the limit is %d",
+			errSessionCookieTooLarge, len(cookie.Value), len(chunks), maxCookieChunkSize, maxChunks)
+	}
+
+	for i := 0; i < maxChunks; i++ {
+		chunk := cookie
+		chunk.Name = chunkCookieName(cookie.Name, i)
+		if i < len(chunks) {
+			chunk.Value = chunks[i]
+		} else {
+			chunk.Value = ""
+			chunk.MaxAge = -1
+		}
+		http.SetCookie(w, &chunk)
+	}
+	return nil
+}
+
+// readChunkedCookie reassembles the value of a cookie written by
+// setChunkedCookie.
+func readChunkedCookie(r *http.Request, name string, maxChunks int) (string, error) {
+	first, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	value := first.Value
+	for i := 1; i < maxChunks; i++ {
+		chunk, err := r.Cookie(chunkCookieName(name, i))
+		if err != nil || chunk.Value == "" {
+			break
+		}
+		value += chunk.Value
+	}
+	return value, nil
+}
+
+// deleteChunkedCookie deletes all chunks of cookie.
+func deleteChunkedCookie(w http.ResponseWriter, cookie http.Cookie, maxChunks int) {
+	if maxChunks < 1 {
+		maxChunks = 1
+	}
+	for i := 0; i < maxChunks; i++ {
+		chunk := cookie
+		chunk.Name = chunkCookieName(cookie.Name, i)
+		chunk.Value = ""
+		http.SetCookie(w, &chunk)
+	}
+}
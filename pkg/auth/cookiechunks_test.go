@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSessionCookieChunks(t *testing.T) {
+	o := &openShiftAuth{cookiePath: "/", sessionCookieMaxChunks: 3}
+	accessToken := strings.Repeat("a", maxCookieChunkSize) + strings.Repeat("b", maxCookieChunkSize) + "c"
+	token := &oauth2.Token{AccessToken: accessToken, Expiry: time.Now().Add(time.Hour)}
+
+	w := httptest.NewRecorder()
+	if _, err := o.login(w, token, http.SameSiteLaxMode); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 3 {
+		t.Fatalf("expected 3 session cookie chunks, got %d", len(cookies))
+	}
+	for i, cookie := range cookies {
+		if want := chunkCookieName(openshiftAccessTokenCookieName, i); cookie.Name != want {
+			t.Errorf("expected chunk %d to be named %q, got %q", i, want, cookie.Name)
+		}
+		if len(cookie.Value) > maxCookieChunkSize {
+			t.Errorf("chunk %d has %d bytes, more than %d", i, len(cookie.Value), maxCookieChunkSize)
+		}
+	}
+	if size := sessionCookieSize(w.Header()); size <= len(accessToken) {
+		t.Errorf("expected the session cookie size to count all chunks, got %d", size)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/kubernetes", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	user, err := getOpenShiftUser(r, o.sessionCookieMaxChunks)
+	if err != nil {
+		t.Fatalf("getOpenShiftUser failed: %v", err)
+	}
+	if user.Token != accessToken {
+		t.Errorf("reassembled token has %d bytes, expected %d", len(user.Token), len(accessToken))
+	}
+
+	w = httptest.NewRecorder()
+	o.logout(w, r)
+	deleted := w.Result().Cookies()
+	if len(deleted) != 3 {
+		t.Fatalf("expected logout to delete 3 chunks, got %d", len(deleted))
+	}
+	for i, cookie := range deleted {
+		if cookie.Name != chunkCookieName(openshiftAccessTokenCookieName, i) || cookie.Value != "" {
+			t.Errorf("expected chunk %d to be deleted, got %s=%q", i, cookie.Name, cookie.Value)
+		}
+	}
+
+	// A smaller token deletes the chunks it doesn't need anymore.
+	w = httptest.NewRecorder()
+	if _, err := o.login(w, &oauth2.Token{AccessToken: "small"}, http.SameSiteLaxMode); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	cookies = w.Result().Cookies()
+	if len(cookies) != 3 || cookies[0].Value != "small" || cookies[1].MaxAge >= 0 || cookies[2].MaxAge >= 0 {
+		t.Errorf("expected the unused chunks to be deleted, got %v", cookies)
+	}
+
+	o.sessionCookieMaxChunks = 2
+	w = httptest.NewRecorder()
+	if _, err := o.login(w, token, http.SameSiteLaxMode); !errors.Is(err, errSessionCookieTooLarge) {
+		t.Errorf("expected errSessionCookieTooLarge, got %v", err)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("expected no cookies when the token is too large, got %v", w.Result().Cookies())
+	}
+}
+
+func TestSessionCookieUnchunked(t *testing.T) {
+	o := &openShiftAuth{cookiePath: "/"}
+
+	w := httptest.NewRecorder()
+	if _, err := o.login(w, &oauth2.Token{AccessToken: "token"}, http.SameSiteLaxMode); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != openshiftAccessTokenCookieName || cookies[0].Value != "token" {
+		t.Errorf("expected a single session cookie, got %v", cookies)
+	}
+
+	w = httptest.NewRecorder()
+	_, err := o.login(w, &oauth2.Token{AccessToken: strings.Repeat("a", maxCookieChunkSize+1)}, http.SameSiteLaxMode)
+	if !errors.Is(err, errSessionCookieTooLarge) {
+		t.Errorf("expected errSessionCookieTooLarge without chunking, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// credentialCheck holds the result of the last client credential check.
+type credentialCheck struct {
+	mux sync.Mutex
+	err error
+}
+
+// ClientCredentialStatus is a health.Checkable reporting whether the provider
+// accepted the client ID and secret on the last check.
+type ClientCredentialStatus struct {
+	a *Authenticator
+}
+
+func (a *Authenticator) ClientCredentialStatus() ClientCredentialStatus {
+	return ClientCredentialStatus{a: a}
+}
+
+func (s ClientCredentialStatus) Healthy() error {
+	s.a.credentials.mux.Lock()
+	defer s.a.credentials.mux.Unlock()
+	return s.a.credentials.err
+}
+
+// errClientCredentialsRejected is returned when the provider doesn't accept the client ID or secret.
+var errClientCredentialsRejected = errors.New("client credentials rejected by the auth provider")
+
+// checkCredentialsPeriodically checks the client credentials every interval until ctx is done.
+func (a *Authenticator) checkCredentialsPeriodically(ctx context.Context, c *Config, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if a.Healthy() == nil {
+			a.checkCredentials(ctx, c)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Authenticator) checkCredentials(ctx context.Context, c *Config) {
+	tokenURL := a.getOAuth2Config().Endpoint.TokenURL
+	err := checkClientCredentials(ctx, a.clientFunc(), tokenURL, c.ClientID, c.ClientSecret)
+	if err != nil {
+		klog.Errorf("auth client credential check failed for client %q at %s: %v", c.ClientID, tokenURL, err)
+	}
+
+	if a.metrics != nil {
+		a.metrics.ClientCredentialsChecked(err)
+	}
+
+	a.credentials.mux.Lock()
+	a.credentials.err = err
+	a.credentials.mux.Unlock()
+}
+
+// checkClientCredentials requests a client_credentials grant from the token
+// endpoint. Providers authenticate the client before checking whether the grant
+// is allowed for it, so only a 401 or an invalid_client error means that the
+// client ID or secret were rejected. Any other response accepts them.
+func checkClientCredentials(ctx context.Context, client *http.Client, tokenURL, clientID, clientSecret string) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errClientCredentialsRejected
+	}
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var tokenErr struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &tokenErr); err != nil {
+		return fmt.Errorf("unexpected response from token endpoint: %s", resp.Status)
+	}
+
+	if tokenErr.Error == "invalid_client" {
+		return errClientCredentialsRejected
+	}
+
+	return nil
+}
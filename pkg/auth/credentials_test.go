@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckClientCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantErr      bool
+		wantRejected bool
+	}{
+		{name: "token issued", status: http.StatusOK, body: `{"access_token":"token","token_type":"Bearer"}`},
+		{name: "grant not allowed for the client", status: http.StatusBadRequest, body: `{"error":"unauthorized_client"}`},
+		{name: "grant not supported", status: http.StatusBadRequest, body: `{"error":"unsupported_grant_type"}`},
+		{name: "invalid client", status: http.StatusBadRequest, body: `{"error":"invalid_client"}`, wantErr: true, wantRejected: true},
+		{name: "unauthorized", status: http.StatusUnauthorized, body: `{"error":"invalid_client"}`, wantErr: true, wantRejected: true},
+		{name: "provider unavailable", status: http.StatusServiceUnavailable, body: `<html>unavailable</html>`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+					t.Errorf("expected a client_credentials grant request, got: %v", r.PostForm)
+				}
+				if id, secret, ok := r.BasicAuth(); !ok || id != "console" || secret != "secret" {
+					t.Errorf("expected basic auth with the client credentials, got: %q %q", id, secret)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer s.Close()
+
+			err := checkClientCredentials(context.Background(), s.Client(), s.URL, "console", "secret")
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if gotRejected := errors.Is(err, errClientCredentialsRejected); gotRejected != tt.wantRejected {
+				t.Errorf("expected rejected: %v, got: %v", tt.wantRejected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+	"k8s.io/klog"
+)
+
+// providerMetadata is the part of the OIDC discovery document used by the console.
+type providerMetadata struct {
+	Issuer     string   `json:"issuer"`
+	AuthURL    string   `json:"authorization_endpoint"`
+	TokenURL   string   `json:"token_endpoint"`
+	JWKSURL    string   `json:"jwks_uri"`
+	Algorithms []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// supportedSigningAlgs are the signing algorithms supported by go-oidc.
+var supportedSigningAlgs = map[string]bool{
+	oidc.RS256: true,
+	oidc.RS384: true,
+	oidc.RS512: true,
+	oidc.ES256: true,
+	oidc.ES384: true,
+	oidc.ES512: true,
+	oidc.PS256: true,
+	oidc.PS384: true,
+	oidc.PS512: true,
+}
+
+// ValidateSigningAlg returns an error if alg can't be used in
+// Config.SigningAlgs.
+func ValidateSigningAlg(alg string) error {
+	if strings.EqualFold(alg, "none") {
+		return fmt.Errorf("unsigned ID tokens are never accepted")
+	}
+	if !supportedSigningAlgs[alg] {
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return nil
+}
+
+// checkSigningAlgs warns if none of the configured signing algorithms is
+// advertised by the provider, logins will then likely fail.
+func checkSigningAlgs(configured, advertised []string) {
+	if len(configured) == 0 || len(advertised) == 0 {
+		return
+	}
+	for _, alg := range configured {
+		for _, a := range advertised {
+			if alg == a {
+				return
+			}
+		}
+	}
+	klog.Warningf("none of the accepted ID token signing algorithms %q is advertised by the provider, which supports %q", configured, advertised)
+}
+
+// parseDiscovery decodes a discovery document and checks that it belongs to issuer.
+func parseDiscovery(doc []byte, issuer string) (*providerMetadata, error) {
+	var m providerMetadata
+	if err := json.Unmarshal(doc, &m); err != nil {
+		return nil, fmt.Errorf("oidc: failed to decode provider discovery object: %v", err)
+	}
+	if m.Issuer != issuer {
+		return nil, fmt.Errorf("oidc: issuer did not match the issuer returned by provider, expected %q got %q", issuer, m.Issuer)
+	}
+	if m.AuthURL == "" || m.TokenURL == "" || m.JWKSURL == "" {
+		return nil, fmt.Errorf("oidc: provider discovery object is missing endpoints")
+	}
+	return &m, nil
+}
+
+// fetchProviderMetadata fetches and parses the discovery document of issuer
+// from issuerURL.
+func fetchProviderMetadata(ctx context.Context, issuerURL, issuer string) (*providerMetadata, error) {
+	doc, err := fetchDiscovery(ctx, issuerURL)
+	if err != nil {
+		return nil, err
+	}
+	return parseDiscovery(doc, issuer)
+}
+
+// fetchDiscovery fetches the discovery document of issuer with the HTTP
+// client of ctx.
+func fetchDiscovery(ctx context.Context, issuer string) ([]byte, error) {
+	return fetch(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+}
+
+// fetchJWKS fetches the key set of the provider from jwksURL and returns the
+// number of keys in it.
+func fetchJWKS(ctx context.Context, jwksURL string) (int, error) {
+	body, err := fetch(ctx, jwksURL)
+	if err != nil {
+		return 0, err
+	}
+	var keySet struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &keySet); err != nil {
+		return 0, fmt.Errorf("oidc: failed to decode keys: %v", err)
+	}
+	if len(keySet.Keys) == 0 {
+		return 0, fmt.Errorf("oidc: no keys at %s", jwksURL)
+	}
+	return len(keySet.Keys), nil
+}
+
+// fetch GETs url with the HTTP client of ctx.
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.DefaultClient
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		client = c
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return body, nil
+}
+
+func (m *providerMetadata) endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{AuthURL: m.AuthURL, TokenURL: m.TokenURL}
+}
+
+// verifier mirrors oidc.Provider.Verifier for a discovery document that was
+// not fetched by go-oidc.
+func (m *providerMetadata) verifier(ctx context.Context, config *oidc.Config) *oidc.IDTokenVerifier {
+	if len(config.SupportedSigningAlgs) == 0 {
+		for _, alg := range m.Algorithms {
+			if supportedSigningAlgs[alg] {
+				config.SupportedSigningAlgs = append(config.SupportedSigningAlgs, alg)
+			}
+		}
+	}
+	return oidc.NewVerifier(m.Issuer, oidc.NewRemoteKeySet(ctx, m.JWKSURL), config)
+}
+
+// discoveryCache persists the discovery document in a file, so that restarts
+// of many console pods don't all hit the discovery endpoint of the provider.
+type discoveryCache struct {
+	path string
+	ttl  time.Duration
+	now  nowFunc
+}
+
+// load returns the cached discovery document of issuer if it is fresh.
+func (c *discoveryCache) load(issuer string) (*providerMetadata, bool) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Warningf("failed to read the OIDC discovery cache: %v", err)
+		}
+		return nil, false
+	}
+	if age := c.now().Sub(info.ModTime()); age > c.ttl {
+		klog.V(4).Infof("OIDC discovery cache is stale, age %s", age)
+		return nil, false
+	}
+
+	doc, err := os.ReadFile(c.path)
+	if err != nil {
+		klog.Warningf("failed to read the OIDC discovery cache: %v", err)
+		return nil, false
+	}
+	m, err := parseDiscovery(doc, issuer)
+	if err != nil {
+		klog.Warningf("ignoring the OIDC discovery cache %s: %v", c.path, err)
+		return nil, false
+	}
+	return m, true
+}
+
+// store replaces the cached discovery document. Failures are only logged, the
+// cache is an optimization.
+func (c *discoveryCache) store(doc []byte) {
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		klog.Warningf("failed to write the OIDC discovery cache: %v", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(doc)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		klog.Warningf("failed to write the OIDC discovery cache: %v", err)
+	}
+}
+
+// discover returns the discovery document of issuer, fetched from issuerURL,
+// from the cache if it is fresh. fromCache reports whether the document was
+// loaded from the cache.
+func (c *discoveryCache) discover(ctx context.Context, issuerURL, issuer string) (m *providerMetadata, fromCache bool, err error) {
+	if m, ok := c.load(issuer); ok {
+		klog.Infof("using the cached OIDC discovery document %s", c.path)
+		return m, true, nil
+	}
+
+	m, err = c.refresh(ctx, issuerURL, issuer)
+	return m, false, err
+}
+
+// refresh fetches the discovery document of issuer from issuerURL and updates
+// the cache.
+func (c *discoveryCache) refresh(ctx context.Context, issuerURL, issuer string) (*providerMetadata, error) {
+	doc, err := fetchDiscovery(ctx, issuerURL)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseDiscovery(doc, issuer)
+	if err != nil {
+		return nil, err
+	}
+	c.store(doc)
+	return m, nil
+}
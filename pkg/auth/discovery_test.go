@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryCache(t *testing.T) {
+	fetches := 0
+	var issuer string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches++
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/auth","token_endpoint":"%[1]s/token","jwks_uri":"%[1]s/keys"}`, issuer)
+	}))
+	defer s.Close()
+	issuer = s.URL
+
+	now := time.Now()
+	cache := &discoveryCache{
+		path: filepath.Join(t.TempDir(), "discovery.json"),
+		ttl:  time.Hour,
+		now:  func() time.Time { return now },
+	}
+
+	for _, tt := range []struct {
+		name          string
+		setup         func()
+		wantFromCache bool
+		wantFetches   int
+	}{
+		{name: "no cache file", wantFromCache: false, wantFetches: 1},
+		{name: "fresh cache file", wantFromCache: true, wantFetches: 1},
+		{name: "stale cache file", setup: func() { now = now.Add(2 * time.Hour) }, wantFromCache: false, wantFetches: 2},
+		{name: "cache file of another issuer", setup: func() {
+			if err := os.WriteFile(cache.path, []byte(`{"issuer":"https://other.example.com","authorization_endpoint":"https://other.example.com/auth","token_endpoint":"https://other.example.com/token","jwks_uri":"https://other.example.com/keys"}`), 0600); err != nil {
+				t.Fatal(err)
+			}
+			now = time.Now()
+		}, wantFromCache: false, wantFetches: 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup()
+			}
+			m, fromCache, err := cache.discover(context.Background(), issuer, issuer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fromCache != tt.wantFromCache {
+				t.Errorf("expected from cache: %v, got: %v", tt.wantFromCache, fromCache)
+			}
+			if fetches != tt.wantFetches {
+				t.Errorf("expected %d fetches, got %d", tt.wantFetches, fetches)
+			}
+			if m.TokenURL != issuer+"/token" {
+				t.Errorf("unexpected token URL %q", m.TokenURL)
+			}
+		})
+	}
+}
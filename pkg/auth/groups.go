@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// errMissingRequiredGroups is returned by login when the user isn't a member
+// of the groups required to use the console.
+var errMissingRequiredGroups = errors.New("user is not a member of the required groups")
+
+const (
+	// GroupsOverflowPolicyTruncate keeps the first groups, in sorted order, of
+	// a user with more groups than allowed.
+	GroupsOverflowPolicyTruncate = "truncate"
+	// GroupsOverflowPolicyReject rejects the login of a user with more groups
+	// than allowed.
+	GroupsOverflowPolicyReject = "reject"
+)
+
+// errTooManyGroups is returned by login when the user has more groups than
+// allowed and the overflow policy rejects the login.
+var errTooManyGroups = errors.New("user has too many groups")
+
+// groupsLimit caps the number of groups kept for a user. A max of zero keeps
+// all groups.
+type groupsLimit struct {
+	max    int
+	reject bool
+}
+
+// apply returns userGroups if they are within the limit. Otherwise it returns
+// the first max groups in sorted order, so that the same groups are kept on
+// every login, or errTooManyGroups if the limit rejects.
+func (l groupsLimit) apply(userGroups []string) ([]string, error) {
+	if l.max == 0 || len(userGroups) <= l.max {
+		return userGroups, nil
+	}
+	if l.reject {
+		return nil, fmt.Errorf("%w: %d groups, at most %d are allowed", errTooManyGroups, len(userGroups), l.max)
+	}
+	sorted := append([]string(nil), userGroups...)
+	sort.Strings(sorted)
+	return sorted[:l.max], nil
+}
+
+// groupRequirement restricts logins to members of groups. With all set, the
+// user must be a member of every group, otherwise of at least one.
+type groupRequirement struct {
+	groups []string
+	all    bool
+}
+
+func (g groupRequirement) allows(userGroups []string) bool {
+	if len(g.groups) == 0 {
+		return true
+	}
+
+	member := make(map[string]bool, len(userGroups))
+	for _, group := range userGroups {
+		member[group] = true
+	}
+	for _, group := range g.groups {
+		if member[group] && !g.all {
+			return true
+		}
+		if !member[group] && g.all {
+			return false
+		}
+	}
+	return g.all
+}
+
+// selfSubjectGroups asks the API server which groups the token belongs to.
+// OpenShift access tokens don't carry groups themselves.
+func selfSubjectGroups(ctx context.Context, k8sConfig *rest.Config, token string) ([]string, error) {
+	client, err := kubernetes.NewForConfig(&rest.Config{
+		Host:        k8sConfig.Host,
+		Transport:   k8sConfig.Transport,
+		BearerToken: token,
+		Timeout:     30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := client.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authnv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return review.Status.UserInfo.Groups, nil
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// idpInitiatedLoginTTL is how old the ID token of a login started by the
+// identity provider may be, and how long its nonce is remembered.
+const idpInitiatedLoginTTL = 5 * time.Minute
+
+// errUnsolicitedLogin is returned for a login started by the identity provider
+// that can't be accepted.
+var errUnsolicitedLogin = errors.New("rejecting login started by the identity provider")
+
+// idpInitiatedLogins accepts logins started by the identity provider, which
+// come without the state cookie protecting logins started by the console.
+// Instead, their ID token must be recent and have a nonce that wasn't seen
+// before. Nonces are only remembered by this console instance.
+type idpInitiatedLogins struct {
+	mux       sync.Mutex
+	nonces    map[string]time.Time
+	ttl       time.Duration
+	clockSkew time.Duration
+	now       nowFunc
+}
+
+func newIdPInitiatedLogins(clockSkew time.Duration) *idpInitiatedLogins {
+	return &idpInitiatedLogins{
+		nonces:    make(map[string]time.Time),
+		ttl:       idpInitiatedLoginTTL,
+		clockSkew: clockSkew,
+		now:       defaultNow,
+	}
+}
+
+// check accepts the ID token of token once. The signature of the ID token is
+// verified by the login method afterwards, token comes from the token endpoint.
+func (l *idpInitiatedLogins) check(token *oauth2.Token) error {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return fmt.Errorf("%w: token response did not have an id_token field", errUnsolicitedLogin)
+	}
+	claims, err := unverifiedIDTokenClaims(rawIDToken)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUnsolicitedLogin, err)
+	}
+	if claims.Nonce == "" {
+		return fmt.Errorf("%w: ID token has no nonce", errUnsolicitedLogin)
+	}
+
+	now := l.now()
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	if issuedAt.Before(now.Add(-l.ttl-l.clockSkew)) || issuedAt.After(now.Add(l.clockSkew)) {
+		return fmt.Errorf("%w: ID token issued at %v is not within %v", errUnsolicitedLogin, issuedAt, l.ttl)
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	for nonce, exp := range l.nonces {
+		if !exp.After(now) {
+			delete(l.nonces, nonce)
+		}
+	}
+	if _, seen := l.nonces[claims.Nonce]; seen {
+		return fmt.Errorf("%w: nonce was already used", errUnsolicitedLogin)
+	}
+	l.nonces[claims.Nonce] = now.Add(l.ttl + 2*l.clockSkew)
+	return nil
+}
+
+type idTokenReplayClaims struct {
+	Nonce    string `json:"nonce"`
+	IssuedAt int64  `json:"iat"`
+}
+
+// unverifiedIDTokenClaims decodes the claims of a JWT without verifying it.
+func unverifiedIDTokenClaims(rawIDToken string) (*idTokenReplayClaims, error) {
+	var claims idTokenReplayClaims
+	if err := decodeUnverifiedClaims(rawIDToken, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// decodeUnverifiedClaims decodes the claims of a JWT into v without verifying
+// it.
+func decodeUnverifiedClaims(rawIDToken string, v interface{}) error {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("malformed ID token payload: %v", err)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("malformed ID token claims: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestIdPInitiatedLoginsCheck(t *testing.T) {
+	now := time.Now()
+	l := newIdPInitiatedLogins(time.Minute)
+	l.now = func() time.Time { return now }
+
+	check := func(claims map[string]interface{}) error {
+		token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, claims)})
+		return l.check(token)
+	}
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		wantErr bool
+	}{
+		{name: "fresh", claims: map[string]interface{}{"nonce": "first", "iat": now.Unix()}},
+		{name: "replayed nonce", claims: map[string]interface{}{"nonce": "first", "iat": now.Unix()}, wantErr: true},
+		{name: "no nonce", claims: map[string]interface{}{"iat": now.Unix()}, wantErr: true},
+		{name: "no iat", claims: map[string]interface{}{"nonce": "second"}, wantErr: true},
+		{name: "within the skew", claims: map[string]interface{}{"nonce": "third", "iat": now.Add(-idpInitiatedLoginTTL - 30*time.Second).Unix()}},
+		{name: "too old", claims: map[string]interface{}{"nonce": "fourth", "iat": now.Add(-idpInitiatedLoginTTL - 2*time.Minute).Unix()}, wantErr: true},
+		{name: "from the future", claims: map[string]interface{}{"nonce": "fifth", "iat": now.Add(2 * time.Minute).Unix()}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := check(tt.claims)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if tt.wantErr && !errors.Is(err, errUnsolicitedLogin) {
+				t.Errorf("expected %v, got: %v", errUnsolicitedLogin, err)
+			}
+		})
+	}
+
+	if err := l.check(&oauth2.Token{AccessToken: "access"}); !errors.Is(err, errUnsolicitedLogin) {
+		t.Errorf("expected a token without ID token to be rejected, got: %v", err)
+	}
+
+	now = now.Add(idpInitiatedLoginTTL + 3*time.Minute)
+	if len(l.nonces) == 0 {
+		t.Fatal("expected nonces to be remembered")
+	}
+	if err := check(map[string]interface{}{"nonce": "sixth", "iat": now.Unix()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(l.nonces) != 1 {
+		t.Errorf("expected expired nonces to be forgotten, got %d", len(l.nonces))
+	}
+}
+
+func TestIdPInitiatedLoginCallback(t *testing.T) {
+	idToken := newTestIDToken(t, map[string]interface{}{"aud": "console", "nonce": "nonce", "iat": time.Now().Unix()})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	}))
+	defer tokenServer.Close()
+
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{ClientID: "console", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}, o
+	}
+
+	var loggedIn int
+	callback := a.CallbackFunc(func(LoginJSON, string, http.ResponseWriter) {
+		loggedIn++
+	})
+	errorType := func(rr *httptest.ResponseRecorder) string {
+		t.Helper()
+		location, err := rr.Result().Location()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return location.Query().Get("error")
+	}
+
+	rr := httptest.NewRecorder()
+	callback(rr, httptest.NewRequest("GET", "http://example.com/auth/callback?code=abc", nil))
+	if got := errorType(rr); got != errorMissingState {
+		t.Errorf("expected logins without state cookie to be rejected by default, want error: %s, got: %q", errorMissingState, got)
+	}
+
+	a.idpInitiated = newIdPInitiatedLogins(0)
+
+	rr = httptest.NewRecorder()
+	callback(rr, httptest.NewRequest("GET", "http://example.com/auth/callback?code=abc&state=state", nil))
+	if got := errorType(rr); got != errorMissingState {
+		t.Errorf("expected a state without state cookie to be rejected, want error: %s, got: %q", errorMissingState, got)
+	}
+
+	rr = httptest.NewRecorder()
+	callback(rr, httptest.NewRequest("GET", "http://example.com/auth/callback?code=abc", nil))
+	if loggedIn != 1 {
+		t.Fatalf("expected the login started by the identity provider to be accepted, got: %v", rr.Result().Header)
+	}
+
+	rr = httptest.NewRecorder()
+	callback(rr, httptest.NewRequest("GET", "http://example.com/auth/callback?code=abc", nil))
+	if got := errorType(rr); got != errorUnsolicitedLogin {
+		t.Errorf("expected a replayed ID token to be rejected, want error: %s, got: %q", errorUnsolicitedLogin, got)
+	}
+	if loggedIn != 1 {
+		t.Errorf("expected one login, got %d", loggedIn)
+	}
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "fmt"
+
+// KubernetesUsername returns the username the Kubernetes API server assigns
+// to the user of an OIDC session, so that it can be impersonated. Like the
+// --oidc-username-claim and --oidc-username-prefix flags of the API server, it
+// is taken from claim of the ID token of u and prefixed with prefix. An empty
+// prefix defaults to the issuer and "#" for claims other than "email", "-"
+// disables the prefix. The ID token was verified when the session was created.
+func KubernetesUsername(u *User, claim, prefix string) (string, error) {
+	var claims map[string]interface{}
+	if err := decodeUnverifiedClaims(u.Token, &claims); err != nil {
+		return "", err
+	}
+	username, ok := claims[claim].(string)
+	if !ok || username == "" {
+		return "", fmt.Errorf("ID token has no username claim %q", claim)
+	}
+	switch {
+	case prefix == "-":
+		return username, nil
+	case prefix != "":
+		return prefix + username, nil
+	case claim == "email":
+		return username, nil
+	}
+	issuer, _ := claims["iss"].(string)
+	return issuer + "#" + username, nil
+}
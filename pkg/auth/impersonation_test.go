@@ -0,0 +1,36 @@
+package auth
+
+import "testing"
+
+func TestKubernetesUsername(t *testing.T) {
+	tests := []struct {
+		name    string
+		claim   string
+		prefix  string
+		claims  map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{name: "sub is prefixed with the issuer", claim: "sub", want: testIssuer + "#user-id"},
+		{name: "email is not prefixed", claim: "email", claims: map[string]interface{}{"email": "jane@example.com"}, want: "jane@example.com"},
+		{name: "other claims are prefixed with the issuer", claim: "preferred_username", claims: map[string]interface{}{"preferred_username": "jane"}, want: testIssuer + "#jane"},
+		{name: "configured prefix", claim: "preferred_username", prefix: "oidc:", claims: map[string]interface{}{"preferred_username": "jane"}, want: "oidc:jane"},
+		{name: "prefix disabled", claim: "sub", prefix: "-", want: "user-id"},
+		{name: "missing claim", claim: "preferred_username", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := tt.claims
+			if claims == nil {
+				claims = map[string]interface{}{}
+			}
+			got, err := KubernetesUsername(&User{ID: "user-id", Token: newTestIDToken(t, claims)}, tt.claim, tt.prefix)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// providerFailures tracks how long contacting the identity provider, for
+// discovery or to refresh its signing keys, has been failing without a single
+// success in between.
+type providerFailures struct {
+	mux       sync.Mutex
+	since     time.Time
+	err       error
+	unhealthy bool
+
+	// threshold is how long failures may last before the authenticator is
+	// reported as not live. Zero disables the check.
+	threshold time.Duration
+	metrics   *Metrics
+	now       nowFunc
+}
+
+func newProviderFailures(threshold time.Duration, metrics *Metrics) *providerFailures {
+	return &providerFailures{
+		threshold: threshold,
+		metrics:   metrics,
+		now:       defaultNow,
+	}
+}
+
+// record tracks the result of contacting the provider. It is a no-op on a nil
+// receiver.
+func (f *providerFailures) record(err error) {
+	if f == nil {
+		return
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if err == nil {
+		if f.unhealthy {
+			klog.Infof("auth provider can be contacted again after failing for %s", f.now().Sub(f.since))
+		}
+		f.since, f.err = time.Time{}, nil
+		f.setUnhealthy(false)
+		return
+	}
+
+	if f.since.IsZero() {
+		f.since = f.now()
+	}
+	f.err = err
+	f.check()
+}
+
+// check returns an error if failures lasted longer than the threshold, and
+// logs when that happens first. f.mux must be held.
+func (f *providerFailures) check() error {
+	if f.threshold <= 0 || f.since.IsZero() {
+		return nil
+	}
+	failing := f.now().Sub(f.since)
+	if failing <= f.threshold {
+		return nil
+	}
+
+	err := fmt.Errorf("contacting the auth provider has been failing for %s: %v", failing.Truncate(time.Second), f.err)
+	if !f.unhealthy {
+		klog.Errorf("authenticator is unhealthy, %v", err)
+	}
+	f.setUnhealthy(true)
+	return err
+}
+
+func (f *providerFailures) setUnhealthy(unhealthy bool) {
+	f.unhealthy = unhealthy
+	if f.metrics != nil {
+		f.metrics.ProviderUnhealthy(unhealthy)
+	}
+}
+
+// isKeyFetchError returns true if the signing keys of the provider couldn't be
+// fetched while verifying an ID token. go-oidc doesn't return typed errors.
+func isKeyFetchError(err error) bool {
+	return strings.Contains(err.Error(), "fetching keys")
+}
+
+// Liveness is a health.Checkable reporting whether the identity provider could
+// be contacted recently, see Config.UnhealthyThreshold. It is checked by
+// /livez, so that Kubernetes restarts a console stuck with a failing provider.
+type Liveness struct {
+	a *Authenticator
+}
+
+func (a *Authenticator) Liveness() Liveness {
+	return Liveness{a: a}
+}
+
+func (l Liveness) Healthy() error {
+	f := l.a.providerFailures
+	if f == nil {
+		return nil
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.check()
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+
+	"github.com/openshift/console/pkg/metrics"
+)
+
+// unreachableKeySet fails like a remote key set whose keys can't be fetched.
+type unreachableKeySet struct{}
+
+func (unreachableKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	return nil, errors.New("fetching keys oidc: get keys failed: 503 Service Unavailable")
+}
+
+func TestLiveness(t *testing.T) {
+	now := time.Now()
+	m := NewMetrics()
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.providerFailures = newProviderFailures(10*time.Minute, m)
+	a.providerFailures.now = func() time.Time { return now }
+
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.verifier = oidc.NewVerifier(testIssuer, unreachableKeySet{}, (&oidcConfig{clientID: "console"}).verifierConfig())
+	o.providerFailures = a.providerFailures
+	verify := func() {
+		if _, err := o.verify(context.Background(), newTestIDToken(t, map[string]interface{}{"aud": "console"})); err == nil {
+			t.Fatal("expected verification to fail without signing keys")
+		}
+	}
+	unhealthy := func() string {
+		return metrics.RemoveComments(metrics.FormatMetrics(m.providerUnhealthy))
+	}
+
+	verify()
+	if err := a.Liveness().Healthy(); err != nil {
+		t.Errorf("expected a new failure to be tolerated, got: %v", err)
+	}
+
+	now = now.Add(5 * time.Minute)
+	verify()
+	now = now.Add(6 * time.Minute)
+	if err := a.Liveness().Healthy(); err == nil {
+		t.Error("expected failures for longer than the threshold to be reported")
+	}
+	if got := unhealthy(); got != "console_auth_provider_unhealthy 1" {
+		t.Errorf("expected the provider to be reported unhealthy, got: %s", got)
+	}
+
+	a.providerFailures.record(nil)
+	if err := a.Liveness().Healthy(); err != nil {
+		t.Errorf("expected a success to end the failures, got: %v", err)
+	}
+	if got := unhealthy(); got != "console_auth_provider_unhealthy 0" {
+		t.Errorf("expected the provider to be reported healthy, got: %s", got)
+	}
+
+	now = now.Add(time.Hour)
+	verify()
+	if err := a.Liveness().Healthy(); err != nil {
+		t.Errorf("expected the failures to be counted from the last success, got: %v", err)
+	}
+
+	a.providerFailures = nil
+	if err := a.Liveness().Healthy(); err != nil {
+		t.Errorf("expected no error without a threshold, got: %v", err)
+	}
+}
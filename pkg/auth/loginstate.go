@@ -13,10 +13,33 @@ type loginState struct {
 	UserID       string
 	Name         string
 	Email        string
+	Groups       []string
 	exp          time.Time
 	now          nowFunc
 	sessionToken string
 	rawToken     string
+	// epoch is the session epoch the session was created in.
+	epoch int64
+	// encryptedRefreshToken is only kept when sessions follow the token
+	// expiry and refresh tokens are stored. It is decrypted for refreshes only.
+	encryptedRefreshToken string
+	// authTime is when the user authenticated at the provider, zero if the
+	// token has no auth_time claim.
+	authTime time.Time
+	// loginTime is when the session was created by a login to the console.
+	// Refreshes keep it.
+	loginTime time.Time
+	// keepUntil is when the session store may drop a session that is
+	// refreshed, which outlives its ID token. Zero for other sessions.
+	keepUntil time.Time
+}
+
+// storeExpiry returns when the session store may drop the session.
+func (ls *loginState) storeExpiry() time.Time {
+	if ls.keepUntil.IsZero() {
+		return ls.exp
+	}
+	return ls.keepUntil
 }
 
 type LoginJSON struct {
@@ -26,8 +49,12 @@ type LoginJSON struct {
 	Exp    int64  `json:"exp"`
 }
 
-// newLoginState unpacks a token and generates a new loginState from it.
-func newLoginState(rawToken string, claims []byte) (*loginState, error) {
+// defaultIdentityClaim is the claim used as the stable user ID unless configured otherwise.
+const defaultIdentityClaim = "sub"
+
+// newLoginState unpacks a token and generates a new loginState from it. The
+// identity claim is used as the user ID, the name and email are only displayed.
+func newLoginState(rawToken string, claims []byte, identityClaim string) (*loginState, error) {
 	ls := &loginState{
 		now:      defaultNow,
 		rawToken: rawToken,
@@ -38,6 +65,9 @@ func newLoginState(rawToken string, claims []byte) (*loginState, error) {
 		Expiry  jsonTime `json:"exp"`
 		Email   string   `json:"email"`
 		Name    string   `json:"name"`
+		Groups  []string `json:"groups"`
+
+		AuthTime *jsonTime `json:"auth_time"`
 	}
 
 	if err := json.Unmarshal(claims, &c); err != nil {
@@ -49,9 +79,24 @@ func newLoginState(rawToken string, claims []byte) (*loginState, error) {
 	}
 
 	ls.UserID = c.Subject
+	if identityClaim != "" && identityClaim != defaultIdentityClaim {
+		var all map[string]interface{}
+		if err := json.Unmarshal(claims, &all); err != nil {
+			return nil, fmt.Errorf("error getting claims from token: %v", err)
+		}
+		id, ok := all[identityClaim].(string)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("token missing identity claim '%s'", identityClaim)
+		}
+		ls.UserID = id
+	}
 	ls.Email = c.Email
 	ls.exp = time.Time(c.Expiry)
 	ls.Name = c.Name
+	ls.Groups = c.Groups
+	if c.AuthTime != nil {
+		ls.authTime = time.Time(*c.AuthTime)
+	}
 	return ls, nil
 }
 
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -9,12 +10,14 @@ import (
 func TestNewLoginState(t *testing.T) {
 	exp := time.Now().Unix()
 	tests := []struct {
-		encoded   string
-		claims    string
-		wantErr   bool
-		wantEmail string
-		wantID    string
-		wantExp   int64
+		encoded       string
+		claims        string
+		identityClaim string
+		wantErr       bool
+		wantEmail     string
+		wantID        string
+		wantExp       int64
+		wantGroups    []string
 	}{
 		// happy case
 		{
@@ -38,10 +41,51 @@ func TestNewLoginState(t *testing.T) {
 			}`, time.Now().Unix()),
 			wantErr: true,
 		},
+		// custom identity claim
+		{
+			encoded: "rando-token-string",
+			claims: fmt.Sprintf(`{
+				"sub": "user-id",
+				"oid": "object-id",
+				"email": "penny@example.com",
+				"exp": %d
+			}`, exp),
+			identityClaim: "oid",
+			wantErr:       false,
+			wantEmail:     "penny@example.com",
+			wantID:        "object-id",
+			wantExp:       exp,
+		},
+		// groups claim
+		{
+			encoded: "rando-token-string",
+			claims: fmt.Sprintf(`{
+				"sub": "user-id",
+				"email": "penny@example.com",
+				"groups": ["developers", "admins"],
+				"exp": %d
+			}`, exp),
+			wantErr:    false,
+			wantEmail:  "penny@example.com",
+			wantID:     "user-id",
+			wantExp:    exp,
+			wantGroups: []string{"developers", "admins"},
+		},
+		// missing custom identity claim
+		{
+			encoded: "rando-token-string",
+			claims: fmt.Sprintf(`{
+				"sub": "user-id",
+				"email": "penny@example.com",
+				"exp": %d
+			}`, exp),
+			identityClaim: "oid",
+			wantErr:       true,
+		},
 	}
 
 	for i, tt := range tests {
-		ls, err := newLoginState(tt.encoded, []byte(tt.claims))
+		ls, err := newLoginState(tt.encoded, []byte(tt.claims), tt.identityClaim)
 		if err != nil {
 			if tt.wantErr {
 				continue
@@ -61,6 +105,10 @@ func TestNewLoginState(t *testing.T) {
 			t.Errorf("case %d: user id mismatch, want: %s, got: %s", i, tt.wantID, ls.UserID)
 		}
 
+		if !reflect.DeepEqual(ls.Groups, tt.wantGroups) {
+			t.Errorf("case %d: groups mismatch, want: %v, got: %v", i, tt.wantGroups, ls.Groups)
+		}
+
 		if ls.exp.Unix() != tt.wantExp {
 			t.Errorf("case %d: exp mismatch, want: %v, got: %v", i, tt.wantExp, ls.exp.Unix())
 		}
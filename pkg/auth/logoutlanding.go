@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"k8s.io/klog"
+)
+
+// LogoutLandingPageData is passed to the template of the logout landing page.
+type LogoutLandingPageData struct {
+	// LoginURL starts a new login.
+	LoginURL string
+}
+
+// LogoutLandingFunc returns a handler serving page after ending the session
+// of the request, for the console to send users to after logging out. Only
+// navigations from the console end the session, checked like mutating
+// requests by their Origin or Referer, so that links from other sites can't
+// log users out. Those are sent to loginURL instead.
+func (a *Authenticator) LogoutLandingFunc(page *template.Template, loginURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := a.VerifySourceOrigin(r); err != nil {
+			klog.V(4).Infof("not serving the logout landing page: %v", err)
+			http.Redirect(w, r, loginURL, http.StatusSeeOther)
+			return
+		}
+
+		var body bytes.Buffer
+		if err := page.Execute(&body, LogoutLandingPageData{LoginURL: loginURL}); err != nil {
+			klog.Errorf("failed to render the logout landing page: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		a.DeleteCookie(w, r)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body.Bytes())
+	}
+}
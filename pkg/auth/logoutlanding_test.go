@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestLogoutLandingFunc(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{}, o
+	}
+	ls, err := o.login(httptest.NewRecorder(), (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{
+		"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console"}),
+	}), http.SameSiteLaxMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := template.Must(template.New("logout").Parse(`<a href="{{ .LoginURL }}">Log in again</a>`))
+	handler := a.LogoutLandingFunc(page, "https://example.com/asdf/auth/login?a=1&b=2")
+	newRequest := func(referer string) *http.Request {
+		r := httptest.NewRequest("GET", "https://example.com/asdf/auth/logout/landing", nil)
+		r.AddCookie(&http.Cookie{Name: openshiftAccessTokenCookieName, Value: ls.sessionToken})
+		if referer != "" {
+			r.Header.Set("Referer", referer)
+		}
+		return r
+	}
+
+	// Navigations from other sites don't end the session.
+	for _, referer := range []string{"", "https://attacker.example.org/"} {
+		rr := httptest.NewRecorder()
+		handler(rr, newRequest(referer))
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "https://example.com/asdf/auth/login?a=1&b=2" {
+			t.Errorf("expected a redirect to the login for referer %q, got %d to %q", referer, rr.Code, rr.Header().Get("Location"))
+		}
+		if len(rr.Result().Cookies()) != 0 {
+			t.Errorf("expected no cookies to be cleared for referer %q, got %v", referer, rr.Result().Cookies())
+		}
+		if stored, _ := o.sessions.Get(context.Background(), ls.sessionToken); stored == nil {
+			t.Fatalf("expected the session to be kept for referer %q", referer)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, newRequest(validReferer+"dashboards"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the landing page, got %d", rr.Code)
+	}
+	if want := `<a href="https://example.com/asdf/auth/login?a=1&amp;b=2">Log in again</a>`; rr.Body.String() != want {
+		t.Errorf("expected the page %q, got %q", want, rr.Body.String())
+	}
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected the page not to be cached, got Cache-Control %q", rr.Header().Get("Cache-Control"))
+	}
+	cleared := false
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == openshiftAccessTokenCookieName && c.Value == "" {
+			cleared = true
+		}
+	}
+	if !cleared {
+		t.Errorf("expected the session cookie to be cleared with the page, got %v", rr.Result().Cookies())
+	}
+	if stored, _ := o.sessions.Get(context.Background(), ls.sessionToken); stored != nil {
+		t.Error("expected the session to be deleted before the page is served")
+	}
+}
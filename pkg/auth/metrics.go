@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"net"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -37,6 +39,14 @@ const (
 
 type LogoutReason string
 
+type TokenRefreshFailureReason string
+
+const (
+	InvalidGrantTokenRefreshFailureReason TokenRefreshFailureReason = "invalid_grant"
+	NetworkTokenRefreshFailureReason      TokenRefreshFailureReason = "network"
+	OtherTokenRefreshFailureReason        TokenRefreshFailureReason = "other"
+)
+
 const (
 	UnknownLogoutReason LogoutReason = "unknown"
 )
@@ -46,6 +56,17 @@ type Metrics struct {
 	loginSuccessful *prometheus.CounterVec
 	loginFailures   *prometheus.CounterVec
 	logoutRequests  *prometheus.CounterVec
+
+	issuerCertificateExpiry prometheus.Gauge
+	sessionCookieSize       prometheus.Histogram
+	clientCredentialChecks  *prometheus.CounterVec
+	inactivityTimeout       prometheus.Gauge
+	activeSessions          prometheus.Gauge
+	providerUnhealthy       prometheus.Gauge
+	sessionStoreFailOpen    *prometheus.CounterVec
+	tokenRefreshSuccesses   prometheus.Counter
+	tokenRefreshFailures    *prometheus.CounterVec
+	tokenRefreshDuration    prometheus.Histogram
 }
 
 func (m *Metrics) GetCollectors() []prometheus.Collector {
@@ -54,6 +75,16 @@ func (m *Metrics) GetCollectors() []prometheus.Collector {
 		m.loginSuccessful,
 		m.loginFailures,
 		m.logoutRequests,
+		m.issuerCertificateExpiry,
+		m.sessionCookieSize,
+		m.clientCredentialChecks,
+		m.inactivityTimeout,
+		m.activeSessions,
+		m.providerUnhealthy,
+		m.sessionStoreFailOpen,
+		m.tokenRefreshSuccesses,
+		m.tokenRefreshFailures,
+		m.tokenRefreshDuration,
 	}
 }
 
@@ -119,6 +150,93 @@ func (m *Metrics) LogoutRequested(reason LogoutReason) {
 	}
 }
 
+func (m *Metrics) IssuerCertificateExpires(notAfter time.Time) {
+	klog.V(4).Infof("auth.Metrics IssuerCertificateExpires at %v\n", notAfter)
+	m.issuerCertificateExpiry.Set(float64(notAfter.Unix()))
+}
+
+func (m *Metrics) SessionCookieWritten(size int) {
+	klog.V(4).Infof("auth.Metrics SessionCookieWritten with %d bytes\n", size)
+	m.sessionCookieSize.Observe(float64(size))
+}
+
+func (m *Metrics) ClientCredentialsChecked(err error) {
+	result := "accepted"
+	if errors.Is(err, errClientCredentialsRejected) {
+		result = "rejected"
+	} else if err != nil {
+		result = "error"
+	}
+
+	klog.V(4).Infof("auth.Metrics ClientCredentialsChecked with result %q\n", result)
+	counter, err := m.clientCredentialChecks.GetMetricWithLabelValues(result)
+	if counter != nil && err == nil {
+		counter.Inc()
+	}
+}
+
+func (m *Metrics) InactivityTimeoutConfigured(seconds int) {
+	klog.V(4).Infof("auth.Metrics InactivityTimeoutConfigured with %d seconds\n", seconds)
+	m.inactivityTimeout.Set(float64(seconds))
+}
+
+func (m *Metrics) ActiveSessionsChanged(count int) {
+	klog.V(4).Infof("auth.Metrics ActiveSessionsChanged to %d\n", count)
+	m.activeSessions.Set(float64(count))
+}
+
+func (m *Metrics) ProviderUnhealthy(unhealthy bool) {
+	klog.V(4).Infof("auth.Metrics ProviderUnhealthy %v\n", unhealthy)
+	if unhealthy {
+		m.providerUnhealthy.Set(1)
+	} else {
+		m.providerUnhealthy.Set(0)
+	}
+}
+
+func (m *Metrics) SessionStoreFailedOpen(accepted bool) {
+	result := "rejected"
+	if accepted {
+		result = "accepted"
+	}
+
+	klog.V(4).Infof("auth.Metrics SessionStoreFailedOpen with result %q\n", result)
+	counter, err := m.sessionStoreFailOpen.GetMetricWithLabelValues(result)
+	if counter != nil && err == nil {
+		counter.Inc()
+	}
+}
+
+// TokenRefreshed records the outcome of exchanging the refresh token of a
+// session at the provider, which took duration.
+func (m *Metrics) TokenRefreshed(duration time.Duration, err error) {
+	m.tokenRefreshDuration.Observe(duration.Seconds())
+	if err == nil {
+		klog.V(4).Info("auth.Metrics TokenRefreshed\n")
+		m.tokenRefreshSuccesses.Inc()
+		return
+	}
+
+	reason := tokenRefreshFailureReason(err)
+	klog.V(4).Infof("auth.Metrics TokenRefreshed failed with reason %q\n", reason)
+	counter, err := m.tokenRefreshFailures.GetMetricWithLabelValues(string(reason))
+	if counter != nil && err == nil {
+		counter.Inc()
+	}
+}
+
+func tokenRefreshFailureReason(err error) TokenRefreshFailureReason {
+	var netErr net.Error
+	switch {
+	case isInvalidGrant(err):
+		return InvalidGrantTokenRefreshFailureReason
+	case errors.As(err, &netErr), errors.Is(err, context.DeadlineExceeded):
+		return NetworkTokenRefreshFailureReason
+	default:
+		return OtherTokenRefreshFailureReason
+	}
+}
+
 func (m *Metrics) canGetNamespaces(ctx context.Context, config *rest.Config) (bool, error) {
 	client, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -197,5 +315,79 @@ func NewMetrics() *Metrics {
 	}, []string{"reason"})
 	m.logoutRequests.GetMetricWithLabelValues(string(UnknownLogoutReason))
 
+	m.issuerCertificateExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "issuer_certificate_expiry_timestamp_seconds",
+		Help:      "Expiry of the earliest expiring certificate presented by the identity provider during discovery, in seconds since epoch.",
+	})
+
+	m.sessionCookieSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "session_cookie_size_bytes",
+		Help:      "Size of the session cookie written on login. Browsers commonly reject cookies larger than 4096 bytes.",
+		Buckets:   []float64{512, 1024, 2048, 3072, 3584, 4096, 8192},
+	})
+
+	m.clientCredentialChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "client_credential_checks_total",
+		Help:      "Total number of checks whether the auth provider accepts the client ID and secret, by result.",
+	}, []string{"result"})
+
+	m.inactivityTimeout = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "inactivity_timeout_seconds",
+		Help:      "Effective inactivity timeout after which users are logged out, 0 if the timeout is disabled.",
+	})
+
+	m.activeSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "console",
+		Name:      "active_sessions",
+		Help:      "Number of unexpired sessions created by this console instance. Only maintained if active session tracking is enabled.",
+	})
+
+	m.providerUnhealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "provider_unhealthy",
+		Help:      "1 if contacting the auth provider has been failing for longer than the unhealthy threshold, 0 otherwise. Only maintained if the threshold is set.",
+	})
+
+	m.sessionStoreFailOpen = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "session_store_fail_open_total",
+		Help:      "Total number of requests authenticated without the failing session store by the session fallback cookie, by result. Only maintained with the fail-open-readonly session store failure policy.",
+	}, []string{"result"})
+
+	m.tokenRefreshSuccesses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "token_refresh_successes_total",
+		Help:      "Total number of sessions refreshed with their refresh token.",
+	})
+
+	m.tokenRefreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "token_refresh_failures_total",
+		Help:      "Total number of failed refreshes of sessions with their refresh token, by reason: invalid_grant if the provider rejected the refresh token, network if it couldn't be reached, other otherwise.",
+	}, []string{"reason"})
+	for _, reason := range []TokenRefreshFailureReason{InvalidGrantTokenRefreshFailureReason, NetworkTokenRefreshFailureReason, OtherTokenRefreshFailureReason} {
+		m.tokenRefreshFailures.GetMetricWithLabelValues(string(reason))
+	}
+
+	m.tokenRefreshDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "console",
+		Subsystem: "auth",
+		Name:      "token_refresh_duration_seconds",
+		Help:      "Time taken by the provider to exchange the refresh token of a session, successful or not.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	})
+
 	return m
 }
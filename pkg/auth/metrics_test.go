@@ -1,14 +1,19 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/openshift/console/pkg/metrics"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
 	"k8s.io/client-go/rest"
 )
 
@@ -17,12 +22,41 @@ func TestDefaultMetrics(t *testing.T) {
 
 	assert.Equal(t,
 		metrics.RemoveComments(`
+		console_active_sessions 0
+		console_auth_inactivity_timeout_seconds 0
+		console_auth_issuer_certificate_expiry_timestamp_seconds 0
 		console_auth_login_failures_total{reason="unknown"} 0
 		console_auth_login_requests_total 0
 		console_auth_login_successes_total{role="cluster-admin"} 0
 		console_auth_login_successes_total{role="developer"} 0
 		console_auth_login_successes_total{role="kubeadmin"} 0
 		console_auth_logout_requests_total{reason="unknown"} 0
+		console_auth_provider_unhealthy 0
+		console_auth_session_cookie_size_bytes_bucket{le="512"} 0
+		console_auth_session_cookie_size_bytes_bucket{le="1024"} 0
+		console_auth_session_cookie_size_bytes_bucket{le="2048"} 0
+		console_auth_session_cookie_size_bytes_bucket{le="3072"} 0
+		console_auth_session_cookie_size_bytes_bucket{le="3584"} 0
+		console_auth_session_cookie_size_bytes_bucket{le="4096"} 0
+		console_auth_session_cookie_size_bytes_bucket{le="8192"} 0
+		console_auth_session_cookie_size_bytes_bucket{le="+Inf"} 0
+		console_auth_session_cookie_size_bytes_sum 0
+		console_auth_session_cookie_size_bytes_count 0
+		console_auth_token_refresh_duration_seconds_bucket{le="0.05"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="0.1"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="0.25"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="0.5"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="1"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="2.5"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="5"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="10"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="+Inf"} 0
+		console_auth_token_refresh_duration_seconds_sum 0
+		console_auth_token_refresh_duration_seconds_count 0
+		console_auth_token_refresh_failures_total{reason="invalid_grant"} 0
+		console_auth_token_refresh_failures_total{reason="network"} 0
+		console_auth_token_refresh_failures_total{reason="other"} 0
+		console_auth_token_refresh_successes_total 0
 		`),
 		metrics.RemoveComments(metrics.FormatMetrics(m.GetCollectors()...)),
 	)
@@ -40,6 +74,70 @@ func TestLoginRequested(t *testing.T) {
 	)
 }
 
+func TestTokenRefreshed(t *testing.T) {
+	m := NewMetrics()
+	m.TokenRefreshed(200*time.Millisecond, nil)
+	m.TokenRefreshed(300*time.Millisecond, &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}, ErrorCode: "invalid_grant"})
+	m.TokenRefreshed(time.Second, fmt.Errorf("wrapped: %w", &url.Error{Op: "Post", URL: "https://idp.example.com/token", Err: errors.New("connection refused")}))
+	m.TokenRefreshed(3*time.Second, context.DeadlineExceeded)
+	m.TokenRefreshed(100*time.Millisecond, &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusInternalServerError}})
+
+	assert.Equal(t,
+		metrics.RemoveComments(`
+		console_auth_token_refresh_duration_seconds_bucket{le="0.05"} 0
+		console_auth_token_refresh_duration_seconds_bucket{le="0.1"} 1
+		console_auth_token_refresh_duration_seconds_bucket{le="0.25"} 2
+		console_auth_token_refresh_duration_seconds_bucket{le="0.5"} 3
+		console_auth_token_refresh_duration_seconds_bucket{le="1"} 4
+		console_auth_token_refresh_duration_seconds_bucket{le="2.5"} 4
+		console_auth_token_refresh_duration_seconds_bucket{le="5"} 5
+		console_auth_token_refresh_duration_seconds_bucket{le="10"} 5
+		console_auth_token_refresh_duration_seconds_bucket{le="+Inf"} 5
+		console_auth_token_refresh_duration_seconds_sum 4.6
+		console_auth_token_refresh_duration_seconds_count 5
+		console_auth_token_refresh_failures_total{reason="invalid_grant"} 1
+		console_auth_token_refresh_failures_total{reason="network"} 2
+		console_auth_token_refresh_failures_total{reason="other"} 1
+		console_auth_token_refresh_successes_total 1
+		`),
+		metrics.RemoveComments(metrics.FormatMetrics(m.tokenRefreshSuccesses, m.tokenRefreshFailures, m.tokenRefreshDuration)),
+	)
+}
+
+func TestInactivityTimeoutConfigured(t *testing.T) {
+	m := NewMetrics()
+	m.InactivityTimeoutConfigured(900)
+
+	assert.Equal(t,
+		metrics.RemoveComments(`
+		console_auth_inactivity_timeout_seconds 900
+		`),
+		metrics.RemoveComments(metrics.FormatMetrics(m.inactivityTimeout)),
+	)
+}
+
+func TestSessionCookieWritten(t *testing.T) {
+	m := NewMetrics()
+	m.SessionCookieWritten(800)
+	m.SessionCookieWritten(5000)
+
+	assert.Equal(t,
+		metrics.RemoveComments(`
+		console_auth_session_cookie_size_bytes_bucket{le="512"} 0
+		console_auth_session_cookie_size_bytes_bucket{le="1024"} 1
+		console_auth_session_cookie_size_bytes_bucket{le="2048"} 1
+		console_auth_session_cookie_size_bytes_bucket{le="3072"} 1
+		console_auth_session_cookie_size_bytes_bucket{le="3584"} 1
+		console_auth_session_cookie_size_bytes_bucket{le="4096"} 1
+		console_auth_session_cookie_size_bytes_bucket{le="8192"} 2
+		console_auth_session_cookie_size_bytes_bucket{le="+Inf"} 2
+		console_auth_session_cookie_size_bytes_sum 5800
+		console_auth_session_cookie_size_bytes_count 2
+		`),
+		metrics.RemoveComments(metrics.FormatMetrics(m.sessionCookieSize)),
+	)
+}
+
 func TestLoginSuccessful(t *testing.T) {
 	testcases := []struct {
 		name            string
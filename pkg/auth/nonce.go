@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// NoncePolicyRequired sends a nonce with OIDC logins and rejects ID
+	// tokens without it.
+	NoncePolicyRequired = "required"
+	// NoncePolicyOptional sends a nonce with OIDC logins and only checks it if
+	// the ID token has one, for providers that leave it out.
+	NoncePolicyOptional = "optional"
+	// NoncePolicyDisabled neither sends nor checks a nonce.
+	NoncePolicyDisabled = "disabled"
+
+	// nonceCookieSuffix is appended to the name of the state cookie of a login
+	// for the cookie holding its nonce.
+	nonceCookieSuffix = "-nonce"
+)
+
+// errInvalidNonce is returned when the nonce of an ID token doesn't match the
+// login it was issued for.
+var errInvalidNonce = errors.New("invalid nonce")
+
+// checksNonce returns true if a nonce is sent with logins.
+func (a *Authenticator) checksNonce() bool {
+	return a.noncePolicy == NoncePolicyRequired || a.noncePolicy == NoncePolicyOptional
+}
+
+// newNonce returns a nonce and the cookie remembering it next to the state
+// cookie of a login.
+func newNonce(stateCookie *http.Cookie) (string, *http.Cookie) {
+	var randData [16]byte
+	if _, err := io.ReadFull(rand.Reader, randData[:]); err != nil {
+		panic(err)
+	}
+	nonce := hex.EncodeToString(randData[:])
+
+	cookie := *stateCookie
+	cookie.Name += nonceCookieSuffix
+	cookie.Value = nonce
+	return nonce, &cookie
+}
+
+// checkNonce compares the nonce of the ID token of token with the nonce cookie
+// of the login. The signature of the ID token is verified by the login method
+// afterwards, token comes from the token endpoint.
+func (a *Authenticator) checkNonce(r *http.Request, stateCookieName string, token *oauth2.Token) error {
+	if !a.checksNonce() {
+		return nil
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return fmt.Errorf("%w: token response did not have an id_token field", errInvalidNonce)
+	}
+	claims, err := unverifiedIDTokenClaims(rawIDToken)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidNonce, err)
+	}
+	if claims.Nonce == "" {
+		if a.noncePolicy == NoncePolicyOptional {
+			return nil
+		}
+		return fmt.Errorf("%w: ID token has no nonce", errInvalidNonce)
+	}
+
+	cookie, err := r.Cookie(stateCookieName + nonceCookieSuffix)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse nonce cookie: %v", errInvalidNonce, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(cookie.Value)) != 1 {
+		return fmt.Errorf("%w: ID token nonce does not match the login", errInvalidNonce)
+	}
+	return nil
+}
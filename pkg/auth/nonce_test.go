@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestNonce(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{
+			ClientID:    "console",
+			RedirectURL: "http://example.com/auth/callback",
+			Endpoint:    oauth2.Endpoint{AuthURL: "https://auth.example.com/auth"},
+		}, newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	}
+
+	rr := httptest.NewRecorder()
+	a.LoginFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/login", nil))
+	location, err := rr.Result().Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce := location.Query().Get("nonce"); nonce != "" {
+		t.Errorf("expected no nonce without a nonce policy, got: %q", nonce)
+	}
+
+	a.noncePolicy = NoncePolicyRequired
+	rr = httptest.NewRecorder()
+	a.LoginFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/login", nil))
+	location, err = rr.Result().Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := location.Query().Get("nonce")
+	if nonce == "" {
+		t.Fatal("expected a nonce in the authorization request")
+	}
+	var nonceCookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == stateCookieName+nonceCookieSuffix {
+			nonceCookie = c
+		}
+	}
+	if nonceCookie == nil || nonceCookie.Value != nonce || !nonceCookie.HttpOnly {
+		t.Fatalf("expected an HttpOnly %s%s cookie with the nonce %q, got: %v", stateCookieName, nonceCookieSuffix, nonce, nonceCookie)
+	}
+
+	tokenWithNonce := func(nonce string) *oauth2.Token {
+		claims := map[string]interface{}{"aud": "console"}
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		return (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, claims)})
+	}
+	tests := []struct {
+		policy  string
+		nonce   string
+		wantErr bool
+	}{
+		{policy: NoncePolicyRequired, nonce: nonce, wantErr: false},
+		{policy: NoncePolicyRequired, nonce: "other", wantErr: true},
+		{policy: NoncePolicyRequired, nonce: "", wantErr: true},
+		{policy: NoncePolicyOptional, nonce: nonce, wantErr: false},
+		{policy: NoncePolicyOptional, nonce: "other", wantErr: true},
+		{policy: NoncePolicyOptional, nonce: "", wantErr: false},
+		{policy: NoncePolicyDisabled, nonce: nonce, wantErr: false},
+		{policy: NoncePolicyDisabled, nonce: "other", wantErr: false},
+		{policy: NoncePolicyDisabled, nonce: "", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.nonce, func(t *testing.T) {
+			a.noncePolicy = tt.policy
+			r := httptest.NewRequest("GET", "http://example.com/auth/callback", nil)
+			r.AddCookie(nonceCookie)
+			err := a.checkNonce(r, stateCookieName, tokenWithNonce(tt.nonce))
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, errInvalidNonce) {
+				t.Errorf("expected %v, got: %v", errInvalidNonce, err)
+			}
+		})
+	}
+
+	a.noncePolicy = NoncePolicyRequired
+	if err := a.checkNonce(httptest.NewRequest("GET", "http://example.com/auth/callback", nil), stateCookieName, tokenWithNonce(nonce)); err == nil {
+		t.Error("expected an error without the nonce cookie")
+	}
+}
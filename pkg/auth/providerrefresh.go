@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// providerRefreshInterval is the minimum time between refreshes started by
+// RefreshProvider, so that it can't be used to flood the provider.
+const providerRefreshInterval = time.Minute
+
+// ErrProviderRefreshUnsupported is returned by RefreshProvider for auth sources
+// whose discovery document and signing keys aren't fetched by the console.
+var ErrProviderRefreshUnsupported = errors.New("the discovery document and signing keys of this auth source are not fetched by the console")
+
+// ProviderRefreshRateLimitedError is returned by RefreshProvider when the
+// provider was refreshed less than providerRefreshInterval ago.
+type ProviderRefreshRateLimitedError struct {
+	// RetryAfter is how long until the provider can be refreshed again.
+	RetryAfter time.Duration
+}
+
+func (e *ProviderRefreshRateLimitedError) Error() string {
+	return fmt.Sprintf("the auth provider was refreshed recently, retry in %s", e.RetryAfter)
+}
+
+// ProviderRefresh is the outcome of a successful RefreshProvider.
+type ProviderRefresh struct {
+	Issuer  string `json:"issuer"`
+	JWKSURL string `json:"jwksURL"`
+	// Keys is the number of signing keys fetched from JWKSURL.
+	Keys int `json:"keys"`
+}
+
+// providerRefresher is implemented by login methods that discover the
+// provider.
+type providerRefresher interface {
+	refreshProvider(ctx context.Context) (*ProviderRefresh, error)
+}
+
+// providerRefreshLimiter allows one refresh per providerRefreshInterval,
+// successful or not. The zero value is ready to use.
+type providerRefreshLimiter struct {
+	mux  sync.Mutex
+	last time.Time
+	now  nowFunc
+}
+
+// reserve takes the slot of the next refresh, or returns how long until it is
+// free. The lock is only held to take the slot, not while refreshing, so that
+// a slow provider doesn't block other callers, which are rate limited anyway.
+func (l *providerRefreshLimiter) reserve() time.Duration {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := defaultNow
+	if l.now != nil {
+		now = l.now
+	}
+	if wait := l.last.Add(providerRefreshInterval).Sub(now()); !l.last.IsZero() && wait > 0 {
+		return wait
+	}
+	l.last = now()
+	return 0
+}
+
+// RefreshProvider fetches the discovery document and the signing keys of the
+// provider immediately, e.g. after the provider rotated its keys, instead of
+// waiting for an ID token signed with an unknown key.
+func (a *Authenticator) RefreshProvider(ctx context.Context) (*ProviderRefresh, error) {
+	if err := a.Healthy(); err != nil {
+		return nil, err
+	}
+	refresher, ok := a.getLoginMethod().(providerRefresher)
+	if !ok {
+		return nil, ErrProviderRefreshUnsupported
+	}
+
+	if wait := a.providerRefreshes.reserve(); wait > 0 {
+		return nil, &ProviderRefreshRateLimitedError{RetryAfter: wait}
+	}
+
+	refresh, err := refresher.refreshProvider(ctx)
+	a.providerFailures.record(err)
+	if err != nil {
+		klog.Errorf("failed to refresh the auth provider: %v", err)
+		return nil, err
+	}
+	klog.Infof("refreshed the auth provider %s, fetched %d signing keys", refresh.Issuer, refresh.Keys)
+	return refresh, nil
+}
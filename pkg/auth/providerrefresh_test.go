@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// blockingRefresher refreshes the provider once release is closed.
+type blockingRefresher struct {
+	*oidcAuth
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingRefresher) refreshProvider(ctx context.Context) (*ProviderRefresh, error) {
+	close(b.started)
+	<-b.release
+	return &ProviderRefresh{Issuer: testIssuer, Keys: 1}, nil
+}
+
+func TestRefreshProviderRateLimitDuringRefresh(t *testing.T) {
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresher := &blockingRefresher{
+		oidcAuth: newTestOIDCAuth(&oidcConfig{clientID: "console"}),
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{}, refresher
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := a.RefreshProvider(context.Background())
+		done <- err
+	}()
+	<-refresher.started
+
+	// The refresh in progress holds the slot, not the lock.
+	var limited *ProviderRefreshRateLimitedError
+	if _, err := a.RefreshProvider(context.Background()); !errors.As(err, &limited) {
+		t.Errorf("expected a refresh during another one to be rate limited without waiting for it, got: %v", err)
+	}
+
+	close(refresher.release)
+	if err := <-done; err != nil {
+		t.Errorf("expected the first refresh to succeed, got: %v", err)
+	}
+}
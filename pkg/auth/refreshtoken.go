@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"k8s.io/klog"
+)
+
+// minRefreshTokenKeyLength is the minimum length of a configured refresh token key.
+const minRefreshTokenKeyLength = 32
+
+const (
+	// OnMissingRefreshTokenWarn logs a warning for logins without a refresh
+	// token, their sessions end when the ID token expires.
+	OnMissingRefreshTokenWarn = "warn"
+	// OnMissingRefreshTokenForceConsent starts the login again with
+	// prompt=consent, for providers that only return a refresh token when
+	// the user consents.
+	OnMissingRefreshTokenForceConsent = "force-consent"
+	// OnMissingRefreshTokenError rejects logins without a refresh token.
+	OnMissingRefreshTokenError = "error"
+
+	// consentStateSuffix marks the login state of a login started with
+	// prompt=consent to obtain a refresh token.
+	consentStateSuffix = ".consent"
+)
+
+// refreshTokenCipher encrypts the refresh tokens kept in sessions with
+// AES-256-GCM, so that they aren't stored in plain text, e.g. in Redis.
+type refreshTokenCipher struct {
+	aead cipher.AEAD
+}
+
+// newRefreshTokenCipher derives the encryption key from key. Without a key,
+// a random one is generated, which only works for sessions kept in memory.
+func newRefreshTokenCipher(key []byte) (*refreshTokenCipher, error) {
+	if len(key) == 0 {
+		key = make([]byte, minRefreshTokenKeyLength)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	if len(key) < minRefreshTokenKeyLength {
+		return nil, fmt.Errorf("refresh token key must be at least %d bytes, got %d", minRefreshTokenKeyLength, len(key))
+	}
+
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &refreshTokenCipher{aead: aead}, nil
+}
+
+// encrypt returns the encrypted refresh token, prefixed with its nonce.
+func (c *refreshTokenCipher) encrypt(refreshToken string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(refreshToken), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns the refresh token of an encrypted one. The error doesn't
+// contain the token.
+func (c *refreshTokenCipher) decrypt(encrypted string) (string, error) {
+	sealed, err := base64.RawStdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", errors.New("malformed encrypted refresh token")
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("malformed encrypted refresh token")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt the refresh token, the key might have changed")
+	}
+	return string(plain), nil
+}
+
+// checkRefreshToken applies the OnMissingRefreshToken policy to a login
+// callback with token when refresh tokens are stored. It returns false if it
+// answered the callback instead of letting the login continue.
+func (a *Authenticator) checkRefreshToken(w http.ResponseWriter, r *http.Request, token *oauth2.Token, state string, embedded bool) bool {
+	if a.refreshTokens == nil || token.RefreshToken != "" {
+		return true
+	}
+
+	switch a.noRefreshToken {
+	case OnMissingRefreshTokenError:
+		klog.Errorf("rejecting login: the identity provider returned no refresh token")
+		a.redirectAuthError(w, r, errorMissingRefreshToken, "Your identity provider did not return a refresh token, which the console requires.")
+		return false
+	case OnMissingRefreshTokenForceConsent:
+		if isSilentLogin(r.Context()) {
+			// A hidden iframe can't ask for consent.
+			klog.Infof("silent login returned no refresh token, an interactive login is required to obtain one")
+			sendSilentLoginError(w, "consent_required", "The identity provider did not return a refresh token.")
+			return false
+		}
+		if !strings.HasSuffix(state, consentStateSuffix) {
+			klog.Infof("the identity provider returned no refresh token, logging in again with prompt=consent to obtain one")
+			a.startLogin(w, r, promptConsent, embedded)
+			return false
+		}
+		klog.Warningf("the identity provider returned no refresh token even with prompt=consent, the session ends when its ID token expires")
+	default:
+		klog.Warningf("the identity provider returned no refresh token, the session ends when its ID token expires, see --on-missing-refresh-token")
+	}
+	return true
+}
@@ -0,0 +1,436 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRefreshTokenCipher(t *testing.T) {
+	key := []byte(strings.Repeat("k", minRefreshTokenKeyLength))
+	c, err := newRefreshTokenCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const refreshToken = "refresh-token-value"
+	encrypted, err := c.encrypt(refreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted, refreshToken) {
+		t.Errorf("expected the encrypted refresh token not to contain the token, got %q", encrypted)
+	}
+	if again, _ := c.encrypt(refreshToken); again == encrypted {
+		t.Errorf("expected a new nonce for every encryption")
+	}
+
+	if got, err := c.decrypt(encrypted); err != nil || got != refreshToken {
+		t.Errorf("expected %q, got %q, error: %v", refreshToken, got, err)
+	}
+
+	other, err := newRefreshTokenCipher([]byte(strings.Repeat("o", minRefreshTokenKeyLength)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.decrypt(encrypted); err == nil {
+		t.Errorf("expected decryption with another key to fail")
+	} else if strings.Contains(err.Error(), refreshToken) {
+		t.Errorf("expected the error not to contain the token, got: %v", err)
+	}
+
+	if _, err := newRefreshTokenCipher([]byte("short")); err == nil {
+		t.Errorf("expected a short key to be rejected")
+	}
+}
+
+func TestOIDCStoresEncryptedRefreshToken(t *testing.T) {
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.followTokenExpiry = true
+	c, err := newRefreshTokenCipher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.refreshTokens = c
+
+	token := (&oauth2.Token{RefreshToken: "refresh-token-value"}).WithExtra(map[string]interface{}{
+		"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(time.Hour).Unix()}),
+	})
+	ls, err := o.login(httptest.NewRecorder(), token, http.SameSiteLaxMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := o.sessions.Get(context.Background(), ls.sessionToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.encryptedRefreshToken == "" || strings.Contains(stored.encryptedRefreshToken, "refresh-token-value") {
+		t.Errorf("expected the stored refresh token to be encrypted, got %q", stored.encryptedRefreshToken)
+	}
+	if got, err := c.decrypt(stored.encryptedRefreshToken); err != nil || got != "refresh-token-value" {
+		t.Errorf("expected the stored refresh token to decrypt to the token, got %q, error: %v", got, err)
+	}
+}
+
+func TestOIDCRefreshSessionSingleFlight(t *testing.T) {
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.followTokenExpiry = true
+	o.refreshLeadTime = 10 * time.Minute
+	c, err := newRefreshTokenCipher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.refreshTokens = c
+
+	var refreshes int32
+	release := make(chan struct{})
+	refreshedIDToken := newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(2 * time.Hour).Unix()})
+	o.refresh = func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+		atomic.AddInt32(&refreshes, 1)
+		<-release
+		return (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": refreshedIDToken}), nil
+	}
+
+	tokenExpiringIn := func(d time.Duration) *oauth2.Token {
+		return (&oauth2.Token{RefreshToken: "refresh-token-value"}).WithExtra(map[string]interface{}{
+			"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(d).Unix()}),
+		})
+	}
+	if _, err := o.login(httptest.NewRecorder(), tokenExpiringIn(5*time.Minute), http.SameSiteLaxMode); err == nil {
+		t.Error("expected a login to fail with an ID token expiring within the refresh lead time")
+	}
+	ls, err := o.login(httptest.NewRecorder(), tokenExpiringIn(time.Hour), http.SameSiteLaxMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "http://example.com/api", nil)
+	r.AddCookie(&http.Cookie{Name: openshiftAccessTokenCookieName, Value: ls.sessionToken})
+	if got, err := o.getLoginState(r); err != nil || got.rawToken != ls.rawToken {
+		t.Fatalf("expected the session not to be refreshed before the lead time, got %v, error: %v", got, err)
+	}
+
+	// Move the session into the refresh lead time.
+	ls.exp = time.Now().Add(5 * time.Minute)
+	o.sessions.Delete(context.Background(), ls.sessionToken)
+	if err := o.sessions.Set(context.Background(), ls.sessionToken, ls); err != nil {
+		t.Fatal(err)
+	}
+
+	const concurrency = 10
+	var wg sync.WaitGroup
+	results := make([]*loginState, concurrency)
+	errs := make([]error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = o.getLoginState(r)
+		}(i)
+	}
+	for atomic.LoadInt32(&refreshes) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&refreshes); n != 1 {
+		t.Errorf("expected a single refresh for concurrent requests, got %d", n)
+	}
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatalf("request %d: %v", i, errs[i])
+		}
+		if results[i].rawToken != refreshedIDToken || results[i].sessionToken != ls.sessionToken {
+			t.Errorf("request %d: expected the refreshed session", i)
+		}
+	}
+	if len(o.refreshing) != 0 {
+		t.Errorf("expected no refreshes in flight, got %d", len(o.refreshing))
+	}
+}
+
+func TestOIDCRefreshSessionFailures(t *testing.T) {
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.followTokenExpiry = true
+	o.refreshLeadTime = 10 * time.Minute
+	c, err := newRefreshTokenCipher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.refreshTokens = c
+
+	var refreshErr error
+	release := make(chan struct{})
+	refreshedIDToken := newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(2 * time.Hour).Unix()})
+	o.refresh = func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+		<-release
+		if refreshErr != nil {
+			return nil, refreshErr
+		}
+		return (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": refreshedIDToken}), nil
+	}
+
+	// newSession returns a request of a session within the refresh lead time.
+	newSession := func() (*loginState, *http.Request) {
+		ls, err := o.login(httptest.NewRecorder(), (&oauth2.Token{RefreshToken: "refresh-token-value"}).WithExtra(map[string]interface{}{
+			"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(time.Hour).Unix()}),
+		}), http.SameSiteLaxMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ls.exp = time.Now().Add(5 * time.Minute)
+		if err := o.sessions.Replace(context.Background(), ls.sessionToken, ls); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "http://example.com/api", nil)
+		r.AddCookie(&http.Cookie{Name: openshiftAccessTokenCookieName, Value: ls.sessionToken})
+		return ls, r
+	}
+
+	t.Run("first caller goes away", func(t *testing.T) {
+		ls, r := newSession()
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error)
+		go func() {
+			_, err := o.getLoginState(r.WithContext(ctx))
+			first <- err
+		}()
+		for {
+			o.refreshMux.Lock()
+			n := len(o.refreshing)
+			o.refreshMux.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		if err := <-first; err != context.Canceled {
+			t.Errorf("expected the canceled request to fail with %v, got: %v", context.Canceled, err)
+		}
+
+		second := make(chan *loginState)
+		go func() {
+			got, err := o.getLoginState(r)
+			if err != nil {
+				t.Errorf("expected the refresh to succeed for the other request, got: %v", err)
+			}
+			second <- got
+		}()
+		release <- struct{}{}
+		if got := <-second; got == nil || got.rawToken != refreshedIDToken {
+			t.Errorf("expected the refreshed session, got %v", got)
+		}
+		if stored, _ := o.sessions.Get(context.Background(), ls.sessionToken); stored == nil || stored.rawToken != refreshedIDToken {
+			t.Errorf("expected the refreshed session to be stored, got %v", stored)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStored bool
+	}{
+		{name: "network error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, wantStored: true},
+		{name: "server error", err: &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}}, wantStored: true},
+		{name: "context deadline", err: context.DeadlineExceeded, wantStored: true},
+		{name: "invalid grant", err: &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}, ErrorCode: "invalid_grant"}, wantStored: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refreshErr = tt.err
+			defer func() { refreshErr = nil }()
+			ls, r := newSession()
+			go func() { release <- struct{}{} }()
+			if _, err := o.getLoginState(r); err == nil {
+				t.Fatal("expected the refresh to fail")
+			}
+			if stored, _ := o.sessions.Get(context.Background(), ls.sessionToken); (stored != nil) != tt.wantStored {
+				t.Errorf("expected the session to be kept: %v, got %v", tt.wantStored, stored)
+			}
+		})
+	}
+}
+
+func TestOnMissingRefreshToken(t *testing.T) {
+	refreshToken := ""
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": refreshToken,
+			"id_token":      newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(time.Hour).Unix()}),
+		})
+	}))
+	defer tokenServer.Close()
+
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newRefreshTokenCipher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.refreshTokens = c
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	o.followTokenExpiry = true
+	o.refreshTokens = c
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{
+			ClientID:    "console",
+			RedirectURL: "http://example.com/auth/callback",
+			Endpoint:    oauth2.Endpoint{AuthURL: "https://auth.example.com/auth", TokenURL: tokenServer.URL},
+		}, o
+	}
+
+	loggedIn := false
+	callback := a.CallbackFunc(func(LoginJSON, string, http.ResponseWriter) {
+		loggedIn = true
+	})
+	login := func(cookieName, state string) *httptest.ResponseRecorder {
+		loggedIn = false
+		r := httptest.NewRequest("GET", "http://example.com/auth/callback?code=abc&state="+state, nil)
+		r.AddCookie(&http.Cookie{Name: cookieName, Value: state})
+		rr := httptest.NewRecorder()
+		callback(rr, r)
+		return rr
+	}
+
+	for _, policy := range []string{"", OnMissingRefreshTokenWarn, OnMissingRefreshTokenForceConsent, OnMissingRefreshTokenError} {
+		a.noRefreshToken = policy
+		refreshToken = "refresh-token-value"
+		if login(stateCookieName, "abc"); !loggedIn {
+			t.Errorf("expected a login with a refresh token to succeed with policy %q", policy)
+		}
+	}
+	refreshToken = ""
+
+	t.Run("warn", func(t *testing.T) {
+		a.noRefreshToken = OnMissingRefreshTokenWarn
+		if login(stateCookieName, "abc"); !loggedIn {
+			t.Error("expected the login to continue without a refresh token")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		a.noRefreshToken = OnMissingRefreshTokenError
+		rr := login(stateCookieName, "abc")
+		if loggedIn || !strings.Contains(rr.Header().Get("Location"), "error="+errorMissingRefreshToken) {
+			t.Errorf("expected the login to be rejected with %s, got %d to %q", errorMissingRefreshToken, rr.Code, rr.Header().Get("Location"))
+		}
+	})
+
+	t.Run("force-consent", func(t *testing.T) {
+		a.noRefreshToken = OnMissingRefreshTokenForceConsent
+		rr := login(stateCookieName, "abc"+embeddedStateSuffix)
+		if loggedIn {
+			t.Fatal("expected the login not to continue without a refresh token")
+		}
+		location, err := rr.Result().Location()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prompt := location.Query().Get("prompt"); location.Host != "auth.example.com" || prompt != "consent" {
+			t.Fatalf("expected a new login with prompt=consent, got %q", location)
+		}
+		state := location.Query().Get("state")
+		if !strings.HasSuffix(state, embeddedStateSuffix+consentStateSuffix) {
+			t.Errorf("expected the state of an embedded login asking for consent, got %q", state)
+		}
+
+		// The provider isn't asked for consent twice.
+		if login(stateCookieName, state); !loggedIn {
+			t.Error("expected the login asking for consent to continue without a refresh token")
+		}
+
+		a.silentRenew = true
+		defer func() { a.silentRenew = false }()
+		rr = login(silentStateCookieName, "abc"+silentStateSuffix)
+		var authErr AuthErrorJSON
+		if err := json.NewDecoder(rr.Body).Decode(&authErr); err != nil {
+			t.Fatal(err)
+		}
+		if loggedIn || rr.Code != http.StatusUnauthorized || authErr.Error != "consent_required" {
+			t.Errorf("expected a silent login to require an interactive login, got %d: %+v", rr.Code, authErr)
+		}
+	})
+}
+
+func TestOIDCRefreshSessionAfterLogout(t *testing.T) {
+	redisStore, _ := newTestRedisSessionStore(t)
+	stores := map[string]SessionStore{
+		"memory": NewSessionStore(32),
+		"redis":  redisStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+			o.sessions = store
+			o.followTokenExpiry = true
+			o.refreshLeadTime = 10 * time.Minute
+			c, err := newRefreshTokenCipher(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.refreshTokens = c
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			refreshedIDToken := newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(2 * time.Hour).Unix()})
+			o.refresh = func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+				close(started)
+				<-release
+				return (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": refreshedIDToken}), nil
+			}
+
+			ls, err := o.login(httptest.NewRecorder(), (&oauth2.Token{RefreshToken: "refresh-token-value"}).WithExtra(map[string]interface{}{
+				"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console", "exp": time.Now().Add(time.Hour).Unix()}),
+			}), http.SameSiteLaxMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Move the session into the refresh lead time.
+			ls.exp = time.Now().Add(5 * time.Minute)
+			if err := o.sessions.Replace(context.Background(), ls.sessionToken, ls); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "http://example.com/api", nil)
+			r.AddCookie(&http.Cookie{Name: openshiftAccessTokenCookieName, Value: ls.sessionToken})
+			refreshErr := make(chan error)
+			go func() {
+				_, err := o.getLoginState(r)
+				refreshErr <- err
+			}()
+
+			<-started
+			if err := o.sessions.Delete(context.Background(), ls.sessionToken); err != nil {
+				t.Fatal(err)
+			}
+			close(release)
+
+			if err := <-refreshErr; err == nil {
+				t.Error("expected the refresh finishing after the logout to fail")
+			}
+			if stored, err := o.sessions.Get(context.Background(), ls.sessionToken); err != nil || stored != nil {
+				t.Errorf("expected the session to stay logged out, got %v, error: %v", stored, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -10,53 +11,110 @@ import (
 
 const openshiftAccessTokenCookieName = "openshift-session-token"
 
+// SessionStore keeps the login state of OIDC sessions by the session token,
+// which is the only value kept in the session cookie. A store shared between
+// console replicas lets any of them serve a session.
+type SessionStore interface {
+	// Get returns the login state for token, or nil if there is none.
+	Get(ctx context.Context, token string) (*loginState, error)
+	// Set stores the login state for token until it expires.
+	Set(ctx context.Context, token string, ls *loginState) error
+	// Replace overwrites the login state for token in place, e.g. after a
+	// refresh, so that concurrent readers never miss the session.
+	Replace(ctx context.Context, token string, ls *loginState) error
+	// Delete removes the login state for token.
+	Delete(ctx context.Context, token string) error
+	// Epoch returns the current session epoch. Sessions created in an
+	// earlier epoch are no longer valid.
+	Epoch(ctx context.Context) (int64, error)
+	// BumpEpoch starts a new session epoch, invalidating all sessions.
+	BumpEpoch(ctx context.Context) (int64, error)
+	// SetLatestSession records the session of ls as the latest one of its
+	// user, until the session expires.
+	SetLatestSession(ctx context.Context, ls *loginState) error
+	// LatestSession returns the sessionKey of the latest session of userID,
+	// or "" if there is none.
+	LatestSession(ctx context.Context, userID string) (string, error)
+	// SetLastActivity records t as the last activity of the user of the
+	// session of token, for ttl.
+	SetLastActivity(ctx context.Context, token string, t time.Time, ttl time.Duration) error
+	// LastActivity returns the last activity recorded for the session of
+	// token, or the zero time if there is none.
+	LastActivity(ctx context.Context, token string) (time.Time, error)
+}
+
 type oldSession struct {
 	token string
 	exp   time.Time
 }
 
-type SessionStore struct {
+// MemorySessionStore is the default SessionStore. It keeps sessions in memory,
+// so that requests of a session must be routed to the same console replica.
+type MemorySessionStore struct {
 	byToken     map[string]*loginState
 	byAge       []oldSession
+	latest      map[string]string
+	activity    map[string]time.Time
 	maxSessions int
+	epoch       int64
 	now         nowFunc
 	mux         sync.Mutex
 }
 
-func NewSessionStore(maxSessions int) *SessionStore {
-	return &SessionStore{
+func NewSessionStore(maxSessions int) *MemorySessionStore {
+	return &MemorySessionStore{
 		byToken:     make(map[string]*loginState),
+		latest:      make(map[string]string),
+		activity:    make(map[string]time.Time),
 		maxSessions: maxSessions,
 		now:         defaultNow,
 	}
 }
 
-// addSession sets sessionToken to a random value and adds loginState to session data structures
-func (ss *SessionStore) addSession(ls *loginState) error {
-	sessionToken := randomString(128)
-	if ss.byToken[sessionToken] != nil {
-		ss.deleteSession(sessionToken)
-		return fmt.Errorf("Session token collision! THIS SHOULD NEVER HAPPEN! Token: %s", sessionToken)
-	}
-	ls.sessionToken = sessionToken
+// Set adds the login state and prunes expired sessions and, if there are too
+// many sessions, the oldest ones.
+func (ss *MemorySessionStore) Set(_ context.Context, token string, ls *loginState) error {
 	ss.mux.Lock()
-	ss.byToken[sessionToken] = ls
+	if ss.byToken[token] != nil {
+		ss.mux.Unlock()
+		return fmt.Errorf("Session token collision! THIS SHOULD NEVER HAPPEN! Token: %s", token)
+	}
+	ss.byToken[token] = ls
 	// Assume token expiration is always the same time in the future. Should be close enough for government work.
-	ss.byAge = append(ss.byAge, oldSession{sessionToken, ls.exp})
+	ss.byAge = append(ss.byAge, oldSession{token, ls.storeExpiry()})
 	ss.mux.Unlock()
+
+	ss.pruneSessions()
+	return nil
+}
+
+// Replace also moves the expiry of the session used for pruning.
+func (ss *MemorySessionStore) Replace(_ context.Context, token string, ls *loginState) error {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	if ss.byToken[token] == nil {
+		return fmt.Errorf("no session to replace")
+	}
+	ss.byToken[token] = ls
+	for i := range ss.byAge {
+		if ss.byAge[i].token == token {
+			ss.byAge[i].exp = ls.storeExpiry()
+		}
+	}
 	return nil
 }
 
-func (ss *SessionStore) getSession(token string) *loginState {
+func (ss *MemorySessionStore) Get(_ context.Context, token string) (*loginState, error) {
 	ss.mux.Lock()
 	defer ss.mux.Unlock()
-	return ss.byToken[token]
+	return ss.byToken[token], nil
 }
 
-func (ss *SessionStore) deleteSession(token string) error {
+func (ss *MemorySessionStore) Delete(_ context.Context, token string) error {
 	ss.mux.Lock()
 	defer ss.mux.Unlock()
 	delete(ss.byToken, token)
+	delete(ss.activity, token)
 	for i := 0; i < len(ss.byAge); i++ {
 		s := ss.byAge[i]
 		if s.token == token {
@@ -68,7 +126,55 @@ func (ss *SessionStore) deleteSession(token string) error {
 	return fmt.Errorf("ss.byAge did not contain session %v", token)
 }
 
-func (ss *SessionStore) pruneSessions() {
+func (ss *MemorySessionStore) Epoch(_ context.Context) (int64, error) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	return ss.epoch, nil
+}
+
+// BumpEpoch also drops all sessions, they can't be used anymore.
+func (ss *MemorySessionStore) BumpEpoch(_ context.Context) (int64, error) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	ss.epoch++
+	ss.byToken = make(map[string]*loginState)
+	ss.byAge = nil
+	ss.latest = make(map[string]string)
+	ss.activity = make(map[string]time.Time)
+	return ss.epoch, nil
+}
+
+func (ss *MemorySessionStore) SetLatestSession(_ context.Context, ls *loginState) error {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	ss.latest[ls.UserID] = sessionKey(ls.sessionToken)
+	return nil
+}
+
+func (ss *MemorySessionStore) LatestSession(_ context.Context, userID string) (string, error) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	return ss.latest[userID], nil
+}
+
+// SetLastActivity keeps the activity as long as the session, ttl is ignored.
+func (ss *MemorySessionStore) SetLastActivity(_ context.Context, token string, t time.Time, _ time.Duration) error {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	if ss.byToken[token] == nil {
+		return fmt.Errorf("no session to record the activity of")
+	}
+	ss.activity[token] = t
+	return nil
+}
+
+func (ss *MemorySessionStore) LastActivity(_ context.Context, token string) (time.Time, error) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	return ss.activity[token], nil
+}
+
+func (ss *MemorySessionStore) pruneSessions() {
 	ss.mux.Lock()
 	defer ss.mux.Unlock()
 	expired := 0
@@ -92,5 +198,28 @@ func (ss *SessionStore) pruneSessions() {
 	}
 	if expired+toRemove > 0 {
 		klog.V(4).Infof("Pruned %v old sessions.", expired+toRemove)
+		ss.pruneGoneLocked()
+	}
+}
+
+// pruneGoneLocked forgets the activity of sessions and the latest sessions of
+// users that are gone.
+func (ss *MemorySessionStore) pruneGoneLocked() {
+	for token := range ss.activity {
+		if ss.byToken[token] == nil {
+			delete(ss.activity, token)
+		}
+	}
+	if len(ss.latest) == 0 {
+		return
+	}
+	kept := make(map[string]bool, len(ss.byToken))
+	for token := range ss.byToken {
+		kept[sessionKey(token)] = true
+	}
+	for userID, key := range ss.latest {
+		if !kept[key] {
+			delete(ss.latest, userID)
+		}
 	}
 }
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisSessionKeyPrefix = "console:session:"
+	redisSessionEpochKey  = "console:session-epoch"
+	redisLatestKeyPrefix  = "console:latest-session:"
+	redisActivityPrefix   = "console:activity:"
+)
+
+// RedisSessionStore is a SessionStore shared by all console replicas using
+// the same Redis server.
+type RedisSessionStore struct {
+	client *redis.Client
+	now    nowFunc
+}
+
+func NewRedisSessionStore(client *redis.Client) *RedisSessionStore {
+	return &RedisSessionStore{
+		client: client,
+		now:    defaultNow,
+	}
+}
+
+// storedLoginState is the representation of a loginState in Redis.
+type storedLoginState struct {
+	UserID   string    `json:"userID"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Groups   []string  `json:"groups,omitempty"`
+	Exp      time.Time `json:"exp"`
+	RawToken string    `json:"rawToken"`
+	Epoch    int64     `json:"epoch,omitempty"`
+	// LoginTime is zero for sessions stored before it was recorded.
+	LoginTime time.Time `json:"loginTime"`
+	// KeepUntil is only set for sessions that are refreshed.
+	KeepUntil time.Time `json:"keepUntil,omitempty"`
+	// EncryptedRefreshToken is only set when refresh tokens are stored.
+	EncryptedRefreshToken string `json:"encryptedRefreshToken,omitempty"`
+}
+
+// redisSessionKey hashes the session token, so that reading the keys of the
+// Redis server isn't enough to take over sessions.
+func redisSessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return redisSessionKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+func (rs *RedisSessionStore) Get(ctx context.Context, token string) (*loginState, error) {
+	data, err := rs.client.Get(ctx, redisSessionKey(token)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting session from redis: %w", err)
+	}
+
+	var stored storedLoginState
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("error decoding session from redis: %w", err)
+	}
+	ls := &loginState{
+		UserID:       stored.UserID,
+		Name:         stored.Name,
+		Email:        stored.Email,
+		Groups:       stored.Groups,
+		exp:          stored.Exp,
+		now:          defaultNow,
+		sessionToken: token,
+		rawToken:     stored.RawToken,
+		epoch:        stored.Epoch,
+	}
+	ls.encryptedRefreshToken = stored.EncryptedRefreshToken
+	ls.loginTime = stored.LoginTime
+	ls.keepUntil = stored.KeepUntil
+	return ls, nil
+}
+
+// Set stores the login state until its storeExpiry, the lifetime of its token
+// unless it is refreshed. Redis takes care of pruning expired sessions.
+func (rs *RedisSessionStore) Set(ctx context.Context, token string, ls *loginState) error {
+	data, ttl, err := rs.encode(ls)
+	if err != nil {
+		return err
+	}
+
+	ok, err := rs.client.SetNX(ctx, redisSessionKey(token), data, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("error storing session in redis: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("Session token collision! THIS SHOULD NEVER HAPPEN!")
+	}
+	return nil
+}
+
+// Replace overwrites the session with a single SET, so that other replicas
+// see either the old or the new login state. The SET only applies to an
+// existing session, so that a refresh finishing after a logout can't bring
+// the session back.
+func (rs *RedisSessionStore) Replace(ctx context.Context, token string, ls *loginState) error {
+	data, ttl, err := rs.encode(ls)
+	if err != nil {
+		return err
+	}
+	ok, err := rs.client.SetXX(ctx, redisSessionKey(token), data, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("error storing session in redis: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("no session to replace")
+	}
+	return nil
+}
+
+// encode returns the representation of ls in Redis and its TTL.
+func (rs *RedisSessionStore) encode(ls *loginState) ([]byte, time.Duration, error) {
+	ttl := ls.storeExpiry().Sub(rs.now())
+	if ttl <= 0 {
+		return nil, 0, fmt.Errorf("session is already expired")
+	}
+
+	data, err := json.Marshal(storedLoginState{
+		UserID:   ls.UserID,
+		Name:     ls.Name,
+		Email:    ls.Email,
+		Groups:   ls.Groups,
+		Exp:      ls.exp,
+		RawToken: ls.rawToken,
+		Epoch:    ls.epoch,
+
+		LoginTime:             ls.loginTime,
+		KeepUntil:             ls.keepUntil,
+		EncryptedRefreshToken: ls.encryptedRefreshToken,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, ttl, nil
+}
+
+func (rs *RedisSessionStore) Delete(ctx context.Context, token string) error {
+	if err := rs.client.Del(ctx, redisSessionKey(token)).Err(); err != nil {
+		return fmt.Errorf("error deleting session from redis: %w", err)
+	}
+	return nil
+}
+
+// Epoch is kept in Redis, so that a new epoch applies to all console replicas.
+func (rs *RedisSessionStore) Epoch(ctx context.Context) (int64, error) {
+	epoch, err := rs.client.Get(ctx, redisSessionEpochKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error getting session epoch from redis: %w", err)
+	}
+	return epoch, nil
+}
+
+// redisLatestSessionKey hashes the user ID, which might be an email address.
+func redisLatestSessionKey(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return redisLatestKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// SetLatestSession keeps the sessionKey, not the session token, so that the
+// value isn't enough to take over the session.
+func (rs *RedisSessionStore) SetLatestSession(ctx context.Context, ls *loginState) error {
+	ttl := ls.storeExpiry().Sub(rs.now())
+	if ttl <= 0 {
+		return fmt.Errorf("session is already expired")
+	}
+	if err := rs.client.Set(ctx, redisLatestSessionKey(ls.UserID), sessionKey(ls.sessionToken), ttl).Err(); err != nil {
+		return fmt.Errorf("error storing latest session in redis: %w", err)
+	}
+	return nil
+}
+
+func (rs *RedisSessionStore) LatestSession(ctx context.Context, userID string) (string, error) {
+	key, err := rs.client.Get(ctx, redisLatestSessionKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting latest session from redis: %w", err)
+	}
+	return key, nil
+}
+
+// redisActivityKey hashes the session token like redisSessionKey.
+func redisActivityKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return redisActivityPrefix + hex.EncodeToString(sum[:])
+}
+
+// SetLastActivity keeps the activity apart from the session, so that
+// recording it can't overwrite a concurrent refresh of the session.
+func (rs *RedisSessionStore) SetLastActivity(ctx context.Context, token string, t time.Time, ttl time.Duration) error {
+	if err := rs.client.Set(ctx, redisActivityKey(token), t.UTC().Format(time.RFC3339Nano), ttl).Err(); err != nil {
+		return fmt.Errorf("error storing session activity in redis: %w", err)
+	}
+	return nil
+}
+
+func (rs *RedisSessionStore) LastActivity(ctx context.Context, token string) (time.Time, error) {
+	value, err := rs.client.Get(ctx, redisActivityKey(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error getting session activity from redis: %w", err)
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error decoding session activity from redis: %w", err)
+	}
+	return t, nil
+}
+
+func (rs *RedisSessionStore) BumpEpoch(ctx context.Context) (int64, error) {
+	epoch, err := rs.client.Incr(ctx, redisSessionEpochKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error bumping session epoch in redis: %w", err)
+	}
+	return epoch, nil
+}
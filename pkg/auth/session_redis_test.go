@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is an in-process Redis server implementing the commands the
+// RedisSessionStore uses.
+type fakeRedis struct {
+	mu     sync.Mutex
+	now    nowFunc
+	values map[string]string
+	expiry map[string]time.Time
+}
+
+// newTestRedisSessionStore returns a RedisSessionStore connected to a
+// fakeRedis.
+func newTestRedisSessionStore(t *testing.T) (*RedisSessionStore, *fakeRedis) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	fake := &fakeRedis{
+		now:    defaultNow,
+		values: map[string]string{},
+		expiry: map[string]time.Time{},
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+
+	client := redis.NewClient(&redis.Options{Addr: l.Addr().String()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisSessionStore(client), fake
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRedisCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.do(args)); err != nil {
+			return
+		}
+	}
+}
+
+// readRedisCommand reads a command sent as an array of bulk strings.
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// do runs the command and returns its reply.
+func (f *fakeRedis) do(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToLower(args[0]) {
+	case "ping":
+		return "+PONG\r\n"
+	case "get":
+		value, ok := f.get(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "set":
+		return f.set(args[1], args[2], args[3:])
+	case "del":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.get(key); ok {
+				deleted++
+			}
+			delete(f.values, key)
+			delete(f.expiry, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "incr":
+		value, _ := f.get(args[1])
+		n, _ := strconv.ParseInt(value, 10, 64)
+		f.values[args[1]] = strconv.FormatInt(n+1, 10)
+		return fmt.Sprintf(":%d\r\n", n+1)
+	case "pttl":
+		if _, ok := f.get(args[1]); !ok {
+			return ":-2\r\n"
+		}
+		exp, ok := f.expiry[args[1]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", exp.Sub(f.now()).Milliseconds())
+	default:
+		// Makes the client fall back to RESP2 for HELLO.
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	if exp, ok := f.expiry[key]; ok && !f.now().Before(exp) {
+		delete(f.values, key)
+		delete(f.expiry, key)
+	}
+	value, ok := f.values[key]
+	return value, ok
+}
+
+func (f *fakeRedis) set(key, value string, options []string) string {
+	var nx, xx, keepTTL bool
+	var ttl time.Duration
+	for i := 0; i < len(options); i++ {
+		switch strings.ToLower(options[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keepTTL = true
+		case "ex", "px":
+			i++
+			n, err := strconv.ParseInt(options[i], 10, 64)
+			if err != nil {
+				return "-ERR value is not an integer or out of range\r\n"
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if strings.ToLower(options[i-1]) == "ex" {
+				ttl = time.Duration(n) * time.Second
+			}
+		default:
+			return "-ERR syntax error\r\n"
+		}
+	}
+
+	_, exists := f.get(key)
+	if (nx && exists) || (xx && !exists) {
+		return "$-1\r\n"
+	}
+	f.values[key] = value
+	if ttl > 0 {
+		f.expiry[key] = f.now().Add(ttl)
+	} else if !keepTTL {
+		delete(f.expiry, key)
+	}
+	return "+OK\r\n"
+}
+
+func TestRedisReplaceDeletedSession(t *testing.T) {
+	rs, _ := newTestRedisSessionStore(t)
+	ctx := context.Background()
+
+	ls := &loginState{UserID: "user-id", exp: time.Now().Add(time.Hour), now: defaultNow}
+	if err := rs.Replace(ctx, "token", ls); err == nil {
+		t.Error("expected replacing a session that was never stored to fail")
+	}
+	if err := rs.Set(ctx, "token", ls); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Replace(ctx, "token", ls); err != nil {
+		t.Errorf("expected the session to be replaced, got: %v", err)
+	}
+	if err := rs.Delete(ctx, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Replace(ctx, "token", ls); err == nil {
+		t.Error("expected replacing a deleted session to fail")
+	}
+	if stored, err := rs.Get(ctx, "token"); err != nil || stored != nil {
+		t.Errorf("expected the deleted session to stay deleted, got %v, error: %v", stored, err)
+	}
+}
+
+func TestRedisSessionStore(t *testing.T) {
+	rs, fake := newTestRedisSessionStore(t)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rs.now = func() time.Time { return now }
+	fake.now = rs.now
+
+	ls := &loginState{
+		UserID:                "user-id",
+		Name:                  "user",
+		Email:                 "user@example.com",
+		Groups:                []string{"admins", "developers"},
+		exp:                   now.Add(time.Hour),
+		rawToken:              "raw-id-token",
+		epoch:                 3,
+		encryptedRefreshToken: "encrypted-refresh-token",
+		loginTime:             now.Add(-time.Hour),
+		keepUntil:             now.Add(8 * time.Hour),
+	}
+	if err := rs.Set(ctx, "token", ls); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := rs.Get(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.now == nil {
+		t.Error("expected the session to have a clock")
+	}
+	got.now = nil
+	want := *ls
+	want.sessionToken = "token"
+	if !reflect.DeepEqual(got, &want) {
+		t.Errorf("expected %+v, got %+v", &want, got)
+	}
+
+	fake.mu.Lock()
+	_, hashed := fake.values[redisSessionKey("token")]
+	_, plain := fake.values[redisSessionKeyPrefix+"token"]
+	fake.mu.Unlock()
+	if !hashed || plain {
+		t.Error("expected the session to be stored under the hashed token")
+	}
+	if ttl := rs.client.PTTL(ctx, redisSessionKey("token")).Val(); ttl != 8*time.Hour {
+		t.Errorf("expected the session to be kept until keepUntil, got a TTL of %v", ttl)
+	}
+
+	collision := &loginState{UserID: "other-user-id", exp: now.Add(time.Hour)}
+	if err := rs.Set(ctx, "token", collision); err == nil {
+		t.Error("expected storing a session under an existing token to fail")
+	}
+	if got, _ := rs.Get(ctx, "token"); got == nil || got.UserID != "user-id" {
+		t.Errorf("expected the existing session to be kept, got %v", got)
+	}
+
+	if err := rs.Set(ctx, "expired", &loginState{exp: now.Add(-time.Second)}); err == nil {
+		t.Error("expected storing an expired session to fail")
+	}
+
+	if err := rs.Set(ctx, "not-refreshed", &loginState{exp: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := rs.client.PTTL(ctx, redisSessionKey("not-refreshed")).Val(); ttl != time.Hour {
+		t.Errorf("expected the session to be kept until its token expires, got a TTL of %v", ttl)
+	}
+	fake.mu.Lock()
+	fake.now = func() time.Time { return now.Add(time.Hour) }
+	fake.mu.Unlock()
+	if got, err := rs.Get(ctx, "not-refreshed"); err != nil || got != nil {
+		t.Errorf("expected the session to expire with its token, got %v, error: %v", got, err)
+	}
+	if got, err := rs.Get(ctx, "token"); err != nil || got == nil {
+		t.Errorf("expected the refreshed session to be kept, got %v, error: %v", got, err)
+	}
+}
+
+func TestRedisSessionEpoch(t *testing.T) {
+	rs, _ := newTestRedisSessionStore(t)
+	ctx := context.Background()
+
+	if epoch, err := rs.Epoch(ctx); err != nil || epoch != 0 {
+		t.Errorf("expected epoch 0 before it is bumped, got %d, error: %v", epoch, err)
+	}
+	for want := int64(1); want <= 2; want++ {
+		if epoch, err := rs.BumpEpoch(ctx); err != nil || epoch != want {
+			t.Errorf("expected epoch %d, got %d, error: %v", want, epoch, err)
+		}
+	}
+
+	other := NewRedisSessionStore(rs.client)
+	if epoch, err := other.Epoch(ctx); err != nil || epoch != 2 {
+		t.Errorf("expected the epoch to be shared, got %d, error: %v", epoch, err)
+	}
+}
+
+func TestRedisLatestSessionAndActivity(t *testing.T) {
+	rs, _ := newTestRedisSessionStore(t)
+	ctx := context.Background()
+
+	if latest, err := rs.LatestSession(ctx, "user-id"); err != nil || latest != "" {
+		t.Errorf("expected no latest session, got %q, error: %v", latest, err)
+	}
+	ls := &loginState{UserID: "user-id", exp: time.Now().Add(time.Hour), sessionToken: "token"}
+	if err := rs.SetLatestSession(ctx, ls); err != nil {
+		t.Fatal(err)
+	}
+	if latest, err := rs.LatestSession(ctx, "user-id"); err != nil || latest != sessionKey("token") {
+		t.Errorf("expected the session key of the latest session, got %q, error: %v", latest, err)
+	}
+
+	if last, err := rs.LastActivity(ctx, "token"); err != nil || !last.IsZero() {
+		t.Errorf("expected no activity, got %v, error: %v", last, err)
+	}
+	activity := time.Date(2024, 1, 1, 12, 0, 0, 123, time.UTC)
+	if err := rs.SetLastActivity(ctx, "token", activity, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if last, err := rs.LastActivity(ctx, "token"); err != nil || !last.Equal(activity) {
+		t.Errorf("expected the last activity %v, got %v, error: %v", activity, last, err)
+	}
+}
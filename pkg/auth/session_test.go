@@ -1,12 +1,13 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
 )
 
-func checkSessions(t *testing.T, ss *SessionStore) {
+func checkSessions(t *testing.T, ss *MemorySessionStore) {
 	if len(ss.byAge) != len(ss.byToken) {
 		t.Fatalf("age: %v != token %v", len(ss.byAge), len(ss.byToken))
 	}
@@ -33,38 +34,35 @@ func TestSessions(t *testing.T) {
 	}
 
 	for _, ft := range fakeTokens {
-		ls, err := newLoginState(ft.raw, []byte(ft.claims))
+		ls, err := newLoginState(ft.raw, []byte(ft.claims), "")
 		if err != nil {
 			t.Fatalf("newLoginState error: %v", err)
 		}
 
-		err = ss.addSession(ls)
+		err = ss.Set(context.Background(), randomString(128), ls)
 		if err != nil {
-			t.Fatalf("addSession error: %v", err)
-		}
-
-		sessionToken := ls.sessionToken
-		if sessionToken == "" {
-			t.Fatal("sessionToken is empty!")
+			t.Fatalf("Set error: %v", err)
 		}
 		checkSessions(t, ss)
 	}
 
-	if len(ss.byAge) != 4 {
-		t.Fatal("ss.byAge != 4")
-	}
-
-	ss.pruneSessions()
-
+	// The expired session is pruned when it is added.
 	if len(ss.byAge) != 3 {
 		t.Fatal("ss.byAge != 3")
 	}
 
-	checkSessions(t, ss)
+	token := ss.byAge[0].token
+	if ls, err := ss.Get(context.Background(), token); err != nil || ls == nil {
+		t.Fatalf("Get error: %v", err)
+	}
 
-	err := ss.deleteSession(ss.byAge[0].token)
+	err := ss.Delete(context.Background(), token)
 	if err != nil {
-		t.Fatalf("deleteSession error: %v", err)
+		t.Fatalf("Delete error: %v", err)
+	}
+
+	if ls, err := ss.Get(context.Background(), token); err != nil || ls != nil {
+		t.Fatalf("expected the session to be deleted, got: %v, %v", ls, err)
 	}
 
 	checkSessions(t, ss)
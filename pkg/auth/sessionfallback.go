@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"k8s.io/klog"
+)
+
+const (
+	// SessionStoreFailClosed rejects requests while the session store fails.
+	SessionStoreFailClosed = "fail-closed"
+	// SessionStoreFailOpenReadOnly accepts read-only requests while the
+	// session store fails, if the session has a valid fallback cookie.
+	SessionStoreFailOpenReadOnly = "fail-open-readonly"
+)
+
+const (
+	// sessionFallbackCookieName holds the ID token of the session with
+	// SessionStoreFailOpenReadOnly. It is only read while the store fails.
+	sessionFallbackCookieName = "openshift-session-fallback"
+	// maxSessionFallbackCookieChunks is the number of cookies the ID token
+	// may be split across. Sessions with larger ID tokens fail closed.
+	maxSessionFallbackCookieChunks = 4
+)
+
+// errSessionFallbackNotReadOnly is returned for requests that could change
+// something while the session store fails.
+var errSessionFallbackNotReadOnly = errors.New("only read-only requests are accepted without the session store")
+
+// writeSubresources are reached with GET requests, upgraded to WebSockets or
+// not, but act on the cluster like writes.
+var writeSubresources = map[string]bool{
+	"exec":        true,
+	"attach":      true,
+	"portforward": true,
+	"proxy":       true,
+}
+
+// isReadOnly returns whether r can't change anything. Requests with a path
+// segment named like a writeSubresource are not, even if the segment is the
+// name of an object.
+func isReadOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+	if r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	for _, segment := range strings.Split(r.URL.Path, "/") {
+		if writeSubresources[segment] {
+			return false
+		}
+	}
+	return true
+}
+
+// setFallbackCookie writes the ID token of ls next to the session cookie. The
+// ID token is signed by the provider, so it can be verified without the store.
+func (o *oidcAuth) setFallbackCookie(w http.ResponseWriter, ls *loginState, sameSite http.SameSite) {
+	err := setChunkedCookie(w, http.Cookie{
+		Name:     sessionFallbackCookieName,
+		Value:    ls.rawToken,
+		MaxAge:   maxAge(ls.exp, ls.now()),
+		HttpOnly: true,
+		Path:     o.cookiePath,
+		Domain:   o.cookieDomain,
+		Secure:   o.secureCookies,
+		SameSite: sameSite,
+	}, maxSessionFallbackCookieChunks)
+	if err != nil {
+		klog.Warningf("not writing the session fallback cookie of user %q, the session fails closed if the session store fails: %v", ls.UserID, err)
+	}
+}
+
+func (o *oidcAuth) deleteFallbackCookie(w http.ResponseWriter) {
+	deleteChunkedCookie(w, http.Cookie{
+		Name:     sessionFallbackCookieName,
+		MaxAge:   0,
+		HttpOnly: true,
+		Path:     o.cookiePath,
+		Domain:   o.cookieDomain,
+		Secure:   o.secureCookies,
+	}, maxSessionFallbackCookieChunks)
+}
+
+// sessionStoreFailed handles the failure storeErr of the session store while
+// authenticating r. With SessionStoreFailOpenReadOnly, read-only requests are
+// authenticated by the ID token of the fallback cookie while it is valid.
+// Sessions invalidated, replaced by a newer login or past their maximum
+// lifetime can't be told apart then. The fallback cookie keeps the ID token of
+// the login, refreshes don't rewrite it.
+func (o *oidcAuth) sessionStoreFailed(r *http.Request, storeErr error) (*loginState, error) {
+	if !o.storeFailOpen {
+		return nil, storeErr
+	}
+	ls, err := o.fallbackLoginState(r)
+	if o.metrics != nil {
+		o.metrics.SessionStoreFailedOpen(err == nil)
+	}
+	if err != nil {
+		klog.Warningf("session store failed, not failing open for %s %s: %v: %v", r.Method, r.URL.Path, storeErr, err)
+		return nil, storeErr
+	}
+	klog.Warningf("session store failed, FAILING OPEN for %s %s of user %q with the ID token of the session fallback cookie: %v", r.Method, r.URL.Path, ls.UserID, storeErr)
+	return ls, nil
+}
+
+func (o *oidcAuth) fallbackLoginState(r *http.Request) (*loginState, error) {
+	if !isReadOnly(r) {
+		return nil, errSessionFallbackNotReadOnly
+	}
+	rawIDToken, err := readChunkedCookie(r, sessionFallbackCookieName, maxSessionFallbackCookieChunks)
+	if err != nil || rawIDToken == "" {
+		return nil, fmt.Errorf("no session fallback cookie")
+	}
+	ls, err := o.newLoginState(r.Context(), (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": rawIDToken}))
+	if err != nil {
+		return nil, fmt.Errorf("invalid session fallback cookie: %w", err)
+	}
+	if ls.exp.Sub(ls.now()) < 0 {
+		return nil, fmt.Errorf("the ID token of the session fallback cookie is expired")
+	}
+	return ls, nil
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openshift/console/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// unavailableSessionStore fails all calls while down.
+type unavailableSessionStore struct {
+	SessionStore
+	down bool
+}
+
+var errSessionStoreDown = errors.New("session store is down")
+
+func (s *unavailableSessionStore) Get(ctx context.Context, token string) (*loginState, error) {
+	if s.down {
+		return nil, errSessionStoreDown
+	}
+	return s.SessionStore.Get(ctx, token)
+}
+
+func (s *unavailableSessionStore) Epoch(ctx context.Context) (int64, error) {
+	if s.down {
+		return 0, errSessionStoreDown
+	}
+	return s.SessionStore.Epoch(ctx)
+}
+
+func TestSessionStoreFailurePolicy(t *testing.T) {
+	for _, policy := range []string{SessionStoreFailClosed, SessionStoreFailOpenReadOnly} {
+		t.Run(policy, func(t *testing.T) {
+			store := &unavailableSessionStore{SessionStore: NewSessionStore(32)}
+			o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+			o.sessions = store
+			o.storeFailOpen = policy == SessionStoreFailOpenReadOnly
+			o.metrics = NewMetrics()
+
+			token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": newTestIDToken(t, map[string]interface{}{"aud": "console"})})
+			rr := httptest.NewRecorder()
+			if _, err := o.login(rr, token, http.SameSiteLaxMode); err != nil {
+				t.Fatal(err)
+			}
+			resp := rr.Result()
+			newRequest := func(method string, resp *http.Response, names ...string) *http.Request {
+				r := httptest.NewRequest(method, "http://example.com/api/kubernetes/", nil)
+				for _, c := range resp.Cookies() {
+					for _, name := range names {
+						if c.Name == name {
+							r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+						}
+					}
+				}
+				return r
+			}
+			allCookies := []string{openshiftAccessTokenCookieName, sessionFallbackCookieName}
+
+			hasFallback := false
+			for _, c := range resp.Cookies() {
+				if c.Name == sessionFallbackCookieName && c.Value != "" && c.HttpOnly {
+					hasFallback = true
+				}
+			}
+			if hasFallback != o.storeFailOpen {
+				t.Errorf("expected a session fallback cookie: %v, got cookies %v", o.storeFailOpen, resp.Cookies())
+			}
+			if _, err := o.authenticate(newRequest(http.MethodGet, resp, allCookies...)); err != nil {
+				t.Fatalf("expected the session to be valid with the store up, got: %v", err)
+			}
+
+			store.down = true
+			user, err := o.authenticate(newRequest(http.MethodGet, resp, allCookies...))
+			if o.storeFailOpen {
+				if err != nil || user.ID != "user-id" {
+					t.Errorf("expected read-only requests to fail open, got %v: %v", user, err)
+				}
+			} else if !errors.Is(err, errSessionStoreDown) {
+				t.Errorf("expected requests to fail closed, got %v: %v", user, err)
+			}
+
+			// Requests that could change something, without the fallback cookie,
+			// or with an expired ID token always fail closed.
+			if _, err := o.authenticate(newRequest(http.MethodPost, resp, allCookies...)); !errors.Is(err, errSessionStoreDown) {
+				t.Errorf("expected requests that aren't read-only to fail closed, got: %v", err)
+			}
+			exec := newRequest(http.MethodGet, resp, allCookies...)
+			exec.URL.Path = "/api/kubernetes/api/v1/namespaces/default/pods/console/exec"
+			exec.Header.Set("Upgrade", "websocket")
+			if _, err := o.authenticate(exec); !errors.Is(err, errSessionStoreDown) {
+				t.Errorf("expected exec requests to fail closed, got: %v", err)
+			}
+			if _, err := o.authenticate(newRequest(http.MethodGet, resp, openshiftAccessTokenCookieName)); !errors.Is(err, errSessionStoreDown) {
+				t.Errorf("expected requests without the fallback cookie to fail closed, got: %v", err)
+			}
+			expired := newRequest(http.MethodGet, resp, openshiftAccessTokenCookieName)
+			expired.AddCookie(&http.Cookie{Name: sessionFallbackCookieName, Value: newTestIDToken(t, map[string]interface{}{
+				"aud": "console",
+				"exp": time.Now().Add(-time.Hour).Unix(),
+			})})
+			if _, err := o.authenticate(expired); !errors.Is(err, errSessionStoreDown) {
+				t.Errorf("expected requests with an expired ID token to fail closed, got: %v", err)
+			}
+
+			want := ""
+			if o.storeFailOpen {
+				want = `
+				console_auth_session_store_fail_open_total{result="accepted"} 1
+				console_auth_session_store_fail_open_total{result="rejected"} 4
+				`
+			}
+			assert.Equal(t,
+				metrics.RemoveComments(want),
+				metrics.RemoveComments(metrics.FormatMetrics(o.metrics.sessionStoreFailOpen)),
+			)
+
+			store.down = false
+			if _, err := o.authenticate(newRequest(http.MethodPost, resp, allCookies...)); err != nil {
+				t.Errorf("expected the session to be valid once the store is back, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionFallbackReadOnly(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		upgrade  string
+		readOnly bool
+	}{
+		{method: http.MethodGet, path: "/api/kubernetes/api/v1/namespaces/default/pods", readOnly: true},
+		{method: http.MethodHead, path: "/api/kubernetes/api/v1/namespaces/default/pods/console", readOnly: true},
+		{method: http.MethodGet, path: "/api/kubernetes/api/v1/namespaces/default/pods/console/log", readOnly: true},
+		{method: http.MethodPost, path: "/api/kubernetes/api/v1/namespaces/default/pods"},
+		{method: http.MethodDelete, path: "/api/kubernetes/api/v1/namespaces/default/pods/console"},
+		{method: http.MethodGet, path: "/api/kubernetes/api/v1/namespaces/default/pods", upgrade: "websocket"},
+		{method: http.MethodGet, path: "/api/kubernetes/api/v1/namespaces/default/pods/console/exec"},
+		{method: http.MethodGet, path: "/api/kubernetes/api/v1/namespaces/default/pods/console/attach"},
+		{method: http.MethodGet, path: "/api/kubernetes/api/v1/namespaces/default/pods/console/portforward"},
+		{method: http.MethodGet, path: "/api/kubernetes/api/v1/namespaces/default/services/console:8443/proxy/metrics"},
+		{method: http.MethodGet, path: "/api/kubernetes/api/v1/nodes/worker-0/proxy/stats"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path+" "+tt.upgrade, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+			if tt.upgrade != "" {
+				r.Header.Set("Upgrade", tt.upgrade)
+			}
+			if got := isReadOnly(r); got != tt.readOnly {
+				t.Errorf("expected read-only: %v, got: %v", tt.readOnly, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+const (
+	// silentStateSuffix marks the login state of a silent login, started with prompt=none.
+	silentStateSuffix = ".silent"
+	// silentStateCookieName keeps the state of a silent login apart from an
+	// interactive login running at the same time.
+	silentStateCookieName = "login-state-silent"
+)
+
+// silentLoginErrors are the errors of a silent login that require an
+// interactive login. They are expected and aren't counted as login failures.
+var silentLoginErrors = map[string]bool{
+	"login_required":             true,
+	"interaction_required":       true,
+	"consent_required":           true,
+	"account_selection_required": true,
+}
+
+type silentLoginKey struct{}
+
+func withSilentLogin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, silentLoginKey{}, true)
+}
+
+// isSilentLogin returns true for callbacks of silent logins, which are loaded
+// in a hidden iframe and answered with JSON instead of a redirect.
+func isSilentLogin(ctx context.Context) bool {
+	silent, _ := ctx.Value(silentLoginKey{}).(bool)
+	return silent
+}
+
+// SilentRenewEnabled returns whether SilentLoginFunc may be used.
+func (a *Authenticator) SilentRenewEnabled() bool {
+	return a.silentRenew
+}
+
+// SilentLoginFunc starts a login with prompt=none, meant to be loaded in a
+// hidden iframe to renew the session without user interaction. The callback
+// responds with the LoginJSON of the new session, or with an AuthErrorJSON
+// and status 401, e.g. with the error login_required when the user has to log
+// in interactively.
+func (a *Authenticator) SilentLoginFunc(w http.ResponseWriter, r *http.Request) {
+	if !a.silentRenew {
+		http.NotFound(w, r)
+		return
+	}
+	a.startLogin(w, r, promptNone, a.isEmbedded(r))
+}
+
+// sendSilentLoginError answers a silent login callback with an error that
+// requires an interactive login.
+func sendSilentLoginError(w http.ResponseWriter, authErr, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	serverutils.SendResponse(w, http.StatusUnauthorized, AuthErrorJSON{Error: authErr, ErrorDescription: description})
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSilentLogin(t *testing.T) {
+	idToken := newTestIDToken(t, map[string]interface{}{"aud": "console", "iat": time.Now().Unix()})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	}))
+	defer tokenServer.Close()
+
+	a, err := makeAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newTestOIDCAuth(&oidcConfig{clientID: "console"})
+	a.authFunc = func() (*oauth2.Config, loginMethod) {
+		return &oauth2.Config{
+			ClientID:    "console",
+			RedirectURL: "http://example.com/auth/callback",
+			Endpoint:    oauth2.Endpoint{AuthURL: "https://auth.example.com/auth", TokenURL: tokenServer.URL},
+		}, o
+	}
+
+	rr := httptest.NewRecorder()
+	a.SilentLoginFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/login/silent", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected silent login to be disabled by default, got: %d", rr.Code)
+	}
+
+	a.silentRenew = true
+	rr = httptest.NewRecorder()
+	a.SilentLoginFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/login/silent?then=/k8s/cluster/projects", nil))
+	location, err := rr.Result().Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Query().Get("prompt"); got != "none" {
+		t.Errorf("wrong prompt in authorization request, want: none, got: %q", got)
+	}
+	state := location.Query().Get("state")
+	if !strings.HasSuffix(state, silentStateSuffix) {
+		t.Errorf("expected the state of a silent login to end with %s, got: %q", silentStateSuffix, state)
+	}
+	var stateCookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		switch c.Name {
+		case silentStateCookieName:
+			stateCookie = c
+		case stateCookieName, loginRedirectCookieName:
+			t.Errorf("unexpected %s cookie from a silent login", c.Name)
+		}
+	}
+	if stateCookie == nil {
+		t.Fatalf("expected a %s cookie", silentStateCookieName)
+	}
+	if stateCookie.Value != state || stateCookie.Path != "/auth/callback" {
+		t.Errorf("wrong %s cookie, want value %q and path /auth/callback, got: %v", silentStateCookieName, state, stateCookie)
+	}
+
+	callback := a.CallbackFunc(func(LoginJSON, string, http.ResponseWriter) {
+		t.Error("unexpected tokenizer page for a silent login")
+	})
+	callbackRequest := func(query string) *http.Request {
+		r := httptest.NewRequest("GET", "http://example.com/auth/callback?"+query, nil)
+		r.AddCookie(stateCookie)
+		return r
+	}
+
+	rr = httptest.NewRecorder()
+	callback(rr, callbackRequest("error=login_required&state="+state))
+	var authErr AuthErrorJSON
+	if err := json.NewDecoder(rr.Body).Decode(&authErr); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusUnauthorized || authErr.Error != "login_required" {
+		t.Errorf("expected login_required with %d, got %d: %+v", http.StatusUnauthorized, rr.Code, authErr)
+	}
+
+	rr = httptest.NewRecorder()
+	callback(rr, callbackRequest("code=abc&state=other"+silentStateSuffix))
+	if err := json.NewDecoder(rr.Body).Decode(&authErr); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusUnauthorized || authErr.Error != errorInvalidState {
+		t.Errorf("expected %s with %d, got %d: %+v", errorInvalidState, http.StatusUnauthorized, rr.Code, authErr)
+	}
+
+	rr = httptest.NewRecorder()
+	callback(rr, callbackRequest("code=abc&state="+state))
+	var loginInfo LoginJSON
+	if err := json.NewDecoder(rr.Body).Decode(&loginInfo); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || loginInfo.Exp == 0 {
+		t.Errorf("expected the silent login to succeed, got %d: %+v", rr.Code, loginInfo)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("wrong Cache-Control, want: no-store, got: %q", got)
+	}
+}
@@ -4,7 +4,12 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"net/http"
 	"time"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/serverutils"
 )
 
 type nowFunc func() time.Time
@@ -26,3 +31,24 @@ func randomString(length int) string {
 	}
 	return base64.StdEncoding.EncodeToString(bytes)
 }
+
+// requestLog prefixes log lines with the request ID of a request, so that the
+// lines of concurrent logins can be told apart.
+type requestLog struct {
+	prefix string
+}
+
+func newRequestLog(r *http.Request) requestLog {
+	if id := serverutils.RequestIDFrom(r.Context()); id != "" {
+		return requestLog{prefix: fmt.Sprintf("request-id=%s ", id)}
+	}
+	return requestLog{}
+}
+
+func (l requestLog) Infof(format string, args ...interface{}) {
+	klog.InfoDepth(1, l.prefix+fmt.Sprintf(format, args...))
+}
+
+func (l requestLog) Errorf(format string, args ...interface{}) {
+	klog.ErrorDepth(1, l.prefix+fmt.Sprintf(format, args...))
+}
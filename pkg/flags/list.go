@@ -0,0 +1,59 @@
+package flags
+
+import (
+	"flag"
+	"strings"
+)
+
+// ParseStringList splits a flag value on commas, trims whitespace and drops
+// empty and repeated items. An empty value is an empty list, a value with
+// only separators is an error.
+func ParseStringList(name, raw string) ([]string, error) {
+	if len(strings.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+
+	var list []string
+	seen := map[string]bool{}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 || seen[item] {
+			continue
+		}
+		seen[item] = true
+		list = append(list, item)
+	}
+	if len(list) == 0 {
+		return nil, NewInvalidFlagError(name, "must be a list of values separated by comma, got %q", raw)
+	}
+	return list, nil
+}
+
+// stringList is a flag.Value for a list of strings separated by comma.
+type stringList struct {
+	name string
+	list *[]string
+}
+
+func (s *stringList) String() string {
+	if s.list == nil {
+		return ""
+	}
+	return strings.Join(*s.list, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	list, err := ParseStringList(s.name, value)
+	if err != nil {
+		return err
+	}
+	*s.list = list
+	return nil
+}
+
+// StringListVar defines a flag for a list of strings separated by comma,
+// parsed with ParseStringList.
+func StringListVar(fs *flag.FlagSet, p *[]string, name string, value []string, usage string) {
+	*p = value
+	fs.Var(&stringList{name: name, list: p}, name, usage)
+}
@@ -0,0 +1,62 @@
+package flags
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseStringList(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", raw: "", want: nil},
+		{name: "whitespace", raw: "  ", want: nil},
+		{name: "single value", raw: "openid", want: []string{"openid"}},
+		{name: "trimmed values", raw: " openid , email ", want: []string{"openid", "email"}},
+		{name: "empty items are dropped", raw: "openid,,email,", want: []string{"openid", "email"}},
+		{name: "repeated items are dropped", raw: "openid,email,openid", want: []string{"openid", "email"}},
+		{name: "only separators", raw: ",", wantErr: true},
+		{name: "only separators and whitespace", raw: " , , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStringList("list", tt.raw)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStringListVar(t *testing.T) {
+	var list []string
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	StringListVar(fs, &list, "list", []string{"default"}, "")
+	if !reflect.DeepEqual(list, []string{"default"}) {
+		t.Errorf("expected the default value, got %q", list)
+	}
+
+	if err := fs.Parse([]string{"--list", "a, b,a"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []string{"a", "b"}) {
+		t.Errorf("expected [a b], got %q", list)
+	}
+	if got := fs.Lookup("list").Value.String(); got != "a,b" {
+		t.Errorf("expected the flag value a,b, got %q", got)
+	}
+
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse([]string{"--list", ","}); err == nil {
+		t.Errorf("expected an error for a list without values")
+	}
+}
@@ -3,6 +3,7 @@ package flags
 import (
 	"fmt"
 	"net/url"
+	"time"
 
 	"k8s.io/klog/v2"
 )
@@ -71,6 +72,38 @@ func ValidateFlagIs(name string, value string, expectedValues ...string) error {
 	return nil
 }
 
+// ValidateDurationRange checks that value is between min and max, inclusive.
+// A max of zero means there is no upper bound.
+func ValidateDurationRange(name string, value, min, max time.Duration) error {
+	if max == 0 {
+		if value < min {
+			return NewInvalidFlagError(name, "must be at least %s, not %s", min, value)
+		}
+		return nil
+	}
+
+	if value < min || value > max {
+		return NewInvalidFlagError(name, "must be between %s and %s, not %s", min, max, value)
+	}
+	return nil
+}
+
+// ValidateIntRange checks that value is between min and max, inclusive.
+// A max of zero means there is no upper bound.
+func ValidateIntRange(name string, value, min, max int) error {
+	if max == 0 {
+		if value < min {
+			return NewInvalidFlagError(name, "must be at least %d, not %d", min, value)
+		}
+		return nil
+	}
+
+	if value < min || value > max {
+		return NewInvalidFlagError(name, "must be between %d and %d, not %d", min, max, value)
+	}
+	return nil
+}
+
 func FatalIfFailed(err error) {
 	if err != nil {
 		klog.Fatalf(err.Error())
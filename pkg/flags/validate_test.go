@@ -0,0 +1,60 @@
+package flags
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateDurationRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   time.Duration
+		min     time.Duration
+		max     time.Duration
+		wantErr bool
+	}{
+		{name: "within range", value: 5 * time.Minute, min: time.Minute, max: 30 * time.Minute},
+		{name: "at min", value: time.Minute, min: time.Minute, max: 30 * time.Minute},
+		{name: "at max", value: 30 * time.Minute, min: time.Minute, max: 30 * time.Minute},
+		{name: "below min", value: time.Second, min: time.Minute, max: 30 * time.Minute, wantErr: true},
+		{name: "above max", value: time.Hour, min: time.Minute, max: 30 * time.Minute, wantErr: true},
+		{name: "no upper bound", value: 1000 * time.Hour, min: 0, max: 0},
+		{name: "negative without upper bound", value: -time.Second, min: 0, max: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDurationRange("duration", tt.value, tt.min, tt.max)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateIntRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   int
+		min     int
+		max     int
+		wantErr bool
+	}{
+		{name: "within range", value: 5, min: 1, max: 10},
+		{name: "at min", value: 1, min: 1, max: 10},
+		{name: "at max", value: 10, min: 1, max: 10},
+		{name: "below min", value: 0, min: 1, max: 10, wantErr: true},
+		{name: "above max", value: 11, min: 1, max: 10, wantErr: true},
+		{name: "no upper bound", value: 86400, min: 300, max: 0},
+		{name: "below min without upper bound", value: 299, min: 300, max: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIntRange("int", tt.value, tt.min, tt.max)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
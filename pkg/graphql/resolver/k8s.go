@@ -18,7 +18,7 @@ type K8sResolver struct {
 }
 
 func (r *K8sResolver) FetchURL(ctx context.Context, args struct{ URL string }) (*string, error) {
-	request, err := http.NewRequest("GET", args.URL, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", args.URL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +70,7 @@ func (r *K8sResolver) SelfSubjectAccessReview(ctx context.Context, args SSARArgs
 	}
 	buf := new(bytes.Buffer)
 	json.NewEncoder(buf).Encode(&spec)
-	request, err := http.NewRequest("POST", "/apis/"+auth.SchemeGroupVersion.String()+"/selfsubjectaccessreviews", buf)
+	request, err := http.NewRequestWithContext(ctx, "POST", "/apis/"+auth.SchemeGroupVersion.String()+"/selfsubjectaccessreviews", buf)
 	if err != nil {
 		return nil, err
 	}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
@@ -65,18 +66,10 @@ func ParsePluginProxyConfig(proxyConfig string) (*serverconfig.Proxy, error) {
 func GetPluginProxyServiceHandlers(proxyConfig *serverconfig.Proxy, defaultTLSConfig *tls.Config, pluginProxyEndpoint string) ([]*PluginsProxyServiceHandler, error) {
 	var proxyServiceHandlers []*PluginsProxyServiceHandler
 	for _, service := range proxyConfig.Services {
-		pluginProxyTLS := defaultTLSConfig.Clone()
-		// if case custom CA cert is defined use it instead of the default one
-		if len(service.CACertificate) != 0 {
-			customCA := x509.NewCertPool()
-			pluginProxyTLS = oscrypto.SecureTLSConfig(&tls.Config{
-				RootCAs: customCA,
-			})
-			if !pluginProxyTLS.RootCAs.AppendCertsFromPEM([]byte(service.CACertificate)) {
-				errMsg := fmt.Sprintf("Error parsing CA cert for %s service", service.Endpoint)
-				klog.Error(errMsg)
-				return nil, fmt.Errorf(errMsg)
-			}
+		pluginProxyTLS, err := getPluginProxyServiceTLSConfig(service, defaultTLSConfig)
+		if err != nil {
+			klog.Error(err)
+			return nil, err
 		}
 		serviceEndpoint, err := url.Parse(service.Endpoint)
 		if err != nil {
@@ -89,6 +82,45 @@ func GetPluginProxyServiceHandlers(proxyConfig *serverconfig.Proxy, defaultTLSCo
 	return proxyServiceHandlers, nil
 }
 
+// getPluginProxyServiceTLSConfig returns the TLS config for a proxied service,
+// which uses the CA of the service if one is configured.
+func getPluginProxyServiceTLSConfig(service serverconfig.ProxyService, defaultTLSConfig *tls.Config) (*tls.Config, error) {
+	if len(service.CACertificate) != 0 && len(service.CAFile) != 0 {
+		return nil, fmt.Errorf("Only one of caCertificate and caFile can be set for %s service", service.Endpoint)
+	}
+
+	if service.InsecureSkipVerify {
+		if len(service.CACertificate) != 0 || len(service.CAFile) != 0 {
+			return nil, fmt.Errorf("insecureSkipVerify can't be set together with a CA for %s service", service.Endpoint)
+		}
+		klog.Warningf("WARNING: TLS certificate verification is disabled for %s service. Requests to it, including user tokens if authorized, can be intercepted.", service.Endpoint)
+		pluginProxyTLS := defaultTLSConfig.Clone()
+		pluginProxyTLS.InsecureSkipVerify = true
+		return pluginProxyTLS, nil
+	}
+
+	caCertificate := []byte(service.CACertificate)
+	if len(service.CAFile) != 0 {
+		var err error
+		caCertificate, err = ioutil.ReadFile(service.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA file for %s service: %v", service.Endpoint, err)
+		}
+	}
+
+	// if case custom CA cert is defined use it instead of the default one
+	if len(caCertificate) == 0 {
+		return defaultTLSConfig.Clone(), nil
+	}
+	pluginProxyTLS := oscrypto.SecureTLSConfig(&tls.Config{
+		RootCAs: x509.NewCertPool(),
+	})
+	if !pluginProxyTLS.RootCAs.AppendCertsFromPEM(caCertificate) {
+		return nil, fmt.Errorf("Error parsing CA cert for %s service", service.Endpoint)
+	}
+	return pluginProxyTLS, nil
+}
+
 func (p *PluginsHandler) HandleI18nResources(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.Header().Set("Allow", "GET")
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Upper bounds so that a misconfigured allowlist can't turn the cache into a memory leak.
+	maxResponseCacheEntries   = 1024
+	maxResponseCacheEntrySize = 1 << 20
+)
+
+// responseCache is a short lived cache for GET responses of rarely changing
+// resources, like API discovery and CRDs. Entries are keyed per user so that
+// a response is never served to a user that didn't request it.
+type responseCache struct {
+	ttl     time.Duration
+	paths   []string
+	now     func() time.Time
+	mux     sync.Mutex
+	entries map[string]*cachedResponse
+}
+
+type cachedResponse struct {
+	path    string
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration, paths []string) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		paths:   paths,
+		now:     time.Now,
+		entries: make(map[string]*cachedResponse),
+	}
+}
+
+// cacheablePath returns true if the path is in the allowlist. Entries ending
+// with a slash match all paths below them, other entries have to match exactly.
+func (c *responseCache) cacheablePath(path string) bool {
+	for _, p := range c.paths {
+		if path == strings.TrimSuffix(p, "/") || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheableRequest checks that a request may be answered from the cache.
+// Watches are never cached. A request for a specific resourceVersion is only
+// cached when it asks for an exact match, otherwise the API server would be
+// expected to return data that is at least as new as the given version.
+func (c *responseCache) cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet || !c.cacheablePath(normalizePath(r.URL.Path)) {
+		return false
+	}
+
+	q := r.URL.Query()
+	if q.Get("watch") == "true" || q.Get("watch") == "1" {
+		return false
+	}
+
+	resourceVersion := q.Get("resourceVersion")
+	if resourceVersion != "" && resourceVersion != "0" && q.Get("resourceVersionMatch") != "Exact" {
+		return false
+	}
+
+	return true
+}
+
+// key identifies a response by the requesting user and the full request URL.
+func (c *responseCache) key(r *http.Request) string {
+	h := sha256.New()
+	for _, header := range []string{"Authorization", "Impersonate-User", "Impersonate-Group", "Accept"} {
+		for _, v := range r.Header.Values(header) {
+			h.Write([]byte(header + ":" + v + "\n"))
+		}
+	}
+	h.Write([]byte(normalizePath(r.URL.Path) + "?" + r.URL.RawQuery))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *responseCache) get(key string) *cachedResponse {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	entry := c.entries[key]
+	if entry == nil {
+		return nil
+	}
+	if c.now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (c *responseCache) set(key string, entry *cachedResponse) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	now := c.now()
+	if len(c.entries) >= maxResponseCacheEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= maxResponseCacheEntries {
+		return
+	}
+	entry.expires = now.Add(c.ttl)
+	c.entries[key] = entry
+}
+
+// invalidate drops the cached responses of all users for the given path, so
+// that a write through the proxy is visible to the next read.
+func (c *responseCache) invalidate(path string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for k, e := range c.entries {
+		if e.path == path || strings.HasPrefix(e.path, path+"/") || strings.HasPrefix(path, e.path+"/") {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// serve answers the request from the cache, or proxies it and stores a successful response.
+func (c *responseCache) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	path := normalizePath(r.URL.Path)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
+		c.invalidate(path)
+	}
+
+	if !c.cacheableRequest(r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	key := c.key(r)
+	if entry := c.get(key); entry != nil {
+		for k, v := range entry.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(entry.status)
+		w.Write(entry.body)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(recorder, r)
+	if recorder.status != http.StatusOK || recorder.overflow || recorder.header == nil {
+		return
+	}
+	c.set(key, &cachedResponse{
+		path:   path,
+		status: recorder.status,
+		header: recorder.header,
+		body:   recorder.body.Bytes(),
+	})
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	overflow    bool
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		r.status = status
+		r.header = r.ResponseWriter.Header().Clone()
+		r.header.Del("Set-Cookie")
+		// The audit ID belongs to the request that filled the cache.
+		r.header.Del(auditIDHeader)
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.overflow {
+		if r.body.Len()+len(b) > maxResponseCacheEntrySize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func normalizePath(path string) string {
+	return "/" + strings.Trim(path, "/")
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxyResponseCache(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("discovery"))
+	}))
+	defer backend.Close()
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(&Config{
+		Endpoint:           endpoint,
+		ResponseCacheTTL:   time.Minute,
+		ResponseCachePaths: []string{"/apis", "/apis/apiextensions.k8s.io/"},
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		wantHits int32
+	}{
+		{name: "first request is proxied", method: "GET", path: "apis", token: "user-a", wantHits: 1},
+		{name: "same user is served from cache", method: "GET", path: "apis", token: "user-a", wantHits: 1},
+		{name: "other user is proxied", method: "GET", path: "apis", token: "user-b", wantHits: 2},
+		{name: "prefix entry is cached", method: "GET", path: "apis/apiextensions.k8s.io/v1/customresourcedefinitions", token: "user-a", wantHits: 3},
+		{name: "prefix entry is served from cache", method: "GET", path: "apis/apiextensions.k8s.io/v1/customresourcedefinitions", token: "user-a", wantHits: 3},
+		{name: "path outside the allowlist is proxied", method: "GET", path: "api/v1/pods", token: "user-a", wantHits: 4},
+		{name: "path outside the allowlist is not cached", method: "GET", path: "api/v1/pods", token: "user-a", wantHits: 5},
+		{name: "watch is proxied", method: "GET", path: "apis?watch=true", token: "user-a", wantHits: 6},
+		{name: "not exact resourceVersion is proxied", method: "GET", path: "apis?resourceVersion=42", token: "user-a", wantHits: 7},
+		{name: "write is proxied", method: "POST", path: "apis/apiextensions.k8s.io/v1/customresourcedefinitions", token: "user-a", wantHits: 8},
+		{name: "write invalidates the cache", method: "GET", path: "apis/apiextensions.k8s.io/v1/customresourcedefinitions", token: "user-a", wantHits: 9},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://console.example.com/"+tt.path, nil)
+		r.URL.Path = tt.path
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		body, _ := ioutil.ReadAll(w.Result().Body)
+		if string(body) != "discovery" {
+			t.Errorf("%s: unexpected body %q", tt.name, string(body))
+		}
+		if got := atomic.LoadInt32(&hits); got != tt.wantHits {
+			t.Errorf("%s: expected %d backend requests, got %d", tt.name, tt.wantHits, got)
+		}
+	}
+}
+
+func TestProxyResponseCacheExpiry(t *testing.T) {
+	now := time.Now()
+	c := newResponseCache(time.Minute, []string{"/apis"})
+	c.now = func() time.Time { return now }
+
+	c.set("key", &cachedResponse{path: "/apis", status: http.StatusOK})
+	if c.get("key") == nil {
+		t.Fatal("expected cached response")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if c.get("key") != nil {
+		t.Error("expected cached response to expire")
+	}
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	oscrypto "github.com/openshift/library-go/pkg/crypto"
+)
+
+// WithClientCertificate returns a copy of tlsConfig that presents the client
+// certificate in certFile and keyFile to the backend. tlsConfig itself is left
+// unchanged, since it is usually shared with other clients of the same
+// backend. A nil tlsConfig is replaced with the secure defaults.
+func WithClientCertificate(tlsConfig *tls.Config, certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %v", err)
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = oscrypto.SecureTLSConfig(&tls.Config{})
+	}
+	withCert := tlsConfig.Clone()
+	withCert.Certificates = []tls.Certificate{cert}
+	return withCert, nil
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithClientCertificate(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	backend.StartTLS()
+	defer backend.Close()
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(backend.Certificate())
+	caConfig := &tls.Config{RootCAs: roots}
+
+	certFile, keyFile := writeClientCertificate(t, t.TempDir(), "console")
+	tlsConfig, err := WithClientCertificate(caConfig, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caConfig.Certificates) != 0 {
+		t.Error("expected the shared TLS config to be left unchanged")
+	}
+	if tlsConfig.RootCAs != roots {
+		t.Error("expected the CAs to be kept")
+	}
+
+	rr := httptest.NewRecorder()
+	NewProxy(&Config{Endpoint: endpoint, TLSClientConfig: tlsConfig}).ServeHTTP(rr, httptest.NewRequest("GET", "http://console.example.com/api", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "console" {
+		t.Errorf("expected the client certificate to be presented, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	NewProxy(&Config{Endpoint: endpoint, TLSClientConfig: caConfig}).ServeHTTP(rr, httptest.NewRequest("GET", "http://console.example.com/api", nil))
+	if rr.Code == http.StatusOK {
+		t.Error("expected the request to fail without a client certificate")
+	}
+
+	if _, err := WithClientCertificate(caConfig, certFile, certFile); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+	if _, err := WithClientCertificate(nil, filepath.Join(t.TempDir(), "missing.crt"), keyFile); err == nil {
+		t.Error("expected an error for a missing certificate")
+	}
+}
+
+// writeClientCertificate writes a self-signed certificate and its key to dir.
+func writeClientCertificate(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
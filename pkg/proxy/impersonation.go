@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Impersonation is the identity a proxied request is made on behalf of when
+// Config.SessionImpersonation is set.
+type Impersonation struct {
+	User   string
+	Groups []string
+}
+
+type impersonationKey struct{}
+
+// WithImpersonation returns a copy of ctx carrying the identity to impersonate
+// in requests proxied with Config.SessionImpersonation.
+func WithImpersonation(ctx context.Context, impersonation Impersonation) context.Context {
+	return context.WithValue(ctx, impersonationKey{}, impersonation)
+}
+
+func impersonationFrom(ctx context.Context) (Impersonation, bool) {
+	impersonation, ok := ctx.Value(impersonationKey{}).(Impersonation)
+	return impersonation, ok && impersonation.User != ""
+}
+
+// setImpersonationHeaders replaces any impersonation headers sent by the
+// client with the given identity, so that it cannot be spoofed.
+func setImpersonationHeaders(header http.Header, impersonation Impersonation) {
+	for name := range header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "Impersonate-") {
+			header.Del(name)
+		}
+	}
+	header.Set("Impersonate-User", impersonation.User)
+	for _, group := range impersonation.Groups {
+		header.Add("Impersonate-Group", group)
+	}
+}
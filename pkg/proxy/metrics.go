@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// proxyErrorCode is the code label of requests that got no response from the
+// backend.
+const proxyErrorCode = "error"
+
+// metricsMethods are the methods used as method label, others are "other".
+var metricsMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// Metrics records the latency and the status codes of the backend responses
+// of proxied requests. Labels are limited to the method and the status class,
+// paths aren't recorded.
+type Metrics struct {
+	requestDuration *prometheus.HistogramVec
+	responses       *prometheus.CounterVec
+}
+
+func (m *Metrics) GetCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.requestDuration,
+		m.responses,
+	}
+}
+
+func (m *Metrics) observe(method, code string, duration time.Duration) {
+	if !metricsMethods[method] {
+		method = "other"
+	}
+	m.requestDuration.WithLabelValues(method).Observe(duration.Seconds())
+	m.responses.WithLabelValues(method, code).Inc()
+}
+
+// statusClass returns the class of a status code like "2xx".
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return proxyErrorCode
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// metricsTransport records the proxied requests in metrics.
+type metricsTransport struct {
+	next    http.RoundTripper
+	metrics *Metrics
+	now     func() time.Time
+}
+
+func (t *metricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := t.now()
+	resp, err := t.next.RoundTrip(r)
+	code := proxyErrorCode
+	if err == nil {
+		code = statusClass(resp.StatusCode)
+	}
+	t.metrics.observe(r.Method, code, t.now().Sub(start))
+	return resp, err
+}
+
+func NewMetrics() *Metrics {
+	m := new(Metrics)
+
+	m.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "console",
+		Subsystem: "proxy",
+		Name:      "request_duration_seconds",
+		Help:      "Time until the backend responded to requests proxied to the Kubernetes API, including retries.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"method"})
+
+	m.responses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "console",
+		Subsystem: "proxy",
+		Name:      "responses_total",
+		Help:      "Total number of responses to requests proxied to the Kubernetes API, by method and status class. The code is \"error\" if the backend couldn't be reached.",
+	}, []string{"method", "code"})
+
+	return m
+}
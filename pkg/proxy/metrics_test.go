@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/openshift/console/pkg/metrics"
+)
+
+func TestProxyMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMetrics()
+	p := NewProxy(&Config{Endpoint: endpoint, Metrics: m})
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "http://console.example.com/api", nil),
+		httptest.NewRequest("GET", "http://console.example.com/api/missing", nil),
+		httptest.NewRequest("PROPFIND", "http://console.example.com/api", nil),
+	} {
+		p.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	got := metrics.RemoveComments(metrics.FormatMetrics(m.responses))
+	want := strings.Join([]string{
+		`console_proxy_responses_total{code="2xx",method="GET"} 1`,
+		`console_proxy_responses_total{code="2xx",method="other"} 1`,
+		`console_proxy_responses_total{code="4xx",method="GET"} 1`,
+	}, "\n")
+	if got != want {
+		t.Errorf("wrong responses metric, want:\n%s\ngot:\n%s", want, got)
+	}
+	if got := metrics.RemoveComments(metrics.FormatMetrics(m.requestDuration)); !strings.Contains(got, `console_proxy_request_duration_seconds_count{method="GET"} 2`) {
+		t.Errorf("expected 2 GET request durations, got:\n%s", got)
+	}
+
+	backend.Close()
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "http://console.example.com/api", nil))
+	if got := metrics.RemoveComments(metrics.FormatMetrics(m.responses)); !strings.Contains(got, `console_proxy_responses_total{code="error",method="DELETE"} 1`) {
+		t.Errorf("expected an unreachable backend to be counted as error, got:\n%s", got)
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for code, want := range map[int]string{200: "2xx", 304: "3xx", 404: "4xx", 503: "5xx", 0: "error", 999: "error"} {
+		if got := statusClass(code); got != want {
+			t.Errorf("statusClass(%d): want %q, got %q", code, want, got)
+		}
+	}
+}
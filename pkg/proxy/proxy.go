@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -20,17 +22,98 @@ import (
 var websocketPingInterval = 30 * time.Second
 var websocketTimeout = 30 * time.Second
 
+const (
+	// defaultFlushInterval is how often streamed responses are flushed to the client.
+	defaultFlushInterval = 100 * time.Millisecond
+	// auditIDHeader is set by the API server to the ID of the audit event of a request.
+	auditIDHeader = "Audit-Id"
+	// requestIDHeader is the correlation ID of the console request, if set by the client or a router in front of the console.
+	requestIDHeader = "X-Request-Id"
+)
+
 type Config struct {
 	HeaderBlacklist         []string
 	Endpoint                *url.URL
 	TLSClientConfig         *tls.Config
 	Origin                  string
 	UseProxyFromEnvironment bool
+
+	// ResponseCacheTTL enables a per-user cache of GET responses for the paths
+	// in ResponseCachePaths. Zero disables the cache.
+	ResponseCacheTTL   time.Duration
+	ResponseCachePaths []string
+
+	// ExposeAuditID relays the API server Audit-ID response header to the browser.
+	ExposeAuditID bool
+
+	// InjectHeaders are set on every proxied request, replacing headers of the
+	// same name sent by the client. See ValidateInjectHeader.
+	InjectHeaders map[string]string
+
+	// WebsocketIdleTimeout closes proxied websocket connections when no message
+	// was sent in either direction for this long. Zero disables the timeout.
+	WebsocketIdleTimeout time.Duration
+	// WebsocketHandshakeTimeout bounds the websocket handshake with the backend
+	// and the client. Defaults to 30 seconds.
+	WebsocketHandshakeTimeout time.Duration
+
+	// FlushInterval is how often streamed responses, like watches and followed
+	// logs, are flushed to the client. A negative value flushes after every
+	// write. Defaults to 100 milliseconds.
+	FlushInterval time.Duration
+
+	// RequestTimeout bounds proxied requests, which are answered with 504 when
+	// it is exceeded. Websockets, watches, followed logs and other upgraded
+	// connections are not bounded. Zero disables the timeout.
+	RequestTimeout time.Duration
+
+	// TransientErrorRetries is how many times GET and HEAD requests are retried
+	// when the API server responds with a Status reason like Timeout or
+	// ServerTimeout, which is likely to succeed later. Zero disables retries.
+	TransientErrorRetries int
+
+	// MaxRetries is how many times GET and HEAD requests are retried when the
+	// backend responds with 502, 503 or 504, waiting RetryBackoff before the
+	// first retry and twice as long before each further one, at most 5
+	// seconds. Watches and followed logs aren't retried. Zero disables retries.
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout configure the
+	// connection pool of the transport to the backend, see http.Transport.
+	// Zero values keep the defaults of http.Transport.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// SessionImpersonation impersonates the identity set with WithImpersonation
+	// in every proxied request and ignores impersonation requested by the client.
+	// Requests without an identity are rejected.
+	SessionImpersonation bool
+
+	// Metrics records the backend latency and status codes of proxied
+	// requests, except websockets and cached responses. Nil disables them.
+	Metrics *Metrics
+}
+
+func (c *Config) websocketHandshakeTimeout() time.Duration {
+	if c.WebsocketHandshakeTimeout == 0 {
+		return websocketTimeout
+	}
+	return c.WebsocketHandshakeTimeout
+}
+
+func (c *Config) flushInterval() time.Duration {
+	if c.FlushInterval == 0 {
+		return defaultFlushInterval
+	}
+	return c.FlushInterval
 }
 
 type Proxy struct {
 	reverseProxy *httputil.ReverseProxy
 	config       *Config
+	cache        *responseCache
 }
 
 // These headers aren't things that proxies should pass along. Some are forbidden by http2.
@@ -64,21 +147,81 @@ func NewProxy(cfg *Config) *Proxy {
 		}).Dial,
 		TLSClientConfig:     cfg.TLSClientConfig,
 		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
 	}
 
 	reverseProxy := httputil.NewSingleHostReverseProxy(cfg.Endpoint)
-	reverseProxy.FlushInterval = time.Millisecond * 100
+	reverseProxy.FlushInterval = cfg.flushInterval()
 	reverseProxy.Transport = transport
-	reverseProxy.ModifyResponse = FilterHeaders
+	if cfg.TransientErrorRetries > 0 || cfg.MaxRetries > 0 {
+		reverseProxy.Transport = &retryTransport{
+			next:          transport,
+			retries:       cfg.TransientErrorRetries,
+			statusRetries: cfg.MaxRetries,
+			backoff:       cfg.RetryBackoff,
+		}
+	}
+	if cfg.Metrics != nil {
+		reverseProxy.Transport = &metricsTransport{next: reverseProxy.Transport, metrics: cfg.Metrics, now: time.Now}
+	}
 
 	proxy := &Proxy{
 		reverseProxy: reverseProxy,
 		config:       cfg,
 	}
 
+	reverseProxy.ModifyResponse = func(r *http.Response) error {
+		proxy.handleAuditID(r)
+		return FilterHeaders(r)
+	}
+	reverseProxy.ErrorHandler = proxy.handleError
+
+	if cfg.ResponseCacheTTL > 0 && len(cfg.ResponseCachePaths) > 0 {
+		proxy.cache = newResponseCache(cfg.ResponseCacheTTL, cfg.ResponseCachePaths)
+	}
+
 	return proxy
 }
 
+// handleAuditID logs the API server audit ID of a response along with the
+// request ID, so that a console request can be found in the audit log. The
+// header is only passed on to the browser when ExposeAuditID is set.
+func (p *Proxy) handleAuditID(r *http.Response) {
+	auditID := r.Header.Get(auditIDHeader)
+	if auditID == "" {
+		return
+	}
+
+	if klog.V(3) && r.Request != nil {
+		klog.Infof("PROXY: %s %#q audit-id=%s request-id=%s\n", r.Request.Method, r.Request.URL.Path, auditID, r.Request.Header.Get(requestIDHeader))
+	}
+
+	if !p.config.ExposeAuditID {
+		r.Header.Del(auditIDHeader)
+	}
+}
+
+// handleError answers requests that could not be proxied. Requests that
+// exceeded RequestTimeout get a 504, everything else a 502 like the default
+// handler of httputil.ReverseProxy.
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if p.config.RequestTimeout > 0 && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		klog.Warningf("PROXY: %s %#q timed out after %s", r.Method, r.URL.Path, p.config.RequestTimeout)
+		http.Error(w, fmt.Sprintf("The request to the backend timed out after %s.", p.config.RequestTimeout), http.StatusGatewayTimeout)
+		return
+	}
+	log.Printf("http: proxy error: %v", err)
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+// hasRequestTimeout returns true if RequestTimeout applies to r. Streams are
+// expected to stay open for long.
+func hasRequestTimeout(r *http.Request) bool {
+	return r.Header.Get("Upgrade") == "" && !IsStreamingRequest(r)
+}
+
 func SingleJoiningSlash(a, b string) string {
 	aslash := strings.HasSuffix(a, "/")
 	bslash := strings.HasPrefix(b, "/")
@@ -100,8 +243,32 @@ func decodeSubprotocol(encodedProtocol string) (string, error) {
 	return string(decodedProtocol), err
 }
 
+// HeaderBlacklist are the client headers the proxy removes, they carry the
+// console session. All other client headers, like Accept-Language or custom
+// headers of extension API servers, are forwarded to the backend.
 var HeaderBlacklist = []string{"Cookie", "X-CSRFToken"}
 
+// forbiddenInjectHeaders carry credentials or the identity of the user and
+// must not be set by InjectHeaders.
+var forbiddenInjectHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-CSRFToken"}
+
+// ValidateInjectHeader returns an error if name is not allowed in Config.InjectHeaders.
+func ValidateInjectHeader(name string) error {
+	name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	if name == "" {
+		return fmt.Errorf("header name must not be empty")
+	}
+	if strings.HasPrefix(name, "Impersonate-") {
+		return fmt.Errorf("header %q must not be injected", name)
+	}
+	for _, h := range forbiddenInjectHeaders {
+		if name == http.CanonicalHeaderKey(h) {
+			return fmt.Errorf("header %q must not be injected", name)
+		}
+	}
+	return nil
+}
+
 // pass through headers that are needed for browser caching and content negotiation,
 // except "Cookie" and "X-CSRFToken" headers.
 func CopyRequestHeaders(originalRequest, newRequest *http.Request) {
@@ -136,17 +303,39 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.Header.Del(h)
 	}
 
+	if p.config.SessionImpersonation {
+		impersonation, ok := impersonationFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		setImpersonationHeaders(r.Header, impersonation)
+	}
+
 	// Include `system:authenticated` when impersonating groups so that basic requests that all
 	// users can run like self-subject access reviews work.
 	if len(r.Header["Impersonate-Group"]) > 0 {
 		r.Header.Add("Impersonate-Group", "system:authenticated")
 	}
 
+	for name, value := range p.config.InjectHeaders {
+		r.Header.Set(name, value)
+	}
+
 	r.Host = p.config.Endpoint.Host
 	r.URL.Host = p.config.Endpoint.Host
 	r.URL.Scheme = p.config.Endpoint.Scheme
 
 	if !isWebsocket {
+		if p.config.RequestTimeout > 0 && hasRequestTimeout(r) {
+			ctx, cancel := context.WithTimeout(r.Context(), p.config.RequestTimeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		if p.cache != nil {
+			p.cache.serve(w, r, p.reverseProxy)
+			return
+		}
 		p.reverseProxy.ServeHTTP(w, r)
 		return
 	}
@@ -202,6 +391,13 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if p.config.SessionImpersonation {
+		// The subprotocols above may carry impersonation requested by the client.
+		for _, name := range []string{"Impersonate-User", "Impersonate-Group"} {
+			proxiedHeader[name] = r.Header.Values(name)
+		}
+	}
+
 	// Filter websocket headers.
 	websocketHeaders := []string{
 		"Connection",
@@ -220,7 +416,8 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	proxiedHeader.Add("Origin", "http://localhost")
 
 	dialer := &websocket.Dialer{
-		TLSClientConfig: p.config.TLSClientConfig,
+		TLSClientConfig:  p.config.TLSClientConfig,
+		HandshakeTimeout: p.config.websocketHandshakeTimeout(),
 	}
 	if p.config.UseProxyFromEnvironment == true {
 		dialer.Proxy = http.ProxyFromEnvironment
@@ -246,7 +443,8 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer backend.Close()
 
 	upgrader := &websocket.Upgrader{
-		Subprotocols: []string{subProtocol},
+		Subprotocols:     []string{subProtocol},
+		HandshakeTimeout: p.config.websocketHandshakeTimeout(),
 		CheckOrigin: func(r *http.Request) bool {
 			origin := r.Header["Origin"]
 			if p.config.Origin == "" {
@@ -279,15 +477,47 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	errc := make(chan error, 2)
+	activity := make(chan struct{}, 1)
 
 	// Can't just use io.Copy here since browsers care about frame headers.
-	go func() { errc <- copyMsgs(nil, frontend, backend) }()
-	go func() { errc <- copyMsgs(&writeMutex, backend, frontend) }()
+	go func() { errc <- copyMsgs(nil, frontend, backend, activity) }()
+	go func() { errc <- copyMsgs(&writeMutex, backend, frontend, activity) }()
+
+	var idleTimer *time.Timer
+	var idleTimeout <-chan time.Time
+	var messages <-chan struct{}
+	lastMessage := time.Now()
+	if p.config.WebsocketIdleTimeout > 0 {
+		idleTimer = time.NewTimer(p.config.WebsocketIdleTimeout)
+		defer idleTimer.Stop()
+		idleTimeout = idleTimer.C
+		messages = activity
+	}
 
 	for {
 		select {
-		case <-errc:
+		case err := <-errc:
 			// Only wait for a single error and let the defers close both connections.
+			writeMutex.Lock()
+			frontend.WriteControl(websocket.CloseMessage, closeMessage(err), time.Now().Add(websocketTimeout))
+			writeMutex.Unlock()
+			return
+		case <-r.Context().Done():
+			writeMutex.Lock()
+			frontend.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(websocketTimeout))
+			writeMutex.Unlock()
+			return
+		case <-messages:
+			lastMessage = time.Now()
+		case <-idleTimeout:
+			if idle := time.Since(lastMessage); idle < p.config.WebsocketIdleTimeout {
+				idleTimer.Reset(p.config.WebsocketIdleTimeout - idle)
+				continue
+			}
+			klog.V(4).Infof("closing websocket to %s after %s without messages", r.URL.Path, p.config.WebsocketIdleTimeout)
+			writeMutex.Lock()
+			frontend.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "idle timeout"), time.Now().Add(websocketTimeout))
+			writeMutex.Unlock()
 			return
 		case <-ticker.C:
 			writeMutex.Lock()
@@ -301,13 +531,35 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func copyMsgs(writeMutex *sync.Mutex, dest, src *websocket.Conn) error {
+// closeMessage returns the close message sent to the client when either side
+// of a proxied websocket fails. Close codes of the backend are relayed, codes
+// which must not be sent in a close frame are replaced by 1001 (going away).
+func closeMessage(err error) []byte {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure, websocket.CloseTLSHandshake:
+		default:
+			return websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)
+		}
+	}
+	return websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+}
+
+// copyMsgs copies messages from src to dest until either fails, signaling
+// activity without blocking after each message.
+func copyMsgs(writeMutex *sync.Mutex, dest, src *websocket.Conn, activity chan<- struct{}) error {
 	for {
 		messageType, msg, err := src.ReadMessage()
 		if err != nil {
 			return err
 		}
 
+		select {
+		case activity <- struct{}{}:
+		default:
+		}
+
 		if writeMutex == nil {
 			err = dest.WriteMessage(messageType, msg)
 		} else {
@@ -1,12 +1,14 @@
 package proxy
 
 import (
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -63,6 +65,177 @@ func TestProxyHTTP(t *testing.T) {
 
 }
 
+func TestProxyAuditID(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Audit-ID", "4c8b2f9e")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expose := range []bool{false, true} {
+		p := NewProxy(&Config{Endpoint: endpoint, ExposeAuditID: expose})
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "http://console.example.com/api", nil))
+
+		got := w.Result().Header.Get("Audit-ID")
+		if expose && got != "4c8b2f9e" {
+			t.Errorf("expected the audit ID to be exposed, got %q", got)
+		}
+		if !expose && got != "" {
+			t.Errorf("expected the audit ID to be removed, got %q", got)
+		}
+	}
+}
+
+func TestProxyInjectHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProxy(&Config{
+		Endpoint: endpoint,
+		InjectHeaders: map[string]string{
+			"X-Forwarded-Client-Cert": "By=spiffe://cluster.local/ns/console/sa/console",
+			"X-Tenant":                "acme",
+		},
+	})
+	req := httptest.NewRequest("GET", "http://console.example.com/api", nil)
+	req.Header.Set("X-Tenant", "spoofed")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	if v := got.Get("X-Forwarded-Client-Cert"); v != "By=spiffe://cluster.local/ns/console/sa/console" {
+		t.Errorf("expected the client cert header to be injected, got %q", v)
+	}
+	if v := got.Values("X-Tenant"); len(v) != 1 || v[0] != "acme" {
+		t.Errorf("expected the tenant header to replace the client value, got %q", v)
+	}
+}
+
+func TestProxyClientHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProxy(&Config{Endpoint: endpoint})
+	req := httptest.NewRequest("GET", "http://console.example.com/api", nil)
+	req.Header.Set("Accept-Language", "de-DE")
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("Cookie", "openshift-session-token=secret")
+	req.Header.Set("X-CSRFToken", "csrf")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	for name, want := range map[string]string{"Accept-Language": "de-DE", "X-Tenant": "acme", "Cookie": "", "X-CSRFToken": ""} {
+		if v := got.Get(name); v != want {
+			t.Errorf("wrong %s header at the backend, want %q, got %q", name, want, v)
+		}
+	}
+}
+
+func TestProxySessionImpersonation(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProxy(&Config{Endpoint: endpoint, SessionImpersonation: true})
+
+	req := httptest.NewRequest("GET", "http://console.example.com/api", nil)
+	req.Header.Set("Impersonate-User", "system:admin")
+	req.Header.Set("Impersonate-Extra-Scopes", "admin")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a request without a session identity to be rejected, got %d", w.Code)
+	}
+
+	req = req.WithContext(WithImpersonation(req.Context(), Impersonation{User: "penny", Groups: []string{"developers"}}))
+	p.ServeHTTP(httptest.NewRecorder(), req)
+	if v := got.Values("Impersonate-User"); len(v) != 1 || v[0] != "penny" {
+		t.Errorf("expected the session user to replace the client value, got %q", v)
+	}
+	if v := got.Values("Impersonate-Group"); len(v) != 2 || v[0] != "developers" || v[1] != "system:authenticated" {
+		t.Errorf("expected the session groups, got %q", v)
+	}
+	if v := got.Get("Impersonate-Extra-Scopes"); v != "" {
+		t.Errorf("expected client impersonation headers to be removed, got %q", v)
+	}
+}
+
+func TestProxyConnectionPool(t *testing.T) {
+	backendURL, _ := url.Parse("https://api.example.com:6443")
+	for _, retries := range []int{0, 2} {
+		p := NewProxy(&Config{
+			Endpoint:              backendURL,
+			MaxIdleConns:          200,
+			MaxIdleConnsPerHost:   50,
+			IdleConnTimeout:       90 * time.Second,
+			TransientErrorRetries: retries,
+		})
+
+		rt := p.reverseProxy.Transport
+		if retry, ok := rt.(*retryTransport); ok {
+			rt = retry.next
+		}
+		transport := rt.(*http.Transport)
+		if transport.MaxIdleConns != 200 || transport.MaxIdleConnsPerHost != 50 || transport.IdleConnTimeout != 90*time.Second {
+			t.Errorf("connection pool settings not applied with %d retries: %d, %d, %s", retries, transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+		}
+	}
+}
+
+func TestValidateInjectHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "X-Tenant"},
+		{name: "x-forwarded-client-cert"},
+		{name: "", wantErr: true},
+		{name: "Authorization", wantErr: true},
+		{name: "authorization", wantErr: true},
+		{name: "Proxy-Authorization", wantErr: true},
+		{name: "Cookie", wantErr: true},
+		{name: "Impersonate-User", wantErr: true},
+		{name: "impersonate-group", wantErr: true},
+		{name: "Impersonate-Extra-Scopes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateInjectHeader(tt.name)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%q: expected error: %v, got: %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
 func TestProxyDecodeSubprotocol(t *testing.T) {
 	tests := []struct {
 		encoded string
@@ -175,3 +348,163 @@ func toWSScheme(url_ string) string {
 	parsed.Scheme = "ws"
 	return parsed.String()
 }
+
+func TestProxyWebsocketIdleTimeout(t *testing.T) {
+	backend := httptest.NewServer(websocketServer(t, func(ws *websocket.Conn) {
+		// Keep the connection open without sending anything until the proxy closes it.
+		readStringFromWS(ws)
+	}))
+	defer backend.Close()
+
+	ws, closer := dialProxyWebsocket(t, backend.URL, &Config{WebsocketIdleTimeout: 100 * time.Millisecond})
+	defer closer()
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := readStringFromWS(ws)
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected the idle websocket to be closed with %d, got: %v", websocket.CloseGoingAway, err)
+	}
+}
+
+func TestProxyWebsocketBackendClosed(t *testing.T) {
+	backend := httptest.NewServer(websocketServer(t, func(ws *websocket.Conn) {
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "backend gone"))
+		ws.Close()
+	}))
+	defer backend.Close()
+
+	ws, closer := dialProxyWebsocket(t, backend.URL, &Config{})
+	defer closer()
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := readStringFromWS(ws)
+	if !websocket.IsCloseError(err, websocket.CloseInternalServerErr) {
+		t.Errorf("expected the backend close code %d to be relayed, got: %v", websocket.CloseInternalServerErr, err)
+	}
+}
+
+// websocketServer upgrades requests and passes the connection to handle.
+func websocketServer(t *testing.T, handle func(ws *websocket.Conn)) http.HandlerFunc {
+	upgrader := &websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade websocket to client: '%v'", err)
+			return
+		}
+		defer ws.Close()
+		handle(ws)
+	}
+}
+
+// dialProxyWebsocket opens a websocket through a proxy to backendURL using config.
+func dialProxyWebsocket(t *testing.T, backendURL string, config *Config) (*websocket.Conn, func()) {
+	t.Helper()
+	targetURL, err := url.Parse(backendURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Endpoint = targetURL
+	proxyServer := httptest.NewServer(NewProxy(config))
+
+	headers := http.Header{}
+	headers.Add("Origin", "http://localhost")
+	ws, _, err := websocket.DefaultDialer.Dial(toWSScheme(proxyServer.URL)+"/", headers)
+	if err != nil {
+		proxyServer.Close()
+		t.Fatalf("error connecting to the proxy as websocket: %v", err)
+	}
+	return ws, func() {
+		ws.Close()
+		proxyServer.Close()
+	}
+}
+
+func TestProxyStreamsResponses(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(NewProxy(&Config{Endpoint: endpoint, FlushInterval: 10 * time.Millisecond}))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/api/v1/namespaces/default/pods/console/log?follow=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The backend only sends the rest of the response once the first line
+	// reached the client.
+	line := make(chan string, 1)
+	go func() {
+		b := make([]byte, len("first\n"))
+		n, _ := io.ReadFull(resp.Body, b)
+		line <- string(b[:n])
+	}()
+
+	select {
+	case got := <-line:
+		if got != "first\n" {
+			t.Errorf("expected the first line, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first line of the response was not streamed to the client")
+	}
+}
+
+func TestProxyRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(200 * time.Millisecond):
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := NewProxy(&Config{Endpoint: endpoint, RequestTimeout: 50 * time.Millisecond})
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "http://console.example.com/api/v1/pods", nil))
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected %d for a slow request, got %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "timed out after 50ms") {
+		t.Errorf("expected the timeout in the response, got %q", rr.Body.String())
+	}
+
+	for _, path := range []string{"/api/v1/pods?watch=true", "/api/v1/namespaces/default/pods/console/log?follow=1"} {
+		rr = httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "http://console.example.com"+path, nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+			t.Errorf("expected %s to be excluded from the timeout, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	backend.Close()
+	rr = httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "http://console.example.com/api/v1/pods", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("expected %d for an unreachable backend, got %d", http.StatusBadGateway, rr.Code)
+	}
+}
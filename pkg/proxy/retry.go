@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// maxRetryStatusSize limits how much of an error response is read to find its
+// Status reason, the API server error responses are small.
+const maxRetryStatusSize = 64 * 1024
+
+var transientErrorRetryDelay = 200 * time.Millisecond
+
+// maxTransientErrorRetryDelay is the longest a request is held back for a
+// retry, responses asking to wait longer are passed on to the client.
+const maxTransientErrorRetryDelay = 5 * time.Second
+
+// transientStatusReasons are the Status reasons of API server errors that are
+// likely to succeed when retried.
+var transientStatusReasons = map[metav1.StatusReason]bool{
+	metav1.StatusReasonTimeout:         true,
+	metav1.StatusReasonServerTimeout:   true,
+	metav1.StatusReasonTooManyRequests: true,
+}
+
+// retryStatusCodes are the status codes of responses of a proxy or load
+// balancer in front of the API server, which are likely to succeed later.
+var retryStatusCodes = map[int]bool{
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// retryTransport retries idempotent requests when the response body is a
+// Status with a transient reason, or when the response has one of
+// retryStatusCodes.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+
+	// statusRetries is how many times requests with one of retryStatusCodes
+	// are retried, waiting backoff before the first retry and twice as long
+	// before each further one.
+	statusRetries int
+	backoff       time.Duration
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Only requests without a body can be sent again as is.
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || (r.Body != nil && r.Body != http.NoBody) {
+		return t.next.RoundTrip(r)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(r)
+		if err != nil {
+			return resp, err
+		}
+
+		delay, reason := t.retryDelay(r, resp, attempt)
+		if reason == "" {
+			return resp, nil
+		}
+		if deadline, ok := r.Context().Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		klog.V(4).Infof("PROXY: retrying %s %#q in %s after %s response", r.Method, r.URL.Path, delay, reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, r.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retrying the request after resp,
+// and why. The reason is empty if the request shouldn't be retried.
+func (t *retryTransport) retryDelay(r *http.Request, resp *http.Response, attempt int) (time.Duration, string) {
+	if attempt <= t.retries {
+		if reason, retryAfter := transientStatus(resp); reason != "" {
+			delay := time.Duration(attempt) * transientErrorRetryDelay
+			if retryAfter > delay {
+				delay = retryAfter
+			}
+			if delay > maxTransientErrorRetryDelay {
+				return 0, ""
+			}
+			return delay, string(reason)
+		}
+	}
+
+	if attempt <= t.statusRetries && retryStatusCodes[resp.StatusCode] && !IsStreamingRequest(r) {
+		delay := t.backoff << (attempt - 1)
+		if delay > maxTransientErrorRetryDelay || delay < 0 {
+			delay = maxTransientErrorRetryDelay
+		}
+		return delay, strconv.Itoa(resp.StatusCode)
+	}
+	return 0, ""
+}
+
+// IsStreamingRequest returns true for watches and followed logs, which are
+// left to the client to restart.
+func IsStreamingRequest(r *http.Request) bool {
+	if strings.Contains(r.URL.Path, "/watch/") {
+		return true
+	}
+	q := r.URL.Query()
+	for _, param := range []string{"watch", "follow"} {
+		if streaming, _ := strconv.ParseBool(q.Get(param)); streaming {
+			return true
+		}
+	}
+	return false
+}
+
+// transientStatus returns the reason and the suggested retry delay if resp is
+// an error Status with a transient reason. Otherwise the body of resp is left
+// readable from the start.
+func transientStatus(resp *http.Response) (metav1.StatusReason, time.Duration) {
+	if resp.StatusCode < http.StatusBadRequest || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return "", 0
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRetryStatusSize))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	if err != nil {
+		return "", 0
+	}
+
+	var status metav1.Status
+	if err := json.Unmarshal(body, &status); err != nil || status.Kind != "Status" || !transientStatusReasons[status.Reason] {
+		return "", 0
+	}
+
+	var retryAfter time.Duration
+	if status.Details != nil {
+		retryAfter = time.Duration(status.Details.RetryAfterSeconds) * time.Second
+	}
+	return status.Reason, retryAfter
+}
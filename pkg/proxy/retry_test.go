@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestProxyTransientErrorRetries(t *testing.T) {
+	defer func(delay time.Duration) { transientErrorRetryDelay = delay }(transientErrorRetryDelay)
+	transientErrorRetryDelay = 0
+
+	tests := []struct {
+		name         string
+		method       string
+		status       string
+		retries      int
+		wantRequests int
+		wantCode     int
+	}{
+		{name: "disabled", method: "GET", status: `{"kind":"Status","reason":"Timeout","code":504}`, retries: 0, wantRequests: 1, wantCode: http.StatusGatewayTimeout},
+		{name: "timeout", method: "GET", status: `{"kind":"Status","reason":"Timeout","code":504}`, retries: 2, wantRequests: 2, wantCode: http.StatusOK},
+		{name: "server timeout", method: "GET", status: `{"kind":"Status","reason":"ServerTimeout","code":504}`, retries: 2, wantRequests: 2, wantCode: http.StatusOK},
+		{name: "not found", method: "GET", status: `{"kind":"Status","reason":"NotFound","code":404}`, retries: 2, wantRequests: 1, wantCode: http.StatusGatewayTimeout},
+		{name: "not idempotent", method: "DELETE", status: `{"kind":"Status","reason":"Timeout","code":504}`, retries: 2, wantRequests: 1, wantCode: http.StatusGatewayTimeout},
+		{name: "retry-after too long", method: "GET", status: `{"kind":"Status","reason":"TooManyRequests","code":429,"details":{"retryAfterSeconds":60}}`, retries: 2, wantRequests: 1, wantCode: http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusGatewayTimeout)
+					w.Write([]byte(tt.status))
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer backend.Close()
+
+			endpoint, err := url.Parse(backend.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := NewProxy(&Config{Endpoint: endpoint, TransientErrorRetries: tt.retries})
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, httptest.NewRequest(tt.method, "http://console.example.com/api/v1/pods", nil))
+
+			if requests != tt.wantRequests {
+				t.Errorf("expected %d requests, got %d", tt.wantRequests, requests)
+			}
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, w.Code)
+			}
+			if body, _ := ioutil.ReadAll(w.Result().Body); w.Code != http.StatusOK && string(body) != tt.status {
+				t.Errorf("expected the error response to be passed on, got %q", body)
+			}
+		})
+	}
+}
+
+func TestProxyStatusRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		failures     int
+		retries      int
+		backoff      time.Duration
+		timeout      time.Duration
+		wantRequests int
+		wantCode     int
+	}{
+		{name: "disabled", method: "GET", path: "/api/v1/pods", failures: 1, retries: 0, wantRequests: 1, wantCode: http.StatusServiceUnavailable},
+		{name: "retried then succeeds", method: "GET", path: "/api/v1/pods", failures: 2, retries: 3, wantRequests: 3, wantCode: http.StatusOK},
+		{name: "head", method: "HEAD", path: "/api/v1/pods", failures: 1, retries: 1, wantRequests: 2, wantCode: http.StatusOK},
+		{name: "retries exhausted", method: "GET", path: "/api/v1/pods", failures: 5, retries: 2, wantRequests: 3, wantCode: http.StatusServiceUnavailable},
+		{name: "not idempotent", method: "POST", path: "/api/v1/pods", failures: 1, retries: 2, wantRequests: 1, wantCode: http.StatusServiceUnavailable},
+		{name: "watch", method: "GET", path: "/api/v1/pods?watch=true", failures: 1, retries: 2, wantRequests: 1, wantCode: http.StatusServiceUnavailable},
+		{name: "followed logs", method: "GET", path: "/api/v1/namespaces/default/pods/web/log?follow=1", failures: 1, retries: 2, wantRequests: 1, wantCode: http.StatusServiceUnavailable},
+		{name: "beyond the deadline", method: "GET", path: "/api/v1/pods", failures: 1, retries: 2, backoff: time.Second, timeout: 100 * time.Millisecond, wantRequests: 1, wantCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer backend.Close()
+
+			endpoint, err := url.Parse(backend.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := NewProxy(&Config{Endpoint: endpoint, MaxRetries: tt.retries, RetryBackoff: tt.backoff})
+			r := httptest.NewRequest(tt.method, "http://console.example.com"+tt.path, nil)
+			if tt.timeout > 0 {
+				ctx, cancel := context.WithTimeout(r.Context(), tt.timeout)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, r)
+
+			if requests != tt.wantRequests {
+				t.Errorf("expected %d requests, got %d", tt.wantRequests, requests)
+			}
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
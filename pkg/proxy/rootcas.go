@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	oscrypto "github.com/openshift/library-go/pkg/crypto"
+)
+
+// WithAdditionalCAs returns a copy of tlsConfig that also trusts the PEM CA
+// certificates in caFile, in addition to its RootCAs, or the system roots if
+// it has none. tlsConfig and its pool are left unchanged, since they are
+// usually shared with other clients of the same backend. A nil tlsConfig is
+// replaced with the secure defaults.
+func WithAdditionalCAs(tlsConfig *tls.Config, caFile string) (*tls.Config, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read additional CAs: %v", err)
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = oscrypto.SecureTLSConfig(&tls.Config{})
+	}
+	var roots *x509.CertPool
+	if tlsConfig.RootCAs != nil {
+		roots = tlsConfig.RootCAs.Clone()
+	} else if roots, err = x509.SystemCertPool(); err != nil {
+		return nil, fmt.Errorf("failed to load the system roots: %v", err)
+	}
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", caFile)
+	}
+
+	withCAs := tlsConfig.Clone()
+	withCAs.RootCAs = roots
+	return withCAs, nil
+}
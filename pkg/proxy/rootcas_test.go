@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithAdditionalCAs(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	endpoint, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pool of the API server CA doesn't trust the backend.
+	apiServerCertFile, _ := writeClientCertificate(t, t.TempDir(), "kube-apiserver")
+	apiServerPEM, err := os.ReadFile(apiServerCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(apiServerPEM)
+	caConfig := &tls.Config{RootCAs: roots}
+
+	caFile := filepath.Join(t.TempDir(), "additional-ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := WithAdditionalCAs(caConfig, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caConfig.RootCAs != roots || roots.Equal(tlsConfig.RootCAs) {
+		t.Error("expected the shared TLS config and its pool to be left unchanged")
+	}
+	want := roots.Clone()
+	want.AddCert(backend.Certificate())
+	if !tlsConfig.RootCAs.Equal(want) {
+		t.Error("expected the root pool to contain the existing and the additional CAs")
+	}
+
+	rr := httptest.NewRecorder()
+	NewProxy(&Config{Endpoint: endpoint, TLSClientConfig: tlsConfig}).ServeHTTP(rr, httptest.NewRequest("GET", "http://console.example.com/api", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+		t.Errorf("expected the backend to be trusted with the additional CA, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	NewProxy(&Config{Endpoint: endpoint, TLSClientConfig: caConfig}).ServeHTTP(rr, httptest.NewRequest("GET", "http://console.example.com/api", nil))
+	if rr.Code == http.StatusOK {
+		t.Error("expected the backend not to be trusted without the additional CA")
+	}
+
+	if _, err := WithAdditionalCAs(caConfig, filepath.Join(t.TempDir(), "missing.crt")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	notPEM := filepath.Join(t.TempDir(), "not-pem.crt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WithAdditionalCAs(caConfig, notPEM); err == nil {
+		t.Error("expected an error for a file without certificates")
+	}
+}
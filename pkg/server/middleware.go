@@ -4,13 +4,23 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
 	"github.com/openshift/console/pkg/serverutils"
 
 	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
 
 	"k8s.io/klog"
 )
@@ -41,6 +51,17 @@ func authMiddlewareWithUser(authenticator *auth.Authenticator, h HandlerWithUser
 	})
 }
 
+// userImpersonation is the identity impersonated on behalf of u when the
+// Kubernetes API proxy uses session impersonation. The username is the one
+// the API server assigns to the user, see auth.KubernetesUsername.
+func (s *Server) userImpersonation(u *auth.User) (proxy.Impersonation, error) {
+	username, err := auth.KubernetesUsername(u, s.ImpersonationUsernameClaim, s.ImpersonationUsernamePrefix)
+	if err != nil {
+		return proxy.Impersonation{}, err
+	}
+	return proxy.Impersonation{User: username, Groups: u.Groups}, nil
+}
+
 func verifyCSRF(authenticator *auth.Authenticator, h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		safe := false
@@ -123,7 +144,159 @@ func gzipHandler(h http.Handler) http.HandlerFunc {
 	}
 }
 
-func securityHeadersMiddleware(hdlr http.Handler) http.HandlerFunc {
+// compressibleContentTypes are the content type prefixes of responses that
+// compressionMiddleware compresses. Other content, like images, is usually
+// compressed already.
+var compressibleContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/yaml",
+	"image/svg+xml",
+}
+
+// compressionMiddleware gzips responses of a compressible content type and of
+// at least minSize bytes for clients accepting gzip. Up to minSize bytes of a
+// response are buffered to decide. Responses flushed before that, like
+// streamed watches, are passed on uncompressed, and compressed responses are
+// flushed through the compressor, so that streams aren't held back.
+func compressionMiddleware(minSize int, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Header.Get("Upgrade") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressResponseWriter{ResponseWriter: w, minSize: minSize}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	}
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     []byte
+	started bool
+	gz      *gzip.Writer
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.started || w.status != 0 {
+		return
+	}
+	w.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.start(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		if !w.compressible() {
+			if err := w.start(false); err != nil {
+				return 0, err
+			}
+		} else {
+			w.buf = append(w.buf, b...)
+			if len(w.buf) < w.minSize {
+				return len(b), nil
+			}
+			return len(b), w.start(true)
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressResponseWriter) Flush() {
+	if !w.started {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// compressible checks the response headers set by the handler.
+func (w *compressResponseWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < w.minSize {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, prefix := range compressibleContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// start writes the response header and the buffered part of the body.
+func (w *compressResponseWriter) start(compress bool) error {
+	w.started = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// close writes what the handler left buffered, which is less than minSize,
+// and completes the compressed stream.
+func (w *compressResponseWriter) close() {
+	if !w.started && (w.status != 0 || len(w.buf) > 0) {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// requestIDMiddleware stores the request ID in the request context and echoes
+// it in the response, so that log lines of a request can be correlated.
+func requestIDMiddleware(hdlr http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := serverutils.RequestID(r)
+		r.Header.Set(serverutils.RequestIDHeader, id)
+		w.Header().Set(serverutils.RequestIDHeader, id)
+		hdlr.ServeHTTP(w, r.WithContext(serverutils.WithRequestID(r.Context(), id)))
+	}
+}
+
+// The configured response headers are set on top of the defaults and take
+// precedence.
+func securityHeadersMiddleware(responseHeaders map[string]string, hdlr http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Prevent MIME sniffing (https://en.wikipedia.org/wiki/Content_sniffing)
 		w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -135,6 +308,485 @@ func securityHeadersMiddleware(hdlr http.Handler) http.HandlerFunc {
 		w.Header().Set("X-DNS-Prefetch-Control", "off")
 		// Less information leakage about what domains we link to
 		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		for name, value := range responseHeaders {
+			w.Header().Set(name, strings.TrimSpace(value))
+		}
+		hdlr.ServeHTTP(w, r)
+	}
+}
+
+// forbiddenResponseHeaders are hop-by-hop headers, which only concern a single
+// connection, and headers carrying credentials or sessions.
+var forbiddenResponseHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"WWW-Authenticate",
+	"X-CSRFToken",
+}
+
+// hstsMaxAge matches the max-age directive of Strict-Transport-Security.
+var hstsMaxAge = regexp.MustCompile(`(?i)^max-age=[0-9]+$`)
+
+// ValidateResponseHeader returns an error if the header can't be set on the
+// responses of the console.
+func ValidateResponseHeader(name, value string) error {
+	name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	if name == "" {
+		return fmt.Errorf("header name must not be empty")
+	}
+	if strings.HasPrefix(name, "Proxy-") {
+		return fmt.Errorf("header %q must not be set", name)
+	}
+	for _, h := range forbiddenResponseHeaders {
+		if name == http.CanonicalHeaderKey(h) {
+			return fmt.Errorf("header %q must not be set", name)
+		}
+	}
+	if name == "Content-Security-Policy" {
+		return fmt.Errorf("header %q must be configured with --content-security-policy", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("value of header %q must not contain line breaks", name)
+	}
+	if name == "Strict-Transport-Security" {
+		return validateStrictTransportSecurity(value)
+	}
+	return nil
+}
+
+// validateStrictTransportSecurity checks for a max-age directive followed by
+// the optional includeSubDomains and preload directives.
+func validateStrictTransportSecurity(value string) error {
+	directives := strings.Split(value, ";")
+	for i := range directives {
+		directives[i] = strings.TrimSpace(directives[i])
+	}
+	if !hstsMaxAge.MatchString(directives[0]) {
+		return fmt.Errorf("Strict-Transport-Security must start with max-age=<seconds>, got %q", value)
+	}
+	seen := map[string]bool{}
+	for _, directive := range directives[1:] {
+		switch d := strings.ToLower(directive); d {
+		case "includesubdomains", "preload":
+			if seen[d] {
+				return fmt.Errorf("Strict-Transport-Security directive %q is repeated", directive)
+			}
+			seen[d] = true
+		default:
+			return fmt.Errorf("unknown Strict-Transport-Security directive %q", directive)
+		}
+	}
+	return nil
+}
+
+// forwardedHeaders are only accepted from trusted proxies.
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"}
+
+// forwardedHeadersMiddleware removes the forwarded headers of requests which
+// don't come from one of the trusted proxies, so clients can't spoof them.
+// X-Forwarded-For is cut down to the hops added by trusted proxies and the
+// client address they received the request from.
+func forwardedHeadersMiddleware(trustedProxies []*net.IPNet, hdlr http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		if !isTrustedProxy(trustedProxies, host) {
+			for _, h := range forwardedHeaders {
+				r.Header.Del(h)
+			}
+			hdlr.ServeHTTP(w, r)
+			return
+		}
+
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			hops := strings.Split(strings.Join(values, ","), ",")
+			first := 0
+			for i := len(hops) - 1; i >= 0; i-- {
+				hops[i] = strings.TrimSpace(hops[i])
+				if !isTrustedProxy(trustedProxies, hops[i]) {
+					first = i
+					break
+				}
+			}
+			r.Header.Set("X-Forwarded-For", strings.Join(hops[first:], ", "))
+		}
 		hdlr.ServeHTTP(w, r)
 	}
 }
+
+// authorizationPassthroughMiddleware passes requests which bring their own
+// bearer token to passthrough as they are, if they come from one of the
+// trusted peers and are for one of the allowed paths. All other requests are
+// passed to next, which authenticates them with the session.
+func authorizationPassthroughMiddleware(paths []string, trustedPeers []*net.IPNet, passthrough, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Values("Authorization")
+		if len(authorization) != 1 || !strings.HasPrefix(authorization[0], "Bearer ") {
+			next(w, r)
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		path := "/" + strings.TrimPrefix(r.URL.Path, "/")
+		if !isTrustedProxy(trustedPeers, host) || !passthroughPath(paths, path) {
+			next(w, r)
+			return
+		}
+
+		klog.V(4).Infof("passing the Authorization header of %s through to %s", host, path)
+		passthrough(w, r)
+	}
+}
+
+// passthroughPath returns true if the path is in the allowlist. Entries ending
+// with a slash match all paths below them, other entries have to match exactly.
+func passthroughPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if path == strings.TrimSuffix(p, "/") || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIPMiddleware puts the client IP of requests into their context, see
+// clientIP. realIPHeader is removed from requests that don't come from one
+// of the trusted proxies, so clients can't spoof it.
+func clientIPMiddleware(trustedProxies []*net.IPNet, realIPHeader string, hdlr http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r, trustedProxies, realIPHeader)
+		if realIPHeader != "" && !isTrustedProxy(trustedProxies, remoteHost(r)) {
+			r.Header.Del(realIPHeader)
+		}
+		hdlr.ServeHTTP(w, r.WithContext(serverutils.WithClientIP(r.Context(), ip)))
+	}
+}
+
+// clientIP returns the address of the client of a request. For requests from
+// a trusted proxy it is taken from realIPHeader, if set and valid, or else the
+// first hop of X-Forwarded-For. Otherwise it is the address of the connection.
+func clientIP(r *http.Request, trustedProxies []*net.IPNet, realIPHeader string) string {
+	host := remoteHost(r)
+	if !isTrustedProxy(trustedProxies, host) {
+		return host
+	}
+	if realIPHeader != "" {
+		realIP := strings.TrimSpace(strings.Split(r.Header.Get(realIPHeader), ",")[0])
+		if net.ParseIP(realIP) != nil {
+			return realIP
+		}
+	}
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		return strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+	}
+	return host
+}
+
+// remoteHost returns the address of the connection of a request without the port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrustedProxy(trustedProxies []*net.IPNet, host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range trustedProxies {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultContentSecurityPolicy is merged with the configured directives, which
+// take precedence. It matches the X-Frame-Options header.
+var defaultContentSecurityPolicy = map[string]string{
+	"frame-ancestors": "'none'",
+}
+
+// contentSecurityPolicyDirectives are the directives accepted in the configured policy.
+var contentSecurityPolicyDirectives = map[string]bool{
+	"base-uri":                  true,
+	"block-all-mixed-content":   true,
+	"child-src":                 true,
+	"connect-src":               true,
+	"default-src":               true,
+	"font-src":                  true,
+	"form-action":               true,
+	"frame-ancestors":           true,
+	"frame-src":                 true,
+	"img-src":                   true,
+	"manifest-src":              true,
+	"media-src":                 true,
+	"object-src":                true,
+	"report-to":                 true,
+	"report-uri":                true,
+	"require-trusted-types-for": true,
+	"sandbox":                   true,
+	"script-src":                true,
+	"script-src-attr":           true,
+	"script-src-elem":           true,
+	"style-src":                 true,
+	"style-src-attr":            true,
+	"style-src-elem":            true,
+	"trusted-types":             true,
+	"upgrade-insecure-requests": true,
+	"worker-src":                true,
+}
+
+// ValidateContentSecurityPolicy returns an error if directives contains an
+// unknown directive or a value that would break the policy header.
+func ValidateContentSecurityPolicy(directives map[string]string) error {
+	for name, value := range directives {
+		if !contentSecurityPolicyDirectives[name] {
+			return fmt.Errorf("unknown directive %q", name)
+		}
+		if strings.ContainsAny(value, ";,\r\n") {
+			return fmt.Errorf("value of directive %q must not contain ';', ',' or line breaks", name)
+		}
+	}
+	return nil
+}
+
+// contentSecurityPolicy merges the configured directives into the defaults and
+// returns the Content-Security-Policy header value.
+func contentSecurityPolicy(directives map[string]string) string {
+	merged := make(map[string]string, len(defaultContentSecurityPolicy)+len(directives))
+	for name, value := range defaultContentSecurityPolicy {
+		merged[name] = value
+	}
+	for name, value := range directives {
+		merged[name] = strings.TrimSpace(value)
+	}
+
+	policy := make([]string, 0, len(merged))
+	for name, value := range merged {
+		policy = append(policy, strings.TrimSpace(name+" "+value))
+	}
+	sort.Strings(policy)
+	return strings.Join(policy, "; ")
+}
+
+// clientRateLimiter limits the requests of each client IP with a token bucket.
+type clientRateLimiter struct {
+	limit          rate.Limit
+	burst          int
+	trustedProxies []*net.IPNet
+
+	mux       sync.Mutex
+	clients   map[string]*clientLimiter
+	lastPrune time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newClientRateLimiter(limit float64, burst int, trustedProxies []*net.IPNet) *clientRateLimiter {
+	return &clientRateLimiter{
+		limit:          rate.Limit(limit),
+		burst:          burst,
+		trustedProxies: trustedProxies,
+		clients:        make(map[string]*clientLimiter),
+		lastPrune:      time.Now(),
+	}
+}
+
+// reserve takes a token of the client and returns how long it has to wait
+// for one if none is available.
+func (l *clientRateLimiter) reserve(client string, now time.Time) time.Duration {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	// A bucket that refilled completely is the same as a new one, drop it.
+	if refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second)); now.Sub(l.lastPrune) > refill {
+		for ip, c := range l.clients {
+			if now.Sub(c.lastSeen) > refill {
+				delete(l.clients, ip)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+
+	reservation := c.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// clientIP returns the address of the client, as found by clientIPMiddleware
+// if it ran, otherwise the first hop of X-Forwarded-For if the request comes
+// from a trusted proxy.
+func (l *clientRateLimiter) clientIP(r *http.Request) string {
+	if ip := serverutils.ClientIPFrom(r.Context()); ip != "" {
+		return ip
+	}
+	return clientIP(r, l.trustedProxies, "")
+}
+
+// rateLimitMiddleware responds with 429 to clients exceeding the rate limit.
+func rateLimitMiddleware(limiter *clientRateLimiter, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := limiter.clientIP(r)
+		if delay := limiter.reserve(client, time.Now()); delay > 0 {
+			klog.V(4).Infof("rate limiting %s request of %s", r.URL.Path, client)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		h(w, r)
+	}
+}
+
+const (
+	corsAllowedMethods = "GET, HEAD"
+	corsAllowedHeaders = "Accept, X-Request-Id"
+	corsMaxAge         = "600"
+)
+
+// ValidateCORSAllowedOrigin returns an error if origin can't be allowed to
+// make cross-origin requests. An origin is a scheme and host, like
+// https://app.example.com. The first label of the host may be a wildcard, like
+// https://*.example.com. Any origin can't be allowed with a single wildcard,
+// since requests are made with credentials.
+func ValidateCORSAllowedOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("origin %q is not a URL: %v", origin, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("origin %q must have the scheme https or http", origin)
+	}
+	if u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("origin %q must only have a scheme and a host", origin)
+	}
+	host := u.Host
+	if domain, ok := strings.CutPrefix(host, "*."); ok {
+		if !strings.Contains(domain, ".") {
+			return fmt.Errorf("origin %q must not have a wildcard for a top-level domain", origin)
+		}
+		host = domain
+	}
+	if strings.Contains(host, "*") {
+		return fmt.Errorf("origin %q may only have a wildcard as the first label of the host", origin)
+	}
+	return nil
+}
+
+// corsOriginAllowed returns true if origin matches one of the allowed origins,
+// which are validated with ValidateCORSAllowedOrigin.
+func corsOriginAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowed := range allowedOrigins {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			continue
+		}
+		prefix, domain, ok := strings.Cut(origin, "://")
+		if !ok || !strings.EqualFold(prefix, scheme) {
+			continue
+		}
+		label, rest, ok := strings.Cut(domain, ".")
+		if ok && label != "" && strings.EqualFold(rest, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsReadOnly returns true for the methods cross-origin requests may use.
+func corsReadOnly(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// corsMiddleware allows the origins in allowedOrigins to make read-only
+// requests with credentials to the paths below apiPath, and answers their
+// preflight requests. The requesting origin is echoed, never a wildcard.
+// Mutating requests aren't allowed cross-origin: the CSRF check rejects
+// foreign origins, and they can't read the CSRF cookie anyway.
+func corsMiddleware(allowedOrigins []string, apiPath string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, apiPath) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		method := r.Method
+		if preflight {
+			method = r.Header.Get("Access-Control-Request-Method")
+		}
+		if origin == "" || !corsOriginAllowed(allowedOrigins, origin) || !corsReadOnly(method) {
+			if preflight {
+				klog.V(4).Infof("rejecting CORS preflight request for %s from origin %q", method, origin)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// streamingDeadlinesMiddleware clears the read and write deadlines the
+// http.Server sets from its ReadTimeout and WriteTimeout for websockets,
+// watches and followed logs, which last as long as the client wants.
+func streamingDeadlinesMiddleware(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" || proxy.IsStreamingRequest(r) {
+			rc := http.NewResponseController(w)
+			if err := rc.SetReadDeadline(time.Time{}); err != nil {
+				klog.V(4).Infof("failed to clear the read deadline of a streaming request: %v", err)
+			}
+			if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+				klog.V(4).Infof("failed to clear the write deadline of a streaming request: %v", err)
+			}
+		}
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,590 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+func TestForwardedHeadersMiddleware(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		wantFor    string
+		wantProto  string
+	}{
+		{
+			name:       "untrusted peer",
+			remoteAddr: "203.0.113.7:4711",
+			forwarded:  []string{"198.51.100.1"},
+			wantFor:    "",
+			wantProto:  "",
+		},
+		{
+			name:       "trusted peer",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"198.51.100.1"},
+			wantFor:    "198.51.100.1",
+			wantProto:  "https",
+		},
+		{
+			name:       "spoofed hops before the client are dropped",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"192.0.2.66, 198.51.100.1", "10.0.0.1"},
+			wantFor:    "198.51.100.1, 10.0.0.1",
+			wantProto:  "https",
+		},
+		{
+			name:       "only trusted hops",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"10.0.0.3, 10.0.0.1"},
+			wantFor:    "10.0.0.3, 10.0.0.1",
+			wantProto:  "https",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			h := forwardedHeadersMiddleware([]*net.IPNet{trusted}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}))
+
+			r := httptest.NewRequest("GET", "http://console.example.com/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			r.Header.Set("X-Forwarded-Proto", "https")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if v := got.Get("X-Forwarded-For"); v != tt.wantFor {
+				t.Errorf("expected X-Forwarded-For %q, got %q", tt.wantFor, v)
+			}
+			if v := got.Get("X-Forwarded-Proto"); v != tt.wantProto {
+				t.Errorf("expected X-Forwarded-Proto %q, got %q", tt.wantProto, v)
+			}
+		})
+	}
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives map[string]string
+		want       string
+	}{
+		{
+			name: "defaults",
+			want: "frame-ancestors 'none'",
+		},
+		{
+			name:       "configured directive replaces the default",
+			directives: map[string]string{"frame-ancestors": "'self' https://portal.example.com"},
+			want:       "frame-ancestors 'self' https://portal.example.com",
+		},
+		{
+			name:       "directives are merged",
+			directives: map[string]string{"connect-src": "'self' wss:", "upgrade-insecure-requests": ""},
+			want:       "connect-src 'self' wss:; frame-ancestors 'none'; upgrade-insecure-requests",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentSecurityPolicy(tt.directives); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateContentSecurityPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives map[string]string
+		wantErr    bool
+	}{
+		{name: "valid", directives: map[string]string{"frame-ancestors": "'self'", "connect-src": "'self' https:"}},
+		{name: "unknown directive", directives: map[string]string{"frame-ancestor": "'self'"}, wantErr: true},
+		{name: "injected directive", directives: map[string]string{"connect-src": "'self'; script-src *"}, wantErr: true},
+		{name: "line break", directives: map[string]string{"connect-src": "'self'\r\nSet-Cookie: a=b"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateContentSecurityPolicy(tt.directives)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	handler := securityHeadersMiddleware(map[string]string{
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Strict-Transport-Security": " max-age=31536000; includeSubDomains",
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	for name, want := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("expected %s %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestValidateResponseHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		wantErr bool
+	}{
+		{name: "custom header", header: "X-Custom", value: "value"},
+		{name: "default header", header: "x-frame-options", value: "SAMEORIGIN"},
+		{name: "empty name", header: " ", value: "value", wantErr: true},
+		{name: "hop-by-hop header", header: "transfer-encoding", value: "chunked", wantErr: true},
+		{name: "proxy header", header: "Proxy-Authenticate", value: "Basic", wantErr: true},
+		{name: "auth header", header: "WWW-Authenticate", value: "Basic", wantErr: true},
+		{name: "cookie header", header: "Set-Cookie", value: "a=b", wantErr: true},
+		{name: "content security policy", header: "Content-Security-Policy", value: "default-src 'self'", wantErr: true},
+		{name: "line break", header: "X-Custom", value: "a\r\nSet-Cookie: a=b", wantErr: true},
+		{name: "hsts", header: "Strict-Transport-Security", value: "max-age=31536000"},
+		{name: "hsts with directives", header: "strict-transport-security", value: "max-age=63072000; includeSubDomains; preload"},
+		{name: "hsts without max-age", header: "Strict-Transport-Security", value: "includeSubDomains", wantErr: true},
+		{name: "hsts with invalid max-age", header: "Strict-Transport-Security", value: "max-age=1y", wantErr: true},
+		{name: "hsts with unknown directive", header: "Strict-Transport-Security", value: "max-age=0; always", wantErr: true},
+		{name: "hsts with repeated directive", header: "Strict-Transport-Security", value: "max-age=0; preload; preload", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateResponseHeader(tt.header, tt.value)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateCORSAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		wantErr bool
+	}{
+		{name: "origin", origin: "https://app.example.com"},
+		{name: "origin with port", origin: "http://localhost:9000"},
+		{name: "wildcard subdomain", origin: "https://*.example.com"},
+		{name: "any origin", origin: "*", wantErr: true},
+		{name: "wildcard top-level domain", origin: "https://*.com", wantErr: true},
+		{name: "wildcard inside host", origin: "https://app.*.example.com", wantErr: true},
+		{name: "no scheme", origin: "app.example.com", wantErr: true},
+		{name: "path", origin: "https://app.example.com/console", wantErr: true},
+		{name: "other scheme", origin: "ftp://app.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCORSAllowedOrigin(tt.origin)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	handler := corsMiddleware([]string{"https://app.example.com", "https://*.apps.example.com"}, "/console/api/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("handled"))
+	}))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		origin     string
+		preflight  string
+		wantStatus int
+		wantOrigin string
+		wantBody   string
+	}{
+		{name: "allowed origin", method: "GET", path: "/console/api/kubernetes/api", origin: "https://app.example.com", wantStatus: http.StatusOK, wantOrigin: "https://app.example.com", wantBody: "handled"},
+		{name: "allowed wildcard origin", method: "GET", path: "/console/api/kubernetes/api", origin: "https://dashboard.apps.example.com", wantStatus: http.StatusOK, wantOrigin: "https://dashboard.apps.example.com", wantBody: "handled"},
+		{name: "disallowed origin", method: "GET", path: "/console/api/kubernetes/api", origin: "https://evil.example.com", wantStatus: http.StatusOK, wantBody: "handled"},
+		{name: "nested wildcard origin", method: "GET", path: "/console/api/kubernetes/api", origin: "https://a.b.apps.example.com", wantStatus: http.StatusOK, wantBody: "handled"},
+		{name: "other scheme", method: "GET", path: "/console/api/kubernetes/api", origin: "http://app.example.com", wantStatus: http.StatusOK, wantBody: "handled"},
+		{name: "not an api path", method: "GET", path: "/console/k8s/cluster/projects", origin: "https://app.example.com", wantStatus: http.StatusOK, wantBody: "handled"},
+		{name: "mutating request", method: "POST", path: "/console/api/kubernetes/api", origin: "https://app.example.com", wantStatus: http.StatusOK, wantBody: "handled"},
+		{name: "preflight", method: "OPTIONS", path: "/console/api/kubernetes/api", origin: "https://app.example.com", preflight: "GET", wantStatus: http.StatusNoContent, wantOrigin: "https://app.example.com"},
+		{name: "mutating preflight", method: "OPTIONS", path: "/console/api/kubernetes/api", origin: "https://app.example.com", preflight: "DELETE", wantStatus: http.StatusForbidden},
+		{name: "disallowed preflight", method: "OPTIONS", path: "/console/api/kubernetes/api", origin: "https://evil.example.com", preflight: "GET", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Origin", tt.origin)
+			if tt.preflight != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.preflight)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("wrong status, want: %d, got: %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("wrong body, want: %q, got: %q", tt.wantBody, got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("wrong Access-Control-Allow-Origin, want: %q, got: %q", tt.wantOrigin, got)
+			}
+			wantCredentials := ""
+			if tt.wantOrigin != "" {
+				wantCredentials = "true"
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != wantCredentials {
+				t.Errorf("wrong Access-Control-Allow-Credentials, want: %q, got: %q", wantCredentials, got)
+			}
+			wantMethods := ""
+			if tt.preflight != "" && tt.wantOrigin != "" {
+				wantMethods = corsAllowedMethods
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != wantMethods {
+				t.Errorf("wrong Access-Control-Allow-Methods, want: %q, got: %q", wantMethods, got)
+			}
+		})
+	}
+}
+
+func TestAuthorizationPassthroughMiddleware(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		remoteAddr      string
+		path            string
+		authorization   []string
+		wantPassthrough bool
+	}{
+		{
+			name:            "trusted peer and allowed path",
+			remoteAddr:      "10.0.0.2:4711",
+			path:            "/apis/batch/v1/namespaces/ci/jobs",
+			authorization:   []string{"Bearer automation"},
+			wantPassthrough: true,
+		},
+		{
+			name:            "exact path",
+			remoteAddr:      "10.0.0.2:4711",
+			path:            "/api/v1/namespaces",
+			authorization:   []string{"Bearer automation"},
+			wantPassthrough: true,
+		},
+		{
+			name:          "untrusted peer",
+			remoteAddr:    "203.0.113.7:4711",
+			path:          "/apis/batch/v1/namespaces/ci/jobs",
+			authorization: []string{"Bearer automation"},
+		},
+		{
+			name:          "path not allowed",
+			remoteAddr:    "10.0.0.2:4711",
+			path:          "/api/v1/secrets",
+			authorization: []string{"Bearer automation"},
+		},
+		{
+			name:          "prefix of an exact path",
+			remoteAddr:    "10.0.0.2:4711",
+			path:          "/api/v1/namespaces/default/secrets",
+			authorization: []string{"Bearer automation"},
+		},
+		{
+			name:       "no authorization header",
+			remoteAddr: "10.0.0.2:4711",
+			path:       "/apis/batch/v1/namespaces/ci/jobs",
+		},
+		{
+			name:          "not a bearer token",
+			remoteAddr:    "10.0.0.2:4711",
+			path:          "/apis/batch/v1/namespaces/ci/jobs",
+			authorization: []string{"Basic YWRtaW46YWRtaW4="},
+		},
+		{
+			name:          "multiple authorization headers",
+			remoteAddr:    "10.0.0.2:4711",
+			path:          "/apis/batch/v1/namespaces/ci/jobs",
+			authorization: []string{"Bearer automation", "Bearer other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passedThrough := false
+			h := authorizationPassthroughMiddleware(
+				[]string{"/apis/batch/v1/", "/api/v1/namespaces"},
+				[]*net.IPNet{trusted},
+				func(w http.ResponseWriter, r *http.Request) { passedThrough = true },
+				func(w http.ResponseWriter, r *http.Request) {},
+			)
+
+			r := httptest.NewRequest("GET", "http://console.example.com"+tt.path, nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.authorization {
+				r.Header.Add("Authorization", v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if passedThrough != tt.wantPassthrough {
+				t.Errorf("expected passthrough: %v, got: %v", tt.wantPassthrough, passedThrough)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := newClientRateLimiter(0.1, 2, []*net.IPNet{trusted})
+	h := rateLimitMiddleware(limiter, func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "http://console.example.com/auth/login", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("203.0.113.7:4711", ""); w.Code != http.StatusOK {
+			t.Fatalf("expected request %d within the burst to succeed, got %d", i, w.Code)
+		}
+	}
+
+	w := request("203.0.113.7:4711", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the request over the limit to fail with 429, got %d", w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "10" {
+		t.Errorf("expected Retry-After 10, got %q", retryAfter)
+	}
+
+	// Forwarded headers of untrusted peers don't give a new identity.
+	if w := request("203.0.113.7:4711", "198.51.100.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected a spoofed X-Forwarded-For to be ignored, got %d", w.Code)
+	}
+
+	if w := request("203.0.113.8:4711", ""); w.Code != http.StatusOK {
+		t.Errorf("expected another client to be allowed, got %d", w.Code)
+	}
+
+	// Clients behind a trusted proxy are limited by their forwarded address.
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		if w := request("10.0.0.2:4711", client); w.Code != http.StatusOK {
+			t.Errorf("expected client %s behind the trusted proxy to be allowed, got %d", client, w.Code)
+		}
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		realIPHeader string
+		realIP       string
+		forwardedFor string
+		want         string
+		wantRealIP   string
+	}{
+		{name: "untrusted peer", remoteAddr: "203.0.113.7:4711", realIPHeader: "True-Client-IP", realIP: "198.51.100.1", forwardedFor: "198.51.100.2", want: "203.0.113.7"},
+		{name: "real IP header of a trusted proxy", remoteAddr: "10.0.0.2:4711", realIPHeader: "True-Client-IP", realIP: "198.51.100.1", want: "198.51.100.1", wantRealIP: "198.51.100.1"},
+		{name: "real IP header takes precedence", remoteAddr: "10.0.0.2:4711", realIPHeader: "True-Client-IP", realIP: "198.51.100.1", forwardedFor: "198.51.100.2", want: "198.51.100.1", wantRealIP: "198.51.100.1"},
+		{name: "first address of the real IP header", remoteAddr: "10.0.0.2:4711", realIPHeader: "True-Client-IP", realIP: " 2001:db8::1 , 198.51.100.1", want: "2001:db8::1", wantRealIP: " 2001:db8::1 , 198.51.100.1"},
+		{name: "invalid real IP header", remoteAddr: "10.0.0.2:4711", realIPHeader: "True-Client-IP", realIP: "unknown", forwardedFor: "198.51.100.2", want: "198.51.100.2", wantRealIP: "unknown"},
+		{name: "missing real IP header", remoteAddr: "10.0.0.2:4711", realIPHeader: "True-Client-IP", forwardedFor: "198.51.100.2, 10.0.0.3", want: "198.51.100.2"},
+		{name: "header not configured", remoteAddr: "10.0.0.2:4711", realIP: "198.51.100.1", forwardedFor: "198.51.100.2", want: "198.51.100.2", wantRealIP: "198.51.100.1"},
+		{name: "trusted proxy without headers", remoteAddr: "10.0.0.2:4711", realIPHeader: "True-Client-IP", want: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, gotRealIP string
+			h := clientIPMiddleware([]*net.IPNet{trusted}, tt.realIPHeader, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = serverutils.ClientIPFrom(r.Context())
+				gotRealIP = r.Header.Get("True-Client-IP")
+			}))
+
+			r := httptest.NewRequest("GET", "http://console.example.com/auth/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				r.Header.Set("True-Client-IP", tt.realIP)
+			}
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("expected client IP %q, got %q", tt.want, got)
+			}
+			if gotRealIP != tt.wantRealIP {
+				t.Errorf("expected True-Client-IP %q, got %q", tt.wantRealIP, gotRealIP)
+			}
+		})
+	}
+
+	// The rate limiter keys clients by the IP found by the middleware.
+	limiter := newClientRateLimiter(0.1, 1, []*net.IPNet{trusted})
+	h := clientIPMiddleware([]*net.IPNet{trusted}, "True-Client-IP", rateLimitMiddleware(limiter, func(w http.ResponseWriter, r *http.Request) {}))
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		r := httptest.NewRequest("GET", "http://console.example.com/auth/login", nil)
+		r.RemoteAddr = "10.0.0.2:4711"
+		r.Header.Set("True-Client-IP", client)
+		r.Header.Set("X-Forwarded-For", "198.51.100.9")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected client %s to be limited on its own, got %d", client, w.Code)
+		}
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		wantEcho  bool
+	}{
+		{name: "inbound ID", requestID: "7f9c2c4e-req", wantEcho: true},
+		{name: "no inbound ID", requestID: ""},
+		{name: "inbound ID with a newline", requestID: "abc\ndef"},
+		{name: "inbound ID too long", requestID: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID string
+			handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = serverutils.RequestIDFrom(r.Context())
+			}))
+
+			r := httptest.NewRequest("GET", "http://example.com/auth/callback", nil)
+			if tt.requestID != "" {
+				r.Header.Set(serverutils.RequestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			got := rr.Header().Get(serverutils.RequestIDHeader)
+			if got == "" || got != ctxID {
+				t.Fatalf("expected the response header %q to match the request context ID %q", got, ctxID)
+			}
+			if tt.wantEcho {
+				if got != tt.requestID {
+					t.Errorf("expected the inbound request ID %q, got: %q", tt.requestID, got)
+				}
+			} else if _, err := uuid.Parse(got); err != nil {
+				t.Errorf("expected a generated UUID, got: %q", got)
+			}
+		})
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"kind":"ConfigMap"}`, 100)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		flush          bool
+		wantCompressed bool
+	}{
+		{name: "json", acceptEncoding: "gzip, deflate, br", contentType: "application/json", body: large, wantCompressed: true},
+		{name: "javascript", acceptEncoding: "gzip", contentType: "application/javascript", body: large, wantCompressed: true},
+		{name: "not negotiated", acceptEncoding: "", contentType: "application/json", body: large},
+		{name: "other encoding", acceptEncoding: "br", contentType: "application/json", body: large},
+		{name: "below min size", acceptEncoding: "gzip", contentType: "application/json", body: `{"kind":"ConfigMap"}`},
+		{name: "image", acceptEncoding: "gzip", contentType: "image/png", body: large},
+		{name: "streamed", acceptEncoding: "gzip", contentType: "application/json", body: `{"type":"ADDED"}`, flush: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := compressionMiddleware(1024, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+				if tt.flush {
+					w.(http.Flusher).Flush()
+					w.Write([]byte(large))
+				}
+			}))
+
+			r := httptest.NewRequest("GET", "http://example.com/api/check-updates", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			wantBody := tt.body
+			if tt.flush {
+				wantBody += large
+			}
+			body := rr.Body.String()
+			if gotCompressed := rr.Header().Get("Content-Encoding") == "gzip"; gotCompressed != tt.wantCompressed {
+				t.Fatalf("expected compressed: %v, got headers: %v", tt.wantCompressed, rr.Header())
+			}
+			if tt.wantCompressed {
+				gz, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decompressed, err := io.ReadAll(gz)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(decompressed)
+			}
+			if body != wantBody {
+				t.Errorf("unexpected body of %d bytes, want %d bytes", len(body), len(wantBody))
+			}
+		})
+	}
+}
@@ -6,18 +6,24 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/coreos/pkg/health"
+	oscrypto "github.com/openshift/library-go/pkg/crypto"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/klog"
@@ -46,18 +52,71 @@ import (
 // Public constants
 const (
 	AuthLoginCallbackEndpoint = "/auth/callback"
+	AuthLoginEndpoint         = "/auth/login"
 	AuthLoginErrorEndpoint    = "/auth/error"
 	AuthLoginSuccessEndpoint  = "/"
 )
 
+// AuthPaths are the paths of the login flow below the base path. Empty paths
+// default to the AuthLogin*Endpoint constants.
+type AuthPaths struct {
+	Login    string
+	Callback string
+	Success  string
+	Error    string
+}
+
+// WithDefaults returns p with the empty paths set to their defaults.
+func (p AuthPaths) WithDefaults() AuthPaths {
+	if p.Login == "" {
+		p.Login = AuthLoginEndpoint
+	}
+	if p.Callback == "" {
+		p.Callback = AuthLoginCallbackEndpoint
+	}
+	if p.Success == "" {
+		p.Success = AuthLoginSuccessEndpoint
+	}
+	if p.Error == "" {
+		p.Error = AuthLoginErrorEndpoint
+	}
+	return p
+}
+
+// ResolveBasePath returns the path the console is served under, which is the
+// path of baseAddress, like https://example.com/console/, or basePath. The two
+// must not conflict. The returned path starts and ends with a slash.
+func ResolveBasePath(baseAddress *url.URL, basePath string) (string, error) {
+	if !strings.HasPrefix(basePath, "/") || !strings.HasSuffix(basePath, "/") {
+		return "", fmt.Errorf("base path %q must start and end with slash", basePath)
+	}
+	if baseAddress.Path == "" || baseAddress.Path == "/" {
+		return basePath, nil
+	}
+
+	addressPath := baseAddress.Path
+	if !strings.HasSuffix(addressPath, "/") {
+		addressPath += "/"
+	}
+	if path.Clean(addressPath) != strings.TrimSuffix(addressPath, "/") {
+		return "", fmt.Errorf("path %q of the base address must be clean", baseAddress.Path)
+	}
+	if basePath != "/" && basePath != addressPath {
+		return "", fmt.Errorf("base path %q conflicts with the path %q of the base address", basePath, baseAddress.Path)
+	}
+	return addressPath, nil
+}
+
 // Private constants
 const (
 	accountManagementEndpoint             = "/api/accounts_mgmt/"
 	alertManagerProxyEndpoint             = "/api/alertmanager"
 	alertManagerTenancyProxyEndpoint      = "/api/alertmanager-tenancy"
 	alertmanagerUserWorkloadProxyEndpoint = "/api/alertmanager-user-workload"
-	authLoginEndpoint                     = "/auth/login"
 	authLogoutEndpoint                    = "/auth/logout"
+	authLogoutLandingEndpoint             = "/auth/logout/landing"
+	authSilentLoginEndpoint               = "/auth/login/silent"
+	authStatusEndpoint                    = "/auth/status"
 	customLogoEndpoint                    = "/custom-logo"
 	deleteOpenshiftTokenEndpoint          = "/api/openshift/delete-token"
 	devfileEndpoint                       = "/api/devfile/"
@@ -66,6 +125,7 @@ const (
 	graphQLEndpoint                       = "/api/graphql"
 	helmChartRepoProxyEndpoint            = "/api/helm/charts/"
 	indexPageTemplateName                 = "index.html"
+	invalidateSessionsEndpoint            = "/api/console/invalidate-sessions"
 	k8sProxyEndpoint                      = "/api/kubernetes/"
 	knativeProxyEndpoint                  = "/api/console/knative/"
 	devConsoleEndpoint                    = "/api/dev-console/"
@@ -75,7 +135,10 @@ const (
 	pluginProxyEndpoint                   = "/api/proxy/"
 	prometheusProxyEndpoint               = "/api/prometheus"
 	prometheusTenancyProxyEndpoint        = "/api/prometheus-tenancy"
+	refreshProviderEndpoint               = "/api/console/refresh-auth-provider"
 	requestTokenEndpoint                  = "/api/request-token"
+	sessionActivityEndpoint               = "/api/console/session-activity"
+	sessionInfoEndpoint                   = "/api/console/session-info"
 	sha256Prefix                          = "sha256~"
 	tokenizerPageTemplateName             = "tokener.html"
 	updatesEndpoint                       = "/api/check-updates"
@@ -87,6 +150,8 @@ type jsGlobals struct {
 	AlertManagerPublicURL           string                     `json:"alertManagerPublicURL"`
 	AlertmanagerUserWorkloadBaseURL string                     `json:"alertmanagerUserWorkloadBaseURL"`
 	AuthDisabled                    bool                       `json:"authDisabled"`
+	AuthIdentityClaim               string                     `json:"authIdentityClaim"`
+	AuthScopes                      []string                   `json:"authScopes"`
 	BasePath                        string                     `json:"basePath"`
 	Branding                        string                     `json:"branding"`
 	ConsolePlugins                  []string                   `json:"consolePlugins"`
@@ -121,6 +186,7 @@ type jsGlobals struct {
 	PrometheusTenancyBaseURL        string                     `json:"prometheusTenancyBaseURL"`
 	QuickStarts                     string                     `json:"quickStarts"`
 	ReleaseVersion                  string                     `json:"releaseVersion"`
+	SilentLoginURL                  string                     `json:"silentLoginURL,omitempty"`
 	StatuspageID                    string                     `json:"statuspageID"`
 	Telemetry                       serverconfig.MultiKeyValue `json:"telemetry"`
 	ThanosPublicURL                 string                     `json:"thanosPublicURL"`
@@ -136,10 +202,18 @@ type Server struct {
 	AlertManagerTenancyProxyConfig      *proxy.Config
 	AlertManagerUserWorkloadHost        string
 	AlertManagerUserWorkloadProxyConfig *proxy.Config
+	AuthMetrics                         *auth.Metrics
+	AuthPaths                           AuthPaths
+	AuthRateLimit                       float64
+	AuthRateLimitBurst                  int
+	AuthorizationPassthroughCIDRs       []*net.IPNet
+	AuthorizationPassthroughPaths       []string
 	Authenticator                       *auth.Authenticator
 	BaseURL                             *url.URL
 	Branding                            string
+	CORSAllowedOrigins                  []string
 	ClusterManagementProxyConfig        *proxy.Config
+	ContentSecurityPolicy               serverconfig.MultiKeyValue
 	ControlPlaneTopology                string
 	CopiedCSVsDisabled                  bool
 	CustomLogoFile                      string
@@ -152,7 +226,13 @@ type Server struct {
 	GOARCH                              string
 	GOOS                                string
 	GrafanaPublicURL                    *url.URL
+	HTTPIdleTimeout                     time.Duration
+	HTTPReadHeaderTimeout               time.Duration
+	HTTPReadTimeout                     time.Duration
+	HTTPWriteTimeout                    time.Duration
 	I18nNamespaces                      []string
+	ImpersonationUsernameClaim          string
+	ImpersonationUsernamePrefix         string
 	InactivityTimeout                   int
 	K8sClient                           *http.Client
 	K8sMode                             string
@@ -162,6 +242,7 @@ type Server struct {
 	KubeAPIServerURL                    string
 	KubeVersion                         string
 	LoadTestFactor                      int
+	LogoutLandingPage                   *template.Template
 	LogoutRedirect                      *url.URL
 	MonitoringDashboardConfigMapLister  ResourceLister
 	NodeArchitectures                   []string
@@ -171,13 +252,21 @@ type Server struct {
 	PluginsProxyTLSConfig               *tls.Config
 	ProjectAccessClusterRoles           string
 	PrometheusPublicURL                 *url.URL
+	ProviderAdminGroup                  string
 	PublicDir                           string
 	QuickStarts                         string
+	RealIPHeader                        string
 	ReleaseVersion                      string
+	ResponseCompression                 bool
+	ResponseCompressionMinSize          int
+	ResponseHeaders                     serverconfig.MultiKeyValue
 	ServiceAccountToken                 string
 	ServiceClient                       *http.Client
+	SessionAdminGroup                   string
 	StaticUser                          *auth.User
 	StatuspageID                        string
+	TLSCipherSuites                     []uint16
+	TLSMinVersion                       uint16
 	TectonicVersion                     string
 	Telemetry                           serverconfig.MultiKeyValue
 	TerminalProxyTLSConfig              *tls.Config
@@ -185,7 +274,49 @@ type Server struct {
 	ThanosPublicURL                     *url.URL
 	ThanosTenancyProxyConfig            *proxy.Config
 	ThanosTenancyProxyForRulesConfig    *proxy.Config
+	TrustedProxyCIDRs                   []*net.IPNet
 	UserSettingsLocation                string
+
+	// shuttingDown makes /readyz fail during the lame-duck period before shutdown.
+	shuttingDown atomic.Bool
+}
+
+// errShuttingDown is reported by /readyz once the server is about to shut down.
+var errShuttingDown = errors.New("server is shutting down")
+
+// SetShuttingDown makes /readyz fail so that load balancers stop routing new
+// requests to the server, while it keeps serving the ones it receives.
+func (s *Server) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+// Drain stops httpsrv from accepting new connections and waits up to
+// gracePeriod for in-flight requests to finish before closing the remaining
+// connections. It then calls cancel, which has to cancel the base context of
+// httpsrv, to end hijacked connections like websockets, which Shutdown doesn't
+// track.
+func Drain(httpsrv *http.Server, gracePeriod time.Duration, cancel context.CancelFunc) error {
+	defer cancel()
+
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancelTimeout()
+	if err := httpsrv.Shutdown(ctx); err != nil {
+		httpsrv.Close()
+		return err
+	}
+	return nil
+}
+
+// shutdownCheck is a health.Checkable failing once the server is shutting down.
+type shutdownCheck struct {
+	s *Server
+}
+
+func (c shutdownCheck) Healthy() error {
+	if c.s.shuttingDown.Load() {
+		return errShuttingDown
+	}
+	return nil
 }
 
 func disableDirectoryListing(handler http.Handler) http.Handler {
@@ -281,17 +412,54 @@ func (s *Server) HTTPHandler() http.Handler {
 	}
 
 	if !s.authDisabled() {
-		handleFunc(authLoginEndpoint, s.Authenticator.LoginFunc)
+		loginHandler := s.Authenticator.LoginFunc
+		silentLoginHandler := s.Authenticator.SilentLoginFunc
+		callbackHandler := s.Authenticator.CallbackFunc(fn)
+		if s.AuthRateLimit > 0 {
+			limiter := newClientRateLimiter(s.AuthRateLimit, s.AuthRateLimitBurst, s.TrustedProxyCIDRs)
+			loginHandler = rateLimitMiddleware(limiter, loginHandler)
+			silentLoginHandler = rateLimitMiddleware(limiter, silentLoginHandler)
+			callbackHandler = rateLimitMiddleware(limiter, callbackHandler)
+		}
+		authPaths := s.AuthPaths.WithDefaults()
+		handleFunc(authPaths.Login, loginHandler)
+		if s.Authenticator.SilentRenewEnabled() {
+			handleFunc(authSilentLoginEndpoint, silentLoginHandler)
+		}
 		handleFunc(authLogoutEndpoint, allowMethod(http.MethodPost, s.handleLogout))
-		handleFunc(AuthLoginCallbackEndpoint, s.Authenticator.CallbackFunc(fn))
+		if s.LogoutLandingPage != nil {
+			loginURL := proxy.SingleJoiningSlash(s.BaseURL.String(), authPaths.Login)
+			handleFunc(authLogoutLandingEndpoint, allowMethod(http.MethodGet, s.Authenticator.LogoutLandingFunc(s.LogoutLandingPage, loginURL)))
+		}
+		handleFunc(authPaths.Callback, callbackHandler)
+		handleFunc(authPaths.Error, s.authErrorHandler)
+		handleFunc(authStatusEndpoint, health.Checker{
+			Checks:         []health.Checkable{s.Authenticator.ClientCredentialStatus()},
+			HealthyHandler: s.handleAuthStatus,
+		}.ServeHTTP)
 		handle(requestTokenEndpoint, authHandler(s.handleClusterTokenURL))
 		handleFunc(deleteOpenshiftTokenEndpoint, allowMethod(http.MethodPost, authHandlerWithUser(s.handleOpenShiftTokenDeletion)))
+		if s.SessionAdminGroup != "" {
+			handleFunc(invalidateSessionsEndpoint, allowMethod(http.MethodPost, authHandlerWithUser(s.handleInvalidateSessions)))
+		}
+		if s.ProviderAdminGroup != "" {
+			handleFunc(refreshProviderEndpoint, allowMethod(http.MethodPost, authHandlerWithUser(s.handleRefreshProvider)))
+		}
+		if s.InactivityTimeout > 0 {
+			handleFunc(sessionInfoEndpoint, allowMethod(http.MethodGet, authHandlerWithUser(s.handleSessionInfo)))
+			handleFunc(sessionActivityEndpoint, allowMethod(http.MethodPost, authHandlerWithUser(s.handleSessionActivity)))
+		}
 	}
 
 	handleFunc("/api/", notFoundHandler)
 
 	staticHandler := http.StripPrefix(proxy.SingleJoiningSlash(s.BaseURL.Path, "/static/"), disableDirectoryListing(http.FileServer(http.Dir(s.PublicDir))))
-	handle("/static/", gzipHandler(securityHeadersMiddleware(staticHandler)))
+	if s.ResponseCompression {
+		// Compressed by compressionMiddleware below.
+		handle("/static/", securityHeadersMiddleware(s.ResponseHeaders, staticHandler))
+	} else {
+		handle("/static/", gzipHandler(securityHeadersMiddleware(s.ResponseHeaders, staticHandler)))
+	}
 
 	if s.CustomLogoFile != "" {
 		handleFunc(customLogoEndpoint, func(w http.ResponseWriter, r *http.Request) {
@@ -308,9 +476,43 @@ func (s *Server) HTTPHandler() http.Handler {
 		Checks: []health.Checkable{},
 	}.ServeHTTP)
 
+	readyChecks := []health.Checkable{shutdownCheck{s: s}}
+	if !s.authDisabled() {
+		readyChecks = append(readyChecks, s.Authenticator)
+	}
+	handleFunc("/readyz", health.Checker{
+		Checks: readyChecks,
+	}.ServeHTTP)
+
+	// Unlike /readyz, /livez only fails for problems a restart may fix.
+	var liveChecks []health.Checkable
+	if !s.authDisabled() {
+		liveChecks = append(liveChecks, s.Authenticator.Liveness())
+	}
+	handleFunc("/livez", health.Checker{
+		Checks: liveChecks,
+	}.ServeHTTP)
+
+	k8sProxyHandler := authHandlerWithHeader(k8sProxy.ServeHTTP)
+	if s.K8sProxyConfig.SessionImpersonation {
+		// The console service account makes the requests on behalf of the
+		// user, so that audit logs attribute them to the session identity.
+		k8sProxyHandler = authHandlerWithUser(func(u *auth.User, w http.ResponseWriter, r *http.Request) {
+			impersonation, err := s.userImpersonation(u)
+			if err != nil {
+				serverutils.SendResponse(w, http.StatusForbidden, serverutils.ApiError{Err: fmt.Sprintf("Failed to impersonate the user: %v", err)})
+				return
+			}
+			r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.ServiceAccountToken))
+			k8sProxy.ServeHTTP(w, r.WithContext(proxy.WithImpersonation(r.Context(), impersonation)))
+		})
+	}
+	if len(s.AuthorizationPassthroughPaths) > 0 {
+		k8sProxyHandler = authorizationPassthroughMiddleware(s.AuthorizationPassthroughPaths, s.AuthorizationPassthroughCIDRs, k8sProxy.ServeHTTP, k8sProxyHandler)
+	}
 	handle(k8sProxyEndpoint, http.StripPrefix(
 		proxy.SingleJoiningSlash(s.BaseURL.Path, k8sProxyEndpoint),
-		authHandlerWithHeader(k8sProxy.ServeHTTP),
+		k8sProxyHandler,
 	))
 
 	handleFunc(devfileEndpoint, devfile.DevfileHandler)
@@ -337,8 +539,17 @@ func (s *Server) HTTPHandler() http.Handler {
 	handler.InitPayload = resolver.InitPayload
 	graphQLHandler := handler.NewHandlerFunc(schema, &relay.Handler{Schema: schema})
 	handle("/api/graphql", authHandlerWithUser(func(user *auth.User, w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(context.Background(), resolver.HeadersKey, map[string]string{
-			"Authorization": fmt.Sprintf("Bearer %s", user.Token),
+		ctx, token := context.Background(), user.Token
+		if s.K8sProxyConfig.SessionImpersonation {
+			impersonation, err := s.userImpersonation(user)
+			if err != nil {
+				serverutils.SendResponse(w, http.StatusForbidden, serverutils.ApiError{Err: fmt.Sprintf("Failed to impersonate the user: %v", err)})
+				return
+			}
+			ctx, token = proxy.WithImpersonation(ctx, impersonation), s.ServiceAccountToken
+		}
+		ctx = context.WithValue(ctx, resolver.HeadersKey, map[string]string{
+			"Authorization": fmt.Sprintf("Bearer %s", token),
 		})
 		graphQLHandler(w, r.WithContext(ctx))
 	}))
@@ -585,6 +796,12 @@ func (s *Server) HTTPHandler() http.Handler {
 	)
 	prometheus.MustRegister(serverconfigMetrics.GetCollectors()...)
 	prometheus.MustRegister(usageMetrics.GetCollectors()...)
+	if s.AuthMetrics != nil {
+		prometheus.MustRegister(s.AuthMetrics.GetCollectors()...)
+	}
+	if s.K8sProxyConfig.Metrics != nil {
+		prometheus.MustRegister(s.K8sProxyConfig.Metrics.GetCollectors()...)
+	}
 	handle("/metrics", metrics.AddHeaderAsCookieMiddleware(
 		authHandler(func(w http.ResponseWriter, r *http.Request) {
 			promhttp.Handler().ServeHTTP(w, r)
@@ -645,7 +862,51 @@ func (s *Server) HTTPHandler() http.Handler {
 
 	mux.HandleFunc(s.BaseURL.Path, s.indexHandler)
 
-	return securityHeadersMiddleware(http.Handler(mux))
+	var rootHandler http.Handler = mux
+	if len(s.CORSAllowedOrigins) > 0 {
+		rootHandler = corsMiddleware(s.CORSAllowedOrigins, proxy.SingleJoiningSlash(s.BaseURL.Path, "/api/"), rootHandler)
+	}
+	if s.ResponseCompression {
+		rootHandler = compressionMiddleware(s.ResponseCompressionMinSize, rootHandler)
+	}
+
+	// The client IP is taken from X-Forwarded-For after it was cut down to the
+	// hops added by trusted proxies.
+	rootHandler = clientIPMiddleware(s.TrustedProxyCIDRs, s.RealIPHeader, requestIDMiddleware(securityHeadersMiddleware(s.ResponseHeaders, rootHandler)))
+	if len(s.TrustedProxyCIDRs) > 0 {
+		return forwardedHeadersMiddleware(s.TrustedProxyCIDRs, rootHandler)
+	}
+	return rootHandler
+}
+
+// TLSConfig returns the TLS config of the serving port. The minimum version
+// and cipher suites default to the OpenShift defaults.
+func (s *Server) TLSConfig() *tls.Config {
+	return oscrypto.SecureTLSConfig(&tls.Config{
+		MinVersion:   s.TLSMinVersion,
+		CipherSuites: s.TLSCipherSuites,
+	})
+}
+
+// HTTPServer returns the server of the serving port for handler, usually
+// HTTPHandler. Websockets, watches and followed logs are exempt from the read
+// and write timeouts. Requests are canceled with baseContext.
+func (s *Server) HTTPServer(addr string, handler http.Handler, baseContext context.Context) *http.Server {
+	if s.HTTPReadTimeout > 0 || s.HTTPWriteTimeout > 0 {
+		handler = streamingDeadlinesMiddleware(handler)
+	}
+	return &http.Server{
+		Addr:    addr,
+		Handler: handler,
+		// Disable HTTP/2, which breaks WebSockets.
+		TLSNextProto:      make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+		TLSConfig:         s.TLSConfig(),
+		BaseContext:       func(net.Listener) context.Context { return baseContext },
+		ReadHeaderTimeout: s.HTTPReadHeaderTimeout,
+		ReadTimeout:       s.HTTPReadTimeout,
+		WriteTimeout:      s.HTTPWriteTimeout,
+		IdleTimeout:       s.HTTPIdleTimeout,
+	}
 }
 
 func (s *Server) handleMonitoringDashboardConfigmaps(w http.ResponseWriter, r *http.Request) {
@@ -660,24 +921,45 @@ func (s *Server) handleKnativeChannelCRDs(w http.ResponseWriter, r *http.Request
 	s.KnativeChannelCRDLister.HandleResources(w, r)
 }
 
+// authErrorHandler serves the login error page, or the error from the query
+// as JSON to clients that accept it.
+func (s *Server) authErrorHandler(w http.ResponseWriter, r *http.Request) {
+	if !serverutils.AcceptsJSON(r) {
+		s.indexHandler(w, r)
+		return
+	}
+	q := r.URL.Query()
+	serverutils.SendResponse(w, http.StatusUnauthorized, auth.AuthErrorJSON{
+		Error:            q.Get("error"),
+		ErrorDescription: q.Get("error_description"),
+	})
+}
+
 func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 	if serverutils.IsUnsupportedBrowser(r) {
 		serverutils.SendUnsupportedBrowserResponse(w, s.Branding)
 		return
 	}
 
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy(s.ContentSecurityPolicy))
+	// X-Frame-Options can't express the configured ancestors, frame-ancestors replaces it.
+	if _, ok := s.ContentSecurityPolicy["frame-ancestors"]; ok {
+		w.Header().Del("X-Frame-Options")
+	}
+
 	plugins := make([]string, 0, len(s.EnabledConsolePlugins))
 	for plugin := range s.EnabledConsolePlugins {
 		plugins = append(plugins, plugin)
 	}
 
+	authPaths := s.AuthPaths.WithDefaults()
 	jsg := &jsGlobals{
 		ConsoleVersion:            version.Version,
 		AuthDisabled:              s.authDisabled(),
 		BasePath:                  s.BaseURL.Path,
-		LoginURL:                  proxy.SingleJoiningSlash(s.BaseURL.String(), authLoginEndpoint),
-		LoginSuccessURL:           proxy.SingleJoiningSlash(s.BaseURL.String(), AuthLoginSuccessEndpoint),
-		LoginErrorURL:             proxy.SingleJoiningSlash(s.BaseURL.String(), AuthLoginErrorEndpoint),
+		LoginURL:                  proxy.SingleJoiningSlash(s.BaseURL.String(), authPaths.Login),
+		LoginSuccessURL:           proxy.SingleJoiningSlash(s.BaseURL.String(), authPaths.Success),
+		LoginErrorURL:             proxy.SingleJoiningSlash(s.BaseURL.String(), authPaths.Error),
 		LogoutURL:                 proxy.SingleJoiningSlash(s.BaseURL.String(), authLogoutEndpoint),
 		KubeAPIServerURL:          s.KubeAPIServerURL,
 		Branding:                  s.Branding,
@@ -713,11 +995,20 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 
 	if s.LogoutRedirect != nil {
 		jsg.LogoutRedirect = s.LogoutRedirect.String()
+	} else if s.LogoutLandingPage != nil && !s.authDisabled() {
+		jsg.LogoutRedirect = proxy.SingleJoiningSlash(s.BaseURL.String(), authLogoutLandingEndpoint)
 	}
 
 	if !s.authDisabled() {
 		specialAuthURLs := s.Authenticator.GetSpecialURLs()
 		jsg.KubeAdminLogoutURL = specialAuthURLs.KubeAdminLogout
+		if s.Authenticator.SilentRenewEnabled() {
+			jsg.SilentLoginURL = proxy.SingleJoiningSlash(s.BaseURL.String(), authSilentLoginEndpoint)
+		}
+
+		capabilities := s.Authenticator.GetCapabilities()
+		jsg.AuthScopes = capabilities.Scopes
+		jsg.AuthIdentityClaim = capabilities.IdentityClaim
 	}
 
 	if s.prometheusProxyEnabled() {
@@ -731,7 +1022,7 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !s.authDisabled() {
-		s.Authenticator.SetCSRFCookie(s.BaseURL.Path, &w)
+		s.Authenticator.SetCSRFCookie(s.BaseURL.Path, r, &w)
 	}
 
 	if s.CustomLogoFile != "" {
@@ -804,8 +1095,90 @@ func (s *Server) handleOpenShiftTokenDeletion(user *auth.User, w http.ResponseWr
 	resp.Body.Close()
 }
 
+// handleInvalidateSessions logs out all users. Only members of the session
+// admin group may do this, e.g. after a security incident.
+func (s *Server) handleInvalidateSessions(user *auth.User, w http.ResponseWriter, r *http.Request) {
+	if !inGroup(user, s.SessionAdminGroup) {
+		serverutils.SendResponse(w, http.StatusForbidden, serverutils.ApiError{Err: fmt.Sprintf("Only members of group %q can invalidate sessions", s.SessionAdminGroup)})
+		return
+	}
+
+	epoch, err := s.Authenticator.InvalidateSessions(r.Context())
+	if errors.Is(err, auth.ErrSessionInvalidationUnsupported) {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: err.Error()})
+		return
+	}
+	if err != nil {
+		serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: fmt.Sprintf("Failed to invalidate sessions: %v", err)})
+		return
+	}
+
+	klog.Infof("user %q invalidated all sessions, the session epoch is now %d", user.Username, epoch)
+	serverutils.SendResponse(w, http.StatusOK, map[string]int64{"epoch": epoch})
+}
+
+// handleRefreshProvider makes the authenticator fetch the discovery document
+// and signing keys of the provider, e.g. after it rotated its keys. Only
+// members of the provider admin group may do this.
+func (s *Server) handleRefreshProvider(user *auth.User, w http.ResponseWriter, r *http.Request) {
+	if !inGroup(user, s.ProviderAdminGroup) {
+		serverutils.SendResponse(w, http.StatusForbidden, serverutils.ApiError{Err: fmt.Sprintf("Only members of group %q can refresh the auth provider", s.ProviderAdminGroup)})
+		return
+	}
+
+	refresh, err := s.Authenticator.RefreshProvider(r.Context())
+	var rateLimited *auth.ProviderRefreshRateLimitedError
+	switch {
+	case errors.As(err, &rateLimited):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateLimited.RetryAfter.Seconds()))))
+		serverutils.SendResponse(w, http.StatusTooManyRequests, serverutils.ApiError{Err: err.Error()})
+		return
+	case errors.Is(err, auth.ErrProviderRefreshUnsupported):
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: err.Error()})
+		return
+	case err != nil:
+		serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("Failed to refresh the auth provider: %v", err)})
+		return
+	}
+
+	klog.Infof("user %q refreshed the auth provider", user.Username)
+	serverutils.SendResponse(w, http.StatusOK, refresh)
+}
+
+// inGroup returns true if user is a member of group.
+func inGroup(user *auth.User, group string) bool {
+	for _, g := range user.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// authStatus is the response of the auth status endpoint when auth is healthy.
+type authStatus struct {
+	Status string `json:"status"`
+	// ActiveSessions is only set if active sessions are tracked.
+	ActiveSessions *int `json:"activeSessions,omitempty"`
+}
+
+func (s *Server) handleAuthStatus(w http.ResponseWriter, r *http.Request) {
+	status := authStatus{Status: "ok"}
+	if count, ok := s.Authenticator.ActiveSessions(); ok {
+		status.ActiveSessions = &count
+	}
+	serverutils.SendResponse(w, http.StatusOK, status)
+}
+
+// handleLogout logs the user out. The optional return_to query parameter is
+// the console page to show after the next login, see auth.Authenticator.LoginFunc.
 func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
-	verifyCSRF(s.Authenticator, s.Authenticator.LogoutFunc).ServeHTTP(w, r)
+	verifyCSRF(s.Authenticator, func(w http.ResponseWriter, r *http.Request) {
+		if returnTo := r.URL.Query().Get("return_to"); returnTo != "" {
+			s.Authenticator.SetLoginRedirect(w, r, returnTo)
+		}
+		s.Authenticator.LogoutFunc(w, r)
+	}).ServeHTTP(w, r)
 }
 
 // tokenToObjectName returns the oauthaccesstokens object name for the given raw token,
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	oscrypto "github.com/openshift/library-go/pkg/crypto"
+
+	"github.com/openshift/console/pkg/auth"
+)
+
+// startDrainTestServer serves handler on a local port with a cancelable base context.
+func startDrainTestServer(t *testing.T, handler http.HandlerFunc) (*http.Server, string, context.CancelFunc) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	httpsrv := &http.Server{
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go httpsrv.Serve(l)
+	return httpsrv, "http://" + l.Addr().String(), cancel
+}
+
+func TestDrainCompletesInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	httpsrv, url, cancel := startDrainTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		results <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	drained := make(chan error, 1)
+	go func() { drained <- Drain(httpsrv, 5*time.Second, cancel) }()
+
+	// Give Shutdown time to close the listener before the request finishes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	res := <-results
+	if res.err != nil || res.body != "done" {
+		t.Errorf("expected the in-flight request to complete, got %q: %v", res.body, res.err)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("expected the server to drain, got: %v", err)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("expected new requests to be refused after draining")
+	}
+}
+
+func TestDrainClosesRequestsAfterGracePeriod(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	httpsrv, url, cancel := startDrainTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		// Like a watch, the request only ends when its context is canceled.
+		<-r.Context().Done()
+		close(canceled)
+	})
+
+	go http.Get(url)
+	<-started
+
+	err := Drain(httpsrv, 50*time.Millisecond, cancel)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the grace period to expire, got: %v", err)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected the long-lived request to be canceled after the grace period")
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	defaults := (&Server{}).TLSConfig()
+	if defaults.MinVersion != tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2 as default minimum version, got: %x", defaults.MinVersion)
+	}
+	if !reflect.DeepEqual(defaults.CipherSuites, oscrypto.DefaultCiphers()) {
+		t.Errorf("expected the default cipher suites, got: %v", defaults.CipherSuites)
+	}
+
+	cipherSuites := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	configured := (&Server{TLSMinVersion: tls.VersionTLS13, TLSCipherSuites: cipherSuites}).TLSConfig()
+	if configured.MinVersion != tls.VersionTLS13 {
+		t.Errorf("expected TLS 1.3 as minimum version, got: %x", configured.MinVersion)
+	}
+	if !reflect.DeepEqual(configured.CipherSuites, cipherSuites) {
+		t.Errorf("expected cipher suites %v, got: %v", cipherSuites, configured.CipherSuites)
+	}
+}
+
+func TestHTTPServerTimeouts(t *testing.T) {
+	s := &Server{
+		HTTPReadHeaderTimeout: time.Second,
+		HTTPReadTimeout:       2 * time.Second,
+		HTTPWriteTimeout:      100 * time.Millisecond,
+		HTTPIdleTimeout:       3 * time.Second,
+	}
+	httpsrv := s.HTTPServer("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("second"))
+	}), context.Background())
+	if httpsrv.ReadHeaderTimeout != time.Second || httpsrv.ReadTimeout != 2*time.Second || httpsrv.WriteTimeout != 100*time.Millisecond || httpsrv.IdleTimeout != 3*time.Second {
+		t.Errorf("expected the timeouts of the server, got read header %s, read %s, write %s, idle %s", httpsrv.ReadHeaderTimeout, httpsrv.ReadTimeout, httpsrv.WriteTimeout, httpsrv.IdleTimeout)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go httpsrv.Serve(l)
+	defer httpsrv.Close()
+
+	get := func(path string) (string, error) {
+		resp, err := http.Get("http://" + l.Addr().String() + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+	if body, err := get("/api/kubernetes/api/v1/pods"); err == nil && body == "firstsecond" {
+		t.Error("expected the write timeout to cut off the response")
+	}
+	for _, path := range []string{"/api/kubernetes/api/v1/pods?watch=true", "/api/kubernetes/api/v1/namespaces/default/pods/console/log?follow=true"} {
+		if body, err := get(path); err != nil || body != "firstsecond" {
+			t.Errorf("expected %s to be exempt from the write timeout, got %q: %v", path, body, err)
+		}
+	}
+}
+
+func TestResolveBasePath(t *testing.T) {
+	tests := []struct {
+		baseAddress string
+		basePath    string
+		want        string
+		wantErr     bool
+	}{
+		{baseAddress: "", basePath: "/", want: "/"},
+		{baseAddress: "https://example.com", basePath: "/", want: "/"},
+		{baseAddress: "https://example.com/", basePath: "/console/", want: "/console/"},
+		{baseAddress: "https://example.com/console", basePath: "/", want: "/console/"},
+		{baseAddress: "https://example.com/console/", basePath: "/", want: "/console/"},
+		{baseAddress: "https://example.com/console/", basePath: "/console/", want: "/console/"},
+		{baseAddress: "https://example.com/console/", basePath: "/other/", wantErr: true},
+		{baseAddress: "https://example.com/a/../console/", basePath: "/", wantErr: true},
+		{baseAddress: "https://example.com", basePath: "console", wantErr: true},
+		{baseAddress: "https://example.com", basePath: "/console", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseAddress+" "+tt.basePath, func(t *testing.T) {
+			baseAddress, err := url.Parse(tt.baseAddress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ResolveBasePath(baseAddress, tt.basePath)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleRefreshProvider(t *testing.T) {
+	var fetches []string
+	keysFail := false
+	var issuer string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches = append(fetches, r.URL.Path)
+		switch {
+		case r.URL.Path == "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/auth","token_endpoint":"%[1]s/token","jwks_uri":"%[1]s/keys"}`, issuer)
+		case r.URL.Path == "/keys" && !keysFail:
+			fmt.Fprint(w, `{"keys":[{"kty":"oct","kid":"1","k":"c2VjcmV0"}]}`)
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer provider.Close()
+	issuer = provider.URL
+
+	newServer := func() *Server {
+		a, err := auth.NewAuthenticator(context.Background(), &auth.Config{
+			AuthSource:   auth.AuthSourceTectonic,
+			IssuerURL:    issuer,
+			ClientID:     "console",
+			ClientSecret: "secret",
+			RedirectURL:  "https://console.example.com/auth/callback",
+			ErrorURL:     "https://console.example.com/error",
+			SuccessURL:   "https://console.example.com/",
+			CookiePath:   "/",
+			RefererPath:  "https://console.example.com/",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Server{Authenticator: a, ProviderAdminGroup: "idp-admins"}
+	}
+	refresh := func(s *Server, groups ...string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.handleRefreshProvider(&auth.User{Username: "alice", Groups: groups}, rr, httptest.NewRequest(http.MethodPost, refreshProviderEndpoint, nil))
+		return rr
+	}
+
+	s := newServer()
+	fetches = nil
+	if rr := refresh(s, "developers"); rr.Code != http.StatusForbidden || len(fetches) != 0 {
+		t.Errorf("expected non-admins to be forbidden without contacting the provider, got %d and fetches %v", rr.Code, fetches)
+	}
+
+	rr := refresh(s, "developers", "idp-admins")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the refresh to succeed, got %d: %s", rr.Code, rr.Body)
+	}
+	if want := []string{"/.well-known/openid-configuration", "/keys"}; !reflect.DeepEqual(fetches, want) {
+		t.Errorf("expected the refresh to fetch %v, got %v", want, fetches)
+	}
+	var outcome auth.ProviderRefresh
+	if err := json.Unmarshal(rr.Body.Bytes(), &outcome); err != nil {
+		t.Fatal(err)
+	}
+	if want := (auth.ProviderRefresh{Issuer: issuer, JWKSURL: issuer + "/keys", Keys: 1}); outcome != want {
+		t.Errorf("expected the outcome %+v, got %+v", want, outcome)
+	}
+
+	fetches = nil
+	rr = refresh(s, "idp-admins")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" || len(fetches) != 0 {
+		t.Errorf("expected a refresh right after the last one to be rate limited, got %d with Retry-After %q and fetches %v", rr.Code, rr.Header().Get("Retry-After"), fetches)
+	}
+
+	keysFail = true
+	if rr := refresh(newServer(), "idp-admins"); rr.Code != http.StatusBadGateway || !strings.Contains(rr.Body.String(), "signing keys") {
+		t.Errorf("expected the failure to fetch the keys to be reported, got %d: %s", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+// sessionInfo is the response of the session info and activity endpoints.
+type sessionInfo struct {
+	InactivityTimeoutSeconds int `json:"inactivityTimeoutSeconds"`
+	SecondsUntilIdleLogout   int `json:"secondsUntilIdleLogout"`
+}
+
+// handleSessionInfo tells the frontend how long until the session is logged
+// out for inactivity, to warn users before. It doesn't count as activity, so
+// that polling it doesn't keep the session alive.
+func (s *Server) handleSessionInfo(user *auth.User, w http.ResponseWriter, r *http.Request) {
+	s.sendSessionInfo(w, r)
+}
+
+// handleSessionActivity records the user activity the frontend observed, e.g.
+// input in the console, which restarts the inactivity timeout of the session.
+// API requests don't, since the console polls the cluster without the user.
+func (s *Server) handleSessionActivity(user *auth.User, w http.ResponseWriter, r *http.Request) {
+	err := s.Authenticator.RecordActivity(r, s.inactivityTimeout())
+	if errors.Is(err, auth.ErrActivityTrackingUnsupported) {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: err.Error()})
+		return
+	}
+	if err != nil {
+		serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: fmt.Sprintf("Failed to record the session activity: %v", err)})
+		return
+	}
+	s.sendSessionInfo(w, r)
+}
+
+func (s *Server) sendSessionInfo(w http.ResponseWriter, r *http.Request) {
+	timeout := s.inactivityTimeout()
+	left, err := s.Authenticator.IdleLogoutIn(r, timeout)
+	if errors.Is(err, auth.ErrActivityTrackingUnsupported) {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: err.Error()})
+		return
+	}
+	if err != nil {
+		serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: fmt.Sprintf("Failed to get the session activity: %v", err)})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	serverutils.SendResponse(w, http.StatusOK, sessionInfo{
+		InactivityTimeoutSeconds: int(timeout.Seconds()),
+		SecondsUntilIdleLogout:   int(math.Ceil(left.Seconds())),
+	})
+}
+
+func (s *Server) inactivityTimeout() time.Duration {
+	return time.Duration(s.InactivityTimeout) * time.Second
+}
@@ -45,7 +45,7 @@ func (mkv *MultiKeyValue) Set(value string) error {
 }
 
 // Parse configuration from
-// 1. Config file
+// 1. Config files, separated by comma and merged in order
 // 2. Environment variables (overrides config file)
 // 3. Commandline arguments (overrides config file and environment varibles)
 //
@@ -61,10 +61,10 @@ func Parse(fs *flag.FlagSet, args []string, envPrefix string) (*Config, error) {
 	}
 
 	cfg := &Config{}
-	configFile := fs.Lookup("config").Value.String()
-	if configFile != "" {
+	configFiles := splitConfigFiles(fs.Lookup("config").Value.String())
+	if len(configFiles) > 0 {
 		var err error
-		cfg, err = SetFlagsFromConfigFile(fs, configFile)
+		cfg, err = SetFlagsFromConfigFiles(fs, configFiles)
 		if err != nil {
 			klog.Fatalf("Failed to load config: %v", err)
 			return nil, err
@@ -80,26 +80,79 @@ func Parse(fs *flag.FlagSet, args []string, envPrefix string) (*Config, error) {
 	return cfg, nil
 }
 
+func splitConfigFiles(value string) []string {
+	filenames := []string{}
+	for _, filename := range strings.Split(value, ",") {
+		if filename = strings.TrimSpace(filename); filename != "" {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames
+}
+
 // SetFlagsFromConfigFile sets flag values based on a YAML config file.
 func SetFlagsFromConfigFile(fs *flag.FlagSet, filename string) (*Config, error) {
-	content, err := ioutil.ReadFile(filename)
+	return SetFlagsFromConfigFiles(fs, []string{filename})
+}
+
+// SetFlagsFromConfigFiles sets flag values based on YAML config files, see
+// LoadConfigFiles.
+func SetFlagsFromConfigFiles(fs *flag.FlagSet, filenames []string) (*Config, error) {
+	config, err := LoadConfigFiles(filenames)
 	if err != nil {
 		return nil, err
 	}
 
-	config := &Config{}
-	err = yaml.Unmarshal(content, config)
-	if err != nil {
+	if err := SetFlagsFromConfig(fs, config); err != nil {
 		return nil, err
 	}
 
-	if err := SetFlagsFromConfig(fs, config); err != nil {
+	return config, nil
+}
+
+// LoadConfigFiles merges YAML config files in order. Later files override
+// earlier ones field by field, mappings are merged recursively while lists
+// and other values are replaced.
+func LoadConfigFiles(filenames []string) (*Config, error) {
+	merged := map[interface{}]interface{}{}
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		overlay := map[interface{}]interface{}{}
+		if err := yaml.Unmarshal(content, &overlay); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		mergeConfig(merged, overlay)
+	}
+
+	content, err := yaml.Marshal(merged)
+	if err != nil {
 		return nil, err
 	}
 
+	config := &Config{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
+// mergeConfig merges overlay into base.
+func mergeConfig(base, overlay map[interface{}]interface{}) {
+	for key, value := range overlay {
+		baseMap, baseIsMap := base[key].(map[interface{}]interface{})
+		overlayMap, overlayIsMap := value.(map[interface{}]interface{})
+		if baseIsMap && overlayIsMap {
+			mergeConfig(baseMap, overlayMap)
+			continue
+		}
+		base[key] = value
+	}
+}
+
 // SetFlagsFromConfig sets flag values based on a YAML config.
 func SetFlagsFromConfig(fs *flag.FlagSet, config *Config) (err error) {
 	if !(config.APIVersion == "console.openshift.io/v1beta1" || config.APIVersion == "console.openshift.io/v1") || config.Kind != "ConsoleConfig" {
@@ -312,3 +312,60 @@ func TestSetFlagsFromConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfigFilesOverridePrecedence(t *testing.T) {
+	config, err := LoadConfigFiles([]string{"test/auth-base-config.yaml", "test/auth-overlay-config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set by the base file only.
+	if config.APIVersion != "console.openshift.io/v1" || config.Kind != "ConsoleConfig" {
+		t.Errorf("Unexpected apiVersion %q and kind %q", config.APIVersion, config.Kind)
+	}
+	if config.ServingInfo.BindAddress != "http://localhost:9000" {
+		t.Errorf("Unexpected value: actual %s, expected %s", config.ServingInfo.BindAddress, "http://localhost:9000")
+	}
+	if config.Auth.LogoutRedirect != "https://idp.example.com/logout" {
+		t.Errorf("Unexpected value: actual %s, expected %s", config.Auth.LogoutRedirect, "https://idp.example.com/logout")
+	}
+	// Overridden by the overlay.
+	if config.Auth.ClientID != "console-staging" {
+		t.Errorf("Unexpected value: actual %s, expected %s", config.Auth.ClientID, "console-staging")
+	}
+	// Lists are replaced, not concatenated.
+	if expected := []string{"openid", "profile"}; !reflect.DeepEqual(config.Auth.Scopes, expected) {
+		t.Errorf("Unexpected value: actual %v, expected %v", config.Auth.Scopes, expected)
+	}
+
+	reversed, err := LoadConfigFiles([]string{"test/auth-overlay-config.yaml", "test/auth-base-config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversed.Auth.ClientID != "console" {
+		t.Errorf("Unexpected value: actual %s, expected %s", reversed.Auth.ClientID, "console")
+	}
+	if expected := []string{"openid", "email", "groups"}; !reflect.DeepEqual(reversed.Auth.Scopes, expected) {
+		t.Errorf("Unexpected value: actual %v, expected %v", reversed.Auth.Scopes, expected)
+	}
+}
+
+func TestParseMultipleConfigFiles(t *testing.T) {
+	prefix := fmt.Sprintf("TEST_PREFIX_%d", rand.Int())
+	fs := flag.NewFlagSet(prefix, flag.ContinueOnError)
+	fs.String("config", "", "The config file.")
+	listen := fs.String("listen", "http://0.0.0.0:9000", "")
+
+	args := []string{"-config", "test/auth-base-config.yaml, test/auth-overlay-config.yaml"}
+	cfg, err := Parse(fs, args, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *listen != "http://localhost:9000" {
+		t.Errorf("Unexpected value: actual %s, expected %s", *listen, "http://localhost:9000")
+	}
+	if cfg.Auth.ClientID != "console-staging" {
+		t.Errorf("Unexpected value: actual %s, expected %s", cfg.Auth.ClientID, "console-staging")
+	}
+}
@@ -34,7 +34,11 @@ type ProxyService struct {
 	Endpoint       string `yaml:"endpoint"`
 	ConsoleAPIPath string `yaml:"consoleAPIPath"`
 	CACertificate  string `yaml:"caCertificate"`
-	Authorize      bool   `yaml:"authorize"`
+	// CAFile is a PEM file with the CA of the service, as an alternative to CACertificate.
+	CAFile string `yaml:"caFile,omitempty"`
+	// InsecureSkipVerify disables the certificate verification of the service.
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify,omitempty"`
+	Authorize          bool `yaml:"authorize"`
 }
 
 // ServingInfo holds configuration for serving HTTP.
@@ -84,6 +88,8 @@ type Auth struct {
 	OAuthEndpointCAFile      string `yaml:"oauthEndpointCAFile,omitempty"`
 	LogoutRedirect           string `yaml:"logoutRedirect,omitempty"`
 	InactivityTimeoutSeconds int    `yaml:"inactivityTimeoutSeconds,omitempty"`
+	// Scopes are the OAuth2 scopes requested from an OIDC provider.
+	Scopes []string `yaml:"scopes,omitempty"`
 }
 
 // Customization holds configuration such as what logo to use.
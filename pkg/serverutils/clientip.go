@@ -0,0 +1,19 @@
+package serverutils
+
+import (
+	"context"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx carrying the client IP ip.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFrom returns the client IP of ctx, or "" if there is none. It is set
+// by the server from the connection, or the headers of trusted proxies.
+func ClientIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
@@ -0,0 +1,50 @@
+package serverutils
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the correlation ID of a console request, taken from the
+// client or a router in front of the console if set.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength limits the request IDs taken from clients, which end up
+// in log lines.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID of ctx, or "" if there is none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID returns the request ID sent by the client, or a new UUID if the
+// client sent none or one that isn't safe to log.
+func RequestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); isValidRequestID(id) {
+		return id
+	}
+	return uuid.NewString()
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
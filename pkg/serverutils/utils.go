@@ -26,6 +26,19 @@ func SendResponse(rw http.ResponseWriter, code int, resp interface{}) {
 	}
 }
 
+// AcceptsJSON reports whether the Accept header of r asks for a JSON response.
+func AcceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType := strings.TrimSpace(strings.SplitN(mediaRange, ";", 2)[0])
+			if strings.EqualFold(mediaType, "application/json") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func IsUnsupportedBrowser(r *http.Request) bool {
 	userAgentHeader := r.Header.Get("User-Agent")
 	isUnsupported := false
@@ -7,3 +7,12 @@ var Version string
 type KubeVersionGetter interface {
 	GetKubeVersion() string
 }
+
+// UserAgent identifies the console in outbound requests, e.g.
+// "openshift-console/v4.15.0".
+func UserAgent() string {
+	if Version == "" {
+		return "openshift-console"
+	}
+	return "openshift-console/" + Version
+}